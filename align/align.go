@@ -0,0 +1,198 @@
+// Package align time-aligns sample streams from two dongles sharing a
+// clock, as needed for passive radar and direction finding. The offset
+// between streams is estimated by cross correlation and removed, integer
+// samples by discarding the leading stream's samples and fractions of a
+// sample with a fractional delay filter.
+package align
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Defaults for Aligner.
+const (
+	DefaultBlockSize   = 16384   // Samples per pair.
+	DefaultCalibration = 1 << 16 // Samples correlated by Calibrate.
+	delayTaps          = 31
+)
+
+// Minimum correlation coefficient magnitude accepted by Calibrate.
+const MinCorrelation = 0.3
+
+// ErrUncorrelated is returned by Calibrate when the streams don't share a
+// common signal to align on.
+var ErrUncorrelated = errors.New("align: streams are not correlated")
+
+// Estimated offset of the other stream relative to the reference.
+type Offset struct {
+	Samples     float64 // Delay of the other stream, in samples.
+	Phase       float64 // Carrier phase of the other stream, in radians.
+	Correlation float64 // Magnitude of the normalized correlation peak.
+}
+
+// Aligned samples from both streams, covering the same instants.
+type Pair struct {
+	Ref, Other     rtltcp.Metadata
+	RefIQ, OtherIQ []complex64
+}
+
+// Aligner reads two sources and delivers their samples in aligned pairs.
+// Both sources must already be tuned identically and streaming from
+// dongles sharing a reference clock.
+type Aligner struct {
+	// Complex samples per pair.
+	BlockSize int
+	// Complex samples correlated to estimate the offset.
+	CalibrationLen int
+	// Rotate the other stream by the estimated phase so both share a
+	// carrier phase.
+	CorrectPhase bool
+
+	ref, other   rtltcp.Source
+	offset       Offset
+	dropRef      int // Samples still to discard from each stream.
+	dropOther    int
+	refFilter    dsp.Filter
+	otherFilter  dsp.Filter
+	refPending   []complex64
+	otherPending []complex64
+	refMeta      rtltcp.Metadata
+	otherMeta    rtltcp.Metadata
+	raw          []byte
+	iq           []complex64
+}
+
+// Returns an aligner pairing samples from other with those from ref.
+func New(ref, other rtltcp.Source) *Aligner {
+	return &Aligner{
+		BlockSize:      DefaultBlockSize,
+		CalibrationLen: DefaultCalibration,
+		ref:            ref,
+		other:          other,
+		refFilter:      dsp.NewFIR(dsp.FractionalDelay(delayTaps, 0, dsp.Blackman)),
+		otherFilter:    dsp.NewFIR(dsp.FractionalDelay(delayTaps, 0, dsp.Blackman)),
+	}
+}
+
+// Reads n complex samples from src, returning them and the tags of the
+// last block read.
+func (a *Aligner) read(src rtltcp.Source, n int) ([]complex64, rtltcp.Metadata, error) {
+	if cap(a.raw) < 2*n {
+		a.raw = make([]byte, 2*n)
+	}
+	blk, err := src.ReadBlock(a.raw[:2*n])
+	if err != nil {
+		return nil, rtltcp.Metadata{}, err
+	}
+	return dsp.ConvertU8(nil, blk.Samples), blk.Metadata, nil
+}
+
+// Estimates the offset between streams from CalibrationLen samples of each
+// and configures its removal from subsequent pairs. Samples already pending
+// are discarded. Calibrate should be repeated after retuning either source.
+func (a *Aligner) Calibrate() (Offset, error) {
+	ref, _, err := a.read(a.ref, a.CalibrationLen)
+	if err != nil {
+		return Offset{}, err
+	}
+	other, _, err := a.read(a.other, a.CalibrationLen)
+	if err != nil {
+		return Offset{}, err
+	}
+
+	lag, peak := dsp.CrossCorrelate(ref, other)
+	off := Offset{Samples: lag, Phase: cmplx.Phase(peak), Correlation: cmplx.Abs(peak)}
+	if off.Correlation < MinCorrelation {
+		return off, ErrUncorrelated
+	}
+
+	// The other stream lags by whole + frac samples: skip whole samples of
+	// it and delay the reference by the fraction.
+	whole := math.Round(lag)
+	frac := lag - whole
+	a.dropRef, a.dropOther = 0, 0
+	if whole > 0 {
+		a.dropOther = int(whole)
+	} else {
+		a.dropRef = int(-whole)
+	}
+
+	a.refFilter = dsp.NewFIR(dsp.FractionalDelay(delayTaps, frac, dsp.Blackman))
+	a.otherFilter = dsp.NewFIR(dsp.FractionalDelay(delayTaps, 0, dsp.Blackman))
+	a.refPending = a.refPending[:0]
+	a.otherPending = a.otherPending[:0]
+	a.offset = off
+
+	return off, nil
+}
+
+// Returns the offset found by the last calibration.
+func (a *Aligner) Offset() Offset {
+	return a.offset
+}
+
+// Reads until a full block of src is pending after dropping drop samples.
+func (a *Aligner) fill(src rtltcp.Source, f dsp.Filter, pending []complex64, drop *int, meta *rtltcp.Metadata) ([]complex64, error) {
+	for len(pending) < a.BlockSize {
+		iq, m, err := a.read(src, a.BlockSize)
+		if err != nil {
+			return pending, err
+		}
+		*meta = m
+
+		if *drop > 0 {
+			n := *drop
+			if n > len(iq) {
+				n = len(iq)
+			}
+			iq = iq[n:]
+			*drop -= n
+		}
+		pending = f.Process(pending, iq)
+	}
+	return pending, nil
+}
+
+// Returns the next pair of aligned blocks. The slices are only valid until
+// the next call.
+func (a *Aligner) Next() (p Pair, err error) {
+	if a.BlockSize <= 0 {
+		return p, errors.New("align: block size must be positive")
+	}
+
+	a.refPending, err = a.fill(a.ref, a.refFilter, a.refPending, &a.dropRef, &a.refMeta)
+	if err != nil {
+		return
+	}
+	a.otherPending, err = a.fill(a.other, a.otherFilter, a.otherPending, &a.dropOther, &a.otherMeta)
+	if err != nil {
+		return
+	}
+
+	n := a.BlockSize
+	p.Ref, p.Other = a.refMeta, a.otherMeta
+	if cap(a.iq) < 2*n {
+		a.iq = make([]complex64, 2*n)
+	}
+	p.RefIQ = a.iq[:n:n]
+	p.OtherIQ = a.iq[n : 2*n]
+	copy(p.RefIQ, a.refPending)
+	copy(p.OtherIQ, a.otherPending)
+
+	if a.CorrectPhase {
+		rot := complex64(cmplx.Rect(1, -a.offset.Phase))
+		for i := range p.OtherIQ {
+			p.OtherIQ[i] *= rot
+		}
+	}
+
+	a.refPending = append(a.refPending[:0], a.refPending[n:]...)
+	a.otherPending = append(a.otherPending[:0], a.otherPending[n:]...)
+
+	return
+}
@@ -0,0 +1,77 @@
+package align
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Serves u8 samples from a slice.
+type sliceSource struct {
+	samples []byte
+}
+
+func (s *sliceSource) SetCenterFreq(uint32) error { return nil }
+func (s *sliceSource) SetSampleRate(uint32) error { return nil }
+func (s *sliceSource) Close() error               { return nil }
+
+func (s *sliceSource) ReadBlock(buf []byte) (rtltcp.Block, error) {
+	n := copy(buf, s.samples)
+	s.samples = s.samples[n:]
+	return rtltcp.Block{Samples: buf[:n]}, nil
+}
+
+func quantize(iq []complex64) []byte {
+	out := make([]byte, 0, 2*len(iq))
+	for _, v := range iq {
+		out = append(out, byte(real(v)*100+128), byte(imag(v)*100+128))
+	}
+	return out
+}
+
+func TestAligner(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	noise := make([]complex64, 1<<18)
+	for i := range noise {
+		noise[i] = complex(rng.Float32()-0.5, rng.Float32()-0.5)
+	}
+	x := dsp.NewFIR(dsp.LowPass(63, 0.2, dsp.Blackman)).Process(nil, noise)
+
+	// The other dongle lags the reference by 7 samples.
+	const lag = 7
+	ref := &sliceSource{quantize(x[lag:])}
+	other := &sliceSource{quantize(x)}
+
+	a := New(ref, other)
+	a.BlockSize = 4096
+	off, err := a.Calibrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(off.Samples-lag) > 0.1 || off.Correlation < 0.9 {
+		t.Fatalf("offset: %+v", off)
+	}
+
+	for i := 0; i < 4; i++ {
+		p, err := a.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.RefIQ) != a.BlockSize || len(p.OtherIQ) != a.BlockSize {
+			t.Fatalf("pair lengths %d, %d", len(p.RefIQ), len(p.OtherIQ))
+		}
+
+		// Skip the filters' startup transient.
+		var maxErr float64
+		for j := 100; j < len(p.RefIQ); j++ {
+			maxErr = math.Max(maxErr, cmplx.Abs(complex128(p.RefIQ[j]-p.OtherIQ[j])))
+		}
+		if maxErr > 0.05 {
+			t.Errorf("pair %d: streams differ by up to %.3f", i, maxErr)
+		}
+	}
+}
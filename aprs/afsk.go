@@ -0,0 +1,240 @@
+// Package aprs decodes APRS packets from the audio of an NBFM channel, as
+// delivered by a demod.Receiver: a Bell 202 AFSK demodulator recovers the
+// 1200 baud bit stream, HDLC framing and the FCS delimit and check AX.25
+// frames, and the frames are parsed into their addresses and information
+// field.
+package aprs
+
+import (
+	"context"
+	"math"
+	"math/cmplx"
+
+	"github.com/bemasher/rtltcp/demod"
+)
+
+// APRS channel frequencies in Hz.
+const (
+	FreqNorthAmerica = 144390000
+	FreqEurope       = 144800000
+)
+
+// Bell 202 signalling: mark and space tones in Hz and the bit rate.
+const (
+	Baud  = 1200
+	Mark  = 1200
+	Space = 2200
+)
+
+// Gain with which the bit clock is pulled toward each tone transition.
+const clockGain = 0.3
+
+// Time constants, in bits, with which the tone levels the correlators are
+// normalized by follow rising and falling magnitudes. Levels track each
+// tone's peak however seldom it's sent, evening out the tilt pre-emphasis
+// gives the tones.
+const (
+	levelAttackBits = 1
+	levelDecayBits  = 256
+)
+
+// Demodulator recovers AX.25 frames from AFSK audio. Each tone is
+// correlated over one bit period, the stronger relative to its peak
+// level being the tone sent, and bits are sampled midway between tone
+// transitions, which keep the bit clock in step.
+type Demodulator struct {
+	rate float64
+
+	mark, space   tone
+	attack, decay float64 // Smoothing factors of the tone levels.
+
+	phase    float64 // Of the bit clock, bits.
+	step     float64 // Bits per sample.
+	prevTone bool    // Tone of the previous sample, mark if true.
+	lastBit  bool    // Tone sampled for the previous bit.
+
+	hdlc hdlc
+}
+
+// Correlator of one tone over a bit period, a sliding sum of the audio
+// mixed down by the tone.
+type tone struct {
+	osc, step complex128
+	count     int
+	window    []complex128
+	pos       int
+	sum       complex128
+	level     float64 // Peak magnitude.
+}
+
+func newTone(freq, rate float64, n int) tone {
+	return tone{osc: 1, step: cmplx.Rect(1, -2*math.Pi*freq/rate), window: make([]complex128, n)}
+}
+
+// Adds a sample and returns the tone's magnitude over the last bit period.
+func (t *tone) next(x float64) float64 {
+	v := complex(x, 0) * t.osc
+	t.osc *= t.step
+	// Renormalized now and then against rounding drift.
+	if t.count++; t.count == 1024 {
+		t.osc /= complex(cmplx.Abs(t.osc), 0)
+		t.count = 0
+	}
+	t.sum += v - t.window[t.pos]
+	t.window[t.pos] = v
+	t.pos = (t.pos + 1) % len(t.window)
+	return cmplx.Abs(t.sum)
+}
+
+// Returns a demodulator of audio at rate samples per second. Rates of at
+// least 9600 work, higher ones track the bit clock more finely.
+func NewDemodulator(rate int) *Demodulator {
+	n := max(1, int(math.Round(float64(rate)/Baud)))
+	return &Demodulator{
+		rate:   float64(rate),
+		mark:   newTone(Mark, float64(rate), n),
+		space:  newTone(Space, float64(rate), n),
+		attack: 1 - math.Exp(-Baud/(levelAttackBits*float64(rate))),
+		decay:  1 - math.Exp(-Baud/(levelDecayBits*float64(rate))),
+		step:   Baud / float64(rate),
+	}
+}
+
+// Demodulates audio and appends the frames completed to dst, returning the
+// extended slice. Frames failing their FCS or unparseable are dropped.
+func (d *Demodulator) Process(dst []Frame, audio []float32) []Frame {
+	for _, x := range audio {
+		m := d.mark.next(float64(x))
+		s := d.space.next(float64(x))
+		d.follow(&d.mark.level, m)
+		d.follow(&d.space.level, s)
+		mark := m*d.space.level > s*d.mark.level
+
+		if mark != d.prevTone {
+			// Transitions fall on bit boundaries, phase zero.
+			d.phase -= clockGain * (d.phase - math.Round(d.phase))
+			d.prevTone = mark
+		}
+		prev := d.phase
+		d.phase += d.step
+		if prev < 0.5 && d.phase >= 0.5 {
+			// NRZI: an unchanged tone is a one.
+			if data := d.hdlc.bit(mark == d.lastBit); data != nil {
+				if f, err := Parse(data); err == nil {
+					dst = append(dst, f)
+				}
+			}
+			d.lastBit = mark
+		}
+		if d.phase >= 1 {
+			d.phase--
+		}
+	}
+	return dst
+}
+
+// Moves a tone level toward magnitude v.
+func (d *Demodulator) follow(level *float64, v float64) {
+	if v > *level {
+		*level += d.attack * (v - *level)
+	} else {
+		*level += d.decay * (v - *level)
+	}
+}
+
+// HDLC deframer: frames are delimited by flags, six ones, with a zero
+// stuffed after any five ones of the data.
+type hdlc struct {
+	ones  int
+	frame []byte
+	cur   byte
+	bits  int
+	in    bool // Between flags.
+}
+
+// Adds a bit, returning the frame it ends without its FCS, if its FCS
+// checks.
+func (h *hdlc) bit(one bool) []byte {
+	if one {
+		h.ones++
+		if h.ones == 7 {
+			// Abort, or noise.
+			h.in = false
+			return nil
+		}
+		h.add(1)
+		return nil
+	}
+
+	ones := h.ones
+	h.ones = 0
+	switch {
+	case ones == 6:
+		// A flag, whose first seven bits were taken for data.
+		var data []byte
+		if h.in && h.bits == 7 && len(h.frame) >= minFrameLen {
+			n := len(h.frame) - fcsLen
+			if FCS(h.frame[:n]) == uint16(h.frame[n])|uint16(h.frame[n+1])<<8 {
+				data = append([]byte(nil), h.frame[:n]...)
+			}
+		}
+		h.frame, h.cur, h.bits, h.in = h.frame[:0], 0, 0, true
+		return data
+	case ones == 5:
+		// Stuffed.
+		return nil
+	}
+	h.add(0)
+	return nil
+}
+
+// Adds a data bit, least significant first.
+func (h *hdlc) add(bit byte) {
+	if !h.in {
+		return
+	}
+	h.cur |= bit << h.bits
+	if h.bits++; h.bits == 8 {
+		if len(h.frame) == maxFrameLen {
+			h.in = false
+			return
+		}
+		h.frame = append(h.frame, h.cur)
+		h.cur, h.bits = 0, 0
+	}
+}
+
+// Demodulates frames of NBFM audio, from demod.Frames, delivering the
+// packets decoded until audio is closed or ctx is done, then closing the
+// returned channel. The audio rate is taken from the first frame.
+func Frames(ctx context.Context, audio <-chan demod.AudioFrame) <-chan Frame {
+	frames := make(chan Frame, 16)
+	go func() {
+		defer close(frames)
+		var d *Demodulator
+		var found []Frame
+		for {
+			select {
+			case af, ok := <-audio:
+				if !ok {
+					return
+				}
+				if d == nil || d.rate != float64(af.Rate) {
+					d = NewDemodulator(af.Rate)
+				}
+				found = d.Process(found[:0], af.Samples)
+				for _, f := range found {
+					f.Time, f.Freq = af.Time, af.Freq
+					select {
+					case frames <- f:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return frames
+}
@@ -0,0 +1,166 @@
+package aprs
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/demod"
+)
+
+func testFrame() Frame {
+	return Frame{
+		Dest:    Address{Call: "APRS"},
+		Source:  Address{Call: "N0CALL", SSID: 9},
+		Path:    []Address{{Call: "WIDE1", SSID: 1, Repeated: true}, {Call: "WIDE2", SSID: 1}},
+		Control: ControlUI,
+		PID:     PIDNone,
+		Info:    []byte("!4903.50N/07201.75W-Test 001"),
+	}
+}
+
+const testPacket = "N0CALL-9>APRS,WIDE1-1*,WIDE2-1:!4903.50N/07201.75W-Test 001"
+
+// Returns Bell 202 AFSK audio of data and its FCS at rate samples per
+// second, with the space tone at spaceGain relative to the mark, as if
+// pre-emphasized.
+func modulate(data []byte, rate int, spaceGain float64) []float32 {
+	fcs := FCS(data)
+	data = append(append([]byte(nil), data...), byte(fcs), byte(fcs>>8))
+
+	var bits []bool
+	flags := func(n int) {
+		for i := 0; i < n; i++ {
+			for j := 0; j < 8; j++ {
+				bits = append(bits, 0x7e&(1<<j) != 0)
+			}
+		}
+	}
+	flags(32)
+	ones := 0
+	for _, b := range data {
+		for j := 0; j < 8; j++ {
+			one := b&(1<<j) != 0
+			bits = append(bits, one)
+			if ones = ones + 1; !one {
+				ones = 0
+			} else if ones == 5 {
+				bits = append(bits, false)
+				ones = 0
+			}
+		}
+	}
+	flags(4)
+
+	var audio []float32
+	var phase float64
+	mark := true
+	for i, one := range bits {
+		if !one {
+			mark = !mark
+		}
+		freq, gain := float64(Mark), 0.4
+		if !mark {
+			freq, gain = Space, 0.4*spaceGain
+		}
+		for n := i * rate / Baud; n < (i+1)*rate/Baud; n++ {
+			phase += 2 * math.Pi * freq / float64(rate)
+			audio = append(audio, float32(gain*math.Sin(phase)))
+		}
+	}
+	return append(audio, make([]float32, rate/10)...)
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(testFrame().Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.String() != testPacket || f.Control != ControlUI || f.PID != PIDNone {
+		t.Errorf("parsed %q", f)
+	}
+	if _, err := Parse(testFrame().Encode()[:10]); err != ErrShortFrame {
+		t.Errorf("short frame: %v", err)
+	}
+	if a, err := ParseAddress("WIDE2-2"); err != nil || a != (Address{Call: "WIDE2", SSID: 2}) {
+		t.Errorf("parsed address %+v, %v", a, err)
+	}
+	if _, err := ParseAddress("N0CALL-16"); err == nil {
+		t.Error("expected error for invalid SSID")
+	}
+	// The check sequence of "123456789" under X.25.
+	if fcs := FCS([]byte("123456789")); fcs != 0x906e {
+		t.Errorf("FCS %04x", fcs)
+	}
+}
+
+func TestDemodulator(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, test := range []struct {
+		rate      int
+		spaceGain float64
+	}{
+		{48000, 1},
+		{22050, 2}, // Pre-emphasized, and a fractional number of samples per bit.
+		{9600, 0.5},
+	} {
+		audio := modulate(testFrame().Encode(), test.rate, test.spaceGain)
+		for i := range audio {
+			audio[i] += 0.02 * float32(rng.NormFloat64())
+		}
+		frames := NewDemodulator(test.rate).Process(nil, audio)
+		if len(frames) != 1 || frames[0].String() != testPacket {
+			t.Errorf("%d Hz: decoded %q", test.rate, frames)
+		}
+	}
+
+	// A corrupt frame fails its FCS.
+	data := testFrame().Encode()
+	audio := modulate(data, 48000, 1)
+	data[20] ^= 4
+	corrupt := modulate(data, 48000, 1)
+	fcs := len(audio) - 48000/10 - 6*8*48000/Baud // Just before the FCS.
+	copy(corrupt[fcs:], audio[fcs:])
+	if frames := NewDemodulator(48000).Process(nil, corrupt); len(frames) != 0 {
+		t.Errorf("decoded %q", frames)
+	}
+}
+
+func TestNBFM(t *testing.T) {
+	// The packet FM modulated 25 kHz above the center of a 240 kHz
+	// stream, deviating up to 3 kHz, and received through demod.Receiver.
+	const rate, audioRate, interp = 240000, 48000, 5
+	audio := modulate(testFrame().Encode(), audioRate, 1)
+	iq := make([]byte, 0, 2*interp*len(audio))
+	var phase float64
+	for _, a := range audio {
+		for i := 0; i < interp; i++ {
+			phase += 2 * math.Pi * (25e3 + 0.6*demod.NarrowDeviation*float64(a)) / rate
+			iq = append(iq, byte(127.5+100*math.Cos(phase)), byte(127.5+100*math.Sin(phase)))
+		}
+	}
+
+	blocks := make(chan rtltcp.Block, len(iq)/16384+1)
+	for i := 0; i < len(iq); i += 16384 {
+		blocks <- rtltcp.Block{
+			Metadata: rtltcp.Metadata{CenterFreq: FreqNorthAmerica - 25e3, SampleRate: rate},
+			Samples:  iq[i:min(i+16384, len(iq))],
+		}
+	}
+	close(blocks)
+
+	rx, err := demod.NewReceiver(demod.ReceiverConfig{Offset: 25e3, AudioRate: 24000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	var packets []Frame
+	for f := range Frames(ctx, demod.Frames(ctx, blocks, rx)) {
+		packets = append(packets, f)
+	}
+	if len(packets) != 1 || packets[0].String() != testPacket || packets[0].Freq != FreqNorthAmerica {
+		t.Errorf("received %q", packets)
+	}
+}
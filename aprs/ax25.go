@@ -0,0 +1,201 @@
+package aprs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sizes of AX.25 frame fields in bytes.
+const (
+	addressLen = 7
+	fcsLen     = 2
+	maxPath    = 8 // Digipeater addresses.
+	// Addresses, control and FCS at least.
+	minFrameLen = 2*addressLen + 1 + fcsLen
+	// Longest frame accepted, an information field of 256 bytes with a
+	// full path.
+	maxFrameLen = (2+maxPath)*addressLen + 2 + 256 + fcsLen
+)
+
+// Control and protocol identifier of the UI frames APRS is sent in.
+const (
+	ControlUI = 0x03
+	PIDNone   = 0xf0 // No layer 3 protocol.
+)
+
+var (
+	// Returned when a frame holds no complete address fields.
+	ErrShortFrame = errors.New("ax25: frame too short")
+	// Returned when a frame's address field isn't terminated.
+	ErrBadAddress = errors.New("ax25: malformed address field")
+)
+
+// A station address: callsign and secondary station identifier.
+type Address struct {
+	Call string
+	SSID int
+	// Set on digipeater addresses which have repeated the frame.
+	Repeated bool
+}
+
+// Parses an address of the form CALL[-SSID].
+func ParseAddress(s string) (Address, error) {
+	a := Address{Call: s}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		ssid, err := strconv.Atoi(s[i+1:])
+		if err != nil || ssid < 0 || ssid > 15 {
+			return Address{}, fmt.Errorf("invalid SSID in %q", s)
+		}
+		a.Call, a.SSID = s[:i], ssid
+	}
+	if a.Call == "" || len(a.Call) > 6 {
+		return Address{}, fmt.Errorf("invalid callsign in %q", s)
+	}
+	return a, nil
+}
+
+// Returns the address as CALL-SSID, the SSID omitted if zero, marked with
+// an asterisk if repeated.
+func (a Address) String() string {
+	s := a.Call
+	if a.SSID != 0 {
+		s += "-" + strconv.Itoa(a.SSID)
+	}
+	if a.Repeated {
+		s += "*"
+	}
+	return s
+}
+
+// Decodes the address at the start of b, which must hold addressLen bytes,
+// returning whether it's the last of the address field.
+func decodeAddress(b []byte) (a Address, last bool) {
+	var call [6]byte
+	for i := range call {
+		call[i] = b[i] >> 1
+	}
+	a.Call = strings.TrimRight(string(call[:]), " ")
+	a.SSID = int(b[6]>>1) & 0x0f
+	a.Repeated = b[6]&0x80 != 0
+	return a, b[6]&1 != 0
+}
+
+// Appends the encoding of a to dst, marked last if last.
+func (a Address) encode(dst []byte, last bool) []byte {
+	call := strings.ToUpper(a.Call) + "      "
+	for i := 0; i < 6; i++ {
+		dst = append(dst, call[i]<<1)
+	}
+	ssid := byte(0x60 | a.SSID<<1)
+	if a.Repeated {
+		ssid |= 0x80
+	}
+	if last {
+		ssid |= 1
+	}
+	return append(dst, ssid)
+}
+
+// A decoded AX.25 frame, an APRS packet if a UI frame.
+type Frame struct {
+	Dest, Source Address
+	Path         []Address // Digipeaters, in order.
+	Control      byte
+	PID          byte   // Present in UI and I frames only.
+	Info         []byte // Information field.
+
+	// Estimated capture time and channel frequency of the audio the frame
+	// ended in, see demod.AudioFrame.
+	Time time.Time
+	Freq uint32
+}
+
+// Parses an AX.25 frame without its FCS.
+func Parse(data []byte) (f Frame, err error) {
+	if len(data) < minFrameLen-fcsLen {
+		return f, ErrShortFrame
+	}
+
+	var last bool
+	f.Dest, _ = decodeAddress(data)
+	f.Dest.Repeated = false // The command bit, not the H bit.
+	f.Source, last = decodeAddress(data[addressLen:])
+	f.Source.Repeated = false
+	data = data[2*addressLen:]
+	for !last {
+		if len(f.Path) == maxPath || len(data) < addressLen {
+			return f, ErrBadAddress
+		}
+		var a Address
+		a, last = decodeAddress(data)
+		f.Path = append(f.Path, a)
+		data = data[addressLen:]
+	}
+
+	if len(data) == 0 {
+		return f, ErrShortFrame
+	}
+	f.Control, data = data[0], data[1:]
+	// I frames have bit 0 clear, UI frames are unnumbered frames 0x03.
+	if f.Control&1 == 0 || f.Control&^0x10 == ControlUI {
+		if len(data) == 0 {
+			return f, ErrShortFrame
+		}
+		f.PID, data = data[0], data[1:]
+	}
+	f.Info = append([]byte(nil), data...)
+	return f, nil
+}
+
+// Returns the frame's encoding without its FCS, see Parse.
+func (f Frame) Encode() []byte {
+	b := make([]byte, 0, (2+len(f.Path))*addressLen+2+len(f.Info))
+	b = f.Dest.encode(b, false)
+	src := f.Source
+	src.Repeated = false
+	b = src.encode(b, len(f.Path) == 0)
+	for i, a := range f.Path {
+		b = a.encode(b, i == len(f.Path)-1)
+	}
+	b = append(b, f.Control)
+	if f.Control&1 == 0 || f.Control&^0x10 == ControlUI {
+		b = append(b, f.PID)
+	}
+	return append(b, f.Info...)
+}
+
+// Returns the frame in the TNC2 monitor format of APRS software,
+// SOURCE>DEST,PATH:info.
+func (f Frame) String() string {
+	var b strings.Builder
+	b.WriteString(f.Source.String())
+	b.WriteByte('>')
+	b.WriteString(f.Dest.String())
+	for _, a := range f.Path {
+		b.WriteByte(',')
+		b.WriteString(a.String())
+	}
+	b.WriteByte(':')
+	b.Write(f.Info)
+	return b.String()
+}
+
+// Returns the frame check sequence of data, the CRC-16 of HDLC sent low
+// byte first.
+func FCS(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
@@ -0,0 +1,101 @@
+// Package audio plays demodulated audio or writes it as raw PCM, so a
+// demodulator's output can be heard directly or piped into decoders such
+// as multimon-ng. Audio is mono, samples between -1 and 1.
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bemasher/rtltcp/demod"
+)
+
+// Sink consumes audio at the rate it was created for.
+type Sink interface {
+	WriteAudio(samples []float32) error
+	Close() error
+}
+
+// Encoding of raw PCM samples.
+type Format int
+
+const (
+	FormatS16 Format = iota // Signed 16-bit little-endian.
+	FormatF32               // 32-bit little-endian float.
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatS16:
+		return "s16"
+	case FormatF32:
+		return "f32"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Parses a format name as returned by String.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range []Format{FormatS16, FormatF32} {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown audio format %q", s)
+}
+
+// Returns the bytes per encoded sample.
+func (f Format) Size() int {
+	if f == FormatF32 {
+		return 4
+	}
+	return 2
+}
+
+// PCM writes raw samples to an io.Writer, such as stdout. Samples beyond
+// full scale are clipped.
+type PCM struct {
+	w      io.Writer
+	format Format
+	buf    []byte
+}
+
+// Returns a sink writing samples to w in format.
+func NewPCM(w io.Writer, format Format) *PCM {
+	return &PCM{w: w, format: format}
+}
+
+func (p *PCM) WriteAudio(samples []float32) error {
+	p.buf = p.buf[:0]
+	for _, s := range samples {
+		s = max(-1, min(1, s))
+		if p.format == FormatF32 {
+			p.buf = binary.LittleEndian.AppendUint32(p.buf, math.Float32bits(s))
+		} else {
+			p.buf = binary.LittleEndian.AppendUint16(p.buf, uint16(int16(math.Round(float64(s)*math.MaxInt16))))
+		}
+	}
+	_, err := p.w.Write(p.buf)
+	return err
+}
+
+// Closes the underlying writer if it's an io.Closer.
+func (p *PCM) Close() error {
+	if c, ok := p.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Writes the audio of each frame to sink until frames is closed, so any
+// sink can play, record or stream the output of a demod.Receiver.
+func Copy(sink Sink, frames <-chan demod.AudioFrame) error {
+	for frame := range frames {
+		if err := sink.WriteAudio(frame.Samples); err != nil {
+			return fmt.Errorf("Error writing audio: %s", err)
+		}
+	}
+	return nil
+}
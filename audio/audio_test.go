@@ -0,0 +1,39 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bemasher/rtltcp/demod"
+)
+
+func TestPCM(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewPCM(&buf, FormatS16).WriteAudio([]float32{0, 0.5, -2}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 0, 0x00, 0x40, 0x01, 0x80}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("encoded % x, expected % x", buf.Bytes(), want)
+	}
+
+	buf.Reset()
+	NewPCM(&buf, FormatF32).WriteAudio([]float32{1})
+	if want := []byte{0, 0, 0x80, 0x3f}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("encoded % x, expected % x", buf.Bytes(), want)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	frames := make(chan demod.AudioFrame, 2)
+	frames <- demod.AudioFrame{Samples: []float32{0.5}, Rate: 8000}
+	frames <- demod.AudioFrame{Samples: []float32{0, -1}, Rate: 8000}
+	close(frames)
+
+	var buf bytes.Buffer
+	if err := Copy(NewPCM(&buf, FormatS16), frames); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x00, 0x40, 0, 0, 0x01, 0x80}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("encoded % x, expected % x", buf.Bytes(), want)
+	}
+}
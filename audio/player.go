@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+// Audio buffered by the output device when none is given to NewPlayer.
+const DefaultLatency = 100 * time.Millisecond
+
+// Player plays audio on the default output device through oto, which uses
+// ALSA or PulseAudio on Linux, Core Audio on macOS and WASAPI on Windows,
+// loading the system library at run time. WriteAudio blocks while the
+// device's buffer is full, so it paces the caller at the audio rate.
+type Player struct {
+	pcm    *PCM
+	pipe   *io.PipeWriter
+	player *oto.Player
+}
+
+// Opens the default output device at rate samples per second, buffering
+// latency of audio, DefaultLatency if zero. Only one Player can be opened
+// per process.
+func NewPlayer(rate int, latency time.Duration) (*Player, error) {
+	if latency <= 0 {
+		latency = DefaultLatency
+	}
+	ctx, ready, err := oto.NewContext(&oto.NewContextOptions{
+		SampleRate:      rate,
+		ChannelCount:    1,
+		Format:          oto.FormatFloat32LE,
+		BufferSize:      latency,
+		ApplicationName: "rtltcp",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error opening audio device: %s", err)
+	}
+	<-ready
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("Error opening audio device: %s", err)
+	}
+
+	r, w := io.Pipe()
+	p := &Player{pcm: NewPCM(w, FormatF32), pipe: w, player: ctx.NewPlayer(r)}
+	p.player.Play()
+	return p, nil
+}
+
+func (p *Player) WriteAudio(samples []float32) error {
+	return p.pcm.WriteAudio(samples)
+}
+
+// Stops playback, discarding buffered audio.
+func (p *Player) Close() error {
+	p.pipe.Close()
+	return p.player.Close()
+}
@@ -0,0 +1,47 @@
+package rtltcp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic number opening a token handshake. A client connecting to a relay
+// requiring authentication sends the magic, one byte of token length and the
+// token before the server sends the dongle information header. Plain
+// rtl_tcp servers don't understand the handshake.
+var AuthMagic = [...]byte{'R', 'T', 'L', 'A'}
+
+// Longest token a handshake can carry.
+const MaxTokenLen = 255
+
+// Sends the token handshake.
+func WriteAuth(w io.Writer, token string) error {
+	if len(token) > MaxTokenLen {
+		return fmt.Errorf("token longer than %d bytes", MaxTokenLen)
+	}
+
+	buf := make([]byte, 0, len(AuthMagic)+1+len(token))
+	buf = append(buf, AuthMagic[:]...)
+	buf = append(buf, byte(len(token)))
+	buf = append(buf, token...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// Reads a token handshake and returns the token.
+func ReadAuth(r io.Reader) (string, error) {
+	var head [len(AuthMagic) + 1]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return "", err
+	}
+	if [len(AuthMagic)]byte(head[:len(AuthMagic)]) != AuthMagic {
+		return "", errors.New("invalid handshake magic")
+	}
+
+	token := make([]byte, head[len(AuthMagic)])
+	if _, err := io.ReadFull(r, token); err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
@@ -0,0 +1,75 @@
+// Package backend opens sample sources by URI, so applications can switch
+// between servers and protocols without code changes.
+package backend
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/playback"
+	"github.com/bemasher/rtltcp/rtlsdr"
+	"github.com/bemasher/rtltcp/soapy"
+	"github.com/bemasher/rtltcp/spyserver"
+)
+
+// Default ports by scheme.
+var defaultPorts = map[string]string{
+	"rtltcp":    "1234",
+	"rsptcp":    "1234",
+	"spyserver": "5555",
+	"soapy":     soapy.DefaultPort,
+}
+
+// Opens the source described by uri. The scheme selects the protocol:
+//
+//	rtltcp://host:port      rtl_tcp server
+//	rsptcp://host:port      rsp_tcp server, which speaks the rtl_tcp protocol
+//	spyserver://host:port   SpyServer
+//	soapy://host:port?k=v   SoapyRemote, query parameters select the device
+//	file:///path            recording, see playback.Open
+//	rtlsdr://index          dongle attached to this host, see package rtlsdr
+//	rtlsdr://?serial=s      dongle attached to this host, by serial
+//
+// A port missing from the URI defaults to the protocol's usual port.
+func Open(uri string) (rtltcp.Source, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing source URI: %s", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return playback.Open(u.Path)
+	case "rtlsdr":
+		return rtlsdr.OpenAddr(uri)
+	}
+
+	port, ok := defaultPorts[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported source scheme: %q", u.Scheme)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	switch u.Scheme {
+	case "spyserver":
+		return spyserver.Dial(host)
+	case "soapy":
+		args := make(map[string]string)
+		for k, v := range u.Query() {
+			args[k] = v[0]
+		}
+		return soapy.Dial(host, args)
+	}
+
+	sdr := new(rtltcp.SDR)
+	if err := sdr.ConnectAddr(host); err != nil {
+		return nil, err
+	}
+	return sdr, nil
+}
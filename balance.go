@@ -0,0 +1,153 @@
+package rtltcp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fraction of the sample rate around the center frequency considered
+// usable by default, excluding the anti-aliasing filter's rolloff.
+const DefaultUsableFraction = 0.8
+
+// A narrowband channel to be received from a managed device.
+type Channel struct {
+	Name      string
+	Freq      uint32 // Center frequency in Hz.
+	Bandwidth uint32 // Hz.
+}
+
+// A channel assigned to the device receiving it.
+type Assignment struct {
+	Channel Channel
+	Device  *Device
+	// Channel frequency relative to the device's center frequency in Hz, the
+	// frequency to shift by when extracting the channel.
+	Offset int64
+}
+
+// Bounds of a band in Hz.
+type span struct{ lo, hi int64 }
+
+func (s span) covers(c Channel) bool {
+	half := int64(c.Bandwidth) / 2
+	return int64(c.Freq)-half >= s.lo && int64(c.Freq)+half <= s.hi
+}
+
+func (m *Manager) window(center, rate uint32) span {
+	half := int64(float64(rate) * m.UsableFraction / 2)
+	return span{int64(center) - half, int64(center) + half}
+}
+
+// Assigns each channel to a connected device able to receive it. Channels
+// within a device's current window are assigned first, spreading them
+// across devices covering the same band. Devices left without channels are
+// then retuned to cover the remaining channels, packing as many adjacent
+// channels onto each as its sample rate allows. Assignments are returned in
+// the order of channels. Channels that could not be placed are omitted and
+// reported in the error.
+func (m *Manager) Assign(channels []Channel) ([]Assignment, error) {
+	var devices []*Device
+	for _, d := range m.Devices() {
+		if d.Stats().Connected {
+			devices = append(devices, d)
+		}
+	}
+
+	load := make(map[*Device]int)
+	assigned := make([]*Device, len(channels))
+
+	// Place channels on devices already covering them, least loaded first.
+	for i, c := range channels {
+		var best *Device
+		for _, d := range devices {
+			md := d.Metadata()
+			if !m.window(md.CenterFreq, md.SampleRate).covers(c) {
+				continue
+			}
+			if best == nil || load[d] < load[best] {
+				best = d
+			}
+		}
+		if best != nil {
+			assigned[i] = best
+			load[best]++
+		}
+	}
+
+	// Retune idle devices onto clusters of the remaining channels in
+	// frequency order.
+	var pending []int
+	for i := range channels {
+		if assigned[i] == nil {
+			pending = append(pending, i)
+		}
+	}
+	sort.Slice(pending, func(a, b int) bool {
+		return channels[pending[a]].Freq < channels[pending[b]].Freq
+	})
+
+	var errs []string
+	for _, d := range devices {
+		if len(pending) == 0 {
+			break
+		}
+		if load[d] > 0 {
+			continue
+		}
+
+		rate := d.Metadata().SampleRate
+		width := m.window(0, rate)
+
+		// Extend the cluster while it fits the device's usable bandwidth.
+		first := channels[pending[0]]
+		lo := int64(first.Freq) - int64(first.Bandwidth)/2
+		hi := int64(first.Freq) + int64(first.Bandwidth)/2
+		if hi-lo > width.hi-width.lo {
+			continue
+		}
+		n := 1
+		for ; n < len(pending); n++ {
+			c := channels[pending[n]]
+			chi := int64(c.Freq) + int64(c.Bandwidth)/2
+			if chi > hi {
+				if chi-lo > width.hi-width.lo {
+					break
+				}
+				hi = chi
+			}
+		}
+
+		center := uint32((lo + hi) / 2)
+		err := d.Control(func(sdr *SDR) error { return sdr.SetCenterFreq(center) })
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("retuning %s: %s", d.Config.Name, err))
+			continue
+		}
+
+		for _, i := range pending[:n] {
+			assigned[i] = d
+			load[d]++
+		}
+		pending = pending[n:]
+	}
+
+	var result []Assignment
+	for i, c := range channels {
+		d := assigned[i]
+		if d == nil {
+			errs = append(errs, fmt.Sprintf("no device for %s at %d Hz", c.Name, c.Freq))
+			continue
+		}
+		result = append(result, Assignment{
+			Channel: c,
+			Device:  d,
+			Offset:  int64(c.Freq) - int64(d.Metadata().CenterFreq),
+		})
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("Error assigning channels: %s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
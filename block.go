@@ -0,0 +1,461 @@
+package rtltcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Number of blocks buffered by the background reader before it blocks.
+const DefaultQueueDepth = 8
+
+// Size of the USB transfers rtl_tcp reads from the dongle by default.
+const DefaultBufferDepth = 16 * 32 * 512
+
+// Time spanned by blocks sized to the sample rate, see BlockSizeFor.
+const DefaultBlockDuration = 20 * time.Millisecond
+
+// Returns the size in bytes of blocks spanning DefaultBlockDuration at the
+// sample rate, in whole 512 byte USB packets, or DefaultBufferDepth if the
+// rate is unknown.
+func BlockSizeFor(rate uint32) int {
+	return blockSizeFor(rate, DefaultBlockDuration)
+}
+
+func blockSizeFor(rate uint32, d time.Duration) int {
+	if rate == 0 {
+		return DefaultBufferDepth
+	}
+	n := int(2 * float64(rate) * d.Seconds())
+	return max(512, (n+511)/512*512)
+}
+
+// Returns the bytes of upstream buffering assumed, see SDR.BufferDepth.
+func (sdr *SDR) bufferDepth() int {
+	switch {
+	case sdr.BufferDepth < 0:
+		return 0
+	case sdr.BufferDepth == 0:
+		return DefaultBufferDepth
+	}
+	return sdr.BufferDepth
+}
+
+// Returns the size in bytes of blocks read when none is given: BlockSize,
+// else Flags.BlockSize, else sized to span BlockDuration, Flags.BlockDuration
+// or DefaultBlockDuration at the current sample rate.
+func (sdr *SDR) ReadBlockSize() int {
+	switch {
+	case sdr.BlockSize > 0:
+		return sdr.BlockSize
+	case sdr.Flags.BlockSize > 0:
+		return sdr.Flags.BlockSize
+	}
+
+	d := DefaultBlockDuration
+	switch {
+	case sdr.BlockDuration > 0:
+		d = sdr.BlockDuration
+	case sdr.Flags.BlockDuration > 0:
+		d = sdr.Flags.BlockDuration
+	}
+	return blockSizeFor(sdr.Metadata().SampleRate, d)
+}
+
+// Describes the acquisition state valid at the first sample of a block.
+// Fields are zero until the corresponding setting has been issued through
+// this SDR, since rtl_tcp doesn't report its current settings.
+type Metadata struct {
+	CenterFreq uint32 // Center frequency in Hz.
+	SampleRate uint32 // Sample rate in Hz.
+	AutoGain   bool   // Tuner AGC enabled.
+	Gain       uint32 // Manual tuner gain in tenths of dB.
+
+	// Both times carry a monotonic clock reading, so differences between
+	// blocks are immune to wall clock adjustments.
+	Received  time.Time // Time the last byte of the block was read.
+	Timestamp time.Time // Estimated capture time of the first sample.
+
+	// Correction applied to Timestamp by the SDR's Discipline and its
+	// uncertainty, Disciplined is false if no estimate was available.
+	Disciplined      bool
+	ClockOffset      time.Duration
+	ClockUncertainty time.Duration
+}
+
+// Returns the time taken to receive n bytes of interleaved IQ at the
+// sample rate, or zero if the sample rate is unknown.
+func (m Metadata) byteDuration(n int) time.Duration {
+	if m.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(n/2) / float64(m.SampleRate) * float64(time.Second))
+}
+
+// Contains interleaved 8-bit unsigned IQ samples and the acquisition state
+// they were received under.
+type Block struct {
+	Metadata
+	Samples []byte
+
+	// Samples lost between the previous block and this one, zero if the
+	// stream is contiguous. Decoders should reset their state rather than
+	// treat the samples as continuing the previous block.
+	Gap uint64
+
+	// Index of the first sample, counted from the first sample of the
+	// connection, so the next block's is Index + Len() + Gap.
+	Index uint64
+
+	// Set when the center frequency or sample rate changed since the
+	// previous block, nil otherwise. Decoders should reset and recorders
+	// start a new capture at the change.
+	Segment *Segment
+
+	buf *buffer // Pooled buffer backing Samples, see PooledBlocks.
+}
+
+// Marks a change of center frequency or sample rate in the stream. Changes
+// issued within one block are combined into one.
+type Segment struct {
+	Old, New Metadata // Acquisition state before and after the change.
+
+	// Index of the first sample read after the change was issued, see
+	// Block.Index. Samples in transit at the time were still received
+	// under the old settings.
+	Index uint64
+	// Offset of that sample within the block, zero if it fell in samples
+	// dropped before the block, see Gap.
+	Offset int
+}
+
+// Splits the block at its segment boundary into the samples received under
+// the old settings and those under the new, each tagged accordingly. The
+// boundary stays with after, at its start. Before is empty if the block has
+// no boundary or the boundary starts it. Only after holds the block's
+// pooled buffer, if any.
+func (b Block) Split() (before, after Block) {
+	after = b
+	if b.Segment == nil || b.Segment.Offset == 0 {
+		return
+	}
+
+	n := min(2*b.Segment.Offset, len(b.Samples))
+	before = b
+	old := b.Segment.Old
+	before.CenterFreq, before.SampleRate = old.CenterFreq, old.SampleRate
+	before.AutoGain, before.Gain = old.AutoGain, old.Gain
+	before.Samples, before.Segment, before.buf = b.Samples[:n], nil, nil
+
+	seg := *b.Segment
+	seg.Offset = 0
+	after.Samples, after.Segment, after.Gap = b.Samples[n:], &seg, 0
+	after.Timestamp = b.Timestamp.Add(before.Duration())
+	return
+}
+
+// Combines a boundary with one pending from blocks not delivered, for the
+// next block delivered.
+func carrySegment(pending, seg *Segment) *Segment {
+	switch {
+	case pending == nil && seg == nil:
+		return nil
+	case pending == nil:
+		carried := *seg
+		carried.Offset = 0
+		return &carried
+	case seg == nil:
+		return pending
+	}
+	return &Segment{Old: pending.Old, New: seg.New, Index: pending.Index}
+}
+
+// Returns the number of complex samples in the block.
+func (b Block) Len() int {
+	return len(b.Samples) / 2
+}
+
+// Returns the time spanned by the block at its sample rate.
+func (b Block) Duration() time.Duration {
+	return b.byteDuration(len(b.Samples))
+}
+
+// Sink consumes tagged sample blocks, such as a recorder or network
+// streamer. Sinks may retain the block's samples only until WriteBlock
+// returns.
+type Sink interface {
+	WriteBlock(Block) error
+	Close() error
+}
+
+// Returns a snapshot of the acquisition state as of the last command issued.
+func (sdr *SDR) Metadata() Metadata {
+	sdr.mu.Lock()
+	defer sdr.mu.Unlock()
+	return sdr.state
+}
+
+func (sdr *SDR) update(fn func(*Metadata)) {
+	sdr.mu.Lock()
+	old := sdr.state
+	fn(&sdr.state)
+	retuned := sdr.state.CenterFreq != old.CenterFreq || sdr.state.SampleRate != old.SampleRate
+	if retuned && sdr.segment == nil {
+		sdr.segment = &Segment{Old: old, Index: atomic.LoadUint64(&sdr.received) / 2}
+	}
+	sdr.mu.Unlock()
+}
+
+// Tags a block of samples just read with its index, acquisition state and
+// the boundary it contains, if any. A change issued after the block was
+// read is left for the next.
+func (sdr *SDR) tag(blk *Block) {
+	sdr.mu.Lock()
+	defer sdr.mu.Unlock()
+
+	end := atomic.LoadUint64(&sdr.received) / 2
+	blk.Index = end - min(end, uint64(blk.Len()))
+	blk.Metadata, blk.Segment = sdr.state, nil
+
+	pending := sdr.segment
+	if pending == nil {
+		return
+	}
+	if pending.Index >= end {
+		blk.Metadata = pending.Old
+		return
+	}
+	sdr.segment = nil
+	if pending.Old.CenterFreq == sdr.state.CenterFreq && pending.Old.SampleRate == sdr.state.SampleRate {
+		// Changed and changed back.
+		return
+	}
+
+	blk.Segment = &Segment{Old: pending.Old, New: sdr.state, Index: pending.Index}
+	if pending.Index > blk.Index {
+		blk.Segment.Offset = int(pending.Index - blk.Index)
+	}
+}
+
+// Fills buf with samples and returns it as a block tagged with the current
+// acquisition state. Tags reflect the settings at the time the block is
+// read, samples already buffered in transit when a command is issued will
+// carry the new settings.
+//
+// The capture time is estimated by backing off the receive time by the
+// duration of the block plus BufferDepth bytes of upstream buffering, then
+// corrected by Discipline if one is set.
+func (sdr *SDR) ReadBlock(buf []byte) (blk Block, err error) {
+	_, err = io.ReadFull(sdr, buf)
+	if err != nil {
+		return
+	}
+
+	blk.Samples = buf
+	sdr.tag(&blk)
+	blk.Received = time.Now()
+	blk.Timestamp = blk.Received.Add(-blk.byteDuration(len(buf) + sdr.bufferDepth()))
+
+	if sdr.Discipline != nil {
+		offset, uncertainty, derr := sdr.Discipline.Offset()
+		if derr == nil {
+			blk.Disciplined = true
+			blk.ClockOffset = offset
+			blk.ClockUncertainty = uncertainty
+			blk.Timestamp = blk.Timestamp.Add(offset)
+		}
+	}
+
+	return
+}
+
+// Fills buf as ReadBlock, returning ctx's error if ctx is done first. A
+// cancelled read leaves the connection partway through a block, so it
+// should be closed rather than read again.
+func (sdr *SDR) ReadBlockContext(ctx context.Context, buf []byte) (blk Block, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	// An expired deadline unblocks the read.
+	expired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		sdr.Conn.SetReadDeadline(time.Unix(1, 0))
+		close(expired)
+	})
+	blk, err = sdr.ReadBlock(buf)
+	if !stop() {
+		<-expired
+		sdr.Conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			err = ctx.Err()
+		}
+	}
+	return
+}
+
+// Starts a goroutine reading blocks of blockSize bytes and returns the
+// channel they are delivered on. If blockSize is zero each block is sized
+// by ReadBlockSize as it's read, so blocks sized to the sample rate follow
+// SetSampleRate. Each block has its own buffer owned by the
+// receiver. When reading fails the channel is closed and the error is
+// available from Err. Only one reader should be started per connection.
+// See PooledBlocks for a reader recycling its buffers.
+func (sdr *SDR) Blocks(blockSize int) <-chan Block {
+	return sdr.BlocksContext(context.Background(), blockSize)
+}
+
+// Starts a reader as Blocks which also stops when ctx is done, even while
+// blocked reading or delivering, with ctx's error available from Err.
+func (sdr *SDR) BlocksContext(ctx context.Context, blockSize int) <-chan Block {
+	return sdr.startReader(ctx, blockSize, nil)
+}
+
+// Starts the background reader, taking buffers from pool if not nil.
+func (sdr *SDR) startReader(ctx context.Context, blockSize int, pool *bufferPool) <-chan Block {
+	blocks := make(chan Block, DefaultQueueDepth)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	sdr.mu.Lock()
+	sdr.stopReader, sdr.readerDone, sdr.blocks = cancel, done, blocks
+	sdr.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer close(blocks)
+		defer cancel()
+
+		var lost uint64      // Samples dropped since the last block queued.
+		var pending *Segment // Boundary of blocks dropped since then.
+		for {
+			size := blockSize
+			if size <= 0 {
+				size = sdr.ReadBlockSize()
+			}
+
+			var pb *buffer
+			var buf []byte
+			if pool != nil && pool.size != size {
+				// Buffers of the old size return to the old pool.
+				pool = newBufferPool(size)
+			}
+			if pool != nil {
+				pb = getBuffer(pool)
+				buf = pb.data
+			} else {
+				buf = make([]byte, size)
+			}
+
+			blk, err := sdr.ReadBlockContext(ctx, buf)
+			blk.buf, blk.Gap = pb, lost
+			if err == nil && sdr.DropOnOverflow {
+				if pending != nil {
+					blk.Segment = carrySegment(pending, blk.Segment)
+				}
+				select {
+				case blocks <- blk:
+					lost, pending = 0, nil
+				default:
+					lost += uint64(blk.Len())
+					pending = carrySegment(pending, blk.Segment)
+					sdr.drop(uint64(blk.Len()))
+					blk.Release()
+				}
+				continue
+			}
+			if err == nil {
+				select {
+				case blocks <- blk:
+					continue
+				case <-ctx.Done():
+					err = ctx.Err()
+				}
+			}
+			blk.Release()
+
+			sdr.mu.Lock()
+			sdr.err = err
+			sdr.mu.Unlock()
+			return
+		}
+	}()
+
+	return blocks
+}
+
+// Accounts for samples dropped by the background reader.
+func (sdr *SDR) drop(samples uint64) {
+	atomic.AddUint64(&sdr.lost, samples)
+	if sdr.OnGap != nil {
+		sdr.OnGap(samples)
+	}
+}
+
+// Returns the number of samples the background reader has dropped, see
+// DropOnOverflow.
+func (sdr *SDR) Lost() uint64 {
+	return atomic.LoadUint64(&sdr.lost)
+}
+
+// Returns the error which stopped the background reader, if any.
+func (sdr *SDR) Err() error {
+	sdr.mu.Lock()
+	defer sdr.mu.Unlock()
+	return sdr.err
+}
+
+// Treatment by Shutdown of blocks the background reader has queued.
+type DrainPolicy int
+
+const (
+	Discard DrainPolicy = iota // Drop them.
+	Drain                      // Write them to the sinks.
+)
+
+// Shuts down in order: stops the background reader, discards or drains
+// the blocks it queued according to policy, closes sinks, finalizing
+// recordings such as SigMF metadata, then closes the connection. When ctx
+// is done before the reader stops, queued blocks are discarded, the rest
+// still happens. Returns every error encountered.
+func (sdr *SDR) Shutdown(ctx context.Context, policy DrainPolicy, sinks ...Sink) error {
+	sdr.mu.Lock()
+	stop, done, blocks := sdr.stopReader, sdr.readerDone, sdr.blocks
+	sdr.stopReader, sdr.readerDone, sdr.blocks = nil, nil, nil
+	sdr.mu.Unlock()
+
+	var errs []error
+	if stop != nil {
+		stop()
+		select {
+		case <-done:
+			// Closed by the reader, so ranging ends with the queue.
+			for blk := range blocks {
+				if policy == Drain {
+					for _, s := range sinks {
+						if err := s.WriteBlock(blk); err != nil {
+							errs = append(errs, err)
+						}
+					}
+				}
+				blk.Release()
+			}
+		case <-ctx.Done():
+			errs = append(errs, ctx.Err())
+		}
+	}
+
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if sdr.Conn != nil {
+		if err := sdr.Conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
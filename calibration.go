@@ -0,0 +1,91 @@
+package rtltcp
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Calibration measured for one dongle. Zero fields are left unapplied.
+type Calibration struct {
+	PPM     int           `json:"ppm,omitempty"`     // Frequency correction.
+	Balance dsp.IQBalance `json:"iq_balance"`        // Corrected by ReadIQ.
+	Gain    float64       `json:"gain_db,omitempty"` // Preferred manual gain, see SetGainDB.
+	Updated time.Time     `json:"updated"`
+}
+
+// CalibrationStore persists calibrations of several dongles to a JSON file,
+// keyed by serial number or server address, see SDR.CalibrationKey.
+type CalibrationStore struct {
+	store *jsonStore[Calibration]
+}
+
+// Returns the file calibrations are kept in by default, in DefaultConfigDir.
+func DefaultCalibrationPath() (string, error) {
+	dir, err := DefaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "calibration.json"), nil
+}
+
+// Opens the store at path, empty if the file doesn't exist yet.
+func OpenCalibrations(path string) (*CalibrationStore, error) {
+	store, err := openJSONStore[Calibration](path, "calibrations")
+	if err != nil {
+		return nil, err
+	}
+	return &CalibrationStore{store}, nil
+}
+
+// Returns the calibration stored under key and whether there is one.
+func (s *CalibrationStore) Get(key string) (Calibration, bool) {
+	return s.store.get(key)
+}
+
+// Stores c under key, stamped with the current time, and rewrites the file.
+func (s *CalibrationStore) Put(key string, c Calibration) error {
+	c.Updated = time.Now()
+	return s.store.put(key, c, false)
+}
+
+// Returns the key the dongle's calibration is stored under: its serial if
+// the server sent one, otherwise the address it was dialed at.
+func (sdr *SDR) CalibrationKey() string {
+	if sdr.identity.Serial != "" {
+		return "serial:" + sdr.identity.Serial
+	}
+	return sdr.addr
+}
+
+// Returns the calibration applied on connect, zero if none.
+func (sdr *SDR) Calibration() Calibration {
+	return sdr.calibration
+}
+
+// Stores c as the dongle's calibration and applies it.
+func (sdr *SDR) SaveCalibration(c Calibration) error {
+	if sdr.Calibrations == nil {
+		return errors.New("rtltcp: no calibration store")
+	}
+	if err := sdr.Calibrations.Put(sdr.CalibrationKey(), c); err != nil {
+		return err
+	}
+	return sdr.applyCalibration(c)
+}
+
+// Sends the stored corrections and keeps the IQ balance for ReadIQ.
+func (sdr *SDR) applyCalibration(c Calibration) error {
+	sdr.calibration = c
+	if c.PPM != 0 {
+		if err := sdr.SetFreqCorrection(uint32(c.PPM)); err != nil {
+			return err
+		}
+	}
+	if c.Gain != 0 {
+		return sdr.SetGainDB(c.Gain)
+	}
+	return nil
+}
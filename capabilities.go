@@ -0,0 +1,69 @@
+package rtltcp
+
+// IF filter bandwidths in Hz librtlsdr can select for each tuner, widest
+// first. rtl_tcp has no command selecting one, librtlsdr picks the filter
+// from the sample rate unless a server offers a way to set it.
+var tunerBandwidths = map[Tuner][]uint32{
+	TunerE4000:  {27e6, 4.6e6, 4.2e6, 3.8e6, 3.4e6, 3e6, 2.7e6, 2.3e6, 1.9e6},
+	TunerFC0012: {8e6, 7e6, 6e6},
+	TunerFC0013: {8e6, 7e6, 6e6},
+	TunerFC2580: {8e6, 7e6, 6e6, 1.53e6},
+	TunerR820T:  {8e6, 7e6, 6e6, 1.7e6, 1.6e6, 1.55e6, 1.45e6, 1.2e6, 0.9e6, 0.7e6, 0.55e6, 0.45e6, 0.35e6},
+	TunerR828D:  {8e6, 7e6, 6e6, 1.7e6, 1.6e6, 1.55e6, 1.45e6, 1.2e6, 0.9e6, 0.7e6, 0.55e6, 0.45e6, 0.35e6},
+}
+
+// What a dongle supports, for offering only valid settings. Fields are zero
+// if the tuner is unknown.
+type Capabilities struct {
+	Tuner   Tuner  `json:"tuner"`
+	FreqMin uint32 `json:"freq_min,omitempty"` // Tuning range in Hz.
+	FreqMax uint32 `json:"freq_max,omitempty"`
+	// Gains in tenths of a dB, lowest first, see SDR.Gains.
+	Gains []int `json:"gains,omitempty"`
+	// IF gain stages set by SetTunerIfGain, numbered from 1.
+	IFStages int `json:"if_stages,omitempty"`
+	// IF filter bandwidths in Hz, widest first.
+	Bandwidths []uint32 `json:"bandwidths,omitempty"`
+	// Offset tuning applies, moving the DC spike of a zero-IF tuner out of
+	// the passband. R820T-family tuners have a low IF and reject it.
+	OffsetTuning bool `json:"offset_tuning"`
+	// Direct sampling applies, feeding HF from the antenna to the RTL2832
+	// bypassing the tuner. It needs a dongle built or modified for it.
+	DirectSampling bool `json:"direct_sampling"`
+}
+
+// Reports whether offset tuning helps the tuner: the E4000 and FC001x have
+// a zero IF, their DC spike sitting at the center of the band received.
+func (t Tuner) OffsetTuningHelps() bool {
+	return t == TunerE4000 || t == TunerFC0012 || t == TunerFC0013
+}
+
+// Returns the capabilities of the tuner.
+func (t Tuner) Capabilities() (c Capabilities) {
+	if _, ok := tunerRanges[t]; !ok {
+		return Capabilities{Tuner: t}
+	}
+
+	c = Capabilities{
+		Tuner:          t,
+		Gains:          t.Gains(),
+		Bandwidths:     append([]uint32(nil), tunerBandwidths[t]...),
+		OffsetTuning:   t != TunerR820T && t != TunerR828D,
+		DirectSampling: true,
+	}
+	c.FreqMin, c.FreqMax = t.FreqRange()
+	if t == TunerE4000 {
+		c.IFStages = len(e4000IFStageGains)
+	}
+	return
+}
+
+// Returns the capabilities of the dongle: those of its tuner, with the gain
+// table sent by the server if it reports one.
+func (sdr *SDR) Capabilities() Capabilities {
+	c := sdr.Info.Tuner.Capabilities()
+	if len(sdr.identity.Gains) > 0 {
+		c.Gains = sdr.Gains()
+	}
+	return c
+}
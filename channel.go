@@ -0,0 +1,26 @@
+package rtltcp
+
+// Opcodes of commands selecting a narrow channel of the stream. Relays of
+// the proxy package downconvert for each client separately, so narrowband
+// consumers don't each receive the full stream. rtl_tcp ignores them.
+const (
+	// Offset of the channel from the center frequency in Hz, as a two's
+	// complement int32.
+	CmdChannelOffset = 0x80
+	// Factor the channel's sample rate is reduced by, none if zero or one.
+	CmdChannelDecimation = 0x81
+)
+
+// Asks a relay to send only the channel offset Hz from the center
+// frequency, decimated by decim. The stream then carries SampleRate/decim
+// samples per second centered on CenterFreq+offset, while Metadata keeps
+// reporting the tuner's settings. A zero offset and decimation restore the
+// full stream. Servers other than relays ignore the request.
+func (sdr *SDR) SetChannel(offset int32, decim uint32) error {
+	return sdr.Batch(func() error {
+		if err := sdr.execute(Command{CmdChannelOffset, uint32(offset)}); err != nil {
+			return err
+		}
+		return sdr.execute(Command{CmdChannelDecimation, decim})
+	})
+}
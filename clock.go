@@ -0,0 +1,86 @@
+package rtltcp
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Discipline estimates the offset of the local clock from an external time
+// reference. When an SDR has a Discipline, block timestamps are corrected by
+// the offset and both the offset and its uncertainty are recorded in the
+// block metadata, so timestamps from separate receivers can be compared.
+type Discipline interface {
+	// Returns the correction to add to local time and its estimated
+	// uncertainty.
+	Offset() (offset, uncertainty time.Duration, err error)
+}
+
+// Returned when a discipline has no usable estimate.
+var ErrUnsynchronized = errors.New("clock not synchronized")
+
+// Reports the local clock's offset as estimated by the kernel's NTP state,
+// which is maintained by ntpd, chrony or systemd-timesyncd. Only supported
+// on Linux, elsewhere Offset always fails.
+type NTPDiscipline struct{}
+
+// Number of pulses PPSDiscipline derives its estimate from.
+const ppsHistory = 16
+
+// Disciplines timestamps against a pulse-per-second source. The owner of the
+// PPS signal calls Pulse with the local time of each edge, which is assumed
+// to mark the start of a true second.
+type PPSDiscipline struct {
+	// Estimates older than this are considered stale, two seconds if zero.
+	MaxAge time.Duration
+
+	mu      sync.Mutex
+	offsets []time.Duration
+	last    time.Time
+}
+
+// Records a pulse observed at local time t.
+func (pps *PPSDiscipline) Pulse(t time.Time) {
+	// The true time of the edge is the nearest whole second.
+	offset := t.Round(time.Second).Sub(t)
+
+	pps.mu.Lock()
+	defer pps.mu.Unlock()
+
+	pps.offsets = append(pps.offsets, offset)
+	if len(pps.offsets) > ppsHistory {
+		pps.offsets = pps.offsets[1:]
+	}
+	pps.last = t
+}
+
+// Returns the mean offset over recent pulses, and their standard deviation
+// as the uncertainty.
+func (pps *PPSDiscipline) Offset() (offset, uncertainty time.Duration, err error) {
+	pps.mu.Lock()
+	defer pps.mu.Unlock()
+
+	maxAge := pps.MaxAge
+	if maxAge == 0 {
+		maxAge = 2 * time.Second
+	}
+	if len(pps.offsets) == 0 || time.Since(pps.last) > maxAge {
+		return 0, 0, ErrUnsynchronized
+	}
+
+	var sum float64
+	for _, o := range pps.offsets {
+		sum += float64(o)
+	}
+	mean := sum / float64(len(pps.offsets))
+
+	var variance float64
+	for _, o := range pps.offsets {
+		d := float64(o) - mean
+		variance += d * d
+	}
+	variance /= float64(len(pps.offsets))
+
+	return time.Duration(mean), time.Duration(math.Sqrt(variance)), nil
+}
@@ -0,0 +1,34 @@
+package rtltcp
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// Kernel clock status bits from timex.h.
+const (
+	staUnsync = 0x0040
+	staNano   = 0x2000
+	timeError = 5
+)
+
+// Returns the kernel's remaining phase offset and estimated error.
+func (NTPDiscipline) Offset() (offset, uncertainty time.Duration, err error) {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error reading kernel clock state: %s", err)
+	}
+
+	if state == timeError || tx.Status&staUnsync != 0 {
+		return 0, 0, ErrUnsynchronized
+	}
+
+	offset = time.Duration(tx.Offset) * time.Microsecond
+	if tx.Status&staNano != 0 {
+		offset = time.Duration(tx.Offset)
+	}
+
+	return offset, time.Duration(tx.Esterror) * time.Microsecond, nil
+}
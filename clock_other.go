@@ -0,0 +1,12 @@
+//go:build !linux
+
+package rtltcp
+
+import (
+	"errors"
+	"time"
+)
+
+func (NTPDiscipline) Offset() (offset, uncertainty time.Duration, err error) {
+	return 0, 0, errors.New("kernel clock state unsupported on this platform")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/monitor"
+)
+
+// Parses bands given as name=low-high, comma separated.
+func parseBands(arg string) (bands []monitor.Band, err error) {
+	for _, field := range strings.Split(arg, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(field), "=")
+		low, high, ok2 := strings.Cut(spec, "-")
+		if !ok || !ok2 || name == "" {
+			return nil, fmt.Errorf("invalid band %q, want name=low-high", field)
+		}
+		b := monitor.Band{Name: name}
+		if b.Low, err = parseSI(low); err != nil {
+			return nil, err
+		}
+		if b.High, err = parseSI(high); err != nil {
+			return nil, err
+		}
+		bands = append(bands, b)
+	}
+	return bands, nil
+}
+
+// Learns the spectrum, then prints alerts on new and missing signals,
+// optionally posting them to a webhook.
+func runAlert(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	bandList := flag.String("bands", "", "bands watched as name=low-high, comma separated, all of the stream if empty")
+	learn := flag.Duration("learn", monitor.DefaultLearn, "time the baseline spectrum is learned over")
+	threshold := flag.Float64("threshold", monitor.DefaultAlertThreshold, "rise in dB over the baseline of a new signal")
+	hold := flag.Duration("hold", monitor.DefaultHold, "time a change must persist before alerting")
+	bins := flag.Int("bins", monitor.DefaultBins, "FFT size")
+	webhook := flag.String("webhook", "", "URL alerts are posted to as JSON")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	flag.CommandLine.Parse(args)
+
+	cfg := monitor.AlertConfig{Learn: *learn, Threshold: *threshold, Hold: *hold, Bins: *bins}
+	if *bandList != "" {
+		var err error
+		if cfg.Bands, err = parseBands(*bandList); err != nil {
+			return err
+		}
+	}
+	a, err := monitor.NewAlerter(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return err
+	}
+
+	hook := &monitor.Webhook{URL: *webhook}
+	a.OnAlert = func(al monitor.Alert) {
+		state := "cleared"
+		if al.Active {
+			state = "raised"
+		}
+		log.Printf("%s signal at %.3f MHz %s, %.1f kHz wide, %.1f dBFS against %.1f dBFS",
+			al.Kind, float64(al.Freq)/1e6, state, float64(al.Bandwidth)/1e3, al.Power, al.Baseline)
+		if hook.URL != "" {
+			if err := hook.Post(al); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("learning the spectrum for %s", *learn)
+	buf := make([]byte, sdr.ReadBlockSize())
+	for ctx.Err() == nil {
+		blk, err := sdr.ReadBlock(buf)
+		if err != nil {
+			return fmt.Errorf("Error reading samples: %s", err)
+		}
+		a.WriteBlock(blk)
+	}
+	return a.Close()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/aprs"
+	"github.com/bemasher/rtltcp/demod"
+)
+
+// Receives APRS packets from an NBFM channel and prints them in TNC2
+// format, one per line.
+func runAPRS(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	// Tuned to the North American channel at 240 kS/s unless told otherwise.
+	flag.Set("centerfreq", "144.39M")
+	flag.Set("samplerate", "240k")
+	flag.Lookup("centerfreq").DefValue = "144.39M"
+	flag.Lookup("samplerate").DefValue = "240k"
+	offset := flag.Float64("offset", 0, "channel frequency relative to -centerfreq in Hz")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	flag.CommandLine.Parse(args)
+
+	rx, err := demod.NewReceiver(demod.ReceiverConfig{Mode: "fm", Offset: *offset, AudioRate: 24000})
+	if err != nil {
+		return err
+	}
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	audio := demod.Frames(ctx, sdr.PooledBlocks(ctx, 0), rx)
+	for f := range aprs.Frames(ctx, audio) {
+		fmt.Printf("%s %s\n", f.Time.Format("15:04:05"), f)
+	}
+	if err := sdr.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("Error reading samples: %s", err)
+	}
+	return nil
+}
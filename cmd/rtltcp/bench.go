@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Time streamed before measuring, while the server's buffers fill.
+const benchWarmup = 500 * time.Millisecond
+
+// Checks the counter the RTL2832 emits in test mode, one byte incrementing
+// per byte transferred.
+type counterCheck struct {
+	next    byte
+	started bool
+	gaps    uint64
+	dropped uint64 // Bytes skipped, modulo 256 per gap.
+}
+
+func (c *counterCheck) check(buf []byte) {
+	for _, b := range buf {
+		if c.started && b != c.next {
+			c.gaps++
+			c.dropped += uint64(b - c.next)
+		}
+		c.next, c.started = b+1, true
+	}
+}
+
+// Result of streaming at one sample rate and receive buffer size.
+type benchResult struct {
+	rate    uint32
+	buffer  int
+	bytes   uint64
+	elapsed time.Duration
+	counter counterCheck
+	arrival []time.Duration // Time between consecutive blocks.
+}
+
+// Returns the received throughput in bytes per second.
+func (r benchResult) throughput() float64 {
+	return float64(r.bytes) / r.elapsed.Seconds()
+}
+
+// Reports whether the link kept up without losing data.
+func (r benchResult) sustained() bool {
+	return r.counter.gaps == 0 && r.throughput() >= 0.99*2*float64(r.rate)
+}
+
+// Returns the p-th percentile of block arrival intervals.
+func (r benchResult) percentile(p float64) time.Duration {
+	if len(r.arrival) == 0 {
+		return 0
+	}
+	return r.arrival[int(p*float64(len(r.arrival)-1))]
+}
+
+func parseList(arg string) (values []uint32, err error) {
+	for _, field := range strings.Split(arg, ",") {
+		v, err := parseSI(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return
+}
+
+// Streams test mode data at rate for duration over a connection with the
+// given receive buffer size, zero leaving the system default.
+func benchRun(flags rtltcp.Flags, rate uint32, buffer int, duration time.Duration) (r benchResult, err error) {
+	r.rate, r.buffer = rate, buffer
+
+	// Sized before the header is read, so it applies from the start.
+	sdr := rtltcp.SDR{Flags: flags, ReadBuffer: buffer}
+	if err = connect(&sdr); err != nil {
+		return
+	}
+	defer sdr.Close()
+
+	if err = sdr.SetSampleRate(rate); err != nil {
+		return
+	}
+	if err = sdr.SetTestMode(true); err != nil {
+		return
+	}
+	defer sdr.SetTestMode(false)
+
+	buf := make([]byte, sdr.ReadBlockSize())
+	for start := time.Now(); time.Since(start) < benchWarmup; {
+		if _, err = sdr.ReadBlock(buf); err != nil {
+			return
+		}
+	}
+
+	start := time.Now()
+	last := start
+	for time.Since(start) < duration {
+		blk, err := sdr.ReadBlock(buf)
+		if err != nil {
+			return r, fmt.Errorf("Error reading samples: %s", err)
+		}
+		r.counter.check(blk.Samples)
+		r.bytes += uint64(len(blk.Samples))
+		r.arrival = append(r.arrival, blk.Received.Sub(last))
+		last = blk.Received
+	}
+	r.elapsed = time.Since(start)
+
+	sort.Slice(r.arrival, func(i, j int) bool { return r.arrival[i] < r.arrival[j] })
+	return r, nil
+}
+
+func runBench(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	rates := flag.String("rates", "2.4M", "comma separated sample rates to test")
+	buffers := flag.String("buffers", "0", "comma separated receive buffer sizes to test, 0 for the system default")
+	duration := flag.Duration("duration", 10*time.Second, "time streamed per test")
+	flag.CommandLine.Parse(args)
+
+	rateList, err := parseList(*rates)
+	if err != nil {
+		return fmt.Errorf("invalid -rates: %s", err)
+	}
+	bufferList, err := parseList(*buffers)
+	if err != nil {
+		return fmt.Errorf("invalid -buffers: %s", err)
+	}
+
+	const row = "%6s %8s %8s %8s %6s %8s %10s %10s %10s %9s\n"
+	fmt.Printf(row, "rate", "buffer", "MB/s", "expected", "gaps", "dropped", "p50", "p99", "max", "sustained")
+
+	var best uint32
+	var errs []error
+	for _, rate := range rateList {
+		for _, buffer := range bufferList {
+			r, err := benchRun(sdr.Flags, rate, int(buffer), *duration)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%d S/s, %d byte buffer: %s", rate, buffer, err))
+				continue
+			}
+
+			bufName := "default"
+			if buffer > 0 {
+				bufName = formatSI(float64(buffer))
+			}
+			fmt.Printf(row, formatSI(float64(rate)), bufName,
+				fmt.Sprintf("%.2f", r.throughput()/1e6), fmt.Sprintf("%.2f", 2*float64(rate)/1e6),
+				fmt.Sprint(r.counter.gaps), fmt.Sprint(r.counter.dropped),
+				r.percentile(0.5).Round(time.Microsecond), r.percentile(0.99).Round(time.Microsecond),
+				r.percentile(1).Round(time.Microsecond), fmt.Sprint(r.sustained()),
+			)
+
+			if r.sustained() && rate > best {
+				best = rate
+			}
+		}
+	}
+
+	if best > 0 {
+		fmt.Printf("Highest sustained sample rate: %sS/s\n", formatSI(float64(best)))
+	} else if len(errs) == 0 {
+		fmt.Println("No tested sample rate was sustained.")
+	}
+	return errors.Join(errs...)
+}
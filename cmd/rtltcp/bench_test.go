@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounterCheck(t *testing.T) {
+	// A counter losing 3 bytes after 99, and 4 across its wrap.
+	var stream []byte
+	for _, run := range [][2]int{{0, 100}, {103, 256 + 254}, {256 + 258, 256 + 300}} {
+		for i := run[0]; i < run[1]; i++ {
+			stream = append(stream, byte(i))
+		}
+	}
+
+	// Checked in pieces, gaps falling within and between them.
+	var c counterCheck
+	for _, n := range []int{1, 99, 7, 300, 1000} {
+		n = min(n, len(stream))
+		c.check(stream[:n])
+		stream = stream[n:]
+	}
+	if c.gaps != 2 || c.dropped != 7 {
+		t.Errorf("%d gaps dropping %d bytes, want 2 dropping 7", c.gaps, c.dropped)
+	}
+
+	r := benchResult{rate: 1e6, bytes: 2e6, elapsed: time.Second, counter: c}
+	if r.sustained() {
+		t.Error("sustained despite gaps")
+	}
+	r.counter = counterCheck{}
+	if !r.sustained() {
+		t.Error("not sustained at the full rate")
+	}
+}
+
+func TestBenchPercentile(t *testing.T) {
+	var r benchResult
+	if p := r.percentile(0.5); p != 0 {
+		t.Errorf("percentile of no blocks %s", p)
+	}
+	for i := 1; i <= 100; i++ {
+		r.arrival = append(r.arrival, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{0: time.Millisecond, 0.5: 50 * time.Millisecond, 0.99: 99 * time.Millisecond, 1: 100 * time.Millisecond} {
+		if got := r.percentile(p); got != want {
+			t.Errorf("p%g %s, want %s", 100*p, got, want)
+		}
+	}
+}
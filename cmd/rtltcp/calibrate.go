@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+func runCalibrate(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	gain := flag.String("gain", "", "tuner gain in dB to measure at and store as preferred")
+	samples := flag.Int("samples", 1<<20, "samples the IQ balance is measured over")
+	flag.CommandLine.Parse(args)
+
+	if sdr.Flags.Calibration == "" {
+		path, err := rtltcp.DefaultCalibrationPath()
+		if err != nil {
+			return err
+		}
+		sdr.Flags.Calibration = path
+	}
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return err
+	}
+
+	// Raw samples, ReadIQ would correct the balance stored already. The
+	// first block predates the settings.
+	buf := make([]byte, 2**samples)
+	if _, err := sdr.ReadBlock(buf[:rtltcp.DefaultBufferDepth]); err != nil {
+		return fmt.Errorf("Error reading samples: %s", err)
+	}
+	blk, err := sdr.ReadBlock(buf)
+	if err != nil {
+		return fmt.Errorf("Error reading samples: %s", err)
+	}
+
+	c := sdr.Calibration()
+	c.Balance = dsp.MeasureIQBalance(dsp.ConvertU8(nil, blk.Samples))
+	if sdr.Flags.FreqCorrection != 0 {
+		c.PPM = sdr.Flags.FreqCorrection
+	}
+	if db, err := strconv.ParseFloat(*gain, 64); err == nil {
+		c.Gain = db
+	}
+	if err := sdr.SaveCalibration(c); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d ppm, gain %.1f dB, IQ gain %+.4f, phase %+.4f rad, saved to %s\n",
+		sdr.CalibrationKey(), c.PPM, c.Gain, c.Balance.Gain, c.Balance.Phase, sdr.Flags.Calibration)
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/bemasher/rtltcp/scan"
+)
+
+// Renders rtl_power CSV, as written by the scan command, as a PNG heatmap.
+func runHeatmap(args []string) error {
+	in := flag.String("i", "-", "rtl_power CSV input file")
+	out := flag.String("o", "", "PNG output file")
+	flag.CommandLine.Parse(args)
+
+	if *out == "" {
+		return errors.New("-o is required")
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return fmt.Errorf("Error opening input: %s", err)
+		}
+		defer file.Close()
+		r = file
+	}
+	rows, err := scan.ReadCSV(r)
+	if err != nil {
+		return fmt.Errorf("Error reading CSV: %s", err)
+	}
+	if len(rows) == 0 {
+		return errors.New("no rows to render")
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("Error creating output: %s", err)
+	}
+	defer file.Close()
+	bw := bufio.NewWriter(file)
+	if err := png.Encode(bw, scan.Plot(scan.Sweeps(rows))); err != nil {
+		return fmt.Errorf("Error writing heatmap: %s", err)
+	}
+	return bw.Flush()
+}
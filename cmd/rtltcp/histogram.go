@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Columns of the widest bar drawn by runHistogram.
+const histogramWidth = 60
+
+func runHistogram(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	duration := flag.Duration("duration", time.Second, "time samples are counted for")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	flag.CommandLine.Parse(args)
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return err
+	}
+
+	var h rtltcp.Histogram
+	buf := make([]byte, sdr.ReadBlockSize())
+	for start := time.Now(); time.Since(start) < *duration; {
+		blk, err := sdr.ReadBlock(buf)
+		if err != nil {
+			return fmt.Errorf("Error reading samples: %s", err)
+		}
+		h.Add(blk.Samples)
+	}
+
+	// Bins of 8 codes, I and Q summed.
+	var bins [32]uint64
+	var peak uint64
+	for v := range h.I {
+		bins[v/8] += h.I[v] + h.Q[v]
+		peak = max(peak, bins[v/8])
+	}
+	for i, c := range bins {
+		fmt.Printf("%3d-%3d %s\n", 8*i, 8*i+7, strings.Repeat("#", int(c*histogramWidth/max(peak, 1))))
+	}
+
+	d := h.Diagnose()
+	fmt.Printf("%d samples, offset %+.1f I %+.1f Q, RMS %.1f, clipped %.3f%%\n",
+		d.Samples, d.OffsetI, d.OffsetQ, d.RMS, 100*d.Clipped)
+	if len(d.Problems) == 0 {
+		fmt.Println("No problems found.")
+	}
+	for _, p := range d.Problems {
+		fmt.Println(p)
+	}
+	return nil
+}
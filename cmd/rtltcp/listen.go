@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/audio"
+	"github.com/bemasher/rtltcp/demod"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Demodulates a channel and plays it, or writes it as raw PCM.
+func runListen(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	mode := flag.String("mode", "fm", "demodulation: fm, wfm, am, usb or lsb")
+	offset := flag.Float64("offset", 0, "channel frequency relative to -centerfreq in Hz")
+	bandwidth := flag.Float64("bandwidth", 0, "channel bandwidth in Hz, by mode if zero")
+	deemphasis := flag.Duration("deemphasis", demod.DeemphasisEurope, "wfm deemphasis time constant, 75us in the Americas")
+	audioRate := flag.Int("audiorate", demod.DefaultAudioRate, "audio sample rate")
+	out := flag.String("o", "", "raw PCM output file, - for stdout, the audio device if empty")
+	format := flag.String("format", "s16", "raw PCM format, s16 or f32")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	flag.CommandLine.Parse(args)
+
+	if *bandwidth == 0 {
+		*bandwidth = demod.Bandwidths[*mode]
+	}
+	pcmFormat, err := audio.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return err
+	}
+	rate := int(sdr.Metadata().SampleRate)
+	if rate == 0 {
+		return fmt.Errorf("-samplerate is required")
+	}
+
+	// Decimate to the narrowest rate still holding the channel and the
+	// audio, resampling the rest of the way.
+	decim := max(1, int(float64(rate)/max(*bandwidth, float64(*audioRate))))
+	chanRate := float64(rate) / float64(decim)
+	ddc := dsp.NewDDC(*offset, float64(rate), decim)
+	dem, level, err := demod.New(*mode, chanRate, *bandwidth, *deemphasis)
+	if err != nil {
+		return err
+	}
+	resampler := dsp.NewResampler(rate, *audioRate*decim)
+	agc := dsp.NewAGC[float32](dsp.AGCConfig{}, float64(*audioRate))
+
+	var sink audio.Sink
+	switch *out {
+	case "":
+		if sink, err = audio.NewPlayer(*audioRate, 0); err != nil {
+			return err
+		}
+	case "-":
+		sink = audio.NewPCM(os.Stdout, pcmFormat)
+	default:
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		sink = audio.NewPCM(f, pcmFormat)
+	}
+	defer sink.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var (
+		iq        = make([]complex64, rate/20)
+		channel   []complex64
+		demodded  []float32
+		resampled []float32
+	)
+	for ctx.Err() == nil {
+		n, err := sdr.ReadIQInto(iq)
+		if err != nil {
+			return fmt.Errorf("Error reading samples: %s", err)
+		}
+		channel = ddc.Process(channel[:0], iq[:n])
+		demodded = dem.Process(demodded[:0], channel)
+		resampled = resampler.Process(resampled[:0], demodded)
+		if level {
+			resampled = agc.Process(resampled[:0], resampled)
+		}
+		if err := sink.WriteAudio(resampled); err != nil {
+			return fmt.Errorf("Error writing audio: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Command rtltcp controls, records and measures rtl_tcp servers.
+//
+// Usage:
+//
+//	rtltcp <command> [flags]
+//
+// Each command accepts the connection flags of the rtltcp package, such as
+// -server and -centerfreq, in addition to its own. Run a command with -help
+// for its flags. With -ssh the server is reached through an SSH server,
+// -server then giving its address as seen from there.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/si"
+	"github.com/bemasher/rtltcp/sshdial"
+)
+
+type command struct {
+	name, summary string
+	run           func(args []string) error
+}
+
+var commands = []command{
+	{"repl", "interactive control of a live connection", runREPL},
+	{"bench", "measure link throughput and loss in test mode", runBench},
+	{"record", "record to raw, SigMF or WAV files", runRecord},
+	{"listen", "demodulate FM, AM or SSB and play it or write raw PCM", runListen},
+	{"modes", "receive Mode S and ADS-B frames, printed in AVR format", runModes},
+	{"aprs", "receive APRS packets on NBFM, printed in TNC2 format", runAPRS},
+	{"monitor", "report channel activity and squelch events, optionally over MQTT", runMonitor},
+	{"alert", "learn the spectrum and alert on new signals and missing carriers", runAlert},
+	{"scan", "sweep a frequency range, like rtl_power", runScan},
+	{"heatmap", "render rtl_power CSV as a PNG heatmap", runHeatmap},
+	{"settle", "measure the time retuning takes to reach the stream", runSettle},
+	{"profile", "list, show, save and delete device profiles applied with -profile", runProfile},
+	{"calibrate", "measure IQ balance and store it with the correction and gain per dongle", runCalibrate},
+	{"histogram", "count raw sample values and check for stuck bits, DC offset and clipping", runHistogram},
+	{"serve", "serve a local dongle over rtl_tcp in place of rtl_tcp, built with -tags rtlsdr", runServe},
+}
+
+// SSH options shared by every command.
+var sshFlags struct {
+	addr, key, knownHosts string
+}
+
+// Dialer through the SSH server, shared by every connection a command makes.
+var sshDialer rtltcp.Dialer
+
+func registerSSHFlags() {
+	flag.StringVar(&sshFlags.addr, "ssh", "", "connect through SSH server [user@]host[:port]")
+	flag.StringVar(&sshFlags.key, "sshkey", "", "private key file for -ssh, default keys and ssh-agent if empty")
+	flag.StringVar(&sshFlags.knownHosts, "sshknownhosts", "", "known_hosts file for -ssh, ~/.ssh/known_hosts if empty")
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: rtltcp <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+}
+
+func main() {
+	log.SetFlags(log.Lshortfile)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+
+		// The rtltcp package registers its flags on the default set.
+		flag.CommandLine = flag.NewFlagSet("rtltcp "+c.name, flag.ExitOnError)
+		registerSSHFlags()
+		if err := c.run(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+// Connects to the server and applies the connection flags, which must
+// already be parsed.
+func connect(sdr *rtltcp.SDR) error {
+	if sshFlags.addr != "" && sshDialer == nil {
+		cfg := sshdial.Config{Addr: sshFlags.addr, KnownHosts: sshFlags.knownHosts}
+		if sshFlags.key != "" {
+			cfg.KeyFiles = []string{sshFlags.key}
+		}
+		client, err := sshdial.Dial(cfg)
+		if err != nil {
+			return err
+		}
+		sshDialer = client
+	}
+	if sdr.Dialer == nil {
+		sdr.Dialer = sshDialer
+	}
+
+	if err := sdr.Connect(nil); err != nil {
+		return err
+	}
+	if err := sdr.HandleFlags(); err != nil {
+		sdr.Close()
+		return fmt.Errorf("Error applying flags: %s", err)
+	}
+	return nil
+}
+
+// Applies a gain given as dB or "auto", leaving the gain unchanged if empty.
+func setGain(sdr *rtltcp.SDR, gain string) error {
+	switch gain {
+	case "":
+		return nil
+	case "auto":
+		return sdr.SetTunerAGC(true)
+	}
+
+	db, err := strconv.ParseFloat(gain, 64)
+	if err != nil {
+		return fmt.Errorf("invalid gain: %s", gain)
+	}
+	return sdr.SetGainDB(db)
+}
+
+// Parses a frequency or rate with an optional SI suffix, e.g. 433.92M.
+func parseSI(arg string) (uint32, error) {
+	var v si.ScientificNotation
+	if err := v.Set(arg); err != nil {
+		return 0, err
+	}
+	if v < 0 || v > 1<<32-1 {
+		return 0, fmt.Errorf("%s out of range", arg)
+	}
+	return uint32(v), nil
+}
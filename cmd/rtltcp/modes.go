@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/modes"
+)
+
+// Receives Mode S frames and prints them in AVR format, one per line, for
+// tools reading dump1090's raw output.
+func runModes(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	// Tuned to 1090 MHz at 2 MS/s unless told otherwise.
+	flag.Set("centerfreq", "1090M")
+	flag.Set("samplerate", "2M")
+	flag.Lookup("centerfreq").DefValue = "1090M"
+	flag.Lookup("samplerate").DefValue = "2M"
+	all := flag.Bool("all", false, "also print frames whose parity is overlaid with the address, unchecked")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	flag.CommandLine.Parse(args)
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return err
+	}
+	if rate := sdr.Metadata().SampleRate; rate != modes.SampleRate {
+		return fmt.Errorf("sample rate %d Hz, Mode S needs %d Hz", rate, modes.SampleRate)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	d := modes.NewDecoder()
+	d.AddressParity = *all
+	for f := range modes.Frames(ctx, sdr.PooledBlocks(ctx, 0), d) {
+		fmt.Printf("*%s;\n", f)
+	}
+	if err := sdr.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("Error reading samples: %s", err)
+	}
+	return nil
+}
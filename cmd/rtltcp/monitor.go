@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/influx"
+	"github.com/bemasher/rtltcp/monitor"
+	"github.com/bemasher/rtltcp/mqtt"
+)
+
+// Device status published by runMonitor.
+type monitorStatus struct {
+	Time       time.Time `json:"time"`
+	CenterFreq uint32    `json:"center_freq"`
+	SampleRate uint32    `json:"sample_rate"`
+	AutoGain   bool      `json:"auto_gain"`
+	Gain       float64   `json:"gain"` // dB.
+	Lost       uint64    `json:"lost"` // Samples dropped since connecting.
+}
+
+// Parses channels given as name=freq[:bandwidth], comma separated.
+func parseChannels(arg string, squelch float64) (channels []monitor.Channel, err error) {
+	for _, field := range strings.Split(arg, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid channel %q, want name=freq[:bandwidth]", field)
+		}
+		freq, bw, _ := strings.Cut(spec, ":")
+		c := monitor.Channel{Name: name, Bandwidth: 12500, Squelch: squelch}
+		if c.Freq, err = parseSI(freq); err != nil {
+			return nil, err
+		}
+		if bw != "" {
+			if c.Bandwidth, err = parseSI(bw); err != nil {
+				return nil, err
+			}
+		}
+		channels = append(channels, c)
+	}
+	return channels, nil
+}
+
+// Monitors channels for activity, printing reports and squelch events,
+// optionally publishing them with the device's status over MQTT and
+// exporting reports as InfluxDB line protocol.
+func runMonitor(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	channelList := flag.String("channels", "", "channels as name=freq[:bandwidth], comma separated")
+	squelch := flag.Float64("squelch", monitor.DefaultSquelch, "SNR in dB opening a channel's squelch")
+	interval := flag.Duration("interval", monitor.DefaultInterval, "time between channel reports")
+	broker := flag.String("mqtt", "", "MQTT broker address to publish to")
+	user := flag.String("mqttuser", "", "MQTT user name")
+	pass := flag.String("mqttpass", "", "MQTT password")
+	prefix := flag.String("topic", mqtt.DefaultPrefix, "MQTT topic prefix")
+	device := flag.String("device", "", "MQTT topic level and InfluxDB tag of this device, by serial or server address if empty")
+	influxURL := flag.String("influx", "", "InfluxDB write URL, or file to write line protocol to, - for stdout")
+	influxToken := flag.String("influxtoken", "", "InfluxDB API token")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	flag.CommandLine.Parse(args)
+
+	if *channelList == "" {
+		return fmt.Errorf("-channels is required")
+	}
+	channels, err := parseChannels(*channelList, *squelch)
+	if err != nil {
+		return err
+	}
+	m, err := monitor.New(monitor.Config{Channels: channels, Interval: *interval})
+	if err != nil {
+		return err
+	}
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return err
+	}
+
+	if *device == "" {
+		*device = strings.TrimPrefix(sdr.CalibrationKey(), "serial:")
+	}
+
+	var pub *mqtt.Publisher
+	if *broker != "" {
+		opts := mqtt.Options{ClientID: "rtltcp-" + mqtt.Level(*device), Username: *user, Password: *pass}
+		if pub, err = mqtt.NewPublisher(*broker, opts, *prefix, *device); err != nil {
+			return err
+		}
+		defer pub.Close()
+	}
+
+	var exporter *influx.Exporter
+	switch {
+	case *influxURL == "":
+	case strings.HasPrefix(*influxURL, "http://"), strings.HasPrefix(*influxURL, "https://"):
+		exporter = influx.NewHTTPExporter(*influxURL, *influxToken)
+	case *influxURL == "-":
+		exporter = influx.NewExporter(os.Stdout)
+	default:
+		f, err := os.OpenFile(*influxURL, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		exporter = influx.NewExporter(f)
+	}
+	if exporter != nil {
+		exporter.Tags = map[string]string{"device": *device}
+	}
+
+	// Reports of an interval, exported together once the block completing
+	// it has been measured.
+	var reports []monitor.Report
+	export := func() {
+		if exporter != nil && len(reports) > 0 {
+			if err := exporter.ExportReports(reports...); err != nil {
+				log.Print(err)
+			}
+		}
+		reports = reports[:0]
+	}
+
+	m.OnEvent = func(e monitor.Event) {
+		state := "closed"
+		if e.Open {
+			state = "open"
+		}
+		log.Printf("%s %.3f MHz %s, %.1f dBFS, SNR %.1f dB", e.Channel, float64(e.Freq)/1e6, state, e.Power, e.SNR)
+		if pub != nil {
+			if err := pub.Event(e); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+	m.OnReport = func(r monitor.Report) {
+		reports = append(reports, r)
+		if r.Measurements == 0 {
+			log.Printf("%s %.3f MHz outside the stream", r.Channel, float64(r.Freq)/1e6)
+			return
+		}
+		log.Printf("%s %.3f MHz %.1f dBFS, peak %.1f dBFS, SNR %.1f dB, occupancy %.1f%%, %d openings",
+			r.Channel, float64(r.Freq)/1e6, r.Power, r.Peak, r.SNR, 100*r.Occupancy, r.Openings)
+		if pub == nil {
+			return
+		}
+		if err := pub.Report(r); err != nil {
+			log.Print(err)
+		}
+		md := sdr.Metadata()
+		status := monitorStatus{
+			Time:       r.Time,
+			CenterFreq: md.CenterFreq,
+			SampleRate: md.SampleRate,
+			AutoGain:   md.AutoGain,
+			Gain:       float64(md.Gain) / 10,
+			Lost:       sdr.Lost(),
+		}
+		if err := pub.Status(status); err != nil {
+			log.Print(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	buf := make([]byte, sdr.ReadBlockSize())
+	for ctx.Err() == nil {
+		blk, err := sdr.ReadBlock(buf)
+		if err != nil {
+			return fmt.Errorf("Error reading samples: %s", err)
+		}
+		m.WriteBlock(blk)
+		export()
+	}
+	err = m.Close()
+	export()
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bemasher/rtltcp"
+)
+
+const profileUsage = "profile [flags] list | show <name> | save <name> | delete <name>"
+
+// Manages stored profiles. save records the device flags given, such as
+// -centerfreq and -tunergain, under the name.
+func runProfile(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	flag.CommandLine.Parse(args)
+
+	path := filepath.Join(filepath.Dir(sdr.Flags.Calibration), "profiles.json")
+	if sdr.Flags.Calibration == "" {
+		var err error
+		if path, err = rtltcp.DefaultProfilePath(); err != nil {
+			return err
+		}
+	}
+	store, err := rtltcp.OpenProfiles(path)
+	if err != nil {
+		return err
+	}
+
+	cmd, name := flag.Arg(0), flag.Arg(1)
+	if cmd != "list" && (name == "" || flag.NArg() > 2) || cmd == "list" && flag.NArg() > 1 {
+		return errors.New("usage: " + profileUsage)
+	}
+	switch cmd {
+	case "list":
+		for _, name := range store.Names() {
+			fmt.Println(name)
+		}
+	case "show":
+		p, ok := store.Get(name)
+		if !ok {
+			return fmt.Errorf("unknown profile %q", name)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(p)
+	case "save":
+		p := rtltcp.Profile{
+			CenterFreq:      uint32(sdr.Flags.CenterFreq),
+			SampleRate:      uint32(sdr.Flags.SampleRate),
+			AutoGain:        sdr.Flags.TunerGainMode,
+			Gain:            sdr.Flags.TunerGain,
+			PPM:             sdr.Flags.FreqCorrection,
+			AGC:             sdr.Flags.AgcMode,
+			DirectSampling:  sdr.Flags.DirectSampling,
+			OffsetTuning:    sdr.Flags.OffsetTuning,
+			ConverterOffset: int64(sdr.Flags.ConverterOffset),
+		}
+		return store.Put(name, p)
+	case "delete":
+		return store.Delete(name)
+	default:
+		return errors.New("usage: " + profileUsage)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/record"
+	"github.com/bemasher/rtltcp/si"
+)
+
+// Parses a start time, either RFC 3339 or a local time of day of the form
+// 15:04 referring to its next occurrence.
+func parseStart(arg string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, arg); err == nil {
+		return t, nil
+	}
+
+	clock, err := time.ParseInLocation("15:04", arg, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start time %q, want RFC 3339 or 15:04", arg)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if t.Before(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func runRecord(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	out := flag.String("o", "", "output file")
+	format := flag.String("format", "", "output format, raw, sigmf or wav, taken from the extension of -o if empty")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	duration := flag.Duration("duration", 0, "sample time per recording, 0 for no limit")
+	var size si.ScientificNotation
+	flag.Var(&size, "size", "bytes per recording, e.g. 100M, 0 for no limit")
+	trigger := flag.Float64("trigger", 0, "record only bursts above this level in dBFS, 0 to record continuously")
+	pretrigger := flag.Duration("pretrigger", 100*time.Millisecond, "signal kept from before each burst")
+	hold := flag.Duration("hold", time.Second, "quiet time ending each burst")
+	at := flag.String("at", "", "start time, RFC 3339 or 15:04 for its next occurrence")
+	repeat := flag.Duration("repeat", 0, "interval between the starts of repeated recordings, 0 to record once")
+	flag.CommandLine.Parse(args)
+
+	if *out == "" {
+		return errors.New("-o is required")
+	}
+	if *repeat > 0 && *duration == 0 && size == 0 {
+		return errors.New("-repeat requires -duration or -size")
+	}
+
+	next := time.Now()
+	if *at != "" {
+		var err error
+		if next, err = parseStart(*at, next); err != nil {
+			return err
+		}
+	}
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return fmt.Errorf("Error setting gain: %s", err)
+	}
+
+	// Names a recording starting at t, stamped if there may be several.
+	name := func(t time.Time) string {
+		if *repeat > 0 || *trigger != 0 {
+			return stampPath(*out, t)
+		}
+		return *out
+	}
+	open := func(blk rtltcp.Block) (rtltcp.Sink, error) {
+		path := name(blk.Timestamp)
+		log.Printf("Recording %s", path)
+		return createSink(*format, path)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if !next.Before(time.Now()) {
+		log.Printf("Waiting until %s", next.Format(time.RFC3339))
+	}
+
+	var (
+		sink    rtltcp.Sink
+		written int64
+		limit   = int64(size) &^ 1 // Whole IQ pairs.
+		buf     = make([]byte, sdr.ReadBlockSize())
+	)
+	defer func() {
+		if sink != nil {
+			sink.Close()
+		}
+	}()
+
+	if *duration > 0 {
+		if rate := sdr.Metadata().SampleRate; rate == 0 {
+			return errors.New("-duration requires -samplerate")
+		} else if n := 2 * int64(duration.Seconds()*float64(rate)); limit == 0 || n < limit {
+			limit = n
+		}
+	}
+
+	for ctx.Err() == nil {
+		blk, err := sdr.ReadBlock(buf)
+		if err != nil {
+			return fmt.Errorf("Error reading samples: %s", err)
+		}
+
+		// Samples are discarded while waiting so recordings start fresh.
+		if sink == nil {
+			if blk.Timestamp.Before(next) {
+				continue
+			}
+			if *trigger != 0 {
+				sink = &record.Trigger{
+					Threshold:  *trigger,
+					PreTrigger: *pretrigger,
+					Hold:       *hold,
+					NewSink:    open,
+				}
+			} else if sink, err = open(blk); err != nil {
+				return err
+			}
+			written = 0
+		}
+
+		if limit > 0 && written+int64(len(blk.Samples)) > limit {
+			blk.Samples = blk.Samples[:limit-written]
+		}
+		if err := sink.WriteBlock(blk); err != nil {
+			return fmt.Errorf("Error recording: %s", err)
+		}
+		written += int64(len(blk.Samples))
+
+		if limit > 0 && written == limit {
+			err := sink.Close()
+			sink = nil
+			if err != nil {
+				return fmt.Errorf("Error closing recording: %s", err)
+			}
+			if *repeat == 0 {
+				return nil
+			}
+
+			// Skip starts missed while recording overran the interval.
+			for !next.After(blk.Timestamp) {
+				next = next.Add(*repeat)
+			}
+			log.Printf("Next recording at %s", next.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
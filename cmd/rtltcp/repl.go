@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/record"
+	"github.com/bemasher/rtltcp/si"
+)
+
+type replCommand struct {
+	name, args, help string
+	run              func(r *repl, args []string) error
+}
+
+var replCommands []replCommand
+
+func init() {
+	// Assigned in init since help refers to the table itself.
+	replCommands = []replCommand{
+		{"freq", "<Hz>", "set the center frequency, e.g. freq 433.92M", (*repl).freq},
+		{"rate", "<Hz>", "set the sample rate, e.g. rate 2.4M", (*repl).rate},
+		{"gain", "<dB>|auto", "set a manual tuner gain or enable tuner AGC", (*repl).gain},
+		{"ppm", "<ppm>", "set the frequency correction", (*repl).ppm},
+		{"agc", "on|off", "enable or disable the RTL2832 AGC", (*repl).agc},
+		{"rec", "<duration> <file>", "record to a .wav, .sigmf or raw IQ file, e.g. rec 10s out.iq", (*repl).rec},
+		{"stop", "", "stop recording", (*repl).stop},
+		{"stats", "", "show stream statistics", (*repl).stats},
+		{"info", "", "show dongle information and settings", (*repl).info},
+		{"save", "", "store the frequency correction and gain as the dongle's calibration, see -calibration", (*repl).save},
+		{"help", "", "list commands", (*repl).help},
+		{"quit", "", "close the connection and exit", nil},
+	}
+}
+
+// State of an interactive session.
+type repl struct {
+	sdr *rtltcp.SDR
+	out io.Writer
+
+	mu         sync.Mutex
+	blocks     uint64
+	bytes      uint64
+	power      float64 // Mean power of the last block in dBFS.
+	throughput float64 // Measured throughput in complex samples per second.
+	sink       rtltcp.Sink
+	recPath    string
+	recLeft    int64 // Bytes left to record.
+	correction int   // Frequency correction set in ppm.
+	err        error
+
+	sessionPath string // File the session is saved to, none if empty.
+	lastSave    time.Time
+	saveMu      sync.Mutex // Serializes writes of the session file.
+}
+
+func runREPL(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	sessionPath := flag.String("session", "", "file the session is saved to, in the configuration directory if empty, \"none\" to disable")
+	resume := flag.Bool("resume", false, "restore the server, settings and recording of the last session")
+
+	flag.CommandLine.Parse(args)
+	if *sessionPath == "" {
+		// Sessions just aren't saved without a configuration directory.
+		*sessionPath, _ = defaultSessionPath()
+	} else if *sessionPath == "none" {
+		*sessionPath = ""
+	}
+
+	var last session
+	if *resume {
+		var err error
+		if last, err = loadSession(*sessionPath); err != nil {
+			return err
+		}
+		serverSet := false
+		flag.Visit(func(f *flag.Flag) { serverSet = serverSet || f.Name == "server" })
+		if !serverSet {
+			sdr.Flags.ServerAddr = last.Server
+		}
+	}
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if *resume {
+		if err := sdr.Apply(last.Settings); err != nil {
+			return fmt.Errorf("Error restoring session: %s", err)
+		}
+	}
+
+	r := &repl{sdr: &sdr, out: os.Stdout, correction: sdr.Calibration().PPM, sessionPath: *sessionPath}
+	if sdr.Flags.FreqCorrection != 0 {
+		r.correction = sdr.Flags.FreqCorrection
+	}
+	if *resume {
+		if last.Settings.PPM != 0 {
+			r.correction = last.Settings.PPM
+		}
+		// The interrupted file can't be appended to, the rest goes to a
+		// new one beside it.
+		if rec := last.Recording; rec != nil && rec.Left > 0 {
+			if err := r.record(stampPath(rec.Path, time.Now()), rec.Left); err != nil {
+				return fmt.Errorf("Error resuming recording: %s", err)
+			}
+		}
+	}
+	r.saveSession()
+
+	var readLine func() (string, error)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("Error configuring terminal: %s", err)
+		}
+		defer term.Restore(fd, state)
+
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}, "")
+		t.AutoCompleteCallback = complete
+		r.out = t
+		readLine = func() (string, error) {
+			t.SetPrompt(r.prompt())
+			return t.ReadLine()
+		}
+	} else {
+		// Share one reader so buffered input isn't lost between lines.
+		in := bufio.NewReader(os.Stdin)
+		readLine = func() (string, error) {
+			fmt.Fprint(r.out, r.prompt())
+			return in.ReadString('\n')
+		}
+	}
+
+	go r.read()
+	// Quitting ends the recording, so resuming doesn't restart it.
+	defer r.saveSession()
+	defer r.stop(nil)
+
+	fmt.Fprintf(r.out, "Connected to %s, %s tuner. Type help for commands.\n", sdr.Flags.ServerAddr, sdr.Info.Tuner)
+
+	for {
+		line, err := readLine()
+		if errors.Is(err, io.EOF) && line == "" {
+			return nil
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return nil
+		}
+
+		cmd, ok := lookup(fields[0])
+		if !ok {
+			fmt.Fprintf(r.out, "unknown command %q, type help for commands\n", fields[0])
+			continue
+		}
+		if err := cmd.run(r, fields[1:]); err != nil {
+			fmt.Fprintln(r.out, err)
+		}
+		r.saveSession()
+
+		if err := r.streamErr(); err != nil {
+			return fmt.Errorf("Error reading samples: %s", err)
+		}
+	}
+}
+
+func lookup(name string) (replCommand, bool) {
+	for _, c := range replCommands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return replCommand{}, false
+}
+
+// Completes command names on tab, to the longest prefix shared by all
+// matches.
+func complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || strings.ContainsRune(line[:pos], ' ') {
+		return "", 0, false
+	}
+
+	var matches []string
+	for _, c := range replCommands {
+		if strings.HasPrefix(c.name, line[:pos]) {
+			matches = append(matches, c.name)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(matches) == 1 {
+		prefix += " "
+	}
+	return prefix + line[pos:], len(prefix), true
+}
+
+// Reads blocks until the connection fails, updating statistics and feeding
+// the active recording.
+func (r *repl) read() {
+	var (
+		windowStart = time.Now()
+		windowBytes uint64
+	)
+
+	for blk := range r.sdr.PooledBlocks(context.Background(), 0) {
+		power := record.MeanPower(blk)
+
+		r.mu.Lock()
+		r.blocks++
+		r.bytes += uint64(len(blk.Samples))
+		r.power = power
+
+		windowBytes += uint64(len(blk.Samples))
+		if elapsed := time.Since(windowStart); elapsed >= time.Second {
+			r.throughput = float64(windowBytes/2) / elapsed.Seconds()
+			windowStart, windowBytes = time.Now(), 0
+		}
+
+		if r.sink != nil {
+			if int64(len(blk.Samples)) > r.recLeft {
+				blk.Samples = blk.Samples[:r.recLeft]
+			}
+			err := r.sink.WriteBlock(blk)
+			r.recLeft -= int64(len(blk.Samples))
+			if err != nil || r.recLeft == 0 {
+				r.finish(err)
+			}
+		}
+		save := time.Since(r.lastSave) >= sessionSaveInterval
+		r.mu.Unlock()
+		blk.Release()
+
+		if save {
+			r.saveSession()
+		}
+	}
+
+	r.mu.Lock()
+	r.err = r.sdr.Err()
+	r.finish(r.err)
+	r.mu.Unlock()
+}
+
+func (r *repl) streamErr() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Closes the active recording and reports its outcome. The caller must hold
+// the lock.
+func (r *repl) finish(cause error) {
+	if r.sink == nil {
+		return
+	}
+
+	err := r.sink.Close()
+	if cause != nil {
+		err = cause
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "recording %s failed: %s\n", r.recPath, err)
+	} else {
+		fmt.Fprintf(r.out, "recorded %s\n", r.recPath)
+	}
+	r.sink, r.recPath = nil, ""
+}
+
+// Returns the prompt, summarizing the current settings and stream.
+func (r *repl) prompt() string {
+	md := r.sdr.Metadata()
+
+	gain := "auto"
+	if !md.AutoGain {
+		gain = fmt.Sprintf("%.1fdB", float64(md.Gain)/10)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := fmt.Sprintf("[%sHz %sS/s %s | %sS/s %.1fdBFS", formatSI(float64(md.CenterFreq)),
+		formatSI(float64(md.SampleRate)), gain, formatSI(r.throughput), r.power)
+	if r.sink != nil && md.SampleRate != 0 {
+		left := time.Duration(float64(r.recLeft/2) / float64(md.SampleRate) * float64(time.Second))
+		p += fmt.Sprintf(" | rec %s", left.Round(time.Second))
+	}
+	return p + "] > "
+}
+
+// Formats v with an SI prefix, e.g. 433.92M.
+func formatSI(v float64) string {
+	prefixes := []struct {
+		scale  float64
+		prefix string
+	}{{si.G, "G"}, {si.M, "M"}, {1e3, "k"}}
+
+	for _, p := range prefixes {
+		if v >= p.scale {
+			return strconv.FormatFloat(math.Round(v/p.scale*1e3)/1e3, 'f', -1, 64) + p.prefix
+		}
+	}
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
+
+func oneArg(args []string, usage string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: %s", usage)
+	}
+	return args[0], nil
+}
+
+func (r *repl) freq(args []string) error {
+	arg, err := oneArg(args, "freq <Hz>")
+	if err != nil {
+		return err
+	}
+	freq, err := parseSI(arg)
+	if err != nil {
+		return err
+	}
+	return r.sdr.SetCenterFreq(freq)
+}
+
+func (r *repl) rate(args []string) error {
+	arg, err := oneArg(args, "rate <Hz>")
+	if err != nil {
+		return err
+	}
+	rate, err := parseSI(arg)
+	if err != nil {
+		return err
+	}
+	return r.sdr.SetSampleRate(rate)
+}
+
+func (r *repl) gain(args []string) error {
+	arg, err := oneArg(args, "gain <dB>|auto")
+	if err != nil {
+		return err
+	}
+	return setGain(r.sdr, arg)
+}
+
+func (r *repl) ppm(args []string) error {
+	arg, err := oneArg(args, "ppm <ppm>")
+	if err != nil {
+		return err
+	}
+	ppm, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("invalid correction: %s", arg)
+	}
+	if err := r.sdr.SetFreqCorrection(uint32(ppm)); err != nil {
+		return err
+	}
+	r.correction = ppm
+	return nil
+}
+
+func (r *repl) save([]string) error {
+	c := r.sdr.Calibration()
+	c.PPM, c.Gain = r.correction, 0
+	if md := r.sdr.Metadata(); !md.AutoGain {
+		c.Gain = float64(int32(md.Gain)) / 10
+	}
+	if err := r.sdr.SaveCalibration(c); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "saved calibration of %s\n", r.sdr.CalibrationKey())
+	return nil
+}
+
+func (r *repl) agc(args []string) error {
+	arg, err := oneArg(args, "agc on|off")
+	if err != nil {
+		return err
+	}
+	switch arg {
+	case "on":
+		return r.sdr.SetAGCMode(true)
+	case "off":
+		return r.sdr.SetAGCMode(false)
+	}
+	return errors.New("usage: agc on|off")
+}
+
+func (r *repl) rec(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: rec <duration> <file>")
+	}
+	dur, err := time.ParseDuration(args[0])
+	if err != nil || dur <= 0 {
+		return fmt.Errorf("invalid duration: %s", args[0])
+	}
+
+	rate := r.sdr.Metadata().SampleRate
+	if rate == 0 {
+		return errors.New("set the sample rate before recording")
+	}
+
+	return r.record(args[1], 2*int64(dur.Seconds()*float64(rate)))
+}
+
+// Records the next n bytes to path, replacing any active recording.
+func (r *repl) record(path string, n int64) error {
+	sink, err := createSink("", path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finish(nil)
+	r.sink, r.recPath, r.recLeft = sink, path, n
+	if rate := r.sdr.Metadata().SampleRate; rate != 0 {
+		dur := time.Duration(float64(n/2) / float64(rate) * float64(time.Second))
+		fmt.Fprintf(r.out, "recording %s to %s\n", dur.Round(time.Millisecond), path)
+	}
+	return nil
+}
+
+// Saves the server, settings and recording progress for -resume. Failures
+// are reported once, so a read-only configuration directory doesn't flood
+// the terminal.
+func (r *repl) saveSession() {
+	md := r.sdr.Metadata()
+	s := session{
+		Server: r.sdr.Flags.ServerAddr,
+		Settings: rtltcp.Profile{
+			CenterFreq:      md.CenterFreq,
+			SampleRate:      md.SampleRate,
+			AutoGain:        md.AutoGain,
+			Gain:            float64(int32(md.Gain)) / 10,
+			PPM:             r.correction,
+			ConverterOffset: r.sdr.ConverterOffset,
+		},
+	}
+
+	r.mu.Lock()
+	path := r.sessionPath
+	if r.sink != nil {
+		s.Recording = &sessionRecording{Path: r.recPath, Left: r.recLeft}
+	}
+	r.lastSave = time.Now()
+	r.mu.Unlock()
+	if path == "" {
+		return
+	}
+
+	r.saveMu.Lock()
+	err := saveSession(path, s)
+	r.saveMu.Unlock()
+	if err != nil {
+		r.mu.Lock()
+		if r.sessionPath != "" {
+			fmt.Fprintln(r.out, err)
+			r.sessionPath = ""
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *repl) stop([]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finish(nil)
+	return nil
+}
+
+func (r *repl) stats([]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.out, "blocks: %d\nbytes: %d\nthroughput: %sS/s\npower: %.1f dBFS\n",
+		r.blocks, r.bytes, formatSI(r.throughput), r.power)
+	if r.sink != nil {
+		fmt.Fprintf(r.out, "recording: %s\n", r.recPath)
+	}
+	return nil
+}
+
+func (r *repl) info([]string) error {
+	md := r.sdr.Metadata()
+	fmt.Fprintf(r.out, "server: %s (%s)\ntuner: %s\n", r.sdr.Flags.ServerAddr, r.sdr.ServerType(), r.sdr.Info.Tuner)
+	gains := make([]string, 0, r.sdr.Info.GainCount)
+	for _, g := range r.sdr.Gains() {
+		gains = append(gains, fmt.Sprintf("%.1f", float64(g)/10))
+	}
+	fmt.Fprintf(r.out, "gains: %d (%s dB)\n", r.sdr.Info.GainCount, strings.Join(gains, " "))
+	fmt.Fprintf(r.out, "center frequency: %d Hz\nsample rate: %d Hz\n", md.CenterFreq, md.SampleRate)
+	if md.AutoGain {
+		fmt.Fprintln(r.out, "gain: auto")
+	} else {
+		fmt.Fprintf(r.out, "gain: %.1f dB\n", float64(int32(md.Gain))/10)
+	}
+	return nil
+}
+
+func (r *repl) help([]string) error {
+	names := make([]string, len(replCommands))
+	for i, c := range replCommands {
+		names[i] = strings.TrimSpace(c.name + " " + c.args)
+	}
+	width := 0
+	for _, n := range names {
+		if len(n) > width {
+			width = len(n)
+		}
+	}
+
+	for i, c := range replCommands {
+		fmt.Fprintf(r.out, "  %-*s  %s\n", width, names[i], c.help)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/scan"
+	"github.com/bemasher/rtltcp/si"
+)
+
+// Parses an rtl_power style range of the form lower:upper:bin.
+func parseRange(arg string) (cfg scan.Config, err error) {
+	parts := strings.Split(arg, ":")
+	if len(parts) != 3 {
+		return cfg, errors.New("range must be of the form lower:upper:bin, e.g. 88M:108M:10k")
+	}
+	if cfg.Start, err = parseSI(parts[0]); err != nil {
+		return
+	}
+	if cfg.Stop, err = parseSI(parts[1]); err != nil {
+		return
+	}
+
+	var bin si.ScientificNotation
+	if err = bin.Set(parts[2]); err != nil {
+		return
+	}
+	cfg.BinSize = float64(bin)
+
+	return
+}
+
+func runScan(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	rng := flag.String("range", "", "range to sweep as lower:upper:bin, e.g. 88M:108M:10k")
+	interval := flag.Duration("interval", 10*time.Second, "time taken by each sweep")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	crop := flag.Float64("crop", scan.DefaultCrop, "fraction of each hop discarded at its edges")
+	sweeps := flag.Int("sweeps", 0, "number of sweeps, 0 to run until interrupted")
+	workers := flag.Int("workers", runtime.NumCPU(), "goroutines computing FFTs")
+	out := flag.String("o", "-", "output file, a heatmap if it ends in .png, rtl_power CSV otherwise")
+	flag.CommandLine.Parse(args)
+
+	cfg, err := parseRange(*rng)
+	if err != nil {
+		return err
+	}
+	cfg.SampleRate = uint32(sdr.Flags.SampleRate)
+	cfg.Crop = *crop
+	cfg.Workers = *workers
+	if cfg.Crop == 0 {
+		cfg.Crop = -1
+	}
+
+	heatmap := strings.HasSuffix(*out, ".png")
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("Error creating output: %s", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return fmt.Errorf("Error setting gain: %s", err)
+	}
+
+	scanner, err := scan.New(&sdr, cfg)
+	if err != nil {
+		return err
+	}
+	defer scanner.Close()
+	// Size the integration time so each sweep takes the interval.
+	scanner.Config.Integration = *interval / time.Duration(scanner.Hops())
+	log.Printf("Sweeping %d hops of %s Hz bins", scanner.Hops(), strconv.FormatFloat(scanner.Step(), 'f', 2, 64))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	bw := bufio.NewWriter(w)
+	var history []scan.Sweep
+	for n := 0; *sweeps == 0 || n < *sweeps; n++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sweep, err := scanner.Sweep()
+		if err != nil {
+			return err
+		}
+
+		if heatmap {
+			history = append(history, sweep)
+			continue
+		}
+		if err := scan.WriteCSV(bw, sweep); err != nil {
+			return fmt.Errorf("Error writing CSV: %s", err)
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("Error writing CSV: %s", err)
+		}
+	}
+
+	if heatmap {
+		if err := png.Encode(bw, scan.Plot(history)); err != nil {
+			return fmt.Errorf("Error writing heatmap: %s", err)
+		}
+	}
+	return bw.Flush()
+}
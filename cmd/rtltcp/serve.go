@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/bemasher/rtltcp/proxy"
+	"github.com/bemasher/rtltcp/rtlsdr"
+)
+
+// Serves a local dongle over the rtl_tcp protocol, in place of rtl_tcp.
+// Requires a build with the rtlsdr tag.
+func runServe(args []string) error {
+	device := flag.String("device", "rtlsdr://0", "dongle to serve, rtlsdr://index or rtlsdr://?serial=s")
+	listen := flag.String("listen", "127.0.0.1:1234", "address to accept clients on, or unix:path")
+	token := flag.String("token", "", "token clients must present")
+	readOnly := flag.Bool("readonly", false, "ignore commands from clients")
+	blockSize := flag.Int("blocksize", 0, "bytes per write to the client")
+	flag.CommandLine.Parse(args)
+
+	d, err := rtlsdr.OpenAddr(*device)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	l, err := proxy.Listen(*listen)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	log.Printf("serving %s on %s", d.Info.Tuner, l.Addr())
+	s := &rtlsdr.Server{Device: d, BlockSize: *blockSize, Token: *token, ReadOnly: *readOnly}
+	return s.Serve(l)
+}
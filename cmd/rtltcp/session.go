@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Interval at which the repl saves its session while streaming, bounding
+// how much of a recording a crash loses track of.
+const sessionSaveInterval = 5 * time.Second
+
+// Last state of a repl session, saved as it changes so -resume can restore
+// it after a crash or reboot.
+type session struct {
+	Server    string            `json:"server"`
+	Settings  rtltcp.Profile    `json:"settings"`
+	Recording *sessionRecording `json:"recording,omitempty"`
+	Updated   time.Time         `json:"updated"`
+}
+
+// A recording in progress.
+type sessionRecording struct {
+	Path string `json:"path"`
+	Left int64  `json:"bytes_left"`
+}
+
+// Returns the file sessions are saved to by default.
+func defaultSessionPath() (string, error) {
+	dir, err := rtltcp.DefaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "session.json"), nil
+}
+
+func loadSession(path string) (s session, err error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("Error reading session: %s", err)
+	}
+	if err = json.Unmarshal(buf, &s); err != nil {
+		return s, fmt.Errorf("Error parsing session: %s", err)
+	}
+	return s, nil
+}
+
+// Writes s to path, replacing the previous session atomically.
+func saveSession(path string, s session) error {
+	s.Updated = time.Now()
+	buf, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Error saving session: %s", err)
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0644); err != nil {
+		return fmt.Errorf("Error saving session: %s", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Error saving session: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/scan"
+)
+
+func runSettle(args []string) error {
+	var sdr rtltcp.SDR
+	sdr.RegisterFlags()
+	from := flag.String("from", "", "frequency retuned from")
+	to := flag.String("to", "", "frequency retuned to, with a spectrum distinct from -from")
+	trials := flag.Int("trials", 10, "number of retunes measured")
+	observe := flag.Duration("observe", scan.DefaultSettleObserve, "time observed after each retune")
+	gain := flag.String("gain", "", "tuner gain in dB, or auto")
+	flag.CommandLine.Parse(args)
+
+	if *from == "" || *to == "" {
+		return errors.New("-from and -to are required")
+	}
+	if *trials < 1 {
+		return errors.New("-trials must be positive")
+	}
+	cfg := scan.SettleConfig{SampleRate: uint32(sdr.Flags.SampleRate), Observe: *observe}
+	var err error
+	if cfg.From, err = parseSI(*from); err != nil {
+		return fmt.Errorf("invalid -from: %s", err)
+	}
+	if cfg.To, err = parseSI(*to); err != nil {
+		return fmt.Errorf("invalid -to: %s", err)
+	}
+
+	if err := connect(&sdr); err != nil {
+		return err
+	}
+	defer sdr.Close()
+	if err := setGain(&sdr, *gain); err != nil {
+		return err
+	}
+
+	const row = "%5s %10s %12s %12s\n"
+	fmt.Printf(row, "trial", "samples", "settle", "latency")
+	var settles []scan.Settle
+	for i := 0; i < *trials; i++ {
+		s, err := scan.MeasureSettle(&sdr, cfg)
+		if err != nil {
+			return fmt.Errorf("trial %d: %s", i+1, err)
+		}
+		fmt.Printf(row, fmt.Sprint(i+1), fmt.Sprint(s.Samples),
+			s.Duration.Round(time.Microsecond), s.Latency.Round(time.Microsecond))
+		settles = append(settles, s)
+	}
+
+	sort.Slice(settles, func(i, j int) bool { return settles[i].Samples < settles[j].Samples })
+	median, worst := settles[len(settles)/2], settles[len(settles)-1]
+	fmt.Printf("Median settle %s, worst %s. Discard at least %d bytes after retuning.\n",
+		median.Duration.Round(time.Microsecond), worst.Duration.Round(time.Microsecond), 2*worst.Samples)
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/record"
+)
+
+// Writes blocks to a headerless file of unsigned 8-bit IQ.
+type rawFile struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+func (r *rawFile) WriteBlock(blk rtltcp.Block) error {
+	_, err := r.w.Write(blk.Samples)
+	return err
+}
+
+func (r *rawFile) Close() error {
+	err := r.w.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Returns a sink recording to path in format, one of raw, sigmf or wav. If
+// format is empty it's taken from the extension: WAV for .wav, SigMF for
+// .sigmf, .sigmf-data and .sigmf-meta, and raw IQ otherwise.
+func createSink(format, path string) (rtltcp.Sink, error) {
+	if format == "" {
+		switch {
+		case strings.HasSuffix(path, ".wav"):
+			format = "wav"
+		case strings.HasSuffix(path, ".sigmf"):
+			format = "sigmf"
+		case strings.HasSuffix(path, record.SigMFDataExt), strings.HasSuffix(path, record.SigMFMetaExt):
+			format = "sigmf"
+		default:
+			format = "raw"
+		}
+	}
+
+	switch format {
+	case "wav":
+		return record.NewWAV(path)
+	case "sigmf":
+		return record.NewSigMF(strings.TrimSuffix(path, ".sigmf"))
+	case "raw":
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating recording: %s", err)
+		}
+		return &rawFile{file: file, w: bufio.NewWriter(file)}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// Inserts a UTC timestamp into path ahead of its extension, so repeated
+// recordings don't overwrite each other.
+func stampPath(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + t.UTC().Format("20060102T150405Z") + ext
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/bemasher/rtltcp/proxy"
+)
+
+// Returns the handler of the debug endpoint: the profiles of net/http/pprof
+// under /debug/pprof/, including goroutine dumps, runtime memory statistics
+// at /debug/vars and the admin endpoint under /debug/relay/.
+func debugHandler(relay *proxy.Relay) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/debug/relay/", http.StripPrefix("/debug/relay", relay.AdminHandler()))
+	return mux
+}
@@ -0,0 +1,353 @@
+// Command rtltcpd relays a single rtl_tcp server to any number of clients,
+// so one dongle can feed several applications at once.
+//
+// Usage:
+//
+//	rtltcpd -config /etc/rtltcpd.json
+//	rtltcpd -upstream 127.0.0.1:1234 -listen :1235
+//
+// The configuration file is JSON:
+//
+//	{
+//		"upstream": "127.0.0.1:1234",
+//		"listen": [
+//			{"addr": "127.0.0.1:1235"},
+//			{"addr": "unix:/run/rtltcpd/rtltcpd.sock"},
+//			{"addr": ":1236", "token": "secret", "legacy": "readonly",
+//			 "allow": ["192.168.1.0/24"], "deny": ["192.168.1.13"], "max_per_ip": 2},
+//			{"addr": ":1237", "token": "secret", "format": "u4"},
+//			{"addr": "127.0.0.1:1238", "format": "f32", "decimation": 8},
+//			{"addr": ":1239", "tls_cert": "cert.pem", "tls_key": "key.pem",
+//			 "tls_client_ca": "clients.pem"}
+//		],
+//		"block_size": 16384,
+//		"queue_depth": 64,
+//		"reconnect_interval": "5s",
+//		"read_only": false,
+//		"max_client_rate": 4800000,
+//		"slow_client": "drop",
+//		"admin": "127.0.0.1:8080",
+//		"debug": "127.0.0.1:6060"
+//	}
+//
+// Addresses prefixed with "unix:" are unix sockets, for consumers on the
+// same host. The upstream may be one too, or a dongle attached to this host
+// given as rtlsdr://index or rtlsdr://?serial=s, served without rtl_tcp when
+// built with -tags rtlsdr.
+//
+// Listeners with a token only serve clients presenting it, such as the
+// rtltcp command given -token. Clients without a token are rejected, unless
+// legacy is "allow" or "readonly", the latter discarding their commands.
+// When allow is given only clients in its networks are accepted, deny
+// refuses networks regardless, and max_per_ip limits concurrent connections
+// from one address.
+//
+// Each listener re-encodes samples to its format: u8 as received, u4 packed
+// to half the bandwidth for links such as LTE, understood only by rtltcp
+// clients, or s16 and f32 for consumers wanting wider samples. Clients
+// choose a format by connecting to its listener, whose header announces it
+// with a magic other than rtl_tcp's for all but u8. decimation
+// low pass filters and reduces the sample rate by an integer factor.
+// Clients of this package may also select a narrow channel for themselves
+// with rtltcp.SDR.SetChannel, which the relay downconverts to.
+//
+// Listeners with tls_cert and tls_key serve over TLS, for clients such as
+// the rtltcp command given -tls. With tls_client_ca only clients presenting
+// a certificate signed by one of its CAs are accepted.
+//
+// max_client_rate caps the bytes per second sent to each client. Clients
+// falling behind have blocks dropped, are disconnected, or with "decimate"
+// receive every other block until they catch up.
+//
+// When admin is given, relay and per-client statistics are served as JSON
+// over HTTP at /status and /clients, and a histogram of recent raw sample
+// values at /histogram, the diagnosis of which is included in /status. It has
+// no authentication, so bind it to loopback or a management network.
+//
+// When debug is given, a second HTTP listener serves runtime profiles and
+// goroutine dumps under /debug/pprof/, for use with go tool pprof, memory
+// statistics at /debug/vars and the statistics above, including queued and
+// dropped blocks per client, under /debug/relay/. Profiling costs little
+// until a profile is requested, but the endpoint is as unprotected as admin.
+//
+// Flags override the corresponding settings of the file. SIGINT and SIGTERM
+// disconnect all clients and exit cleanly. When run under systemd, log
+// timestamps are left to the journal, see rtltcpd.service for a unit file.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/proxy"
+)
+
+// A time.Duration read from a JSON string such as "5s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = duration(v)
+	return err
+}
+
+type listenConfig struct {
+	Addr string `json:"addr"`
+	// Token clients must present, none required if empty.
+	Token string `json:"token"`
+	// Treatment of clients without a token: reject, allow or readonly.
+	Legacy string `json:"legacy"`
+	// CIDR prefixes or addresses of clients admitted, all if empty.
+	Allow []string `json:"allow"`
+	// CIDR prefixes or addresses of clients refused.
+	Deny []string `json:"deny"`
+	// Concurrent connections per client address, unlimited if zero.
+	MaxPerIP int `json:"max_per_ip"`
+	// Sample format sent to clients: u8, u4, s16 or f32.
+	Format string `json:"format"`
+	// Factor the sample rate is reduced by, none if zero.
+	Decimation int `json:"decimation"`
+	// Certificate and key files to serve TLS with, PEM.
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+	// CA certificates client certificates must be signed by, none required
+	// if empty.
+	TLSClientCA string `json:"tls_client_ca"`
+}
+
+type config struct {
+	Upstream          string         `json:"upstream"`
+	Listen            []listenConfig `json:"listen"`
+	BlockSize         int            `json:"block_size"`
+	QueueDepth        int            `json:"queue_depth"`
+	ReconnectInterval duration       `json:"reconnect_interval"`
+	ReadOnly          bool           `json:"read_only"`
+	MaxClientRate     int            `json:"max_client_rate"`
+	// Treatment of clients falling behind: drop, disconnect or decimate.
+	SlowClient string `json:"slow_client"`
+	// Address of the HTTP statistics endpoint, disabled if empty.
+	Admin string `json:"admin"`
+	// Address of the HTTP profiling endpoint, disabled if empty.
+	Debug string `json:"debug"`
+}
+
+func readConfig(path string) (cfg config, err error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("Error reading config: %s", err)
+	}
+	if err = json.Unmarshal(buf, &cfg); err != nil {
+		return cfg, fmt.Errorf("Error parsing config: %s", err)
+	}
+	return cfg, nil
+}
+
+// Serves every listener of cfg until ctx is done or a listener fails.
+func run(ctx context.Context, cfg config) error {
+	if cfg.Upstream == "" {
+		return errors.New("no upstream configured")
+	}
+	if len(cfg.Listen) == 0 {
+		return errors.New("no listeners configured")
+	}
+
+	slow := proxy.SlowDrop
+	if cfg.SlowClient != "" {
+		var err error
+		if slow, err = proxy.ParseSlowPolicy(cfg.SlowClient); err != nil {
+			return err
+		}
+	}
+
+	relay := &proxy.Relay{
+		Upstream:          cfg.Upstream,
+		BlockSize:         cfg.BlockSize,
+		QueueDepth:        cfg.QueueDepth,
+		ReconnectInterval: time.Duration(cfg.ReconnectInterval),
+		ReadOnly:          cfg.ReadOnly,
+		MaxClientRate:     cfg.MaxClientRate,
+		SlowClients:       slow,
+	}
+
+	var listeners []*proxy.Listener
+	for _, lc := range cfg.Listen {
+		legacy := proxy.LegacyReject
+		if lc.Legacy != "" {
+			var err error
+			if legacy, err = proxy.ParseLegacyPolicy(lc.Legacy); err != nil {
+				return fmt.Errorf("listener %s: %s", lc.Addr, err)
+			}
+		}
+
+		format := proxy.FormatU8
+		if lc.Format != "" {
+			var err error
+			if format, err = proxy.ParseSampleFormat(lc.Format); err != nil {
+				return fmt.Errorf("listener %s: %s", lc.Addr, err)
+			}
+		}
+
+		allow, err := proxy.ParsePrefixes(lc.Allow)
+		if err != nil {
+			return fmt.Errorf("listener %s: invalid allow: %s", lc.Addr, err)
+		}
+		deny, err := proxy.ParsePrefixes(lc.Deny)
+		if err != nil {
+			return fmt.Errorf("listener %s: invalid deny: %s", lc.Addr, err)
+		}
+
+		var tlsConfig *tls.Config
+		if lc.TLSCert != "" || lc.TLSKey != "" || lc.TLSClientCA != "" {
+			if tlsConfig, err = rtltcp.LoadTLSConfig(lc.TLSCert, lc.TLSKey, lc.TLSClientCA); err != nil {
+				return fmt.Errorf("listener %s: %s", lc.Addr, err)
+			}
+			if lc.TLSClientCA != "" {
+				tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+
+		ln, err := proxy.Listen(lc.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, &proxy.Listener{
+			Listener:   ln,
+			Allow:      allow,
+			Deny:       deny,
+			MaxPerIP:   lc.MaxPerIP,
+			TLS:        tlsConfig,
+			Token:      lc.Token,
+			Legacy:     legacy,
+			Format:     format,
+			Decimation: lc.Decimation,
+		})
+	}
+
+	errs := make(chan error, len(listeners)+1)
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(l *proxy.Listener) {
+			defer wg.Done()
+			log.Printf("listening on %s", l.Addr())
+			if err := relay.Serve(l); err != proxy.ErrRelayClosed {
+				errs <- fmt.Errorf("listener %s: %s", l.Addr(), err)
+			}
+		}(l)
+	}
+
+	var servers []*http.Server
+	defer func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}()
+	endpoints := []struct {
+		name, addr string
+		handler    http.Handler
+	}{
+		{"admin", cfg.Admin, relay.AdminHandler()},
+		{"debug", cfg.Debug, debugHandler(relay)},
+	}
+	for _, ep := range endpoints {
+		if ep.addr == "" {
+			continue
+		}
+		ln, err := net.Listen("tcp", ep.addr)
+		if err != nil {
+			relay.Close()
+			wg.Wait()
+			return fmt.Errorf("%s: %s", ep.name, err)
+		}
+		srv := &http.Server{Handler: ep.handler}
+		servers = append(servers, srv)
+		go func(name string) {
+			log.Printf("%s endpoint on %s", name, ln.Addr())
+			if err := srv.Serve(ln); err != http.ErrServerClosed {
+				errs <- fmt.Errorf("%s: %s", name, err)
+			}
+		}(ep.name)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Print("shutting down")
+	case err = <-errs:
+	}
+
+	relay.Close()
+	wg.Wait()
+	return err
+}
+
+func main() {
+	configPath := flag.String("config", "", "path of the JSON configuration file")
+	upstream := flag.String("upstream", "", "address of the rtl_tcp server")
+	listen := flag.String("listen", "", "comma separated addresses to accept clients on")
+	readOnly := flag.Bool("readonly", false, "ignore commands from clients")
+	admin := flag.String("admin", "", "address to serve statistics over HTTP on")
+	debug := flag.String("debug", "", "address to serve profiles over HTTP on")
+	flag.Parse()
+
+	// journald timestamps every line itself.
+	if os.Getenv("JOURNAL_STREAM") != "" {
+		log.SetFlags(0)
+	} else {
+		log.SetFlags(log.LstdFlags)
+	}
+
+	var cfg config
+	if *configPath != "" {
+		var err error
+		if cfg, err = readConfig(*configPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *upstream != "" {
+		cfg.Upstream = *upstream
+	}
+	if *listen != "" {
+		cfg.Listen = nil
+		for _, addr := range strings.Split(*listen, ",") {
+			cfg.Listen = append(cfg.Listen, listenConfig{Addr: strings.TrimSpace(addr)})
+		}
+	}
+	if *readOnly {
+		cfg.ReadOnly = true
+	}
+	if *admin != "" {
+		cfg.Admin = *admin
+	}
+	if *debug != "" {
+		cfg.Debug = *debug
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
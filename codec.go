@@ -0,0 +1,103 @@
+package rtltcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Codec governs the wire format of the dongle information header and of
+// commands, so clients can talk to embedded or bridge servers deviating
+// from rtl_tcp's layout. Samples are unaffected.
+type Codec interface {
+	// Size of the header.
+	HeaderLen() int
+	// Decodes the header at the start of buf, with the errors of
+	// DecodeDongleInfo.
+	DecodeHeader(buf []byte) (DongleInfo, error)
+	// Size of an encoded command.
+	CommandLen() int
+	// Encodes cmd into b, which must hold CommandLen bytes.
+	EncodeCommand(b []byte, cmd Command)
+	// Decodes the command at the start of b.
+	DecodeCommand(b []byte) (Command, error)
+}
+
+// LayoutCodec is a Codec of rtl_tcp's fields in a choice of byte orders and
+// padding, covering the variants seen from servers copying C structs to the
+// wire on little-endian machines.
+type LayoutCodec struct {
+	// Byte order of the header's tuner and gain count, big-endian if nil.
+	Header binary.ByteOrder
+	// Byte order of command parameters, big-endian if nil.
+	Command binary.ByteOrder
+	// Bytes of padding between a command's opcode and parameter, 3 for a
+	// struct aligning its parameter.
+	Padding int
+}
+
+// Codecs of the known protocol variants, by the name given to -protocol.
+var Protocols = map[string]Codec{
+	"rtl_tcp": LayoutCodec{},
+	"le":      LayoutCodec{Header: binary.LittleEndian, Command: binary.LittleEndian},
+	"le-cmd":  LayoutCodec{Command: binary.LittleEndian},
+	"padded":  LayoutCodec{Command: binary.LittleEndian, Padding: 3},
+}
+
+// Codec used by SDRs given none, rtl_tcp's own.
+var DefaultCodec Codec = LayoutCodec{}
+
+// Returns the codec of the protocol variant named name, see Protocols.
+func ParseProtocol(name string) (Codec, error) {
+	if c, ok := Protocols[name]; ok {
+		return c, nil
+	}
+	names := make([]string, 0, len(Protocols))
+	for n := range Protocols {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown protocol %q, expected one of %q", name, names)
+}
+
+func orDefault(order binary.ByteOrder) binary.ByteOrder {
+	if order == nil {
+		return binary.BigEndian
+	}
+	return order
+}
+
+func (c LayoutCodec) HeaderLen() int {
+	return headerLen
+}
+
+func (c LayoutCodec) DecodeHeader(buf []byte) (DongleInfo, error) {
+	return decodeDongleInfo(buf, orDefault(c.Header))
+}
+
+func (c LayoutCodec) CommandLen() int {
+	return CommandLen + c.Padding
+}
+
+func (c LayoutCodec) EncodeCommand(b []byte, cmd Command) {
+	b[0] = cmd.Opcode
+	for i := 1; i <= c.Padding; i++ {
+		b[i] = 0
+	}
+	orDefault(c.Command).PutUint32(b[1+c.Padding:], cmd.Parameter)
+}
+
+func (c LayoutCodec) DecodeCommand(b []byte) (Command, error) {
+	if len(b) < c.CommandLen() {
+		return Command{}, fmt.Errorf("command of %d bytes, expected %d", len(b), c.CommandLen())
+	}
+	return Command{Opcode: b[0], Parameter: orDefault(c.Command).Uint32(b[1+c.Padding:])}, nil
+}
+
+// Returns the SDR's codec, DefaultCodec if none is set.
+func (sdr *SDR) codec() Codec {
+	if sdr.Codec == nil {
+		return DefaultCodec
+	}
+	return sdr.Codec
+}
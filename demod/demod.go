@@ -0,0 +1,173 @@
+// Package demod recovers audio from channels selected with dsp.DDC. Each
+// demodulator is a dsp.Block from complex baseband to real audio at the
+// channel's sample rate, to be resampled to the audio rate with
+// dsp.Resampler and levelled with dsp.AGC.
+package demod
+
+import (
+	"math"
+	"time"
+
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Peak frequency deviations of common FM services in Hz.
+const (
+	NarrowDeviation = 5e3  // Two-way radio, APRS.
+	WideDeviation   = 75e3 // Broadcast.
+)
+
+// Deemphasis time constants of broadcast FM.
+const (
+	DeemphasisEurope = 50 * time.Microsecond
+	DeemphasisUS     = 75 * time.Microsecond
+)
+
+// Standard CTCSS subtones in Hz, for a dsp.ToneDetector watching for the
+// tone opening a repeater or selective squelch.
+var CTCSSTones = []float64{
+	67.0, 69.3, 71.9, 74.4, 77.0, 79.7, 82.5, 85.4, 88.5, 91.5,
+	94.8, 97.4, 100.0, 103.5, 107.2, 110.9, 114.8, 118.8, 123.0, 127.3,
+	131.8, 136.5, 141.3, 146.2, 151.4, 156.7, 159.8, 162.2, 165.5, 167.9,
+	171.3, 173.8, 177.3, 179.9, 183.5, 186.2, 189.9, 192.8, 196.6, 199.5,
+	203.5, 206.5, 210.7, 218.1, 225.7, 229.1, 233.6, 241.8, 250.3, 254.1,
+}
+
+// Taps of the sideband filter per unit of the ratio between sample rate and
+// bandwidth.
+const ssbTaps = 8
+
+// FM is a quadrature discriminator: the phase advance between consecutive
+// samples is the instantaneous frequency, scaled so peak deviation is full
+// scale.
+type FM struct {
+	scale float64
+	prev  complex64
+
+	deemph float64 // Smoothing factor of the deemphasis filter, none if zero.
+	y      float64
+}
+
+// Returns an FM demodulator for a channel of rate samples per second with
+// the given peak deviation in Hz. Deemphasis undoes the treble boost of
+// broadcast transmitters, zero disables it.
+func NewFM(rate, deviation float64, deemphasis time.Duration) *FM {
+	fm := &FM{scale: rate / (2 * math.Pi * deviation)}
+	if deemphasis > 0 {
+		fm.deemph = 1 - math.Exp(-1/(deemphasis.Seconds()*rate))
+	}
+	return fm
+}
+
+// Demodulates src and appends the audio to dst, returning the extended
+// slice.
+func (fm *FM) Process(dst []float32, src []complex64) []float32 {
+	for _, s := range src {
+		d := s * complex(real(fm.prev), -imag(fm.prev))
+		fm.prev = s
+		v := math.Atan2(float64(imag(d)), float64(real(d))) * fm.scale
+		if fm.deemph != 0 {
+			fm.y += fm.deemph * (v - fm.y)
+			v = fm.y
+		}
+		dst = append(dst, float32(v))
+	}
+	return dst
+}
+
+// AM is an envelope detector. The carrier, which the envelope rides on, is
+// removed by tracking its level over DefaultAMCarrier.
+type AM struct {
+	alpha   float64
+	carrier float64
+	started bool
+}
+
+// Time constant the carrier level is tracked with.
+const DefaultAMCarrier = 100 * time.Millisecond
+
+// Returns an AM demodulator for a channel of rate samples per second.
+func NewAM(rate float64) *AM {
+	return &AM{alpha: 1 - math.Exp(-1/(DefaultAMCarrier.Seconds()*rate))}
+}
+
+// Demodulates src and appends the audio to dst, returning the extended
+// slice. Audio is relative to the carrier, so full modulation peaks at one.
+func (am *AM) Process(dst []float32, src []complex64) []float32 {
+	for _, s := range src {
+		mag := math.Hypot(float64(real(s)), float64(imag(s)))
+		if !am.started {
+			am.carrier, am.started = mag, true
+		}
+		am.carrier += am.alpha * (mag - am.carrier)
+		v := 0.0
+		if am.carrier > 0 {
+			v = mag/am.carrier - 1
+		}
+		dst = append(dst, float32(v))
+	}
+	return dst
+}
+
+// SSB selects one sideband of a channel centered on the suppressed carrier:
+// the sideband is shifted to DC, filtered to its bandwidth and shifted back
+// as real audio, rejecting the opposite sideband.
+type SSB struct {
+	down, up oscillator
+	filter   dsp.Filter
+
+	shifted, filtered []complex64
+}
+
+// Returns a demodulator for the upper sideband, or the lower if !upper, of
+// bandwidth Hz from a channel of rate samples per second. 2.7 kHz suits
+// voice.
+func NewSSB(rate, bandwidth float64, upper bool) *SSB {
+	center := bandwidth / 2
+	if !upper {
+		center = -center
+	}
+	taps := ssbTaps*int(rate/bandwidth) | 1
+	step := complex(math.Cos(2*math.Pi*center/rate), math.Sin(2*math.Pi*center/rate))
+	return &SSB{
+		down:   oscillator{step: complex(real(step), -imag(step)), phase: 1},
+		up:     oscillator{step: step, phase: 1},
+		filter: dsp.NewFilter(dsp.LowPass(taps, bandwidth/2/rate, dsp.Blackman)),
+	}
+}
+
+// Demodulates src and appends the audio to dst, returning the extended
+// slice. The filter's delay shifts the phase of the audio, not its
+// frequency, so the oscillators need not line up.
+func (ssb *SSB) Process(dst []float32, src []complex64) []float32 {
+	ssb.shifted = ssb.shifted[:0]
+	for _, s := range src {
+		ssb.shifted = append(ssb.shifted, s*ssb.down.next())
+	}
+	ssb.filtered = ssb.filter.Process(ssb.filtered[:0], ssb.shifted)
+	for _, s := range ssb.filtered {
+		dst = append(dst, real(s*ssb.up.next()))
+	}
+	return dst
+}
+
+// Samples between renormalizations of an oscillator, which otherwise
+// drifts in magnitude as rounding errors accumulate.
+const oscRenormalize = 1024
+
+// A complex oscillator advancing by step per sample.
+type oscillator struct {
+	step, phase complex128
+	count       int
+}
+
+// Returns the current phase and advances it.
+func (o *oscillator) next() complex64 {
+	p := o.phase
+	o.phase *= o.step
+	if o.count++; o.count == oscRenormalize {
+		o.phase /= complex(math.Hypot(real(o.phase), imag(o.phase)), 0)
+		o.count = 0
+	}
+	return complex64(p)
+}
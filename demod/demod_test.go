@@ -0,0 +1,105 @@
+package demod
+
+import (
+	"context"
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+const rate = 48000
+
+// Returns the amplitude of the 1 kHz component of the second half of x,
+// past filter transients.
+func tone(x []float32) float64 {
+	x = x[len(x)/2:]
+	var sum complex128
+	for i, v := range x {
+		sum += complex(float64(v), 0) * cmplx.Rect(1, -2*math.Pi*1e3*float64(i)/rate)
+	}
+	return 2 * cmplx.Abs(sum) / float64(len(x))
+}
+
+func TestFM(t *testing.T) {
+	// A 1 kHz tone at half the peak deviation.
+	src := make([]complex64, rate/4)
+	var phase float64
+	for i := range src {
+		phase += 2 * math.Pi * 0.5 * NarrowDeviation * math.Sin(2*math.Pi*1e3*float64(i)/rate) / rate
+		src[i] = complex64(cmplx.Rect(0.3, phase))
+	}
+	if a := tone(NewFM(rate, NarrowDeviation, 0).Process(nil, src)); math.Abs(a-0.5) > 0.01 {
+		t.Errorf("tone amplitude %.3f", a)
+	}
+}
+
+func TestAM(t *testing.T) {
+	src := make([]complex64, rate/2)
+	for i := range src {
+		src[i] = complex64(complex(0.2*(1+0.8*math.Sin(2*math.Pi*1e3*float64(i)/rate)), 0))
+	}
+	if a := tone(NewAM(rate).Process(nil, src)); math.Abs(a-0.8) > 0.05 {
+		t.Errorf("tone amplitude %.3f", a)
+	}
+}
+
+func TestSSB(t *testing.T) {
+	// A 1 kHz tone above the carrier is heard on the upper sideband only.
+	src := make([]complex64, rate/2)
+	for i := range src {
+		src[i] = complex64(cmplx.Rect(0.5, 2*math.Pi*1e3*float64(i)/rate))
+	}
+	usb := tone(NewSSB(rate, 2.7e3, true).Process(nil, src))
+	lsb := tone(NewSSB(rate, 2.7e3, false).Process(nil, src))
+	if math.Abs(usb-0.5) > 0.05 || lsb > 0.01 {
+		t.Errorf("upper %.3f, lower %.3f", usb, lsb)
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	// A 1 kHz tone at half the peak deviation on a channel 50 kHz above
+	// the center of a 240 kHz stream, delivered in blocks.
+	const streamRate = 240000
+	iq := make([]byte, streamRate/2*2)
+	var phase float64
+	for i := 0; i < len(iq)/2; i++ {
+		phase += 2 * math.Pi * (50e3 + 0.5*NarrowDeviation*math.Sin(2*math.Pi*1e3*float64(i)/streamRate)) / streamRate
+		iq[2*i] = byte(127.5 + 100*math.Cos(phase))
+		iq[2*i+1] = byte(127.5 + 100*math.Sin(phase))
+	}
+	blocks := make(chan rtltcp.Block, len(iq)/4800)
+	for i := 0; i < len(iq); i += 4800 {
+		blocks <- rtltcp.Block{
+			Metadata: rtltcp.Metadata{CenterFreq: 100e6, SampleRate: streamRate},
+			Samples:  iq[i : i+4800],
+		}
+	}
+	close(blocks)
+
+	r, err := NewReceiver(ReceiverConfig{Offset: 50e3, AudioRate: rate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var audio []float32
+	var audioLen time.Duration
+	for frame := range Frames(context.Background(), blocks, r) {
+		if frame.Rate != rate || frame.Freq != 100.05e6 {
+			t.Fatalf("frame of %d Hz at %d Hz", frame.Rate, frame.Freq)
+		}
+		audio = append(audio, frame.Samples...)
+		audioLen += frame.Duration()
+	}
+	if audioLen < 450*time.Millisecond || audioLen > 500*time.Millisecond {
+		t.Errorf("%s of audio", audioLen)
+	}
+	if a := tone(audio); math.Abs(a-0.5) > 0.02 {
+		t.Errorf("tone amplitude %.3f", a)
+	}
+
+	if _, err := NewReceiver(ReceiverConfig{Mode: "cw"}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
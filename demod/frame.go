@@ -0,0 +1,180 @@
+package demod
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Audio rate of a Receiver given none.
+const DefaultAudioRate = 48000
+
+// Channel bandwidths in Hz of the modes accepted by New.
+var Bandwidths = map[string]float64{
+	"fm":  12.5e3,
+	"wfm": 200e3,
+	"am":  10e3,
+	"usb": 2.7e3,
+	"lsb": 2.7e3,
+}
+
+// Returns the demodulator of mode, one of fm, wfm, am, usb or lsb, for a
+// channel of rate samples per second and bandwidth Hz, and whether its
+// output needs levelling with dsp.AGC. Deemphasis applies to wfm only.
+func New(mode string, rate, bandwidth float64, deemphasis time.Duration) (dsp.Block[complex64, float32], bool, error) {
+	switch mode {
+	case "fm":
+		return NewFM(rate, NarrowDeviation, 0), false, nil
+	case "wfm":
+		return NewFM(rate, WideDeviation, deemphasis), false, nil
+	case "am":
+		return NewAM(rate), true, nil
+	case "usb", "lsb":
+		return NewSSB(rate, bandwidth, mode == "usb"), true, nil
+	}
+	return nil, false, fmt.Errorf("unknown mode %q", mode)
+}
+
+// AudioFrame is a run of demodulated audio, the unit receivers deliver on
+// channels to audio sinks, recorders and network streamers alike.
+type AudioFrame struct {
+	Samples []float32 // Mono PCM between -1 and 1.
+	Rate    int       // Samples per second.
+	// Estimated capture time of the IQ samples the audio was demodulated
+	// from, see rtltcp.Metadata.Timestamp. Filter delays are not removed.
+	Time time.Time
+	Freq uint32 // Frequency of the channel in Hz.
+}
+
+// Returns the length of the frame's audio.
+func (f AudioFrame) Duration() time.Duration {
+	if f.Rate == 0 {
+		return 0
+	}
+	return time.Duration(len(f.Samples)) * time.Second / time.Duration(f.Rate)
+}
+
+// Settings of a Receiver, defaults used for zero fields.
+type ReceiverConfig struct {
+	Mode       string        // Demodulation, see New. fm if empty.
+	Offset     float64       // Channel frequency relative to the center frequency in Hz.
+	Bandwidth  float64       // Channel bandwidth in Hz, Bandwidths[Mode] if zero.
+	Deemphasis time.Duration // Deemphasis of wfm, none if zero.
+	AudioRate  int           // Audio samples per second, DefaultAudioRate if zero.
+}
+
+// Receiver demodulates one channel of a stream of blocks into audio
+// frames: it selects the channel with dsp.DDC, demodulates it, resamples it
+// to the audio rate and levels AM and SSB with dsp.AGC. The chain is built
+// for each block's sample rate, and rebuilt when it changes.
+type Receiver struct {
+	cfg ReceiverConfig
+
+	rate      uint32 // Sample rate the chain was built for.
+	ddc       *dsp.DDC
+	demod     dsp.Block[complex64, float32]
+	resampler *dsp.Resampler
+	agc       *dsp.AGC[float32]
+
+	iq, channel []complex64
+	demodded    []float32
+}
+
+// Returns a receiver for cfg, failing if its mode is unknown.
+func NewReceiver(cfg ReceiverConfig) (*Receiver, error) {
+	if cfg.Mode == "" {
+		cfg.Mode = "fm"
+	}
+	if _, ok := Bandwidths[cfg.Mode]; !ok {
+		return nil, fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+	if cfg.Bandwidth == 0 {
+		cfg.Bandwidth = Bandwidths[cfg.Mode]
+	}
+	if cfg.AudioRate <= 0 {
+		cfg.AudioRate = DefaultAudioRate
+	}
+	return &Receiver{cfg: cfg}, nil
+}
+
+// Builds the chain for rate samples per second. Decimates to the narrowest
+// rate still holding the channel and the audio, resampling the rest of the
+// way.
+func (r *Receiver) build(rate uint32) {
+	decim := max(1, int(float64(rate)/max(r.cfg.Bandwidth, float64(r.cfg.AudioRate))))
+	chanRate := float64(rate) / float64(decim)
+
+	var level bool
+	r.rate = rate
+	r.ddc = dsp.NewDDC(r.cfg.Offset, float64(rate), decim)
+	r.demod, level, _ = New(r.cfg.Mode, chanRate, r.cfg.Bandwidth, r.cfg.Deemphasis)
+	r.resampler = dsp.NewResampler(int(rate), r.cfg.AudioRate*decim)
+	r.agc = nil
+	if level {
+		r.agc = dsp.NewAGC[float32](dsp.AGCConfig{}, float64(r.cfg.AudioRate))
+	}
+}
+
+// Demodulates blk, returning a frame of the audio in a buffer of its own.
+// Filters are cleared after gaps in the stream. The frame is empty for
+// blocks of unknown sample rate, and may be for short blocks while filters
+// fill.
+func (r *Receiver) Process(blk rtltcp.Block) AudioFrame {
+	frame := AudioFrame{
+		Rate: r.cfg.AudioRate,
+		Time: blk.Timestamp,
+		Freq: uint32(int64(blk.CenterFreq) + int64(r.cfg.Offset)),
+	}
+	if blk.SampleRate == 0 {
+		return frame
+	}
+	if blk.SampleRate != r.rate {
+		r.build(blk.SampleRate)
+	} else if blk.Gap > 0 {
+		r.ddc.Reset()
+		r.resampler.Reset()
+	}
+
+	r.iq = dsp.ConvertU8(r.iq[:0], blk.Samples)
+	r.channel = r.ddc.Process(r.channel[:0], r.iq)
+	r.demodded = r.demod.Process(r.demodded[:0], r.channel)
+	frame.Samples = r.resampler.Process(nil, r.demodded)
+	if r.agc != nil {
+		frame.Samples = r.agc.Process(frame.Samples[:0], frame.Samples)
+	}
+	return frame
+}
+
+// Demodulates blocks with r, delivering frames until blocks is closed or
+// ctx is done, then closing the returned channel. Frames without audio are
+// skipped.
+func Frames(ctx context.Context, blocks <-chan rtltcp.Block, r *Receiver) <-chan AudioFrame {
+	frames := make(chan AudioFrame, rtltcp.DefaultQueueDepth)
+	go func() {
+		defer close(frames)
+		for {
+			select {
+			case blk, ok := <-blocks:
+				if !ok {
+					return
+				}
+				frame := r.Process(blk)
+				blk.Release()
+				if len(frame.Samples) == 0 {
+					continue
+				}
+				select {
+				case frames <- frame:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return frames
+}
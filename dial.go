@@ -0,0 +1,169 @@
+package rtltcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Prefix of addresses naming unix sockets.
+const unixPrefix = "unix:"
+
+// Splits an address into the network and address to dial or listen on.
+// Addresses of the form "unix:/run/rtltcp.sock" name unix sockets, others
+// are TCP "host:port" addresses.
+func ParseAddr(addr string) (network, address string) {
+	if strings.HasPrefix(addr, unixPrefix) {
+		return "unix", strings.TrimPrefix(addr, unixPrefix)
+	}
+	return "tcp", addr
+}
+
+// Returns a Dialer connecting through the proxy at rawURL, either
+// socks5://[user:pass@]host:port or http://[user:pass@]host:port using the
+// CONNECT method. Connections to the proxy are made by forward, a direct
+// dial if nil.
+func ProxyDialer(rawURL string, forward Dialer) (Dialer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing proxy URL: %s", err)
+	}
+	if forward == nil {
+		forward = proxy.Direct
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		return proxy.FromURL(u, forward)
+	case "http":
+		p := &httpProxy{addr: u.Host, forward: forward}
+		if u.Port() == "" {
+			p.addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+		if u.User != nil {
+			pass, _ := u.User.Password()
+			p.auth = base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+}
+
+// Dials with d, through DialContext if it has one, or directly if nil.
+func dialContext(ctx context.Context, d Dialer, network, address string) (net.Conn, error) {
+	switch d := d.(type) {
+	case nil:
+		var direct net.Dialer
+		return direct.DialContext(ctx, network, address)
+	case ContextDialer:
+		return d.DialContext(ctx, network, address)
+	}
+	return d.Dial(network, address)
+}
+
+// Applies KeepAlive and ReadBuffer to a TCP connection. Connections made by
+// other transports, such as SSH channels, are left alone.
+func (sdr *SDR) tuneSocket(conn net.Conn) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	keepAlive := sdr.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = sdr.Flags.KeepAlive
+	}
+	switch {
+	case keepAlive < 0:
+		if err := tcp.SetKeepAlive(false); err != nil {
+			return fmt.Errorf("Error disabling keepalive: %s", err)
+		}
+	case keepAlive > 0:
+		if err := tcp.SetKeepAlive(true); err != nil {
+			return fmt.Errorf("Error enabling keepalive: %s", err)
+		}
+		if err := tcp.SetKeepAlivePeriod(keepAlive); err != nil {
+			return fmt.Errorf("Error setting keepalive period: %s", err)
+		}
+	}
+
+	size := sdr.ReadBuffer
+	if size == 0 {
+		size = sdr.Flags.ReadBuffer
+	}
+	if size > 0 {
+		if err := tcp.SetReadBuffer(size); err != nil {
+			return fmt.Errorf("Error setting receive buffer: %s", err)
+		}
+	}
+	return nil
+}
+
+// Tunnels connections through an HTTP proxy with CONNECT.
+type httpProxy struct {
+	addr    string
+	auth    string // Basic credentials, none if empty.
+	forward Dialer
+}
+
+func (p *httpProxy) Dial(network, address string) (net.Conn, error) {
+	return p.DialContext(context.Background(), network, address)
+}
+
+func (p *httpProxy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := dialContext(ctx, p.forward, "tcp", p.addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if p.auth != "" {
+		req.Header.Set("Proxy-Authorization", "Basic "+p.auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error sending CONNECT: %s", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error reading CONNECT response: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT: %s", resp.Status)
+	}
+
+	// The server may speak first, its header can arrive with the response.
+	return &bufferedConn{conn, br}, nil
+}
+
+// A connection whose first bytes were read ahead into a buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
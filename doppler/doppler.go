@@ -0,0 +1,186 @@
+// Package doppler predicts satellite Doppler shift from two-line element
+// sets and keeps downlinks centered during a pass, either by retuning the
+// receiver or by shifting samples digitally.
+package doppler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	satellite "github.com/joshuaferrara/go-satellite"
+
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Speed of light in m/s.
+const speedOfLight = 299792458
+
+// Earth's rotation rate in rad/s.
+const earthRotation = 7.2921150e-5
+
+// Length of a TLE line.
+const tleLineLen = 69
+
+// Location of the receiving station.
+type Observer struct {
+	Latitude, Longitude float64 // Degrees, north and east positive.
+	Altitude            float64 // Meters above the ellipsoid.
+}
+
+// Position of a satellite as seen by the observer.
+type Look struct {
+	Azimuth   float64 // Degrees clockwise from north.
+	Elevation float64 // Degrees above the horizon.
+	Range     float64 // Meters.
+	RangeRate float64 // Meters per second, positive when receding.
+}
+
+// Tracker predicts a satellite's position relative to an observer.
+type Tracker struct {
+	sat satellite.Satellite
+	obs Observer
+}
+
+// Returns a tracker for the satellite described by the two lines of a TLE.
+func NewTracker(line1, line2 string, obs Observer) (*Tracker, error) {
+	if len(line1) < tleLineLen || len(line2) < tleLineLen {
+		return nil, errors.New("doppler: TLE lines must be 69 characters")
+	}
+	if line1[0] != '1' || line2[0] != '2' {
+		return nil, errors.New("doppler: malformed TLE")
+	}
+
+	return &Tracker{
+		sat: satellite.TLEToSat(line1, line2, satellite.GravityWGS72),
+		obs: obs,
+	}, nil
+}
+
+// Returns the satellite's position relative to the observer at t.
+func (t *Tracker) Look(at time.Time) (Look, error) {
+	at = at.UTC()
+	whole := at.Truncate(time.Second)
+	pos, vel := satellite.Propagate(t.sat, whole.Year(), int(whole.Month()), whole.Day(),
+		whole.Hour(), whole.Minute(), whole.Second())
+
+	// Propagation has one second resolution, extrapolate the remainder.
+	frac := at.Sub(whole).Seconds()
+	pos.X += vel.X * frac
+	pos.Y += vel.Y * frac
+	pos.Z += vel.Z * frac
+
+	if math.IsNaN(pos.X) || pos.X == 0 && pos.Y == 0 && pos.Z == 0 {
+		return Look{}, errors.New("doppler: propagation failed, TLE may be stale")
+	}
+
+	jday := satellite.JDay(whole.Year(), int(whole.Month()), whole.Day(),
+		whole.Hour(), whole.Minute(), whole.Second()) + frac/86400
+
+	geo := satellite.LatLong{
+		Latitude:  t.obs.Latitude * satellite.DEG2RAD,
+		Longitude: t.obs.Longitude * satellite.DEG2RAD,
+	}
+	alt := t.obs.Altitude / 1000
+	angles := satellite.ECIToLookAngles(pos, geo, alt, jday)
+
+	// The observer moves with the earth's rotation.
+	obs := satellite.LLAToECI(geo, alt, jday)
+	rx, ry, rz := pos.X-obs.X, pos.Y-obs.Y, pos.Z-obs.Z
+	vx := vel.X + earthRotation*obs.Y
+	vy := vel.Y - earthRotation*obs.X
+	vz := vel.Z
+	rng := math.Sqrt(rx*rx + ry*ry + rz*rz)
+
+	return Look{
+		Azimuth:   angles.Az * satellite.RAD2DEG,
+		Elevation: angles.El * satellite.RAD2DEG,
+		Range:     rng * 1000,
+		RangeRate: (rx*vx + ry*vy + rz*vz) / rng * 1000,
+	}, nil
+}
+
+// Returns the Doppler shift in Hz of a transmission at freq Hz received at
+// t.
+func (t *Tracker) Shift(freq float64, at time.Time) (float64, error) {
+	look, err := t.Look(at)
+	if err != nil {
+		return 0, err
+	}
+	return -look.RangeRate / speedOfLight * freq, nil
+}
+
+// Tuner is the part of a source Follow retunes.
+type Tuner interface {
+	SetCenterFreq(uint32) error
+}
+
+// Retunes tuner every interval so a downlink at freq Hz stays at the
+// center, until ctx is done. Retuning is skipped while the correction has
+// changed by less than step Hz.
+func (t *Tracker) Follow(ctx context.Context, tuner Tuner, freq float64, interval time.Duration, step float64) error {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	last := math.Inf(1)
+	for {
+		shift, err := t.Shift(freq, time.Now())
+		if err != nil {
+			return err
+		}
+		if math.Abs(shift-last) >= step {
+			if err := tuner.SetCenterFreq(uint32(math.Round(freq + shift))); err != nil {
+				return fmt.Errorf("Error retuning: %s", err)
+			}
+			last = shift
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Corrector removes Doppler shift from samples digitally, for receivers
+// left tuned to a fixed frequency. The offset is re-evaluated for every
+// call and mixing is phase continuous across calls.
+type Corrector struct {
+	// Downlink frequency in Hz.
+	Freq float64
+
+	tracker *Tracker
+	phase   float64
+}
+
+// Returns a corrector for a downlink of freq Hz.
+func (t *Tracker) Corrector(freq float64) *Corrector {
+	return &Corrector{Freq: freq, tracker: t}
+}
+
+// Shifts src, sampled at rate Hz with its first sample captured at start,
+// and appends the result to dst.
+func (c *Corrector) Process(dst, src []complex64, start time.Time, rate float64) ([]complex64, error) {
+	shift, err := c.tracker.Shift(c.Freq, start)
+	if err != nil {
+		return dst, err
+	}
+
+	step := -2 * math.Pi * shift / rate
+	for _, v := range src {
+		s, co := math.Sincos(c.phase)
+		dst = append(dst, v*complex(float32(co), float32(s)))
+		c.phase += step
+	}
+	c.phase = math.Mod(c.phase, 2*math.Pi)
+
+	return dst, nil
+}
+
+// Corrects a block of unsigned 8-bit IQ samples, see Process.
+func (c *Corrector) ProcessU8(dst []complex64, src []byte, start time.Time, rate float64) ([]complex64, error) {
+	return c.Process(dst, dsp.ConvertU8(nil, src), start, rate)
+}
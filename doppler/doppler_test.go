@@ -0,0 +1,76 @@
+package doppler
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+)
+
+// ISS (ZARYA)
+const (
+	line1 = "1 25544U 98067A   24001.50000000  .00016717  00000-0  30375-3 0  9991"
+	line2 = "2 25544  51.6416 247.4627 0006703 130.5360 325.0288 15.49815203432586"
+)
+
+func TestTracker(t *testing.T) {
+	tr, err := NewTracker(line1, line2, Observer{Latitude: 40, Longitude: -105, Altitude: 1600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	epoch := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for m := 0; m < 90; m += 7 {
+		at := epoch.Add(time.Duration(m) * time.Minute)
+		look, err := tr.Look(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := tr.Look(at.Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if look.Range < 300e3 || look.Range > 14000e3 {
+			t.Errorf("%s: implausible range %.0f m", at, look.Range)
+		}
+		// Range rate matches the change in range over a second.
+		if d := next.Range - look.Range; math.Abs(d-look.RangeRate) > 20 {
+			t.Errorf("%s: range rate %.1f m/s, range changed %.1f m", at, look.RangeRate, d)
+		}
+
+		shift, err := tr.Shift(437e6, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(shift) > 12e3 || math.Signbit(shift) != math.Signbit(-look.RangeRate) {
+			t.Errorf("%s: shift %.0f Hz for range rate %.1f m/s", at, shift, look.RangeRate)
+		}
+	}
+}
+
+func TestCorrector(t *testing.T) {
+	tr, err := NewTracker(line1, line2, Observer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const rate = 48000
+	at := time.Date(2024, 1, 1, 12, 5, 0, 0, time.UTC)
+	shift, _ := tr.Shift(145.8e6, at)
+
+	// A tone at the predicted shift is moved to DC.
+	src := make([]complex64, 4800)
+	for i := range src {
+		src[i] = complex64(cmplx.Rect(1, 2*math.Pi*shift*float64(i)/rate))
+	}
+	out, err := tr.Corrector(145.8e6).Process(nil, src, at, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range out {
+		if cmplx.Abs(complex128(v)-1) > 1e-3 {
+			t.Fatalf("sample %d: %v, want 1", i, v)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package dsp
+
+import (
+	"math"
+	"time"
+)
+
+// Defaults for AGCConfig.
+const (
+	DefaultAGCTarget  = 0.5
+	DefaultAGCAttack  = 5 * time.Millisecond
+	DefaultAGCDecay   = 500 * time.Millisecond
+	DefaultAGCMaxGain = 1e4 // 80 dB.
+)
+
+// Parameters of an AGC, defaults used for zero fields.
+type AGCConfig struct {
+	// Envelope level output is scaled to, full scale being 1.
+	Target float64
+	// Time constants with which the envelope follows rising and falling
+	// input. A short attack keeps bursts from clipping, a long decay
+	// keeps gain from pumping up in the gaps between words.
+	Attack, Decay time.Duration
+	// Largest factor applied, limiting how far noise is amplified in the
+	// absence of a signal.
+	MaxGain float64
+}
+
+// AGC is a digital automatic gain control, scaling a stream so its envelope
+// stays at a target level across signals of different strength. It works
+// on demodulated audio or on I/Q ahead of a demodulator, independent of the
+// tuner's hardware AGC.
+type AGC[T float32 | complex64] struct {
+	target, maxGain float64
+	attack, decay   float64 // Smoothing factors per sample.
+
+	env     float64 // Envelope estimate.
+	started bool
+}
+
+// Returns an AGC for a stream of rate samples per second.
+func NewAGC[T float32 | complex64](cfg AGCConfig, rate float64) *AGC[T] {
+	if cfg.Target <= 0 {
+		cfg.Target = DefaultAGCTarget
+	}
+	if cfg.Attack <= 0 {
+		cfg.Attack = DefaultAGCAttack
+	}
+	if cfg.Decay <= 0 {
+		cfg.Decay = DefaultAGCDecay
+	}
+	if cfg.MaxGain <= 0 {
+		cfg.MaxGain = DefaultAGCMaxGain
+	}
+	return &AGC[T]{
+		target:  cfg.Target,
+		maxGain: cfg.MaxGain,
+		attack:  smoothing(cfg.Attack, rate),
+		decay:   smoothing(cfg.Decay, rate),
+	}
+}
+
+// Returns the factor of a one pole smoother with time constant tau.
+func smoothing(tau time.Duration, rate float64) float64 {
+	return 1 - math.Exp(-1/(tau.Seconds()*rate))
+}
+
+// Scales src and appends the result to dst, returning the extended slice.
+func (a *AGC[T]) Process(dst, src []T) []T {
+	for _, s := range src {
+		mag := magnitude(s)
+		if !a.started {
+			a.env, a.started = mag, true
+		}
+		if mag > a.env {
+			a.env += a.attack * (mag - a.env)
+		} else {
+			a.env += a.decay * (mag - a.env)
+		}
+		dst = append(dst, scale(s, a.Gain()))
+	}
+	return dst
+}
+
+// Returns the factor currently applied.
+func (a *AGC[T]) Gain() float64 {
+	if a.env*a.maxGain <= a.target {
+		return a.maxGain
+	}
+	return a.target / a.env
+}
+
+// Clears the envelope estimate, as if newly created.
+func (a *AGC[T]) Reset() {
+	a.env, a.started = 0, false
+}
+
+func magnitude[T float32 | complex64](s T) float64 {
+	switch v := any(s).(type) {
+	case float32:
+		return math.Abs(float64(v))
+	case complex64:
+		return math.Hypot(float64(real(v)), float64(imag(v)))
+	}
+	return 0
+}
+
+func scale[T float32 | complex64](s T, gain float64) T {
+	switch v := any(s).(type) {
+	case float32:
+		return any(v * float32(gain)).(T)
+	case complex64:
+		return any(v * complex(float32(gain), 0)).(T)
+	}
+	return s
+}
@@ -0,0 +1,40 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAGC(t *testing.T) {
+	const rate, tone = 48000, 1000
+	agc := NewAGC[float32](AGCConfig{Target: 0.5, Attack: time.Millisecond, Decay: 50 * time.Millisecond, MaxGain: 1000}, rate)
+
+	// A weak signal then a strong one, a quarter second each, then silence.
+	peak := func(amplitude float32) float64 {
+		src := make([]float32, rate/4)
+		for i := range src {
+			src[i] = amplitude * float32(math.Sin(2*math.Pi*tone*float64(i)/rate))
+		}
+		out := agc.Process(nil, src)
+		var p float64
+		for _, s := range out[len(out)/2:] {
+			p = math.Max(p, math.Abs(float64(s)))
+		}
+		return p
+	}
+	for _, amplitude := range []float32{0.01, 0.9} {
+		if p := peak(amplitude); math.Abs(p-0.5) > 0.1 {
+			t.Errorf("amplitude %g peaks at %.3f", amplitude, p)
+		}
+	}
+	if agc.Process(nil, make([]float32, rate)); agc.Gain() != 1000 {
+		t.Errorf("gain %g in silence", agc.Gain())
+	}
+
+	iq := NewAGC[complex64](AGCConfig{}, rate)
+	out := iq.Process(nil, []complex64{3i, 3i})
+	if out[1] != complex64(DefaultAGCTarget*1i) {
+		t.Errorf("scaled to %v", out[1])
+	}
+}
@@ -0,0 +1,106 @@
+package dsp
+
+import (
+	"io"
+	"unsafe"
+)
+
+// Maps unsigned 8-bit samples to floats centered on zero.
+var u8Table [256]float32
+
+// Scale of a sample step, multiplied rather than divided by, as in the
+// vector conversions.
+const u8Scale float32 = 1 / 127.5
+
+func init() {
+	for i := range u8Table {
+		// Rounded before subtracting, never fused, to match the vector
+		// conversions exactly.
+		u8Table[i] = float32(float32(i)*u8Scale) - 1
+	}
+}
+
+// Converts interleaved unsigned 8-bit IQ, as delivered by rtl_tcp, to complex
+// samples between -1 and 1 and appends them to dst. A trailing odd byte is
+// ignored.
+func ConvertU8(dst []complex64, src []byte) []complex64 {
+	n := len(src) / 2
+	if n == 0 {
+		return dst
+	}
+	if cap(dst)-len(dst) < n {
+		grown := make([]complex64, len(dst), len(dst)+n)
+		copy(grown, dst)
+		dst = grown
+	}
+	out := dst[len(dst) : len(dst)+n]
+
+	// A complex64 is laid out as its real and imaginary float32 parts, the
+	// same order as the interleaved samples.
+	convertU8(unsafe.Slice((*float32)(unsafe.Pointer(&out[0])), 2*n), src[:2*n])
+	return dst[:len(dst)+n]
+}
+
+// Converts unsigned 8-bit samples to floats between -1 and 1 as ConvertU8
+// does, keeping I and Q interleaved, and appends them to dst.
+func ConvertU8Float32(dst []float32, src []byte) []float32 {
+	if cap(dst)-len(dst) < len(src) {
+		grown := make([]float32, len(dst), len(dst)+len(src))
+		copy(grown, dst)
+		dst = grown
+	}
+	convertU8(dst[len(dst):len(dst)+len(src)], src)
+	return dst[:len(dst)+len(src)]
+}
+
+// Converts src into dst, of equal length, one float per byte.
+func convertU8Generic(dst []float32, src []byte) {
+	dst = dst[:len(src)]
+	for i, b := range src {
+		dst[i] = u8Table[b]
+	}
+}
+
+// IQReader adapts a stream of interleaved unsigned 8-bit IQ, such as an
+// rtltcp.SDR, to numeric code reading complex samples.
+type IQReader struct {
+	r   io.Reader
+	buf []byte
+	odd bool // buf[0] holds the I of a sample whose Q is yet to be read.
+}
+
+// Returns a reader converting samples read from r.
+func NewIQReader(r io.Reader) *IQReader {
+	return &IQReader{r: r}
+}
+
+// Reads up to len(dst) samples into dst, converted as by ConvertU8, and
+// returns the number read. Like io.Reader it may return fewer samples than
+// requested, and a sample split between reads of the stream is completed by
+// the next call.
+func (r *IQReader) ReadComplex(dst []complex64) (n int, err error) {
+	if len(dst) == 0 {
+		return 0, nil
+	}
+	if cap(r.buf) < 2*len(dst) {
+		buf := make([]byte, 2*len(dst))
+		// Carrying over a held I.
+		copy(buf, r.buf[:min(1, len(r.buf))])
+		r.buf = buf
+	}
+	buf := r.buf[:2*len(dst)]
+
+	start := 0
+	if r.odd {
+		start = 1
+	}
+	m, err := r.r.Read(buf[start:])
+	m += start
+
+	n = m / 2
+	ConvertU8(dst[:0], buf[:2*n])
+	if r.odd = m%2 == 1; r.odd {
+		buf[0] = buf[m-1]
+	}
+	return n, err
+}
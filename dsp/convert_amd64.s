@@ -0,0 +1,65 @@
+#include "textflag.h"
+
+// 1/127.5 and 1 as float32s in each lane.
+DATA u8Scale<>+0(SB)/4, $0x3c008081
+DATA u8Scale<>+4(SB)/4, $0x3c008081
+DATA u8Scale<>+8(SB)/4, $0x3c008081
+DATA u8Scale<>+12(SB)/4, $0x3c008081
+GLOBL u8Scale<>(SB), RODATA|NOPTR, $16
+DATA u8One<>+0(SB)/4, $0x3f800000
+DATA u8One<>+4(SB)/4, $0x3f800000
+DATA u8One<>+8(SB)/4, $0x3f800000
+DATA u8One<>+12(SB)/4, $0x3f800000
+GLOBL u8One<>(SB), RODATA|NOPTR, $16
+
+// func convertU8Asm(dst *float32, src *byte, n int)
+TEXT ·convertU8Asm(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+	PXOR X0, X0
+	MOVUPS u8Scale<>(SB), X6
+	MOVUPS u8One<>(SB), X7
+
+loop:
+	CMPQ CX, $16
+	JB   done
+
+	// Widen 16 bytes to four vectors of 32-bit integers.
+	MOVOU     (SI), X1
+	MOVO      X1, X3
+	PUNPCKLBW X0, X1
+	PUNPCKHBW X0, X3
+	MOVO      X1, X2
+	PUNPCKLWL X0, X1
+	PUNPCKHWL X0, X2
+	MOVO      X3, X4
+	PUNPCKLWL X0, X3
+	PUNPCKHWL X0, X4
+
+	// x/127.5 - 1, rounded exactly as the lookup table.
+	CVTPL2PS X1, X1
+	CVTPL2PS X2, X2
+	CVTPL2PS X3, X3
+	CVTPL2PS X4, X4
+	MULPS    X6, X1
+	MULPS    X6, X2
+	MULPS    X6, X3
+	MULPS    X6, X4
+	SUBPS    X7, X1
+	SUBPS    X7, X2
+	SUBPS    X7, X3
+	SUBPS    X7, X4
+
+	MOVUPS X1, (DI)
+	MOVUPS X2, 16(DI)
+	MOVUPS X3, 32(DI)
+	MOVUPS X4, 48(DI)
+
+	ADDQ $16, SI
+	ADDQ $64, DI
+	SUBQ $16, CX
+	JMP  loop
+
+done:
+	RET
@@ -0,0 +1,63 @@
+#include "textflag.h"
+
+// 1/127.5 and 1 as float32s in each lane.
+DATA u8Scale<>+0(SB)/4, $0x3c008081
+DATA u8Scale<>+4(SB)/4, $0x3c008081
+DATA u8Scale<>+8(SB)/4, $0x3c008081
+DATA u8Scale<>+12(SB)/4, $0x3c008081
+GLOBL u8Scale<>(SB), RODATA|NOPTR, $16
+DATA u8One<>+0(SB)/4, $0x3f800000
+DATA u8One<>+4(SB)/4, $0x3f800000
+DATA u8One<>+8(SB)/4, $0x3f800000
+DATA u8One<>+12(SB)/4, $0x3f800000
+GLOBL u8One<>(SB), RODATA|NOPTR, $16
+
+// The assembler lacks vector UCVTF, FMUL and FSUB, they are encoded by hand
+// for the .4S arrangement. FMLA would fuse the rounding the table doesn't.
+#define UCVTF(n, d) WORD $(0x6e21d800 | (n)<<5 | (d))
+#define FMUL(m, n, d) WORD $(0x6e20dc00 | (m)<<16 | (n)<<5 | (d))
+#define FSUB(m, n, d) WORD $(0x4ea0d400 | (m)<<16 | (n)<<5 | (d))
+
+// func convertU8Asm(dst *float32, src *byte, n int)
+TEXT ·convertU8Asm(SB), NOSPLIT, $0-24
+	MOVD dst+0(FP), R0
+	MOVD src+8(FP), R1
+	MOVD n+16(FP), R2
+	MOVD $u8Scale<>(SB), R3
+	VLD1 (R3), [V6.S4]
+	MOVD $u8One<>(SB), R3
+	VLD1 (R3), [V7.S4]
+
+loop:
+	CMP $16, R2
+	BLT done
+
+	// Widen 16 bytes to four vectors of 32-bit integers.
+	VLD1.P 16(R1), [V0.B16]
+	VUXTL  V0.B8, V1.H8
+	VUXTL2 V0.B16, V2.H8
+	VUXTL  V1.H4, V16.S4
+	VUXTL2 V1.H8, V17.S4
+	VUXTL  V2.H4, V18.S4
+	VUXTL2 V2.H8, V19.S4
+
+	// x/127.5 - 1, rounded exactly as the lookup table.
+	UCVTF(16, 16)
+	UCVTF(17, 17)
+	UCVTF(18, 18)
+	UCVTF(19, 19)
+	FMUL(6, 16, 16)
+	FMUL(6, 17, 17)
+	FMUL(6, 18, 18)
+	FMUL(6, 19, 19)
+	FSUB(7, 16, 16)
+	FSUB(7, 17, 17)
+	FSUB(7, 18, 18)
+	FSUB(7, 19, 19)
+
+	VST1.P [V16.S4, V17.S4, V18.S4, V19.S4], 64(R0)
+	SUB    $16, R2
+	B      loop
+
+done:
+	RET
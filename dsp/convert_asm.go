@@ -0,0 +1,20 @@
+//go:build amd64 || arm64
+
+package dsp
+
+// Bytes converted per iteration of convertU8Asm.
+const convertChunk = 16
+
+// Converts n bytes, a multiple of convertChunk, as convertU8Generic using
+// SSE2 or NEON, both present on every CPU of their architecture.
+//
+//go:noescape
+func convertU8Asm(dst *float32, src *byte, n int)
+
+func convertU8(dst []float32, src []byte) {
+	n := len(src) &^ (convertChunk - 1)
+	if n > 0 {
+		convertU8Asm(&dst[0], &src[0], n)
+	}
+	convertU8Generic(dst[n:], src[n:])
+}
@@ -0,0 +1,7 @@
+//go:build !amd64 && !arm64
+
+package dsp
+
+func convertU8(dst []float32, src []byte) {
+	convertU8Generic(dst, src)
+}
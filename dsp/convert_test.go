@@ -0,0 +1,84 @@
+package dsp
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+)
+
+func TestConvertU8(t *testing.T) {
+	src := make([]byte, 1000)
+	for i := range src {
+		src[i] = byte(i * 7)
+	}
+
+	// Every length and alignment exercises the vector loop and its tail.
+	for off := 0; off < 4; off++ {
+		for n := 0; n+off <= 100; n++ {
+			in := src[off : off+n]
+			got := ConvertU8Float32([]float32{9}, in)
+			if len(got) != n+1 || got[0] != 9 {
+				t.Fatalf("%d bytes at %d: converted to %d floats", n, off, len(got))
+			}
+			for i, b := range in {
+				if got[i+1] != u8Table[b] {
+					t.Fatalf("%d bytes at %d: byte %d converted to %v, want %v", n, off, i, got[i+1], u8Table[b])
+				}
+			}
+
+			iq := ConvertU8(nil, in)
+			if len(iq) != n/2 {
+				t.Fatalf("%d bytes converted to %d samples", n, len(iq))
+			}
+			for i, s := range iq {
+				if s != complex(u8Table[in[2*i]], u8Table[in[2*i+1]]) {
+					t.Fatalf("%d bytes at %d: sample %d converted to %v", n, off, i, s)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkConvertU8(b *testing.B) {
+	src := make([]byte, 16384)
+	dst := make([]complex64, 0, len(src)/2)
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		ConvertU8(dst, src)
+	}
+}
+
+func BenchmarkConvertU8Generic(b *testing.B) {
+	src := make([]byte, 16384)
+	dst := make([]float32, len(src))
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		convertU8Generic(dst, src)
+	}
+}
+
+func TestIQReader(t *testing.T) {
+	src := make([]byte, 64)
+	for i := range src {
+		src[i] = byte(i*37 + 11)
+	}
+	want := ConvertU8(nil, src)
+
+	// Reads of one byte leave samples split between calls, which ask for
+	// more samples each time, growing the buffer.
+	r := NewIQReader(iotest.OneByteReader(bytes.NewReader(src)))
+	var got []complex64
+	for size := 1; len(got) < len(want); size++ {
+		dst := make([]complex64, size)
+		n, err := r.ReadComplex(dst)
+		if err != nil {
+			t.Fatalf("read %d: %s", size, err)
+		}
+		got = append(got, dst[:n]...)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d: got %v, expected %v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Estimates the delay of b relative to a from the peak of their cross
+// correlation, so that b[n] ≈ a[n-lag]. The lag is refined to a fraction of
+// a sample by parabolic interpolation around the peak. Peak is the
+// normalized correlation coefficient at the peak, its magnitude near 1 for
+// identical signals and its phase the carrier phase of b relative to a.
+func CrossCorrelate(a, b []complex64) (lag float64, peak complex128) {
+	n := 1
+	for n < len(a)+len(b) {
+		n <<= 1
+	}
+
+	fa := make([]complex64, n)
+	fb := make([]complex64, n)
+	copy(fa, a)
+	copy(fb, b)
+
+	fft := NewFFT(n)
+	fft.Forward(fa)
+	fft.Forward(fb)
+	for i := range fb {
+		fb[i] *= complex64(cmplx.Conj(complex128(fa[i])))
+	}
+	fft.Inverse(fb)
+
+	best := 0
+	for i := range fb {
+		if cmplx.Abs(complex128(fb[i])) > cmplx.Abs(complex128(fb[best])) {
+			best = i
+		}
+	}
+
+	// Fit a parabola through the peak and its neighbors.
+	mag := func(i int) float64 { return cmplx.Abs(complex128(fb[(i+n)%n])) }
+	y0, y1, y2 := mag(best-1), mag(best), mag(best+1)
+	frac := 0.0
+	if d := y0 - 2*y1 + y2; d != 0 {
+		frac = 0.5 * (y0 - y2) / d
+	}
+
+	lag = float64(best) + frac
+	if best > n/2 {
+		lag -= float64(n)
+	}
+
+	ea, eb := energy(a), energy(b)
+	if ea > 0 && eb > 0 {
+		peak = complex128(fb[best]) / complex(math.Sqrt(ea*eb), 0)
+	}
+
+	return
+}
+
+// Returns n windowed-sinc taps delaying a signal by (n-1)/2 + delay
+// samples, for fractional delays between -0.5 and 0.5.
+func FractionalDelay(n int, delay float64, w WindowType) []float64 {
+	taps := make([]float64, n)
+	win := Window(w, n)
+	center := float64(n-1)/2 + delay
+
+	var sum float64
+	for i := range taps {
+		taps[i] = sinc(float64(i)-center) * win[i]
+		sum += taps[i]
+	}
+
+	for i := range taps {
+		taps[i] /= sum
+	}
+
+	return taps
+}
+
+func energy(x []complex64) (e float64) {
+	for _, v := range x {
+		e += float64(real(v)*real(v) + imag(v)*imag(v))
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Taps of a DDC's anti-aliasing filter per unit of decimation.
+const ddcTaps = 16
+
+// Samples between renormalizations of a DDC's oscillator, which otherwise
+// drifts in magnitude as rounding errors accumulate.
+const ddcRenormalize = 1024
+
+// DDC is a digital downconverter selecting a narrow channel of a wideband
+// stream: it shifts the channel to DC, low pass filters and decimates, so a
+// narrowband consumer processes only the samples it needs.
+type DDC struct {
+	decim  int
+	step   complex128 // Oscillator rotation per input sample.
+	osc    complex128
+	count  int // Samples since the oscillator was renormalized.
+	filter Filter
+	phase  int // Filtered samples to skip before the next output.
+
+	mixed, filtered []complex64
+}
+
+// Returns a downconverter for a channel offset Hz from the center of a
+// stream of rate samples per second, decimating by decim. A decimation of
+// one or less only shifts the channel.
+func NewDDC(offset, rate float64, decim int) *DDC {
+	if decim < 1 {
+		decim = 1
+	}
+	d := &DDC{decim: decim, osc: 1}
+	if offset != 0 {
+		d.step = cmplx.Rect(1, -2*math.Pi*offset/rate)
+	}
+	if decim > 1 {
+		d.filter = NewFilter(LowPass(ddcTaps*decim+1, 0.5/float64(decim), Blackman))
+	}
+	return d
+}
+
+// Returns the decimation factor.
+func (d *DDC) Decimation() int {
+	return d.decim
+}
+
+// Downconverts src and appends the result to dst, returning the extended
+// slice. Each call yields about len(src)/Decimation samples, the filter
+// holds back a share of them until later calls.
+func (d *DDC) Process(dst, src []complex64) []complex64 {
+	in := src
+	if d.step != 0 {
+		d.mixed = d.mixed[:0]
+		for _, s := range src {
+			d.mixed = append(d.mixed, s*complex64(d.osc))
+			d.osc *= d.step
+			if d.count++; d.count == ddcRenormalize {
+				d.osc /= complex(cmplx.Abs(d.osc), 0)
+				d.count = 0
+			}
+		}
+		in = d.mixed
+	}
+	if d.filter == nil {
+		return append(dst, in...)
+	}
+
+	d.filtered = d.filter.Process(d.filtered[:0], in)
+	for ; d.phase < len(d.filtered); d.phase += d.decim {
+		dst = append(dst, d.filtered[d.phase])
+	}
+	d.phase -= len(d.filtered)
+	return dst
+}
+
+// Clears filter and oscillator state, as if newly created.
+func (d *DDC) Reset() {
+	d.osc, d.count, d.phase = 1, 0, 0
+	if d.filter != nil {
+		d.filter.Reset()
+	}
+}
@@ -0,0 +1,71 @@
+package dsp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"testing/iotest"
+)
+
+func ExamplePipeline() {
+	p := NewPipeline(context.Background())
+
+	// Produce ten blocks of a constant signal.
+	blocks := 0
+	src := Source(p, func() ([]complex64, error) {
+		if blocks == 10 {
+			return nil, io.EOF
+		}
+		blocks++
+
+		buf := make([]complex64, 1000)
+		for i := range buf {
+			buf[i] = 1
+		}
+		return buf, nil
+	})
+
+	// Low-pass filter, then take the magnitude of each sample.
+	filtered := Then[complex64, complex64](p, src, NewFilter(LowPass(31, 0.1, Hamming)))
+	mag := Then(p, filtered, BlockFunc[complex64, float32](func(dst []float32, src []complex64) []float32 {
+		for _, s := range src {
+			dst = append(dst, real(s)*real(s)+imag(s)*imag(s))
+		}
+		return dst
+	}))
+
+	var n int
+	Sink(p, mag, func(buf []float32) error {
+		n += len(buf)
+		return nil
+	})
+
+	if err := p.Wait(); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(n)
+	// Output: 10000
+}
+
+func ExampleIQReader() {
+	// A stream delivering one byte per read splits every sample.
+	stream := iotest.OneByteReader(bytes.NewReader([]byte{255, 0, 0, 255}))
+	r := NewIQReader(stream)
+
+	iq := make([]complex64, 2)
+	for {
+		n, err := r.ReadComplex(iq)
+		for _, s := range iq[:n] {
+			fmt.Printf("%.0f\n", s)
+		}
+		if err != nil {
+			break
+		}
+	}
+	// Output:
+	// (1-1i)
+	// (-1+1i)
+}
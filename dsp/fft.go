@@ -0,0 +1,99 @@
+package dsp
+
+import (
+	"math"
+	"math/bits"
+)
+
+// FFT computes in-place radix-2 fast fourier transforms of a fixed length.
+// Twiddle factors and the bit-reversal permutation are computed once, so a
+// single FFT should be reused for every transform of the same size. An FFT
+// is not safe for concurrent use.
+type FFT struct {
+	n       int
+	twiddle []complex64
+	rev     []int
+}
+
+// Returns an FFT of length n, which must be a power of two.
+func NewFFT(n int) *FFT {
+	if n < 1 || n&(n-1) != 0 {
+		panic("dsp: fft length must be a power of two")
+	}
+
+	f := &FFT{
+		n:       n,
+		twiddle: make([]complex64, n/2),
+		rev:     make([]int, n),
+	}
+
+	for i := range f.twiddle {
+		s, c := math.Sincos(-2 * math.Pi * float64(i) / float64(n))
+		f.twiddle[i] = complex(float32(c), float32(s))
+	}
+
+	shift := bits.UintSize - bits.Len(uint(n-1))
+	for i := range f.rev {
+		if n > 1 {
+			f.rev[i] = int(bits.Reverse(uint(i)) >> shift)
+		}
+	}
+
+	return f
+}
+
+// Returns the transform length.
+func (f *FFT) Len() int {
+	return f.n
+}
+
+// Transforms x in-place from time to frequency domain.
+func (f *FFT) Forward(x []complex64) {
+	f.transform(x, false)
+}
+
+// Transforms x in-place from frequency to time domain, including the 1/n
+// scaling so that Inverse(Forward(x)) == x.
+func (f *FFT) Inverse(x []complex64) {
+	f.transform(x, true)
+
+	scale := complex(1/float32(f.n), 0)
+	for i := range x {
+		x[i] *= scale
+	}
+}
+
+func (f *FFT) transform(x []complex64, inverse bool) {
+	if len(x) != f.n {
+		panic("dsp: fft input length mismatch")
+	}
+
+	for i, j := range f.rev {
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= f.n; size <<= 1 {
+		half := size >> 1
+		step := f.n / size
+		for start := 0; start < f.n; start += size {
+			for k := 0; k < half; k++ {
+				w := f.twiddle[k*step]
+				if inverse {
+					w = complex(real(w), -imag(w))
+				}
+				a, b := x[start+k], x[start+k+half]*w
+				x[start+k], x[start+k+half] = a+b, a-b
+			}
+		}
+	}
+}
+
+// Rotates the spectrum so the zero frequency bin is in the center.
+func FFTShift(x []complex64) {
+	half := len(x) / 2
+	for i := 0; i < half; i++ {
+		x[i], x[i+half] = x[i+half], x[i]
+	}
+}
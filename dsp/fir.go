@@ -0,0 +1,198 @@
+package dsp
+
+import "math"
+
+// Below this many taps direct convolution is cheaper than overlap-save.
+const fftFilterThreshold = 64
+
+// Returns n windowed-sinc low-pass taps with unity gain at DC. Cutoff is
+// normalized to the sample rate and must be between 0 and 0.5.
+func LowPass(n int, cutoff float64, w WindowType) []float64 {
+	taps := make([]float64, n)
+	win := Window(w, n)
+	center := float64(n-1) / 2
+
+	var sum float64
+	for i := range taps {
+		taps[i] = 2 * cutoff * sinc(2*cutoff*(float64(i)-center)) * win[i]
+		sum += taps[i]
+	}
+
+	for i := range taps {
+		taps[i] /= sum
+	}
+
+	return taps
+}
+
+// Returns n windowed-sinc high-pass taps with unity gain at Nyquist. The
+// spectral inversion used requires n to be odd.
+func HighPass(n int, cutoff float64, w WindowType) []float64 {
+	if n%2 == 0 {
+		panic("dsp: high-pass filter length must be odd")
+	}
+
+	taps := LowPass(n, cutoff, w)
+	for i := range taps {
+		taps[i] = -taps[i]
+	}
+	taps[n/2] += 1
+
+	return taps
+}
+
+// Returns n windowed-sinc band-pass taps passing frequencies between low and
+// high with unity gain at the center of the band.
+func BandPass(n int, low, high float64, w WindowType) []float64 {
+	if low >= high {
+		panic("dsp: band-pass low edge must be below high edge")
+	}
+
+	// Shift a low-pass of half the bandwidth up to the center of the band.
+	half := (high - low) / 2
+	center := (high + low) / 2
+	taps := LowPass(n, half, w)
+
+	mid := float64(n-1) / 2
+	for i := range taps {
+		taps[i] *= 2 * math.Cos(2*math.Pi*center*(float64(i)-mid))
+	}
+
+	return taps
+}
+
+// Filter is a streaming filter over complex samples.
+type Filter interface {
+	// Filters src and appends the result to dst, returning the extended slice.
+	Process(dst, src []complex64) []complex64
+	// Clears filter state.
+	Reset()
+}
+
+// Returns a streaming filter for the given taps, using overlap-save fast
+// convolution for long filters and direct convolution otherwise.
+func NewFilter(taps []float64) Filter {
+	if len(taps) >= fftFilterThreshold {
+		return NewFFTFilter(taps)
+	}
+	return NewFIR(taps)
+}
+
+// FIR is a direct-form streaming filter with real taps, producing one
+// output per input.
+type FIR struct {
+	taps []float32 // Reversed, so taps line up with the history window.
+	hist []complex64
+}
+
+// Returns a direct-form filter for the given taps.
+func NewFIR(taps []float64) *FIR {
+	f := &FIR{
+		taps: make([]float32, len(taps)),
+		hist: make([]complex64, len(taps)-1),
+	}
+	for i, t := range taps {
+		f.taps[len(taps)-1-i] = float32(t)
+	}
+	return f
+}
+
+func (f *FIR) Process(dst, src []complex64) []complex64 {
+	n := len(f.taps)
+	f.hist = append(f.hist, src...)
+
+	for i := 0; i+n <= len(f.hist); i++ {
+		window := f.hist[i : i+n]
+		var re, im float32
+		for k, t := range f.taps {
+			re += t * real(window[k])
+			im += t * imag(window[k])
+		}
+		dst = append(dst, complex(re, im))
+	}
+
+	f.hist = f.hist[:copy(f.hist, f.hist[len(f.hist)-(n-1):])]
+
+	return dst
+}
+
+func (f *FIR) Reset() {
+	f.hist = f.hist[:len(f.taps)-1]
+	for i := range f.hist {
+		f.hist[i] = 0
+	}
+}
+
+// FFTFilter convolves using the overlap-save method. Output is produced in
+// chunks as enough input accumulates, so it lags the input by up to one
+// chunk, but the output stream is identical to that of an equivalent FIR.
+type FFTFilter struct {
+	fft   *FFT
+	h     []complex64 // Frequency response of the taps.
+	ntaps int
+	buf   []complex64 // Overlap followed by pending input.
+	work  []complex64
+}
+
+// Returns an overlap-save filter for the given taps.
+func NewFFTFilter(taps []float64) *FFTFilter {
+	n := 1
+	for n < 4*len(taps) {
+		n <<= 1
+	}
+
+	f := &FFTFilter{
+		fft:   NewFFT(n),
+		h:     make([]complex64, n),
+		ntaps: len(taps),
+		buf:   make([]complex64, len(taps)-1, n),
+		work:  make([]complex64, n),
+	}
+
+	for i, t := range taps {
+		f.h[i] = complex(float32(t), 0)
+	}
+	f.fft.Forward(f.h)
+
+	return f
+}
+
+func (f *FFTFilter) Process(dst, src []complex64) []complex64 {
+	n := f.fft.Len()
+	overlap := f.ntaps - 1
+
+	for len(src) > 0 {
+		// Fill the block with pending input.
+		take := n - len(f.buf)
+		if take > len(src) {
+			take = len(src)
+		}
+		f.buf = append(f.buf, src[:take]...)
+		src = src[take:]
+
+		if len(f.buf) < n {
+			break
+		}
+
+		copy(f.work, f.buf)
+		f.fft.Forward(f.work)
+		for i := range f.work {
+			f.work[i] *= f.h[i]
+		}
+		f.fft.Inverse(f.work)
+
+		// The first overlap outputs are corrupted by circular wrap-around.
+		dst = append(dst, f.work[overlap:]...)
+
+		f.buf = f.buf[:copy(f.buf, f.buf[n-overlap:])]
+	}
+
+	return dst
+}
+
+func (f *FFTFilter) Reset() {
+	f.buf = f.buf[:f.ntaps-1]
+	for i := range f.buf {
+		f.buf[i] = 0
+	}
+}
@@ -0,0 +1,91 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+func TestFFTFilterMatchesFIR(t *testing.T) {
+	taps := BandPass(127, 0.05, 0.2, Hamming)
+	direct, fast := NewFIR(taps), NewFFTFilter(taps)
+
+	rng := rand.New(rand.NewSource(1))
+	src := make([]complex64, 10000)
+	for i := range src {
+		src[i] = complex(rng.Float32()-0.5, rng.Float32()-0.5)
+	}
+
+	var want, got []complex64
+	for i := 0; i < len(src); i += 777 {
+		end := i + 777
+		if end > len(src) {
+			end = len(src)
+		}
+		want = direct.Process(want, src[i:end])
+		got = fast.Process(got, src[i:end])
+	}
+
+	if len(got) == 0 || len(got) > len(want) {
+		t.Fatalf("got %d outputs, direct produced %d", len(got), len(want))
+	}
+	for i := range got {
+		if cmplx.Abs(complex128(got[i]-want[i])) > 1e-4 {
+			t.Fatalf("sample %d: got %v want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFilterResponse(t *testing.T) {
+	gain := func(taps []float64, freq float64) float64 {
+		var sum complex128
+		for i, h := range taps {
+			sum += complex(h, 0) * cmplx.Exp(complex(0, -2*math.Pi*freq*float64(i)))
+		}
+		return cmplx.Abs(sum)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		taps       []float64
+		pass, stop float64
+	}{
+		{"lowpass", LowPass(101, 0.1, Blackman), 0, 0.2},
+		{"highpass", HighPass(101, 0.1, Blackman), 0.5, 0},
+		{"bandpass", BandPass(101, 0.1, 0.2, Blackman), 0.15, 0.35},
+	} {
+		if g := gain(tc.taps, tc.pass); math.Abs(g-1) > 0.01 {
+			t.Errorf("%s: passband gain %f", tc.name, g)
+		}
+		if g := gain(tc.taps, tc.stop); g > 0.01 {
+			t.Errorf("%s: stopband gain %f", tc.name, g)
+		}
+	}
+}
+
+func TestCrossCorrelate(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	noise := make([]complex64, 8192)
+	for i := range noise {
+		noise[i] = complex(rng.Float32()-0.5, rng.Float32()-0.5)
+	}
+
+	// Band-limited reference, and a copy delayed by 5 + 15 + 0.3 samples
+	// with a carrier phase offset.
+	a := NewFIR(LowPass(63, 0.2, Blackman)).Process(nil, noise)
+	delayed := NewFIR(FractionalDelay(31, 0.3, Blackman)).Process(nil, a)
+	b := make([]complex64, len(a))
+	rot := complex64(cmplx.Rect(1, 0.7))
+	for i := 5; i < len(b); i++ {
+		b[i] = delayed[i-5] * rot
+	}
+
+	lag, peak := CrossCorrelate(a[1000:5000], b[1000:5000])
+	if math.Abs(lag-20.3) > 0.15 {
+		t.Errorf("lag: got %.3f, want 20.3", lag)
+	}
+	if math.Abs(cmplx.Phase(peak)-0.7) > 0.05 || cmplx.Abs(peak) < 0.9 {
+		t.Errorf("peak: got %.3f at %.3f rad", cmplx.Abs(peak), cmplx.Phase(peak))
+	}
+}
@@ -0,0 +1,58 @@
+package dsp
+
+import "math"
+
+// IQBalance is the amplitude and phase mismatch between the I and Q
+// branches of a receiver, which leaks each signal onto its mirror frequency
+// about the center. The zero value is a balanced receiver.
+type IQBalance struct {
+	Gain  float64 `json:"gain"`  // Amplitude of Q relative to I, less one.
+	Phase float64 `json:"phase"` // Radians Q deviates from quadrature.
+}
+
+// Estimates the imbalance of src blindly, from the correlation between I
+// and Q. The estimate assumes the received spectrum is symmetric about
+// neither the center nor any signal, such as noise or signals off center,
+// and improves with the number of samples.
+func MeasureIQBalance(src []complex64) (b IQBalance) {
+	if len(src) == 0 {
+		return
+	}
+	var mi, mq float64
+	for _, s := range src {
+		mi += float64(real(s))
+		mq += float64(imag(s))
+	}
+	mi /= float64(len(src))
+	mq /= float64(len(src))
+
+	var ii, qq, iq float64
+	for _, s := range src {
+		i, q := float64(real(s))-mi, float64(imag(s))-mq
+		ii += i * i
+		qq += q * q
+		iq += i * q
+	}
+	if ii == 0 || qq == 0 {
+		return
+	}
+	b.Gain = math.Sqrt(qq/ii) - 1
+	b.Phase = math.Asin(iq / math.Sqrt(ii*qq))
+	return
+}
+
+// Corrects src for the imbalance and appends the result to dst, returning
+// the extended slice. I is passed through, Q rescaled and rotated back into
+// quadrature with it.
+func (b IQBalance) Process(dst, src []complex64) []complex64 {
+	if b == (IQBalance{}) {
+		return append(dst, src...)
+	}
+	scale := float32(1 / ((1 + b.Gain) * math.Cos(b.Phase)))
+	leak := float32(math.Tan(b.Phase))
+	for _, s := range src {
+		i, q := real(s), imag(s)
+		dst = append(dst, complex(i, q*scale-i*leak))
+	}
+	return dst
+}
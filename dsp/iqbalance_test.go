@@ -0,0 +1,26 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestIQBalance(t *testing.T) {
+	const gain, phase = 0.05, 0.03
+	rng := rand.New(rand.NewSource(1))
+	src := make([]complex64, 1<<16)
+	for i := range src {
+		// Circular noise through a mismatched Q branch.
+		re, im := rng.NormFloat64(), rng.NormFloat64()
+		src[i] = complex64(complex(re, (1+gain)*(im*math.Cos(phase)+re*math.Sin(phase))))
+	}
+
+	b := MeasureIQBalance(src)
+	if math.Abs(b.Gain-gain) > 0.01 || math.Abs(b.Phase-phase) > 0.01 {
+		t.Fatalf("measured %+v", b)
+	}
+	if c := MeasureIQBalance(b.Process(nil, src)); math.Abs(c.Gain) > 1e-3 || math.Abs(c.Phase) > 1e-3 {
+		t.Errorf("corrected stream measures %+v", c)
+	}
+}
@@ -0,0 +1,165 @@
+package dsp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Default number of buffers queued between pipeline stages.
+const DefaultDepth = 4
+
+// Block is a processing stage which consumes src and appends its output to
+// dst, returning the extended slice. Filters, resamplers and demodulators in
+// this package all satisfy Block for their respective sample types.
+type Block[In, Out any] interface {
+	Process(dst []Out, src []In) []Out
+}
+
+// BlockFunc adapts an ordinary function to a Block.
+type BlockFunc[In, Out any] func(dst []Out, src []In) []Out
+
+func (f BlockFunc[In, Out]) Process(dst []Out, src []In) []Out {
+	return f(dst, src)
+}
+
+// Pipeline runs a chain of stages, each in its own goroutine, connected by
+// bounded channels. A slow stage fills the channel feeding it, which blocks
+// upstream stages in turn, so backpressure propagates to the source. The
+// first error returned by any stage stops the whole pipeline.
+//
+// Stages are added with Source, Then and Sink. Every buffer passed between
+// stages is freshly allocated and owned by the receiving stage.
+type Pipeline struct {
+	// Number of buffers queued between stages, DefaultDepth if zero.
+	Depth int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	once sync.Once
+	err  error
+}
+
+// Returns an empty pipeline which stops when ctx is cancelled.
+func NewPipeline(ctx context.Context) *Pipeline {
+	p := &Pipeline{}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	return p
+}
+
+// Stops all stages, Wait will return context.Canceled.
+func (p *Pipeline) Stop() {
+	p.fail(context.Canceled)
+}
+
+// Waits for all stages to exit and returns the first error encountered.
+// A source returning io.EOF is a clean shutdown and yields a nil error.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.cancel()
+	return p.err
+}
+
+func (p *Pipeline) fail(err error) {
+	p.once.Do(func() {
+		if !errors.Is(err, io.EOF) {
+			p.err = err
+		}
+		p.cancel()
+	})
+}
+
+func (p *Pipeline) depth() int {
+	if p.Depth <= 0 {
+		return DefaultDepth
+	}
+	return p.Depth
+}
+
+func (p *Pipeline) run(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn()
+	}()
+}
+
+// send delivers buf downstream, returning false if the pipeline stopped.
+func send[T any](p *Pipeline, out chan<- []T, buf []T) bool {
+	select {
+	case out <- buf:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// Adds a stage which repeatedly calls next and delivers each buffer to the
+// returned channel. The source ends when next returns an error, io.EOF ends
+// the pipeline cleanly once downstream stages have drained.
+func Source[T any](p *Pipeline, next func() ([]T, error)) <-chan []T {
+	out := make(chan []T, p.depth())
+	p.run(func() {
+		defer close(out)
+		for {
+			buf, err := next()
+			if len(buf) > 0 && !send(p, out, buf) {
+				return
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				p.fail(err)
+				return
+			}
+		}
+	})
+	return out
+}
+
+// Adds a stage which processes each buffer from in with blk.
+func Then[In, Out any](p *Pipeline, in <-chan []In, blk Block[In, Out]) <-chan []Out {
+	out := make(chan []Out, p.depth())
+	p.run(func() {
+		defer close(out)
+		for {
+			select {
+			case buf, ok := <-in:
+				if !ok {
+					return
+				}
+				if res := blk.Process(nil, buf); len(res) > 0 && !send(p, out, res) {
+					return
+				}
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	})
+	return out
+}
+
+// Adds a terminal stage which passes each buffer from in to sink. An error
+// from sink stops the pipeline.
+func Sink[T any](p *Pipeline, in <-chan []T, sink func([]T) error) {
+	p.run(func() {
+		for {
+			select {
+			case buf, ok := <-in:
+				if !ok {
+					return
+				}
+				if err := sink(buf); err != nil {
+					p.fail(err)
+					return
+				}
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package dsp
+
+import "math"
+
+// Floor added to powers before taking logarithms, so silence yields a large
+// negative value rather than -Inf.
+const powerFloor = 1e-20
+
+// Appends the squared magnitude of each sample of src to dst.
+func MagSquared(dst []float32, src []complex64) []float32 {
+	if cap(dst)-len(dst) < len(src) {
+		grown := make([]float32, len(dst), len(dst)+len(src))
+		copy(grown, dst)
+		dst = grown
+	}
+	magSquared(dst[len(dst):len(dst)+len(src)], src)
+	return dst[:len(dst)+len(src)]
+}
+
+// Computes the squared magnitudes of src into dst, of equal length.
+func magSquaredGeneric(dst []float32, src []complex64) {
+	dst = dst[:len(src)]
+	for i, v := range src {
+		// Rounded before adding, never fused, to match the vector versions.
+		dst[i] = float32(real(v)*real(v)) + float32(imag(v)*imag(v))
+	}
+}
+
+// Returns the mean squared magnitude of src, zero if it is empty.
+func MeanPower(src []complex64) float64 {
+	if len(src) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range src {
+		sum += float64(real(v)*real(v) + imag(v)*imag(v))
+	}
+	return sum / float64(len(src))
+}
+
+// Appends the power in dB of each sample of src to dst, as DB of the
+// squared magnitudes.
+func PowerDB(dst []float32, src []complex64) []float32 {
+	n := len(dst)
+	dst = MagSquared(dst, src)
+	out := dst[n:]
+	DB(out, out)
+	return dst
+}
+
+// Coefficients of a polynomial approximating log2(1+t) for t in [0, 1),
+// lowest degree first, accurate to 2e-5.
+var log2Poly = [...]float32{
+	1.6514670e-05, 1.4414924, -0.70648646, 0.40947029, -0.18748860, 0.043004956,
+}
+
+// Converts powers in src to dB in dst, which may be src itself, within
+// 0.0001 dB of 10*log10(p). Several times faster than math.Log10, for
+// spectra and meters converting every sample or bin.
+func DB(dst, src []float32) {
+	dst = dst[:len(src)]
+	for i, p := range src {
+		// Split into exponent and mantissa in [1, 2).
+		bits := math.Float32bits(p + powerFloor)
+		exp := float32(int32(bits>>23) - 127)
+		t := math.Float32frombits(bits&0x7fffff|0x3f800000) - 1
+
+		l := log2Poly[5]
+		l = l*t + log2Poly[4]
+		l = l*t + log2Poly[3]
+		l = l*t + log2Poly[2]
+		l = l*t + log2Poly[1]
+		l = l*t + log2Poly[0]
+		dst[i] = 10 * math.Log10E / math.Log2E * (exp + l)
+	}
+}
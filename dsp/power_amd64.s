@@ -0,0 +1,30 @@
+#include "textflag.h"
+
+// func magSquaredAsm(dst *float32, src *complex64, n int)
+TEXT ·magSquaredAsm(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+
+loop:
+	CMPQ CX, $4
+	JB   done
+
+	// Square four samples, then gather the real and imaginary parts.
+	MOVUPS (SI), X0
+	MOVUPS 16(SI), X1
+	MULPS  X0, X0
+	MULPS  X1, X1
+	MOVAPS X0, X2
+	SHUFPS $0x88, X1, X0
+	SHUFPS $0xdd, X1, X2
+	ADDPS  X2, X0
+	MOVUPS X0, (DI)
+
+	ADDQ $32, SI
+	ADDQ $16, DI
+	SUBQ $4, CX
+	JMP  loop
+
+done:
+	RET
@@ -0,0 +1,20 @@
+//go:build amd64 || arm64
+
+package dsp
+
+// Samples processed per iteration of magSquaredAsm.
+const magChunk = 4
+
+// Computes the squared magnitudes of n samples, a multiple of magChunk, as
+// magSquaredGeneric.
+//
+//go:noescape
+func magSquaredAsm(dst *float32, src *complex64, n int)
+
+func magSquared(dst []float32, src []complex64) {
+	n := len(src) &^ (magChunk - 1)
+	if n > 0 {
+		magSquaredAsm(&dst[0], &src[0], n)
+	}
+	magSquaredGeneric(dst[n:], src[n:])
+}
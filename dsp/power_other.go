@@ -0,0 +1,7 @@
+//go:build !amd64 && !arm64
+
+package dsp
+
+func magSquared(dst []float32, src []complex64) {
+	magSquaredGeneric(dst, src)
+}
@@ -0,0 +1,75 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPower(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	src := make([]complex64, 103)
+	for i := range src {
+		src[i] = complex(float32(rng.NormFloat64()), float32(rng.NormFloat64()))
+	}
+	src[5] = 0
+
+	mag := MagSquared([]float32{-1}, src)
+	db := PowerDB(nil, src)
+	if len(mag) != len(src)+1 || mag[0] != -1 || len(db) != len(src) {
+		t.Fatalf("%d magnitudes, %d powers of %d samples", len(mag), len(db), len(src))
+	}
+	for i, v := range src {
+		want := float32(real(v)*real(v)) + float32(imag(v)*imag(v))
+		if mag[i+1] != want {
+			t.Errorf("sample %d: squared magnitude %v, want %v", i, mag[i+1], want)
+		}
+		wantDB := 10 * math.Log10(float64(want)+powerFloor)
+		if math.Abs(float64(db[i])-wantDB) > 1e-4 {
+			t.Errorf("sample %d: %v dB, want %v", i, db[i], wantDB)
+		}
+	}
+}
+
+func BenchmarkMagSquared(b *testing.B) {
+	src := make([]complex64, 8192)
+	dst := make([]float32, 0, len(src))
+	b.SetBytes(int64(8 * len(src)))
+	for i := 0; i < b.N; i++ {
+		MagSquared(dst, src)
+	}
+}
+
+func BenchmarkMagSquaredNaive(b *testing.B) {
+	src := make([]complex64, 8192)
+	dst := make([]float32, 0, len(src))
+	b.SetBytes(int64(8 * len(src)))
+	for i := 0; i < b.N; i++ {
+		dst = dst[:0]
+		for _, v := range src {
+			dst = append(dst, real(v)*real(v)+imag(v)*imag(v))
+		}
+	}
+}
+
+func BenchmarkPowerDB(b *testing.B) {
+	src := make([]complex64, 8192)
+	dst := make([]float32, 0, len(src))
+	b.SetBytes(int64(8 * len(src)))
+	for i := 0; i < b.N; i++ {
+		PowerDB(dst, src)
+	}
+}
+
+func BenchmarkPowerDBNaive(b *testing.B) {
+	src := make([]complex64, 8192)
+	dst := make([]float32, 0, len(src))
+	b.SetBytes(int64(8 * len(src)))
+	for i := 0; i < b.N; i++ {
+		dst = dst[:0]
+		for _, v := range src {
+			p := real(v)*real(v) + imag(v)*imag(v)
+			dst = append(dst, float32(10*math.Log10(float64(p)+powerFloor)))
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package dsp provides signal processing primitives for working with samples
+// received from rtl_tcp.
+package dsp
+
+import "math"
+
+// Number of filter bank phases, fractional delays between phases are
+// linearly interpolated.
+const resamplePhases = 64
+
+// Taps per phase when no band limiting beyond the input rate is needed.
+const resampleTaps = 16
+
+// Resampler converts a real stream from one sample rate to another using a
+// polyphase filter bank. The ratio between rates is tracked exactly as a
+// rational number so the output rate never drifts, regardless of how the
+// rates relate to each other.
+type Resampler struct {
+	num, den int // Input samples advanced per output sample: num/den.
+
+	acc  int         // Position of the next output in units of 1/den samples.
+	bank [][]float32 // bank[phase][tap], resamplePhases+1 phases.
+	buf  []float32   // Filter history followed by unconsumed input.
+}
+
+// Returns a resampler converting from inRate to outRate samples per second.
+func NewResampler(inRate, outRate int) *Resampler {
+	if inRate <= 0 || outRate <= 0 {
+		panic("dsp: sample rates must be positive")
+	}
+
+	g := gcd(inRate, outRate)
+	r := &Resampler{
+		num: inRate / g,
+		den: outRate / g,
+	}
+
+	// When decimating the filter must also reject everything above the
+	// output Nyquist rate, which requires proportionally more taps.
+	ratio := math.Min(1, float64(outRate)/float64(inRate))
+	taps := int(math.Ceil(resampleTaps / ratio))
+	cutoff := 0.5 * ratio
+
+	// Design the prototype at the upsampled rate, normalized for unity gain
+	// at DC on every phase.
+	n := taps * resamplePhases
+	h := LowPass(n, cutoff/resamplePhases, Blackman)
+	scale := float64(resamplePhases)
+
+	r.bank = make([][]float32, resamplePhases+1)
+	for p := range r.bank {
+		r.bank[p] = make([]float32, taps)
+		for k := range r.bank[p] {
+			if idx := k*resamplePhases + p; idx < n {
+				r.bank[p][k] = float32(h[idx] * scale)
+			}
+		}
+	}
+
+	r.buf = make([]float32, taps-1)
+
+	return r
+}
+
+// Returns the number of input samples of delay introduced by the filter.
+func (r *Resampler) Delay() float64 {
+	return float64(len(r.bank[0])-1) / 2
+}
+
+// Resamples src and appends the result to dst, returning the extended slice.
+// Input that doesn't yet produce a complete output is retained for the next
+// call.
+func (r *Resampler) Process(dst, src []float32) []float32 {
+	r.buf = append(r.buf, src...)
+	taps := len(r.bank[0])
+
+	for {
+		i := r.acc / r.den
+		if i+taps > len(r.buf) {
+			break
+		}
+
+		// Fractional position between input samples selects the phase.
+		pf := float64(r.acc%r.den) / float64(r.den) * resamplePhases
+		p := int(pf)
+		a := float32(pf - float64(p))
+
+		h0, h1 := r.bank[p], r.bank[p+1]
+		window := r.buf[i : i+taps]
+
+		var y0, y1 float32
+		for k := range h0 {
+			x := window[taps-1-k]
+			y0 += h0[k] * x
+			y1 += h1[k] * x
+		}
+		dst = append(dst, y0+a*(y1-y0))
+
+		r.acc += r.num
+	}
+
+	// Discard input no longer needed by any future output.
+	consumed := r.acc / r.den
+	if consumed > len(r.buf) {
+		consumed = len(r.buf)
+	}
+	r.buf = r.buf[:copy(r.buf, r.buf[consumed:])]
+	r.acc -= consumed * r.den
+
+	return dst
+}
+
+// Clears filter history, as if the resampler were newly created.
+func (r *Resampler) Reset() {
+	taps := len(r.bank[0])
+	r.buf = r.buf[:taps-1]
+	for i := range r.buf {
+		r.buf[i] = 0
+	}
+	r.acc = 0
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
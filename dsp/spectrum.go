@@ -0,0 +1,152 @@
+package dsp
+
+import "sync"
+
+// Spectrum computes windowed power spectra, averaged across consecutive
+// non-overlapping frames. Bins are ordered from the most negative frequency
+// to the most positive, with DC at the center.
+type Spectrum struct {
+	// Goroutines the frames of one call are transformed on, so long
+	// integrations keep up on multi-core machines. One if zero. Each has
+	// its own FFT and buffers, the output doesn't depend on scheduling.
+	// The caller's goroutine is the first, the others are started by the
+	// first call needing them and run until Close.
+	Workers int
+
+	n    int
+	win  []float32
+	work []*spectrumWorker
+	acc  []float64
+	wg   sync.WaitGroup // Runs of frames being transformed by workers.
+}
+
+// State of one goroutine transforming frames.
+type spectrumWorker struct {
+	fft   *FFT
+	frame []complex64
+	mag   []float32
+	acc   []float64
+	jobs  chan []complex64 // Runs of frames, nil for the caller's worker.
+}
+
+func newSpectrumWorker(n int) *spectrumWorker {
+	return &spectrumWorker{
+		fft:   NewFFT(n),
+		frame: make([]complex64, n),
+		mag:   make([]float32, 0, n),
+		acc:   make([]float64, n),
+	}
+}
+
+// Sums the power of each bin over the frames of src.
+func (w *spectrumWorker) accumulate(win []float32, src []complex64) {
+	for i := range w.acc {
+		w.acc[i] = 0
+	}
+
+	n := len(w.frame)
+	for f := 0; f+n <= len(src); f += n {
+		for i, v := range src[f : f+n] {
+			w.frame[i] = v * complex(win[i], 0)
+		}
+		w.fft.Forward(w.frame)
+		w.mag = MagSquared(w.mag[:0], w.frame)
+		for i, p := range w.mag {
+			w.acc[i] += float64(p)
+		}
+	}
+}
+
+// Returns a spectrum estimator with n bins, which must be a power of two.
+func NewSpectrum(n int, w WindowType) *Spectrum {
+	s := &Spectrum{
+		n:    n,
+		win:  make([]float32, n),
+		work: []*spectrumWorker{newSpectrumWorker(n)},
+		acc:  make([]float64, n),
+	}
+
+	// Normalize so a full scale tone reads 0 dB regardless of window.
+	win := Window(w, n)
+	var sum float64
+	for _, v := range win {
+		sum += v
+	}
+	for i, v := range win {
+		s.win[i] = float32(v / sum)
+	}
+
+	return s
+}
+
+// Returns the number of bins.
+func (s *Spectrum) Len() int {
+	return s.n
+}
+
+// Appends the average power in dB of each bin over all complete frames in
+// src to dst. If src is shorter than one frame nothing is appended.
+func (s *Spectrum) PowerDB(dst []float32, src []complex64) []float32 {
+	n := s.n
+	frames := len(src) / n
+	if frames == 0 {
+		return dst
+	}
+
+	workers := s.Workers
+	if workers > frames {
+		workers = frames
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for len(s.work) < workers {
+		w := newSpectrumWorker(n)
+		w.jobs = make(chan []complex64)
+		go func() {
+			for run := range w.jobs {
+				w.accumulate(s.win, run)
+				s.wg.Done()
+			}
+		}()
+		s.work = append(s.work, w)
+	}
+
+	// Contiguous runs of frames per worker, summed in order.
+	for i, w := range s.work[1:workers] {
+		first, last := (i+1)*frames/workers, (i+2)*frames/workers
+		s.wg.Add(1)
+		w.jobs <- src[first*n : last*n]
+	}
+	s.work[0].accumulate(s.win, src[:frames/workers*n])
+	s.wg.Wait()
+
+	for i := range s.acc {
+		s.acc[i] = 0
+	}
+	for _, w := range s.work[:workers] {
+		for i, p := range w.acc {
+			s.acc[i] += p
+		}
+	}
+
+	// Emit with DC centered.
+	half := n / 2
+	start := len(dst)
+	for i := 0; i < n; i++ {
+		dst = append(dst, float32(s.acc[(i+half)%n]/float64(frames)))
+	}
+	DB(dst[start:], dst[start:])
+
+	return dst
+}
+
+// Stops the goroutines started for Workers. Later calls to PowerDB start
+// them again.
+func (s *Spectrum) Close() error {
+	for _, w := range s.work[1:] {
+		close(w.jobs)
+	}
+	s.work = s.work[:1]
+	return nil
+}
@@ -0,0 +1,40 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestSpectrumWorkers(t *testing.T) {
+	const n = 64
+	src := make([]complex64, 37*n)
+	for i := range src {
+		src[i] = complex64(cmplx.Rect(0.5, 2*math.Pi*5*float64(i)/n))
+	}
+
+	want := NewSpectrum(n, Hann).PowerDB(nil, src)
+	for _, workers := range []int{2, 4, 100} {
+		s := NewSpectrum(n, Hann)
+		s.Workers = workers
+		s.PowerDB(nil, src)
+		// Workers persist across calls, and restart after Close.
+		got := s.PowerDB(nil, src)
+		s.Close()
+		if again := s.PowerDB(nil, src); len(again) != len(got) || again[n/2+5] != got[n/2+5] {
+			t.Errorf("%d workers: spectrum changed after Close", workers)
+		}
+		s.Close()
+		if len(got) != n {
+			t.Fatalf("%d workers: %d bins", workers, len(got))
+		}
+		for i := range got {
+			if math.Abs(float64(got[i]-want[i])) > 1e-3 {
+				t.Errorf("%d workers: bin %d is %v dB, want %v", workers, i, got[i], want[i])
+			}
+		}
+	}
+	if peak := want[n/2+5]; math.Abs(float64(peak)+6.02) > 0.1 {
+		t.Errorf("tone reads %v dB, want -6.02", peak)
+	}
+}
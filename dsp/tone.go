@@ -0,0 +1,182 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"time"
+)
+
+// Defaults for ToneConfig.
+const (
+	// Long enough to tell apart the closest CTCSS tones, 2.3 Hz apart.
+	DefaultToneWindow    = 400 * time.Millisecond
+	DefaultToneThreshold = 0.25
+)
+
+// Parameters of a ToneDetector, defaults used for zero fields.
+type ToneConfig struct {
+	// Frequencies watched for in Hz. Tones in I/Q are relative to the
+	// center frequency, those below it negative.
+	Freqs []float64
+	// Length of the windows each tone is measured over. Longer windows
+	// resolve closer tones and reject more noise, but detect later.
+	Window time.Duration
+	// Fraction of a window's power a tone must hold to be detected. It's
+	// lost once below half of that.
+	Threshold float64
+}
+
+// A tone appearing or disappearing.
+type ToneEvent struct {
+	Freq    float64 // Hz, as configured.
+	Present bool
+	// Fraction of the window's power in the tone, close to one for a
+	// clean tone.
+	Level float64
+	// Samples processed up to the end of the window, counted from the
+	// first.
+	Index uint64
+}
+
+// ToneDetector watches a stream for tones, such as repeater pilot tones or
+// CTCSS subtones in demodulated audio, or carriers offset from the center
+// of I/Q, measuring each with the Goertzel algorithm over successive
+// windows. Voice swamps subaudible tones, so audio is best low pass
+// filtered to 300 Hz before looking for CTCSS. It passes samples through
+// unchanged, so it can tap any point of a chain.
+type ToneDetector[T float32 | complex64] struct {
+	// Optional callback invoked from Process when a tone appears or
+	// disappears.
+	OnTone func(ToneEvent)
+
+	threshold float64
+	window    int
+	tones     []goertzel
+
+	n      int     // Samples into the current window.
+	energy float64 // Power of the current window.
+	index  uint64
+}
+
+// Goertzel filter state of one tone.
+type goertzel struct {
+	freq    float64
+	coeff   float64    // Twice the cosine of the tone's phase step.
+	w       complex128 // Conjugate phase step.
+	s1, s2  complex128
+	level   float64
+	present bool
+}
+
+// Returns a detector of cfg's tones for a stream of rate samples per
+// second.
+func NewToneDetector[T float32 | complex64](cfg ToneConfig, rate float64) *ToneDetector[T] {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultToneWindow
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultToneThreshold
+	}
+	d := &ToneDetector[T]{
+		threshold: cfg.Threshold,
+		window:    max(1, int(cfg.Window.Seconds()*rate)),
+	}
+	for _, f := range cfg.Freqs {
+		omega := 2 * math.Pi * f / rate
+		d.tones = append(d.tones, goertzel{
+			freq:  f,
+			coeff: 2 * math.Cos(omega),
+			w:     cmplx.Rect(1, -omega),
+		})
+	}
+	return d
+}
+
+// Measures the tones of src and appends it unchanged to dst, returning the
+// extended slice.
+func (d *ToneDetector[T]) Process(dst, src []T) []T {
+	for _, s := range src {
+		x := toneSample(s)
+		d.energy += real(x)*real(x) + imag(x)*imag(x)
+		for i := range d.tones {
+			g := &d.tones[i]
+			g.s1, g.s2 = x+complex(g.coeff, 0)*g.s1-g.s2, g.s1
+		}
+		d.index++
+		if d.n++; d.n == d.window {
+			d.measure()
+		}
+	}
+	return append(dst, src...)
+}
+
+// Converts a sample for the filters.
+func toneSample[T float32 | complex64](s T) complex128 {
+	switch v := any(s).(type) {
+	case float32:
+		return complex(float64(v), 0)
+	case complex64:
+		return complex128(v)
+	}
+	return 0
+}
+
+// Ends the window, reporting tones whose state changed.
+func (d *ToneDetector[T]) measure() {
+	// A real tone's power splits between its frequency and the negative.
+	norm := float64(d.n) * d.energy
+	var zero T
+	if _, ok := any(zero).(float32); ok {
+		norm /= 2
+	}
+
+	for i := range d.tones {
+		g := &d.tones[i]
+		g.level = 0
+		if norm > 0 {
+			y := g.s1 - g.w*g.s2
+			g.level = min(1, (real(y)*real(y)+imag(y)*imag(y))/norm)
+		}
+		g.s1, g.s2 = 0, 0
+
+		present := g.level >= d.threshold || g.present && g.level >= d.threshold/2
+		if present != g.present {
+			g.present = present
+			if d.OnTone != nil {
+				d.OnTone(ToneEvent{Freq: g.freq, Present: present, Level: g.level, Index: d.index})
+			}
+		}
+	}
+	d.n, d.energy = 0, 0
+}
+
+// Reports whether the tone of frequency freq was detected in the last
+// window, for selective squelch.
+func (d *ToneDetector[T]) Present(freq float64) bool {
+	for _, g := range d.tones {
+		if g.freq == freq {
+			return g.present
+		}
+	}
+	return false
+}
+
+// Returns the fraction of the last window's power in the tone of frequency
+// freq.
+func (d *ToneDetector[T]) Level(freq float64) float64 {
+	for _, g := range d.tones {
+		if g.freq == freq {
+			return g.level
+		}
+	}
+	return 0
+}
+
+// Clears the current window and the tones' states, as if newly created,
+// e.g. after a gap in the stream. No events are reported.
+func (d *ToneDetector[T]) Reset() {
+	for i := range d.tones {
+		d.tones[i] = goertzel{freq: d.tones[i].freq, coeff: d.tones[i].coeff, w: d.tones[i].w}
+	}
+	d.n, d.energy, d.index = 0, 0, 0
+}
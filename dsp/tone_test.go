@@ -0,0 +1,53 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+func TestToneDetector(t *testing.T) {
+	const rate = 8000
+	rng := rand.New(rand.NewSource(1))
+
+	// A 100 Hz subtone amid noise for a second, then noise alone, among
+	// the neighbouring CTCSS tones. The window straddling its end still
+	// holds enough of it.
+	src := make([]float32, 2*rate)
+	for i := range src {
+		src[i] = 0.1 * float32(rng.NormFloat64())
+		if i < rate {
+			src[i] += 0.5 * float32(math.Sin(2*math.Pi*100*float64(i)/rate))
+		}
+	}
+	var events []ToneEvent
+	d := NewToneDetector[float32](ToneConfig{Freqs: []float64{94.8, 100, 103.5}}, rate)
+	d.OnTone = func(e ToneEvent) { events = append(events, e) }
+	if out := d.Process(nil, src[:rate]); len(out) != rate || out[1] != src[1] {
+		t.Error("samples not passed through")
+	}
+	if !d.Present(100) || d.Present(103.5) || d.Level(100) < 0.8 {
+		t.Errorf("present %t, level %.3f", d.Present(100), d.Level(100))
+	}
+	d.Process(nil, src[rate:])
+	if len(events) != 2 || events[0].Freq != 100 || !events[0].Present || events[0].Index != 3200 || events[1].Present || events[1].Index != 12800 {
+		t.Errorf("events %+v", events)
+	}
+
+	// Tones in I/Q are told apart by the sign of their offset.
+	iq := make([]complex64, rate/2)
+	for i := range iq {
+		iq[i] = complex64(cmplx.Rect(0.5, -2*math.Pi*1e3*float64(i)/rate))
+	}
+	c := NewToneDetector[complex64](ToneConfig{Freqs: []float64{-1e3, 1e3}}, rate)
+	c.Process(nil, iq)
+	if !c.Present(-1e3) || c.Present(1e3) {
+		t.Errorf("levels %.3f below, %.3f above center", c.Level(-1e3), c.Level(1e3))
+	}
+
+	c.Reset()
+	if c.Present(-1e3) || c.Level(-1e3) != 0 {
+		t.Error("state kept across Reset")
+	}
+}
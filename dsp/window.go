@@ -0,0 +1,52 @@
+package dsp
+
+import "math"
+
+// Window function types.
+type WindowType int
+
+const (
+	Rectangular WindowType = iota
+	Hann
+	Hamming
+	Blackman
+)
+
+func (w WindowType) String() string {
+	switch w {
+	case Rectangular:
+		return "rectangular"
+	case Hann:
+		return "hann"
+	case Hamming:
+		return "hamming"
+	case Blackman:
+		return "blackman"
+	}
+	return "unknown"
+}
+
+// Returns n coefficients of the given window type.
+func Window(w WindowType, n int) []float64 {
+	win := make([]float64, n)
+	if n == 1 {
+		win[0] = 1
+		return win
+	}
+
+	for i := range win {
+		x := 2 * math.Pi * float64(i) / float64(n-1)
+		switch w {
+		case Hann:
+			win[i] = 0.5 - 0.5*math.Cos(x)
+		case Hamming:
+			win[i] = 0.54 - 0.46*math.Cos(x)
+		case Blackman:
+			win[i] = 0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x)
+		default:
+			win[i] = 1
+		}
+	}
+
+	return win
+}
@@ -0,0 +1,308 @@
+package rtltcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Defaults for Failover timing.
+const (
+	DefaultStallTimeout   = 5 * time.Second
+	DefaultHealthInterval = 10 * time.Second
+)
+
+// Failover streams from one of several rtl_tcp servers, switching to other
+// servers when the active one fails or stalls. Standby servers are probed
+// periodically and healthy ones are tried first. Settings applied to the
+// active server are re-applied to each replacement, so readers see an
+// uninterrupted stream apart from the samples lost while switching.
+type Failover struct {
+	// Longest wait for samples before the active server is abandoned.
+	StallTimeout time.Duration
+	// Interval between health probes of standby servers.
+	HealthInterval time.Duration
+	// Called after switching to a new server, with the error that caused
+	// the switch.
+	OnSwitch func(addr string, err error)
+	// Called when the new server has a different dongle than the one
+	// switched from, after settings were revalidated, see SDR.Restore.
+	OnDongleChange func(addr string, c DongleChange)
+
+	addrs []string
+
+	switching sync.Mutex // Held while replacing the active server.
+
+	mu      sync.Mutex
+	sdr     *SDR
+	active  int
+	healthy []bool
+	closed  bool
+	done    chan struct{}
+}
+
+var _ Source = (*Failover)(nil)
+
+// Connects to the first reachable server of addrs, in order, and starts
+// probing the others.
+func NewFailover(addrs ...string) (*Failover, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no server addresses")
+	}
+
+	f := &Failover{
+		StallTimeout:   DefaultStallTimeout,
+		HealthInterval: DefaultHealthInterval,
+		addrs:          addrs,
+		healthy:        make([]bool, len(addrs)),
+		active:         -1,
+		done:           make(chan struct{}),
+	}
+	for i := range f.healthy {
+		f.healthy[i] = true
+	}
+
+	if err := f.failover(nil, nil); err != nil {
+		return nil, err
+	}
+
+	go f.probe()
+
+	return f, nil
+}
+
+func dial(addr string) (*SDR, error) {
+	sdr := new(SDR)
+	if err := sdr.ConnectAddr(addr); err != nil {
+		return nil, err
+	}
+	return sdr, nil
+}
+
+// Replaces the failed server with the next working one, healthy servers
+// first, restoring the failed server's settings. Fails if no server accepts
+// the connection and settings.
+func (f *Failover) failover(failed *SDR, cause error) error {
+	f.switching.Lock()
+	defer f.switching.Unlock()
+
+	f.mu.Lock()
+	old, from := f.sdr, f.active
+	if old != failed {
+		// Another caller already replaced it.
+		f.mu.Unlock()
+		return nil
+	}
+	if from >= 0 {
+		f.healthy[from] = false
+	}
+	f.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	// Try healthy servers after the failed one, then the rest.
+	var order []int
+	for pass := 0; pass < 2; pass++ {
+		for i := 1; i <= len(f.addrs); i++ {
+			idx := (from + i) % len(f.addrs)
+			f.mu.Lock()
+			healthy := f.healthy[idx]
+			f.mu.Unlock()
+			if healthy == (pass == 0) {
+				order = append(order, idx)
+			}
+		}
+	}
+
+	var errs []error
+	for _, idx := range order {
+		sdr, err := dial(f.addrs[idx])
+		if err == nil && old != nil {
+			if f.OnDongleChange != nil {
+				addr := f.addrs[idx]
+				sdr.OnDongleChange = func(c DongleChange) { f.OnDongleChange(addr, c) }
+			}
+			if err = sdr.Restore(old); err != nil {
+				sdr.Close()
+			}
+		}
+		if err != nil {
+			f.mu.Lock()
+			f.healthy[idx] = false
+			f.mu.Unlock()
+			errs = append(errs, fmt.Errorf("%s: %s", f.addrs[idx], err))
+			continue
+		}
+
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			sdr.Close()
+			return io.ErrClosedPipe
+		}
+		f.sdr, f.active = sdr, idx
+		f.healthy[idx] = true
+		f.mu.Unlock()
+
+		if f.OnSwitch != nil && old != nil {
+			f.OnSwitch(f.addrs[idx], cause)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Error connecting to any server: %s", errors.Join(errs...))
+}
+
+// Periodically checks that standby servers accept connections and answer
+// with a valid dongle header.
+func (f *Failover) probe() {
+	t := time.NewTicker(f.HealthInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-f.done:
+			return
+		}
+
+		for idx, addr := range f.addrs {
+			f.mu.Lock()
+			active := idx == f.active
+			f.mu.Unlock()
+			if active {
+				continue
+			}
+
+			ok := probe(addr, f.StallTimeout)
+			f.mu.Lock()
+			f.healthy[idx] = ok
+			f.mu.Unlock()
+		}
+	}
+}
+
+// Reports whether addr completes the handshake dial would make.
+func probe(addr string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	sdr := new(SDR)
+	network, address := ParseAddr(addr)
+	if err := sdr.DialContext(ctx, network, address); err != nil {
+		return false
+	}
+	sdr.Close()
+	return true
+}
+
+// Pings the active server, see SDR.Ping, switching servers if it fails.
+// Reads must continue meanwhile for samples to be noticed. Fails only if no
+// server can replace an unhealthy one.
+func (f *Failover) Ping(timeout time.Duration) error {
+	sdr, err := f.current()
+	if err != nil {
+		return err
+	}
+	if err = sdr.Ping(timeout); err != nil {
+		return f.failover(sdr, err)
+	}
+	return nil
+}
+
+// Returns the address of the active server.
+func (f *Failover) Active() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addrs[f.active]
+}
+
+// Returns the health of each server as of its last probe, in the order
+// given to NewFailover.
+func (f *Failover) Healthy() []bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]bool(nil), f.healthy...)
+}
+
+func (f *Failover) current() (*SDR, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, io.ErrClosedPipe
+	}
+	return f.sdr, nil
+}
+
+// Calls fn with the active server, for settings beyond those of Source.
+// If fn fails the server is replaced and fn is retried once on the new one.
+func (f *Failover) Control(fn func(*SDR) error) error {
+	sdr, err := f.current()
+	if err != nil {
+		return err
+	}
+	if err = fn(sdr); err == nil {
+		return nil
+	}
+	if ferr := f.failover(sdr, err); ferr != nil {
+		return ferr
+	}
+	if sdr, err = f.current(); err != nil {
+		return err
+	}
+	return fn(sdr)
+}
+
+func (f *Failover) SetCenterFreq(freq uint32) error {
+	return f.Control(func(sdr *SDR) error { return sdr.SetCenterFreq(freq) })
+}
+
+func (f *Failover) SetSampleRate(rate uint32) error {
+	return f.Control(func(sdr *SDR) error { return sdr.SetSampleRate(rate) })
+}
+
+// Reads a block from the active server, switching servers if it fails or
+// sends nothing for StallTimeout.
+func (f *Failover) ReadBlock(buf []byte) (Block, error) {
+	for {
+		sdr, err := f.current()
+		if err != nil {
+			return Block{}, err
+		}
+
+		sdr.SetReadDeadline(time.Now().Add(f.StallTimeout))
+		blk, err := sdr.ReadBlock(buf)
+		if err == nil {
+			return blk, nil
+		}
+
+		if f.isClosed() {
+			return Block{}, io.ErrClosedPipe
+		}
+		if ferr := f.failover(sdr, err); ferr != nil {
+			return Block{}, ferr
+		}
+	}
+}
+
+func (f *Failover) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// Stops probing and disconnects from the active server.
+func (f *Failover) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	close(f.done)
+	return f.sdr.Close()
+}
@@ -0,0 +1,141 @@
+package rtltcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Handling of the dongle information header by Connect.
+type HeaderMode int
+
+const (
+	HeaderStrict  HeaderMode = iota // Require a valid header.
+	HeaderLenient                   // Tolerate a missing or unrecognized header.
+	HeaderNone                      // Expect no header at all.
+)
+
+// Size of the dongle information header.
+const headerLen = 12
+
+// Time Connect waits for the header, unless the context expires sooner.
+const DefaultHeaderTimeout = 5 * time.Second
+
+var (
+	// Returned when the server sends no complete header in time.
+	ErrHeaderTimeout = errors.New("timed out waiting for dongle information")
+	// Returned when the server closes the connection partway through the
+	// header.
+	ErrShortHeader = errors.New("connection closed during dongle information")
+	// Returned when the header's magic number isn't one Connect accepts.
+	ErrBadMagic = errors.New("invalid magic number")
+)
+
+// Reports whether err is a failure to exchange the header with a server
+// that accepted the connection.
+func handshakeFailed(err error) bool {
+	return errors.Is(err, ErrHeaderTimeout) || errors.Is(err, ErrShortHeader) || errors.Is(err, ErrBadMagic)
+}
+
+// Time a lenient handshake waits for the header before assuming the server
+// sends none, unless HeaderTimeout is set.
+const LenientTimeout = time.Second
+
+// Information assumed of servers sending no header, or one not understood,
+// in HeaderLenient and HeaderNone modes.
+var DefaultDongleInfo = DongleInfo{Magic: dongleMagic, Tuner: TunerR820T, GainCount: uint32(len(R820TGains))}
+
+// Reads the dongle information header as the Header mode directs.
+func (sdr *SDR) readHeader(ctx context.Context) error {
+	sdr.headerless = false
+	if sdr.Header == HeaderNone {
+		sdr.Info, sdr.headerless = DefaultDongleInfo, true
+		return nil
+	}
+
+	timeout := sdr.HeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultHeaderTimeout
+		if sdr.Header == HeaderLenient {
+			timeout = LenientTimeout
+		}
+	}
+
+	codec := sdr.codec()
+	buf := make([]byte, codec.HeaderLen())
+	n, err := sdr.readFull(ctx, buf, timeout)
+	var netErr net.Error
+	timedOut := errors.As(err, &netErr) && netErr.Timeout()
+
+	if sdr.Header == HeaderLenient {
+		if timedOut && ctx.Err() == nil {
+			err = nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("Error getting dongle information: %s", err)
+		}
+		if info, err := codec.DecodeHeader(buf[:n]); err == nil {
+			sdr.Info = info
+			return nil
+		}
+		// Whatever was sent is already samples.
+		sdr.pending = append(sdr.pending[:0], buf[:n]...)
+		sdr.Info, sdr.headerless = DefaultDongleInfo, true
+		return nil
+	}
+
+	switch {
+	case timedOut:
+		return fmt.Errorf("%w: received %d of %d bytes", ErrHeaderTimeout, n, len(buf))
+	case err == io.EOF, err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("%w: received %d of %d bytes", ErrShortHeader, n, len(buf))
+	case err != nil:
+		return fmt.Errorf("Error getting dongle information: %s", err)
+	}
+
+	sdr.Info, err = codec.DecodeHeader(buf)
+	return err
+}
+
+// Decodes the header at the start of buf, all fields big-endian. Returns
+// ErrShortHeader if buf holds less than a header and ErrBadMagic if its
+// magic number isn't one Connect accepts. Bytes past the header are
+// ignored.
+func DecodeDongleInfo(buf []byte) (DongleInfo, error) {
+	return decodeDongleInfo(buf, binary.BigEndian)
+}
+
+// Decodes the header at the start of buf with fields in byte order order.
+func decodeDongleInfo(buf []byte, order binary.ByteOrder) (DongleInfo, error) {
+	if len(buf) < headerLen {
+		return DongleInfo{}, fmt.Errorf("%w: received %d of %d bytes", ErrShortHeader, len(buf), headerLen)
+	}
+	info := DongleInfo{
+		Magic:     [4]byte(buf[:4]),
+		Tuner:     Tuner(order.Uint32(buf[4:])),
+		GainCount: order.Uint32(buf[8:]),
+	}
+	if !info.Valid() && info.Magic != PackedMagic && info.Magic != rspMagic {
+		return info, fmt.Errorf("%w: expected %q received %q", ErrBadMagic, dongleMagic, info.Magic)
+	}
+	return info, nil
+}
+
+// Reads len(buf) bytes within timeout or before ctx expires, whichever is
+// sooner, returning the bytes read on error too.
+func (sdr *SDR) readFull(ctx context.Context, buf []byte, timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	sdr.Conn.SetReadDeadline(deadline)
+	defer func() {
+		d, _ := ctx.Deadline()
+		sdr.Conn.SetReadDeadline(d)
+	}()
+	return io.ReadFull(sdr.Conn, buf)
+}
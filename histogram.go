@@ -0,0 +1,130 @@
+package rtltcp
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Limits beyond which Diagnose reports a problem.
+const (
+	// Mean distance of I or Q from mid-scale, in codes.
+	DCOffsetLimit = 4.0
+	// Fraction of values at either end of the scale.
+	ClipLimit = 0.001
+	// Samples needed before bits never toggling are considered stuck.
+	stuckMinSamples = 4096
+)
+
+// Histogram counts raw 8-bit sample values, I and Q separately, to check the
+// health of a dongle and its gain setting without demodulating anything.
+type Histogram struct {
+	I [256]uint64 `json:"i"`
+	Q [256]uint64 `json:"q"`
+
+	odd bool // The next byte added is a Q value.
+}
+
+// Counts the interleaved samples of buf, which may split a pair with the
+// previous call.
+func (h *Histogram) Add(buf []byte) {
+	if h.odd && len(buf) > 0 {
+		h.Q[buf[0]]++
+		buf = buf[1:]
+	}
+	for i := 0; i+1 < len(buf); i += 2 {
+		h.I[buf[i]]++
+		h.Q[buf[i+1]]++
+	}
+	h.odd = len(buf)%2 == 1
+	if h.odd {
+		h.I[buf[len(buf)-1]]++
+	}
+}
+
+// Returns the number of complete samples counted.
+func (h *Histogram) Samples() (n uint64) {
+	for _, c := range h.Q {
+		n += c
+	}
+	return
+}
+
+// Clears the counts.
+func (h *Histogram) Reset() {
+	*h = Histogram{}
+}
+
+// Findings of Diagnose. Offsets and RMS are in codes of the 8-bit scale.
+type Diagnosis struct {
+	Samples uint64 `json:"samples"`
+	// Means less mid-scale, 127.5.
+	OffsetI float64 `json:"offset_i"`
+	OffsetQ float64 `json:"offset_q"`
+	RMS     float64 `json:"rms"`     // Of I and Q about their means.
+	Clipped float64 `json:"clipped"` // Fraction of values at 0 or 255.
+	// Bits set, or clear, in every value counted. They're stuck, or the
+	// signal never spans them, since a large DC offset freezes high bits.
+	StuckHigh uint8    `json:"stuck_high"`
+	StuckLow  uint8    `json:"stuck_low"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// Checks the counts for stuck bits, a DC offset beyond DCOffsetLimit and
+// clipping beyond ClipLimit, the latter suggesting too much gain.
+func (h *Histogram) Diagnose() (d Diagnosis) {
+	d.Samples = h.Samples()
+	if d.Samples == 0 {
+		return
+	}
+
+	var varI, varQ float64
+	d.OffsetI, varI = moments(&h.I)
+	d.OffsetQ, varQ = moments(&h.Q)
+	d.RMS = math.Sqrt((varI + varQ) / 2)
+	d.Clipped = float64(h.I[0]+h.I[255]+h.Q[0]+h.Q[255]) / float64(2*d.Samples)
+
+	if d.Samples >= stuckMinSamples {
+		d.StuckHigh, d.StuckLow = 0xff, 0xff
+		for _, counts := range []*[256]uint64{&h.I, &h.Q} {
+			for v, c := range counts {
+				if c > 0 {
+					d.StuckHigh &= uint8(v)
+					d.StuckLow &^= uint8(v)
+				}
+			}
+		}
+		for _, stuck := range []struct {
+			mask  uint8
+			level string
+		}{{d.StuckHigh, "high"}, {d.StuckLow, "low"}} {
+			if stuck.mask != 0 {
+				d.Problems = append(d.Problems, fmt.Sprintf("%d bits stuck %s, mask %#02x",
+					bits.OnesCount8(stuck.mask), stuck.level, stuck.mask))
+			}
+		}
+	}
+
+	if math.Abs(d.OffsetI) > DCOffsetLimit || math.Abs(d.OffsetQ) > DCOffsetLimit {
+		d.Problems = append(d.Problems, fmt.Sprintf("DC offset of %+.1f I, %+.1f Q codes", d.OffsetI, d.OffsetQ))
+	}
+	if d.Clipped > ClipLimit {
+		d.Problems = append(d.Problems, fmt.Sprintf("%.2f%% of values clipped, reduce gain", 100*d.Clipped))
+	}
+	return
+}
+
+// Returns the mean less mid-scale and the variance of counted values.
+func moments(counts *[256]uint64) (offset, variance float64) {
+	var n, sum, sq float64
+	for v, c := range counts {
+		n += float64(c)
+		sum += float64(c) * float64(v)
+		sq += float64(c) * float64(v) * float64(v)
+	}
+	if n == 0 {
+		return
+	}
+	mean := sum / n
+	return mean - 127.5, sq/n - mean*mean
+}
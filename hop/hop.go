@@ -0,0 +1,154 @@
+// Package hop time-shares one source between several frequencies, cycling
+// through them on a fixed schedule and segmenting the stream per visit, so
+// one dongle can feed decoders of several channels in turn.
+package hop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Defaults for Config.
+const (
+	DefaultSampleRate = 2400000
+	DefaultDwell      = 100 * time.Millisecond
+	DefaultSettle     = 1 << 16
+)
+
+// A frequency visited by the hopper.
+type Channel struct {
+	Name string
+	Freq uint32 // Center frequency in Hz.
+	// Time spent per visit including settling, Config.Dwell if zero.
+	Dwell time.Duration
+}
+
+// Parameters of a hopper.
+type Config struct {
+	Channels   []Channel // Visited in order, repeating.
+	SampleRate uint32    // Hz, DefaultSampleRate if zero.
+	Dwell      time.Duration
+	// Bytes discarded after each retune while the tuner settles,
+	// DefaultSettle if zero, negative for none. See scan.MeasureSettle.
+	Settle int
+}
+
+// Samples received during one visit to a channel, settling discarded.
+type Segment struct {
+	Channel Channel
+	Index   int    // Of the channel in Config.Channels.
+	Hop     uint64 // Visits made before this one, across all channels.
+	Samples []byte // Interleaved 8-bit IQ.
+	// Estimated capture time of the first sample, or its receive time
+	// without an estimate.
+	Time       time.Time
+	SampleRate uint32
+	Discarded  int // Bytes discarded while settling.
+}
+
+// Hopper cycles a source through a list of channels. Dwells are counted in
+// samples, so the schedule follows the stream's clock rather than the
+// host's, and every visit to a channel yields a segment of the same length.
+type Hopper struct {
+	Config Config
+
+	src     rtltcp.Source
+	lengths []int // Bytes kept per visit of each channel.
+	settle  []byte
+	next    int
+	hops    uint64
+}
+
+// Returns a hopper over src, setting its sample rate.
+func New(src rtltcp.Source, cfg Config) (*Hopper, error) {
+	if len(cfg.Channels) == 0 {
+		return nil, errors.New("hop: no channels")
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = DefaultSampleRate
+	}
+	if cfg.Dwell == 0 {
+		cfg.Dwell = DefaultDwell
+	}
+	if cfg.Settle == 0 {
+		cfg.Settle = DefaultSettle
+	} else if cfg.Settle < 0 {
+		cfg.Settle = 0
+	}
+	cfg.Settle &^= 1
+
+	h := &Hopper{Config: cfg, src: src, settle: make([]byte, cfg.Settle)}
+	for _, c := range cfg.Channels {
+		dwell := c.Dwell
+		if dwell == 0 {
+			dwell = cfg.Dwell
+		}
+		n := 2*int(dwell.Seconds()*float64(cfg.SampleRate)) - cfg.Settle
+		if n < 2 {
+			return nil, fmt.Errorf("hop: dwell on %q no longer than settling", c.Name)
+		}
+		h.lengths = append(h.lengths, n)
+	}
+
+	if err := src.SetSampleRate(cfg.SampleRate); err != nil {
+		return nil, fmt.Errorf("Error setting sample rate: %s", err)
+	}
+	return h, nil
+}
+
+// Tunes to the next channel and returns the segment received there.
+func (h *Hopper) Next() (seg Segment, err error) {
+	i := h.next
+	c := h.Config.Channels[i]
+	if err = h.src.SetCenterFreq(c.Freq); err != nil {
+		return seg, fmt.Errorf("Error tuning to %d Hz: %s", c.Freq, err)
+	}
+	if len(h.settle) > 0 {
+		if _, err = h.src.ReadBlock(h.settle); err != nil {
+			return seg, err
+		}
+	}
+
+	blk, err := h.src.ReadBlock(make([]byte, h.lengths[i]))
+	if err != nil {
+		return seg, err
+	}
+
+	seg = Segment{
+		Channel:    c,
+		Index:      i,
+		Hop:        h.hops,
+		Samples:    blk.Samples,
+		Time:       blk.Timestamp,
+		SampleRate: h.Config.SampleRate,
+		Discarded:  len(h.settle),
+	}
+	if seg.Time.IsZero() {
+		seg.Time = blk.Received
+	}
+	h.next = (i + 1) % len(h.Config.Channels)
+	h.hops++
+	return seg, nil
+}
+
+// Hops until ctx is done or an error occurs, passing each segment to fn.
+// Returns ctx's error once done, otherwise the first error of the source or
+// fn.
+func (h *Hopper) Run(ctx context.Context, fn func(Segment) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		seg, err := h.Next()
+		if err != nil {
+			return err
+		}
+		if err := fn(seg); err != nil {
+			return err
+		}
+	}
+}
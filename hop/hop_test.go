@@ -0,0 +1,69 @@
+package hop
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp/dsp"
+	"github.com/bemasher/rtltcp/synth"
+)
+
+func TestHopper(t *testing.T) {
+	src := synth.New(0, 0, synth.Tone{Freq: 433.92e6, Amplitude: 0.5})
+	src.Lag = 4096
+	h, err := New(src, Config{
+		Channels: []Channel{
+			{Name: "ism", Freq: 433.9e6},
+			{Name: "pager", Freq: 929e6, Dwell: 20 * time.Millisecond},
+		},
+		Dwell:  10 * time.Millisecond,
+		Settle: 2 * 4096,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var segs []Segment
+	errDone := errors.New("done")
+	err = h.Run(context.Background(), func(seg Segment) error {
+		segs = append(segs, seg)
+		if len(segs) == 4 {
+			return errDone
+		}
+		return nil
+	})
+	if err != errDone {
+		t.Fatal(err)
+	}
+
+	for i, seg := range segs {
+		want := h.Config.Channels[i%2]
+		if seg.Channel != want || seg.Index != i%2 || seg.Hop != uint64(i) {
+			t.Errorf("segment %d: %+v", i, seg.Channel)
+		}
+		samples := int(want.Dwell.Seconds()*DefaultSampleRate) - 4096
+		if want.Dwell == 0 {
+			samples = int(h.Config.Dwell.Seconds()*DefaultSampleRate) - 4096
+		}
+		if len(seg.Samples) != 2*samples || seg.Discarded != 2*4096 {
+			t.Errorf("segment %d: %d bytes, %d discarded", i, len(seg.Samples), seg.Discarded)
+		}
+
+		// Settling covered the lag, so the tone is 20 kHz above center
+		// throughout segments of ism and absent from pager's.
+		var sum complex128
+		for n, v := range dsp.ConvertU8(nil, seg.Samples) {
+			sum += complex128(v) * cmplx.Exp(complex(0, -2*math.Pi*20e3*float64(n)/DefaultSampleRate))
+		}
+		if amp := cmplx.Abs(sum) / float64(samples); (amp > 0.4) != (i%2 == 0) {
+			t.Errorf("segment %d at %s: tone amplitude %g", i, seg.Channel.Name, amp)
+		}
+	}
+	if !segs[1].Time.After(segs[0].Time) {
+		t.Errorf("segment times %s, %s", segs[0].Time, segs[1].Time)
+	}
+}
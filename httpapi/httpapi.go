@@ -0,0 +1,252 @@
+// Package httpapi provides an HTTP interface for controlling a connected
+// SDR, suitable for scripts and home automation.
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/si"
+)
+
+// Largest request body accepted.
+const maxBody = 4096
+
+// Current settings of the SDR, as returned by every endpoint.
+type State struct {
+	Tuner      string  `json:"tuner"`
+	GainCount  uint32  `json:"gain_count"`
+	CenterFreq uint32  `json:"center_freq"`
+	SampleRate uint32  `json:"sample_rate"`
+	AutoGain   bool    `json:"auto_gain"`
+	Gain       float64 `json:"gain"` // dB
+}
+
+// Server handles:
+//
+//	GET  /state           current settings
+//	GET  /capabilities    tuning range, gains and features of the tuner
+//	POST /frequency       center frequency in Hz, e.g. 433.92M
+//	POST /samplerate      sample rate in Hz, e.g. 2.4M
+//	POST /gain            gain in dB, or "auto" for tuner AGC
+//	POST /freqcorrection  frequency correction in ppm
+//	POST /agc             RTL AGC, "on" or "off"
+//	POST /directsampling  direct sampling, "on" or "off"
+//	POST /offsettuning    offset tuning, "on" or "off"
+//
+// Values are posted as the plain request body, or as a JSON object with a
+// single "value" member. Responses are the resulting State as JSON, except
+// for /capabilities which responds with rtltcp.Capabilities. Invalid values
+// are answered with 400, failures sending commands to the server with 502.
+type Server struct {
+	// Optional bearer token required on every request.
+	Token string
+	// Origins allowed to make cross-origin requests, "*" for any.
+	AllowedOrigins []string
+
+	sdr *rtltcp.SDR
+	mux *http.ServeMux
+}
+
+// Returns a server controlling sdr.
+func NewServer(sdr *rtltcp.SDR) *Server {
+	s := &Server{sdr: sdr, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("/state", s.handle(nil))
+	s.mux.HandleFunc("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.sdr.Capabilities())
+	})
+	s.mux.HandleFunc("/frequency", s.handle(func(v string) error {
+		f, err := parseSI(v)
+		if err != nil {
+			return err
+		}
+		return s.sdr.SetCenterFreq(f)
+	}))
+	s.mux.HandleFunc("/samplerate", s.handle(func(v string) error {
+		r, err := parseSI(v)
+		if err != nil {
+			return err
+		}
+		return s.sdr.SetSampleRate(r)
+	}))
+	s.mux.HandleFunc("/gain", s.handle(func(v string) error {
+		if strings.EqualFold(v, "auto") {
+			return s.sdr.SetTunerAGC(true)
+		}
+		db, err := strconv.ParseFloat(v, 64)
+		if err != nil || db < 0 {
+			return invalid("invalid gain: %q", v)
+		}
+		if err := s.sdr.SetManualGainMode(true); err != nil {
+			return err
+		}
+		return s.sdr.SetGain(uint32(db * 10))
+	}))
+	s.mux.HandleFunc("/freqcorrection", s.handle(func(v string) error {
+		ppm, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return invalid("invalid frequency correction: %q", v)
+		}
+		return s.sdr.SetFreqCorrection(uint32(ppm))
+	}))
+	s.mux.HandleFunc("/agc", s.handle(onOff(s.sdr.SetAGCMode)))
+	s.mux.HandleFunc("/directsampling", s.handle(onOff(s.sdr.SetDirectSampling)))
+	s.mux.HandleFunc("/offsettuning", s.handle(onOff(s.sdr.SetOffsetTuning)))
+
+	return s
+}
+
+// Registers an additional handler behind the server's auth and CORS checks.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && s.allowed(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if s.Token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) allowed(origin string) bool {
+	for _, o := range s.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a handler applying set to posted values, or only reporting state
+// for GET requests if set is nil.
+func (s *Server) handle(set func(string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+		case r.Method == http.MethodPost && set != nil:
+			v, err := readValue(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := set(v); err != nil {
+				status := http.StatusBadGateway
+				if errors.As(err, new(valueError)) {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.State())
+	}
+}
+
+// Returns the SDR's current settings.
+func (s *Server) State() State {
+	m := s.sdr.Metadata()
+	return State{
+		Tuner:      s.sdr.Info.Tuner.String(),
+		GainCount:  s.sdr.Info.GainCount,
+		CenterFreq: m.CenterFreq,
+		SampleRate: m.SampleRate,
+		AutoGain:   m.AutoGain,
+		Gain:       float64(m.Gain) / 10,
+	}
+}
+
+// Reads a value posted as plain text or as {"value": ...}.
+func readValue(r *http.Request) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		return "", err
+	}
+
+	v := strings.TrimSpace(string(body))
+	if strings.HasPrefix(v, "{") {
+		var obj struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return "", fmt.Errorf("invalid JSON body: %s", err)
+		}
+		v = strings.Trim(string(obj.Value), `"`)
+	}
+	if v == "" {
+		return "", fmt.Errorf("missing value")
+	}
+
+	return v, nil
+}
+
+// A posted value which is malformed or out of range, unlike errors of the
+// SDR.
+type valueError string
+
+func (e valueError) Error() string {
+	return string(e)
+}
+
+func invalid(format string, a ...any) error {
+	return valueError(fmt.Sprintf(format, a...))
+}
+
+// Parses a positive value in Hz, which must fit the 32 bits of commands.
+func parseSI(v string) (uint32, error) {
+	var n si.ScientificNotation
+	if err := n.Set(v); err != nil || n <= 0 || n > math.MaxUint32 {
+		return 0, invalid("invalid value: %q", v)
+	}
+	return uint32(n), nil
+}
+
+func onOff(set func(bool) error) func(string) error {
+	return func(v string) error {
+		switch strings.ToLower(v) {
+		case "on", "true", "1":
+			return set(true)
+		case "off", "false", "0":
+			return set(false)
+		}
+		return invalid("expected on or off, got %q", v)
+	}
+}
@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Serves an rtl_tcp header and no samples, reporting received commands on
+// cmds.
+func fakeServer(t *testing.T, cmds chan<- rtltcp.Command) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte{'R', 'T', 'L', '0', 0, 0, 0, 5, 0, 0, 0, 29})
+				for {
+					b := make([]byte, rtltcp.CommandLen)
+					if _, err := io.ReadFull(conn, b); err != nil {
+						return
+					}
+					cmd, _ := rtltcp.DefaultCodec.DecodeCommand(b)
+					cmds <- cmd
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	cmds := make(chan rtltcp.Command, 16)
+	var sdr rtltcp.SDR
+	if err := sdr.Dial("tcp", fakeServer(t, cmds)); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+
+	s := NewServer(&sdr)
+	s.Token = "secret"
+	s.AllowedOrigins = []string{"http://allowed.example"}
+
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	// Requests without the token, or with the wrong one, are refused.
+	if w := do("GET", "/state", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without token: %d", w.Code)
+	}
+	if w := do("GET", "/state", "", "Authorization", "Bearer wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("with wrong token: %d", w.Code)
+	}
+	if w := do("GET", "/state?token=secret", ""); w.Code != http.StatusOK {
+		t.Errorf("with token parameter: %d", w.Code)
+	}
+
+	// Preflight requests are answered for allowed origins only.
+	w := do("OPTIONS", "/frequency", "", "Origin", "http://allowed.example")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "http://allowed.example" {
+		t.Errorf("preflight from allowed origin: %d %v", w.Code, w.Header())
+	}
+	w = do("OPTIONS", "/frequency", "", "Origin", "http://other.example")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Code != http.StatusUnauthorized {
+		t.Errorf("preflight from other origin: %d %v", w.Code, w.Header())
+	}
+
+	// Posted values become commands.
+	auth := []string{"Authorization", "Bearer secret"}
+	if w := do("POST", "/frequency", "433.92M", auth...); w.Code != http.StatusOK {
+		t.Fatalf("setting frequency: %d %s", w.Code, w.Body)
+	}
+	if cmd := <-cmds; cmd != (rtltcp.Command{Opcode: rtltcp.CenterFreq, Parameter: 433920000}) {
+		t.Errorf("sent %+v", cmd)
+	}
+	if w := do("POST", "/samplerate", `{"value": "2.4M"}`, auth...); w.Code != http.StatusOK {
+		t.Fatalf("setting sample rate: %d %s", w.Code, w.Body)
+	}
+	if cmd := <-cmds; cmd != (rtltcp.Command{Opcode: rtltcp.SampleRate, Parameter: 2400000}) {
+		t.Errorf("sent %+v", cmd)
+	}
+
+	// Values beyond 32 bits are refused rather than wrapped.
+	for _, v := range []string{"5G", "-1", "x"} {
+		if w := do("POST", "/frequency", v, auth...); w.Code != http.StatusBadRequest {
+			t.Errorf("setting frequency %s: %d", v, w.Code)
+		}
+	}
+
+	// Failing to reach the server is the gateway's fault.
+	sdr.Close()
+	if w := do("POST", "/frequency", "100M", auth...); w.Code != http.StatusBadGateway {
+		t.Errorf("setting frequency while disconnected: %d", w.Code)
+	}
+}
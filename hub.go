@@ -0,0 +1,191 @@
+package rtltcp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Treatment of a hub subscriber whose queue is full.
+type Overflow int
+
+const (
+	// Drop blocks for the subscriber, reported by Block.Gap, while others
+	// carry on.
+	OverflowDrop Overflow = iota
+	// Wait for the subscriber, holding up the hub and every other
+	// subscriber, for consumers which must see every sample.
+	OverflowWait
+)
+
+// Hub fans the blocks of one Source out to any number of in-process
+// subscribers, such as a recorder, a demodulator and a spectrum display
+// sharing an SDR. Each subscriber has its own queue, so one falling behind
+// only loses blocks itself unless it subscribes with OverflowWait.
+//
+// Blocks are shared, not copied: each delivered block holds a reference
+// for its subscriber, which must Release it when done, see PooledBlocks.
+// Subscribers must not modify the samples.
+type Hub struct {
+	src  Source
+	pool *bufferPool
+
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	removed []*Subscription // Unsubscribed, their channels yet to be closed.
+	done    bool
+	err     error
+}
+
+// Subscription receives a hub's blocks on C, which is closed when the
+// subscription is closed or the hub stops.
+type Subscription struct {
+	C <-chan Block
+
+	hub     *Hub
+	c       chan Block
+	policy  Overflow
+	stop    chan struct{}
+	once    sync.Once
+	pending uint64   // Samples lost since the last block queued.
+	segment *Segment // Boundary of blocks lost since then.
+	dropped uint64   // Samples dropped in total, updated atomically.
+}
+
+// Returns a hub reading blocks of blockSize bytes from src once Run is
+// called.
+func NewHub(src Source, blockSize int) *Hub {
+	return &Hub{
+		src:  src,
+		pool: newBufferPool(blockSize),
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Adds a subscriber queueing up to depth blocks, DefaultQueueDepth if
+// zero. Subscribers added while the hub runs receive blocks read after.
+func (h *Hub) Subscribe(depth int, policy Overflow) *Subscription {
+	if depth <= 0 {
+		depth = DefaultQueueDepth
+	}
+	c := make(chan Block, depth)
+	s := &Subscription{C: c, hub: h, c: c, policy: policy, stop: make(chan struct{})}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done {
+		close(c)
+	} else {
+		h.subs[s] = struct{}{}
+	}
+	return s
+}
+
+// Stops delivery to the subscription. C is closed shortly after, blocks
+// still queued on it need not be released.
+func (s *Subscription) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+		h := s.hub
+		h.mu.Lock()
+		if _, ok := h.subs[s]; ok {
+			delete(h.subs, s)
+			h.removed = append(h.removed, s)
+		}
+		h.mu.Unlock()
+	})
+	return nil
+}
+
+// Returns the number of samples dropped for the subscriber.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Queues a block, which holds a reference for the subscriber.
+func (s *Subscription) deliver(ctx context.Context, blk Block) {
+	blk.Gap += s.pending
+	if s.segment != nil {
+		blk.Segment = carrySegment(s.segment, blk.Segment)
+	}
+	if s.policy == OverflowWait {
+		select {
+		case s.c <- blk:
+			s.pending, s.segment = 0, nil
+		case <-s.stop:
+			blk.Release()
+		case <-ctx.Done():
+			blk.Release()
+		}
+		return
+	}
+
+	select {
+	case s.c <- blk:
+		s.pending, s.segment = 0, nil
+	default:
+		s.pending = blk.Gap + uint64(blk.Len())
+		s.segment = carrySegment(nil, blk.Segment)
+		atomic.AddUint64(&s.dropped, uint64(blk.Len()))
+		blk.Release()
+	}
+}
+
+// Reads blocks from the source and delivers them to every subscriber until
+// reading fails or ctx is done, then closes every subscription and returns
+// the error, io.EOF at the end of a recording. ctx is checked between
+// blocks, closing the source interrupts a read.
+func (h *Hub) Run(ctx context.Context) (err error) {
+	defer func() {
+		h.mu.Lock()
+		h.done, h.err = true, err
+		for s := range h.subs {
+			close(s.c)
+		}
+		for _, s := range h.removed {
+			close(s.c)
+		}
+		h.subs, h.removed = nil, nil
+		h.mu.Unlock()
+	}()
+
+	var subs []*Subscription
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		pb := getBuffer(h.pool)
+		var blk Block
+		blk, err = h.src.ReadBlock(pb.data)
+		blk.buf = pb
+		if err != nil {
+			blk.Release()
+			return
+		}
+
+		h.mu.Lock()
+		subs = subs[:0]
+		for s := range h.subs {
+			subs = append(subs, s)
+		}
+		removed := h.removed
+		h.removed = nil
+		h.mu.Unlock()
+
+		for _, s := range removed {
+			close(s.c)
+		}
+		for _, s := range subs {
+			s.deliver(ctx, blk.Retain())
+		}
+		blk.Release()
+	}
+}
+
+// Returns the error which stopped the hub, nil while it runs.
+func (h *Hub) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
@@ -0,0 +1,160 @@
+package rtltcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// Magic number opening an identity extension, this package's own addition
+// to the protocol, which servers built on it may send with WriteIdentity
+// right after the dongle information header so clients of multi-dongle
+// setups can tell which physical device they're talking to. No
+// third-party server is known to send it, so their identity is empty. The
+// magic is followed by a big-endian uint16 length and that many bytes of
+// fields, each a type byte, a length byte and the value. Unknown fields
+// are skipped. Plain rtl_tcp servers send samples instead.
+var IdentityMagic = [...]byte{'R', 'T', 'L', 'X'}
+
+// Field types of an identity extension.
+const (
+	IdentitySerial = 1 // USB serial number of the dongle.
+	IdentityName   = 2 // Name of the device, such as its USB product string.
+	IdentityServer = 3 // Name of the server software, such as rtltcpd.
+	// Gains the dongle accepts, each a big-endian int16 in tenths of a dB,
+	// lowest first. Sent by servers whose driver reports its gain table.
+	IdentityGains = 4
+)
+
+// Time waited for the bytes following the header when checking for an
+// identity extension.
+const IdentityTimeout = 500 * time.Millisecond
+
+// Identity of a server's dongle, from an identity extension, empty fields
+// if not sent.
+type Identity struct {
+	Serial string
+	Name   string
+	Server string
+	Gains  []int // Tenths of a dB, lowest first.
+}
+
+// Reports whether no field is set.
+func (id Identity) empty() bool {
+	return id.Serial == "" && id.Name == "" && id.Server == "" && len(id.Gains) == 0
+}
+
+// Sends an identity extension. Servers send it right after the header.
+func WriteIdentity(w io.Writer, id Identity) error {
+	var gains []byte
+	for _, g := range id.Gains {
+		if g < math.MinInt16 || g > math.MaxInt16 {
+			return fmt.Errorf("gain %d out of range", g)
+		}
+		gains = binary.BigEndian.AppendUint16(gains, uint16(int16(g)))
+	}
+
+	var fields []byte
+	for _, f := range []struct {
+		typ   byte
+		value string
+	}{{IdentitySerial, id.Serial}, {IdentityName, id.Name}, {IdentityServer, id.Server}, {IdentityGains, string(gains)}} {
+		if f.value == "" {
+			continue
+		}
+		if len(f.value) > 255 {
+			return fmt.Errorf("identity field %d longer than 255 bytes", f.typ)
+		}
+		fields = append(fields, f.typ, byte(len(f.value)))
+		fields = append(fields, f.value...)
+	}
+
+	buf := append(IdentityMagic[:], 0, 0)
+	binary.BigEndian.PutUint16(buf[len(IdentityMagic):], uint16(len(fields)))
+	_, err := w.Write(append(buf, fields...))
+	return err
+}
+
+// Parses the fields of an identity extension.
+func parseIdentity(fields []byte) (id Identity, err error) {
+	for len(fields) > 0 {
+		if len(fields) < 2 || len(fields) < 2+int(fields[1]) {
+			return id, errors.New("truncated identity field")
+		}
+		value := string(fields[2 : 2+fields[1]])
+		switch fields[0] {
+		case IdentitySerial:
+			id.Serial = value
+		case IdentityName:
+			id.Name = value
+		case IdentityServer:
+			id.Server = value
+		case IdentityGains:
+			if len(value)%2 != 0 {
+				return id, errors.New("odd length gain field")
+			}
+			id.Gains = make([]int, len(value)/2)
+			for i := range id.Gains {
+				id.Gains[i] = int(int16(binary.BigEndian.Uint16([]byte(value[2*i:]))))
+			}
+		}
+		fields = fields[2+fields[1]:]
+	}
+	return id, nil
+}
+
+// Reads an identity extension if the server sends one, keeping the bytes
+// read otherwise as the first samples.
+func (sdr *SDR) readIdentity(ctx context.Context) error {
+	deadline := time.Now().Add(IdentityTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	sdr.Conn.SetReadDeadline(deadline)
+	defer func() {
+		d, _ := ctx.Deadline()
+		sdr.Conn.SetReadDeadline(d)
+	}()
+
+	var magic [len(IdentityMagic)]byte
+	n, err := io.ReadFull(sdr.Conn, magic[:])
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+		err = nil
+	}
+	if err != nil || magic != IdentityMagic {
+		sdr.pending = append(sdr.pending[:0], magic[:n]...)
+		if err != nil {
+			return fmt.Errorf("Error reading identity: %s", err)
+		}
+		return nil
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(sdr.Conn, length[:]); err != nil {
+		return fmt.Errorf("Error reading identity: %s", err)
+	}
+	fields := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(sdr.Conn, fields); err != nil {
+		return fmt.Errorf("Error reading identity: %s", err)
+	}
+	sdr.identity, err = parseIdentity(fields)
+	return err
+}
+
+// Returns the dongle's serial number sent in an identity extension, empty
+// if unknown, as it is for servers not built on this package.
+func (sdr *SDR) Serial() string {
+	return sdr.identity.Serial
+}
+
+// Returns the device name sent in an identity extension, empty if unknown,
+// as it is for servers not built on this package.
+func (sdr *SDR) Name() string {
+	return sdr.identity.Name
+}
@@ -0,0 +1,228 @@
+// Package influx exports measurements as InfluxDB line protocol, to a file
+// or over HTTP to InfluxDB's write API or any endpoint accepting it, for
+// long-term trend dashboards in Grafana and similar tools.
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp/monitor"
+)
+
+// Measurement name of channel report points.
+const ChannelMeasurement = "rtltcp_channel"
+
+// Time allowed for one HTTP write.
+const DefaultTimeout = 10 * time.Second
+
+// A point of a series.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	// Values may be float64, float32, int, int64, uint32, uint64, bool or
+	// string. Non-finite floats are omitted, as line protocol can't carry
+	// them.
+	Fields map[string]interface{}
+	Time   time.Time
+}
+
+// Returns the point of a channel report.
+func ReportPoint(r monitor.Report) Point {
+	return Point{
+		Measurement: ChannelMeasurement,
+		Tags: map[string]string{
+			"channel": r.Channel,
+			"freq":    strconv.FormatUint(uint64(r.Freq), 10),
+		},
+		Fields: map[string]interface{}{
+			"power":        r.Power,
+			"peak":         r.Peak,
+			"noise":        r.Noise,
+			"snr":          r.SNR,
+			"occupancy":    r.Occupancy,
+			"openings":     r.Openings,
+			"measurements": r.Measurements,
+		},
+		Time: r.Time,
+	}
+}
+
+// Appends p as a line, without fields it can't encode. Points with no fields
+// left aren't appended.
+func AppendLine(dst []byte, p Point, tags map[string]string) []byte {
+	start := len(dst)
+	dst = appendEscaped(dst, p.Measurement, ", ")
+
+	// Sorted as InfluxDB recommends, the point's tags overriding.
+	merged := make(map[string]string, len(tags)+len(p.Tags))
+	for k, v := range tags {
+		merged[k] = v
+	}
+	for k, v := range p.Tags {
+		merged[k] = v
+	}
+	for _, k := range sortedKeys(merged) {
+		if k == "" || merged[k] == "" {
+			continue
+		}
+		dst = append(dst, ',')
+		dst = appendEscaped(dst, k, ",= ")
+		dst = append(dst, '=')
+		dst = appendEscaped(dst, merged[k], ",= ")
+	}
+
+	sep := byte(' ')
+	for _, k := range sortedKeys(p.Fields) {
+		value, ok := appendValue(nil, p.Fields[k])
+		if !ok {
+			continue
+		}
+		dst = append(dst, sep)
+		dst = appendEscaped(dst, k, ",= ")
+		dst = append(dst, '=')
+		dst = append(dst, value...)
+		sep = ','
+	}
+	if sep == ' ' {
+		return dst[:start]
+	}
+
+	if !p.Time.IsZero() {
+		dst = append(dst, ' ')
+		dst = strconv.AppendInt(dst, p.Time.UnixNano(), 10)
+	}
+	return append(dst, '\n')
+}
+
+// Appends a field value, returning false if it has no encoding.
+func appendValue(dst []byte, v interface{}) ([]byte, bool) {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return dst, false
+		}
+		return strconv.AppendFloat(dst, v, 'g', -1, 64), true
+	case float32:
+		return appendValue(dst, float64(v))
+	case int:
+		return append(strconv.AppendInt(dst, int64(v), 10), 'i'), true
+	case int64:
+		return append(strconv.AppendInt(dst, v, 10), 'i'), true
+	case uint32:
+		return append(strconv.AppendUint(dst, uint64(v), 10), 'i'), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return dst, false
+		}
+		return append(strconv.AppendUint(dst, v, 10), 'i'), true
+	case bool:
+		return strconv.AppendBool(dst, v), true
+	case string:
+		dst = append(dst, '"')
+		dst = appendEscaped(dst, v, `"\`)
+		return append(dst, '"'), true
+	}
+	return dst, false
+}
+
+// Appends s with any of special backslash escaped.
+func appendEscaped(dst []byte, s, special string) []byte {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(special, s[i]) >= 0 {
+			dst = append(dst, '\\')
+		}
+		dst = append(dst, s[i])
+	}
+	return dst
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Exporter writes batches of points as line protocol.
+type Exporter struct {
+	// Tags added to every point, such as the device, unless the point has
+	// its own.
+	Tags map[string]string
+
+	w    io.Writer
+	post func([]byte) error
+	buf  []byte
+}
+
+// Returns an exporter writing each batch to w, such as a file.
+func NewExporter(w io.Writer) *Exporter {
+	return &Exporter{w: w}
+}
+
+// Returns an exporter posting each batch to url, such as InfluxDB 2's
+// http://localhost:8086/api/v2/write?org=o&bucket=b or 1.x's
+// http://localhost:8086/write?db=d, with nanosecond precision. A non-empty
+// token is sent as InfluxDB's Authorization header.
+func NewHTTPExporter(url, token string) *Exporter {
+	client := &http.Client{Timeout: DefaultTimeout}
+	return &Exporter{post: func(body []byte) error {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("Error writing points: %s", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("influx: write failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+		}
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}}
+}
+
+// Writes points as one batch, nothing if none can be encoded.
+func (e *Exporter) Export(points ...Point) error {
+	e.buf = e.buf[:0]
+	for _, p := range points {
+		e.buf = AppendLine(e.buf, p, e.Tags)
+	}
+	if len(e.buf) == 0 {
+		return nil
+	}
+	if e.post != nil {
+		return e.post(e.buf)
+	}
+	if _, err := e.w.Write(e.buf); err != nil {
+		return fmt.Errorf("Error writing points: %s", err)
+	}
+	return nil
+}
+
+// Writes the points of reports as one batch.
+func (e *Exporter) ExportReports(reports ...monitor.Report) error {
+	points := make([]Point, 0, len(reports))
+	for _, r := range reports {
+		if r.Measurements > 0 {
+			points = append(points, ReportPoint(r))
+		}
+	}
+	return e.Export(points...)
+}
@@ -0,0 +1,71 @@
+package influx
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp/monitor"
+)
+
+func TestAppendLine(t *testing.T) {
+	p := Point{
+		Measurement: "m,1",
+		Tags:        map[string]string{"b": "x y", "a": "1=2", "empty": ""},
+		Fields: map[string]interface{}{
+			"f":   1.5,
+			"i":   3,
+			"s":   `say "hi"`,
+			"nan": math.NaN(),
+			"ok":  true,
+		},
+		Time: time.Unix(1, 5),
+	}
+	got := string(AppendLine(nil, p, map[string]string{"device": "d", "a": "overridden"}))
+	want := `m\,1,a=1\=2,b=x\ y,device=d f=1.5,i=3i,ok=true,s="say \"hi\"" 1000000005` + "\n"
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	if b := AppendLine(nil, Point{Measurement: "m", Fields: map[string]interface{}{"x": math.Inf(1)}}, nil); len(b) != 0 {
+		t.Errorf("appended %q without fields", b)
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	var body []byte
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		auth = r.Header.Get("Authorization")
+		if bytes.Contains(body, []byte("bad")) {
+			http.Error(w, "unable to parse", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	e := NewHTTPExporter(srv.URL+"/api/v2/write?bucket=b", "secret")
+	e.Tags = map[string]string{"device": "0001"}
+	at := time.Unix(10, 0)
+	err := e.ExportReports(
+		monitor.Report{Time: at, Channel: "a", Freq: 100e6, Power: -20, SNR: 30, Occupancy: 0.5, Openings: 2, Measurements: 10},
+		monitor.Report{Time: at, Channel: "outside", Freq: 200e6},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "rtltcp_channel,channel=a,device=0001,freq=100000000 measurements=10i,noise=0,occupancy=0.5,openings=2i,peak=0,power=-20,snr=30 10000000000\n"
+	if string(body) != want || auth != "Token secret" {
+		t.Errorf("posted %q with %q", body, auth)
+	}
+
+	if err := e.Export(Point{Measurement: "bad", Fields: map[string]interface{}{"x": 1}}); err == nil {
+		t.Error("rejected write succeeded")
+	}
+}
@@ -0,0 +1,146 @@
+package rtltcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Gains in tenths of a dB librtlsdr offers for each tuner, lowest first.
+var tunerGains = map[Tuner][]int{
+	TunerE4000:  {-10, 15, 40, 65, 90, 115, 140, 165, 190, 215, 240, 290, 340, 420},
+	TunerFC0012: {-99, -40, 71, 179, 192},
+	TunerFC0013: {-99, -73, -65, -63, -60, -58, -54, 58, 61, 63, 65, 67, 68, 70, 71, 179, 181, 182, 184, 186, 188, 191, 197},
+	TunerFC2580: {0},
+}
+
+// Usable tuning range of each tuner in Hz. The E4000 has a gap between
+// about 1.1 and 1.25 GHz, the FC2580 between 308 and 438 MHz.
+var tunerRanges = map[Tuner][2]uint32{
+	TunerE4000:  {52e6, 2200e6},
+	TunerFC0012: {22e6, 948.6e6},
+	TunerFC0013: {22e6, 1100e6},
+	TunerFC2580: {146e6, 924e6},
+	TunerR820T:  {24e6, 1766e6},
+	TunerR828D:  {24e6, 1766e6},
+}
+
+// Returns the gains in tenths of a dB the tuner accepts, lowest first, nil
+// if unknown. The i-th is selected by SetGainByIndex(i).
+func (t Tuner) Gains() []int {
+	if t == TunerR820T || t == TunerR828D {
+		gains := make([]int, len(R820TGains))
+		for i, g := range R820TGains {
+			gains[i] = int(g)
+		}
+		return gains
+	}
+	return append([]int(nil), tunerGains[t]...)
+}
+
+// Returns the gains in tenths of a dB the dongle accepts, lowest first: the
+// table sent by the server if it reports one, see IdentityGains, otherwise
+// the built-in table of the tuner. Nil if neither is known.
+func (sdr *SDR) Gains() []int {
+	if len(sdr.identity.Gains) > 0 {
+		return append([]int(nil), sdr.identity.Gains...)
+	}
+	return sdr.Info.Tuner.Gains()
+}
+
+// Disables tuner AGC and sets the accepted gain nearest db, per Gains. The
+// gain is sent as given if the table is unknown.
+func (sdr *SDR) SetGainDB(db float64) error {
+	gain := int(math.Round(db * 10))
+	if gains := sdr.Gains(); len(gains) > 0 {
+		nearest := gains[0]
+		for _, g := range gains[1:] {
+			if abs(g-gain) < abs(nearest-gain) {
+				nearest = g
+			}
+		}
+		gain = nearest
+	}
+	if err := sdr.SetManualGainMode(true); err != nil {
+		return err
+	}
+	return sdr.SetGain(uint32(int32(gain)))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Returns the tuning range of the tuner in Hz, zero if unknown.
+func (t Tuner) FreqRange() (low, high uint32) {
+	r := tunerRanges[t]
+	return r[0], r[1]
+}
+
+// Parses a tuner name as returned by String.
+func ParseTuner(s string) (Tuner, error) {
+	for t := TunerE4000; t <= TunerR828D; t++ {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tuner %q", s)
+}
+
+// Encodes the tuner by name, as String.
+func (t Tuner) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Decodes a tuner name, UNKNOWN as zero.
+func (t *Tuner) UnmarshalText(b []byte) error {
+	tuner, err := ParseTuner(string(b))
+	if err != nil && string(b) != Tuner(0).String() {
+		return err
+	}
+	*t = tuner
+	return nil
+}
+
+// JSON form of DongleInfo, with the capabilities derived from the tuner.
+type dongleInfoJSON struct {
+	Magic     string `json:"magic"`
+	Tuner     string `json:"tuner"`
+	GainCount uint32 `json:"gain_count"`
+	FreqMin   uint32 `json:"freq_min,omitempty"` // Hz.
+	FreqMax   uint32 `json:"freq_max,omitempty"`
+	Gains     []int  `json:"gains,omitempty"` // Tenths of a dB.
+}
+
+func (d DongleInfo) MarshalJSON() ([]byte, error) {
+	v := dongleInfoJSON{
+		Magic:     string(d.Magic[:]),
+		Tuner:     d.Tuner.String(),
+		GainCount: d.GainCount,
+		Gains:     d.Tuner.Gains(),
+	}
+	v.FreqMin, v.FreqMax = d.Tuner.FreqRange()
+	return json.Marshal(v)
+}
+
+// Reads the form written by MarshalJSON, ignoring the derived fields.
+func (d *DongleInfo) UnmarshalJSON(b []byte) error {
+	var v dongleInfoJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if len(v.Magic) != len(d.Magic) {
+		return fmt.Errorf("invalid dongle magic %q", v.Magic)
+	}
+
+	tuner, err := ParseTuner(v.Tuner)
+	if err != nil && v.Tuner != Tuner(0).String() {
+		return err
+	}
+	copy(d.Magic[:], v.Magic)
+	d.Tuner, d.GainCount = tuner, v.GainCount
+	return nil
+}
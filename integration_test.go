@@ -0,0 +1,217 @@
+//go:build integration
+
+// Tests against the reference rtl_tcp with a dongle attached, run with
+//
+//	go test -tags integration -run Integration
+//
+// rtl_tcp is found on the PATH, or at RTL_TCP if set. The tests skip if it
+// or a dongle is missing.
+package rtltcp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Time allowed for rtl_tcp to open the dongle and start listening.
+const rtlTCPStartup = 10 * time.Second
+
+// A running rtl_tcp process and the lines it logs.
+type rtlTCP struct {
+	addr string
+	cmd  *exec.Cmd
+
+	mu    sync.Mutex
+	lines []string
+	more  chan struct{} // Closed and replaced as lines arrive.
+	done  chan struct{} // Closed when the process exits.
+}
+
+// Starts rtl_tcp on a free loopback port, skipping the test if the binary
+// or a dongle is missing.
+func startRTLTCP(t *testing.T) *rtlTCP {
+	t.Helper()
+	bin := os.Getenv("RTL_TCP")
+	if bin == "" {
+		var err error
+		if bin, err = exec.LookPath("rtl_tcp"); err != nil {
+			t.Skip("rtl_tcp not found, set RTL_TCP or add it to the PATH")
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+
+	args := []string{bin, "-a", "127.0.0.1", "-p", port, "-s", "1024000", "-f", "100000000"}
+	// rtl_tcp logs commands with printf, block buffered into a pipe.
+	if stdbuf, err := exec.LookPath("stdbuf"); err == nil {
+		args = append([]string{stdbuf, "-oL"}, args...)
+	}
+	r := &rtlTCP{
+		addr: net.JoinHostPort("127.0.0.1", port),
+		cmd:  exec.Command(args[0], args[1:]...),
+		more: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	out, err := r.cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.cmd.Stderr = r.cmd.Stdout
+	if err := r.cmd.Start(); err != nil {
+		t.Fatalf("Error starting rtl_tcp: %s", err)
+	}
+	go r.collect(out)
+	t.Cleanup(func() {
+		r.cmd.Process.Kill()
+		<-r.done
+		if t.Failed() {
+			t.Logf("rtl_tcp output:\n%s", strings.Join(r.output(), "\n"))
+		}
+	})
+
+	for deadline := time.Now().Add(rtlTCPStartup); ; {
+		select {
+		case <-r.done:
+			output := strings.Join(r.output(), "\n")
+			if strings.Contains(output, "No supported devices") {
+				t.Skip("no dongle attached")
+			}
+			t.Fatalf("rtl_tcp exited:\n%s", output)
+		default:
+		}
+		if conn, err := net.Dial("tcp", r.addr); err == nil {
+			// rtl_tcp serves one client, which this probe was.
+			conn.Close()
+			r.wait(t, "client accepted")
+			return r
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rtl_tcp not listening after %s", rtlTCPStartup)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Collects lines of output until the process exits.
+func (r *rtlTCP) collect(out io.Reader) {
+	s := bufio.NewScanner(out)
+	for s.Scan() {
+		r.mu.Lock()
+		r.lines = append(r.lines, s.Text())
+		close(r.more)
+		r.more = make(chan struct{})
+		r.mu.Unlock()
+	}
+	r.cmd.Wait()
+	close(r.done)
+}
+
+func (r *rtlTCP) output() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lines...)
+}
+
+// Waits for rtl_tcp to log a line containing want, consuming the lines up
+// to it.
+func (r *rtlTCP) wait(t *testing.T, want string) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		r.mu.Lock()
+		for i, line := range r.lines {
+			if strings.Contains(line, want) {
+				r.lines = r.lines[i+1:]
+				r.mu.Unlock()
+				return
+			}
+		}
+		more := r.more
+		r.mu.Unlock()
+
+		select {
+		case <-more:
+		case <-r.done:
+			t.Fatalf("rtl_tcp exited before logging %q", want)
+		case <-timeout:
+			t.Fatalf("rtl_tcp never logged %q", want)
+		}
+	}
+}
+
+func TestIntegration(t *testing.T) {
+	r := startRTLTCP(t)
+
+	var sdr SDR
+	if err := sdr.ConnectAddr(r.addr); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+
+	t.Run("Handshake", func(t *testing.T) {
+		if !sdr.Info.Valid() || sdr.Info.Tuner.String() == "UNKNOWN" {
+			t.Fatalf("header %s", sdr.Info)
+		}
+		if gains := sdr.Info.Tuner.Gains(); len(gains) > 1 && uint32(len(gains)) != sdr.Info.GainCount {
+			t.Errorf("%s reports %d gains, librtlsdr has %d", sdr.Info.Tuner, sdr.Info.GainCount, len(gains))
+		}
+		if sdr.ServerType() != ServerRTLTCP {
+			t.Errorf("fingerprinted as %s", sdr.ServerType())
+		}
+	})
+
+	// Each command as rtl_tcp reports applying it.
+	t.Run("Commands", func(t *testing.T) {
+		gains := sdr.Info.Tuner.Gains()
+		commands := []struct {
+			set  func() error
+			want string
+		}{
+			{func() error { return sdr.SetSampleRate(2048000) }, "set sample rate 2048000"},
+			{func() error { return sdr.SetCenterFreq(433920000) }, "set freq 433920000"},
+			{func() error { return sdr.SetManualGainMode(true) }, "set gain mode 1"},
+			{func() error { return sdr.SetGain(uint32(gains[len(gains)-1])) }, fmt.Sprintf("set gain %d", gains[len(gains)-1])},
+			{func() error { return sdr.SetGainByIndex(0) }, "set tuner gain by index 0"},
+			{func() error { return sdr.SetFreqCorrection(1) }, "set freq correction 1"},
+			{func() error { return sdr.SetAGCMode(true) }, "set agc mode 1"},
+			{func() error { return sdr.SetAGCMode(false) }, "set agc mode 0"},
+			{func() error { return sdr.SetTunerAGC(true) }, "set gain mode 0"},
+		}
+		for _, c := range commands {
+			if err := c.set(); err != nil {
+				t.Fatalf("%s: %s", c.want, err)
+			}
+			r.wait(t, c.want)
+		}
+	})
+
+	t.Run("Streaming", func(t *testing.T) {
+		if err := sdr.SetSampleRate(1024000); err != nil {
+			t.Fatal(err)
+		}
+		report, err := sdr.VerifyLink(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.OK() {
+			t.Errorf("%d gaps, %d bytes dropped", report.Gaps, report.Dropped)
+		}
+		// Two bytes per sample, within USB scheduling jitter.
+		if report.Throughput < 0.9*2*1024000 {
+			t.Errorf("throughput %.0f B/s at 1024000 S/s", report.Throughput)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package rtltcp
+
+import (
+	"io"
+
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Reads exactly n samples and returns them converted to complex values
+// between -1 and 1, for scripts which don't need blocks or metadata. The IQ
+// balance of the dongle's calibration is corrected, see CalibrationStore.
+func (sdr *SDR) ReadIQ(n int) ([]complex64, error) {
+	iq := make([]complex64, n)
+	m, err := sdr.ReadIQInto(iq)
+	return iq[:m], err
+}
+
+// Fills dst with converted samples and returns the number read, failing as
+// io.ReadFull does if fewer than len(dst) are available. Reuses a buffer
+// between calls, so it doesn't allocate once warmed up.
+func (sdr *SDR) ReadIQInto(dst []complex64) (int, error) {
+	if cap(sdr.iq) < 2*len(dst) {
+		sdr.iq = make([]byte, 2*len(dst))
+	}
+	buf := sdr.iq[:2*len(dst)]
+
+	n, err := io.ReadFull(sdr, buf)
+	if err == io.ErrUnexpectedEOF && n == 1 {
+		// Half a sample is as good as none.
+		err = io.EOF
+	}
+	iq := dsp.ConvertU8(dst[:0], buf[:n])
+	// Corrected in place, each sample depending only on itself.
+	sdr.calibration.Balance.Process(iq[:0], iq)
+	return n / 2, err
+}
@@ -0,0 +1,132 @@
+package rtltcp
+
+import (
+	"fmt"
+	"time"
+)
+
+// Gap positions kept by VerifyLink, later gaps are only counted.
+const MaxLinkGaps = 1024
+
+// Consecutive counter values VerifyLink waits for before checking, so
+// samples in transit from before test mode was enabled aren't mistaken for
+// gaps.
+const linkSyncLen = 256
+
+// Bytes read at a time by VerifyLink.
+const linkReadSize = 16384
+
+// Result of VerifyLink.
+type LinkReport struct {
+	Bytes   uint64 // Bytes checked, from the first complete counter run.
+	Gaps    uint64 // Discontinuities in the counter.
+	Dropped uint64 // Bytes skipped, modulo 256 per gap.
+	// Offsets of the first MaxLinkGaps gaps into the bytes checked.
+	GapOffsets []uint64
+	Elapsed    time.Duration
+	Throughput float64 // Bytes checked per second.
+}
+
+// Reports whether the counter was received without gaps.
+func (r LinkReport) OK() bool {
+	return r.Gaps == 0
+}
+
+// Tracks the counter the RTL2832 emits in test mode, one byte incrementing
+// per byte transferred.
+type linkCheck struct {
+	next byte
+	run  int // Consecutive values matching the counter, until synced.
+}
+
+// Consumes p until linkSyncLen consecutive counter values are seen,
+// returning the remainder and whether they were found.
+func (c *linkCheck) sync(p []byte) ([]byte, bool) {
+	for i, b := range p {
+		if c.run > 0 && b == c.next {
+			c.run++
+		} else {
+			c.run = 1
+		}
+		c.next = b + 1
+		if c.run == linkSyncLen {
+			return p[i+1:], true
+		}
+	}
+	return nil, false
+}
+
+// Checks p against the counter, recording gaps in r.
+func (c *linkCheck) check(p []byte, r *LinkReport) {
+	for i, b := range p {
+		if b != c.next {
+			if len(r.GapOffsets) < MaxLinkGaps {
+				r.GapOffsets = append(r.GapOffsets, r.Bytes+uint64(i))
+			}
+			r.Gaps++
+			r.Dropped += uint64(b - c.next)
+		}
+		c.next = b + 1
+	}
+	r.Bytes += uint64(len(p))
+}
+
+// Verifies the link end to end: enables test mode, waits up to duration for
+// the counter to appear, then checks every byte received for duration more.
+// Test mode is restored to its previous setting afterwards, even on error.
+// Re-encoded streams, such as relayed 4-bit or decimated samples, don't
+// carry the counter intact and fail to synchronize.
+func (sdr *SDR) VerifyLink(duration time.Duration) (r LinkReport, err error) {
+	key := uint32(TestMode) << 16
+	sdr.mu.Lock()
+	prev, set := sdr.settings[key]
+	sdr.mu.Unlock()
+
+	if err = sdr.SetTestMode(true); err != nil {
+		return r, fmt.Errorf("Error enabling test mode: %s", err)
+	}
+	defer func() {
+		if set && prev.Parameter != 0 {
+			return
+		}
+		if terr := sdr.SetTestMode(false); terr != nil {
+			if err == nil {
+				err = fmt.Errorf("Error disabling test mode: %s", terr)
+			}
+			return
+		}
+		if !set {
+			sdr.mu.Lock()
+			delete(sdr.settings, key)
+			sdr.mu.Unlock()
+		}
+	}()
+
+	var c linkCheck
+	buf := make([]byte, linkReadSize)
+	var p []byte
+	synced := false
+	for deadline := time.Now().Add(duration); !synced; {
+		if time.Now().After(deadline) {
+			return r, fmt.Errorf("rtltcp: test pattern not received within %s", duration)
+		}
+		n, err := sdr.Read(buf)
+		if err != nil {
+			return r, fmt.Errorf("Error reading samples: %s", err)
+		}
+		p, synced = c.sync(buf[:n])
+	}
+
+	start := time.Now()
+	c.check(p, &r)
+	for time.Since(start) < duration {
+		n, err := sdr.Read(buf)
+		if err != nil {
+			return r, fmt.Errorf("Error reading samples: %s", err)
+		}
+		c.check(buf[:n], &r)
+	}
+	r.Elapsed = time.Since(start)
+	r.Throughput = float64(r.Bytes) / r.Elapsed.Seconds()
+	return r, nil
+}
@@ -0,0 +1,520 @@
+package rtltcp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default interval between reconnection attempts of a managed device.
+const DefaultReconnectInterval = 5 * time.Second
+
+// Settings applied to a managed device whenever it connects.
+type DeviceConfig struct {
+	Name   string // Unique name the device is looked up by.
+	Addr   string // Server address of the form "host:port".
+	Serial string // Dongle serial the device can be looked up by, until one is reported.
+
+	CenterFreq     uint32 // Hz, unchanged if zero.
+	SampleRate     uint32 // Hz, unchanged if zero.
+	AutoGain       bool
+	Gain           uint32 // Tenths of a dB, applied if nonzero unless AutoGain.
+	FreqCorrection int    // ppm, unchanged if zero.
+	// Offset of a converter ahead of the dongle in Hz, see SDR.ConverterOffset.
+	ConverterOffset int64
+	// Enable offset tuning if the tuner benefits, see SDR.AutoOffsetTuning.
+	AutoOffsetTuning bool
+	// Branch to sample HF directly on, see SDR.AutoDirectSampling.
+	AutoDirectSampling DirectSamplingBranch
+
+	// Bytes per block delivered to sinks, DefaultBlockSize if zero.
+	BlockSize int
+
+	// Optional policy for retrying command writes, see SDR.Retry.
+	Retry *RetryPolicy
+	// Wire format of the server, see SDR.Codec.
+	Codec Codec
+	// Check for an identity extension, see SDR.ExtendedHeader. A serial
+	// it reports takes precedence over Serial.
+	ExtendedHeader bool
+	// Calls to Control made while disconnected queued for replay once
+	// reconnected, in order, instead of failing. Zero queues none.
+	ControlQueue int
+}
+
+// Default block size of managed devices.
+const DefaultBlockSize = 16384
+
+// Counters of a managed device.
+type DeviceStats struct {
+	Name       string
+	Addr       string
+	Connected  bool
+	Blocks     uint64
+	Bytes      uint64
+	Reconnects uint64
+	LastBlock  time.Time
+	LastError  string
+	// Reconnections finding a different dongle, and the last one found.
+	DongleChanges    uint64
+	LastDongleChange string
+
+	// Connection attempts made after losing the connection, successful or
+	// not, those failing in the header exchange, and the time taken by the
+	// last.
+	ReconnectAttempts uint64
+	HandshakeFailures uint64
+	LastAttempt       time.Duration
+	// Time spent disconnected in total and in the last outage, both
+	// including an outage in progress.
+	Downtime   time.Duration
+	LastOutage time.Duration
+
+	// Failed command writes by opcode, and the last failure.
+	CommandErrors    map[uint8]uint64
+	LastCommandError string
+}
+
+// Stats of all managed devices and their totals.
+type ManagerStats struct {
+	Devices    []DeviceStats
+	Connected  int
+	Blocks     uint64
+	Bytes      uint64
+	Reconnects uint64
+
+	ReconnectAttempts uint64
+	HandshakeFailures uint64
+	CommandErrors     uint64
+}
+
+// Device is a server maintained by a Manager. Blocks read from it are
+// delivered to attached sinks.
+type Device struct {
+	Config DeviceConfig
+
+	manager *Manager
+
+	mu     sync.Mutex
+	sdr    *SDR
+	sinks  []Sink
+	queued []func(*SDR) error // Control calls awaiting reconnection.
+	stats  DeviceStats
+	down   time.Time // Start of the outage in progress.
+	closed bool
+	done   chan struct{}
+}
+
+// Manager maintains connections to several rtl_tcp servers, reconnecting
+// and re-applying configuration when they drop.
+type Manager struct {
+	// Interval between reconnection attempts.
+	ReconnectInterval time.Duration
+	// Fraction of each device's sample rate usable for assigned channels.
+	UsableFraction float64
+	// Optional callback invoked when a device reconnects to a different
+	// dongle, after its settings were revalidated, see SDR.Restore.
+	OnDongleChange func(*Device, DongleChange)
+
+	mu      sync.Mutex
+	devices map[string]*Device
+}
+
+// Returns an empty manager.
+func NewManager() *Manager {
+	return &Manager{
+		ReconnectInterval: DefaultReconnectInterval,
+		UsableFraction:    DefaultUsableFraction,
+		devices:           make(map[string]*Device),
+	}
+}
+
+// Connects to and configures a device, then maintains the connection until
+// the device is removed. Fails if the name is taken or the initial
+// connection fails.
+func (m *Manager) Add(cfg DeviceConfig) (*Device, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("device name is required")
+	}
+	if cfg.BlockSize == 0 {
+		cfg.BlockSize = DefaultBlockSize
+	}
+
+	d := &Device{
+		Config:  cfg,
+		manager: m,
+		stats:   DeviceStats{Name: cfg.Name, Addr: cfg.Addr},
+		done:    make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	_, taken := m.devices[cfg.Name]
+	if !taken {
+		m.devices[cfg.Name] = d
+	}
+	m.mu.Unlock()
+	if taken {
+		return nil, fmt.Errorf("device %q already exists", cfg.Name)
+	}
+
+	if err := d.connect(nil); err != nil {
+		m.mu.Lock()
+		delete(m.devices, cfg.Name)
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	go d.run()
+
+	return d, nil
+}
+
+// Returns the device with the given name, or nil.
+func (m *Manager) Device(name string) *Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.devices[name]
+}
+
+// Returns the device with the given serial, or nil.
+func (m *Manager) BySerial(serial string) *Device {
+	for _, d := range m.Devices() {
+		if s := d.Serial(); s != "" && s == serial {
+			return d
+		}
+	}
+	return nil
+}
+
+// Returns all devices ordered by name.
+func (m *Manager) Devices() []*Device {
+	m.mu.Lock()
+	devices := make([]*Device, 0, len(m.devices))
+	for _, d := range m.devices {
+		devices = append(devices, d)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Config.Name < devices[j].Config.Name
+	})
+	return devices
+}
+
+// Disconnects a device and stops maintaining it.
+func (m *Manager) Remove(name string) error {
+	m.mu.Lock()
+	d, ok := m.devices[name]
+	delete(m.devices, name)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no device %q", name)
+	}
+	return d.close()
+}
+
+// Returns the stats of every device and their totals.
+func (m *Manager) Stats() (s ManagerStats) {
+	for _, d := range m.Devices() {
+		ds := d.Stats()
+		s.Devices = append(s.Devices, ds)
+		if ds.Connected {
+			s.Connected++
+		}
+		s.Blocks += ds.Blocks
+		s.Bytes += ds.Bytes
+		s.Reconnects += ds.Reconnects
+		s.ReconnectAttempts += ds.ReconnectAttempts
+		s.HandshakeFailures += ds.HandshakeFailures
+		for _, n := range ds.CommandErrors {
+			s.CommandErrors += n
+		}
+	}
+	return
+}
+
+// Removes all devices.
+func (m *Manager) Close() error {
+	var errs []error
+	for _, d := range m.Devices() {
+		if err := m.Remove(d.Config.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Connects and configures the device. If a previous connection is given
+// its settings are restored instead, keeping changes made since connecting.
+func (d *Device) connect(prev *SDR) (err error) {
+	sdr := &SDR{Codec: d.Config.Codec, ExtendedHeader: d.Config.ExtendedHeader}
+	if err = sdr.ConnectAddr(d.Config.Addr); err != nil {
+		if prev != nil && handshakeFailed(err) {
+			d.mu.Lock()
+			d.stats.HandshakeFailures++
+			d.mu.Unlock()
+		}
+		return fmt.Errorf("Error connecting to %s: %s", d.Config.Name, err)
+	}
+	sdr.Retry = d.Config.Retry
+	sdr.OnDongleChange = d.dongleChanged
+	sdr.OnCommandError = d.commandFailed
+
+	if prev != nil {
+		err = sdr.Restore(prev)
+	} else {
+		err = d.configure(sdr)
+	}
+	if err != nil {
+		sdr.Close()
+		return fmt.Errorf("Error configuring %s: %s", d.Config.Name, err)
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		sdr.Close()
+		return errors.New("device removed")
+	}
+	d.sdr = sdr
+	d.stats.Connected = true
+	queued := d.queued
+	d.queued = nil
+	d.mu.Unlock()
+
+	for _, fn := range queued {
+		if err := fn(sdr); err != nil {
+			d.mu.Lock()
+			d.stats.LastError = err.Error()
+			d.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+func (d *Device) dongleChanged(c DongleChange) {
+	d.mu.Lock()
+	d.stats.DongleChanges++
+	d.stats.LastDongleChange = c.String()
+	d.mu.Unlock()
+	if d.manager.OnDongleChange != nil {
+		d.manager.OnDongleChange(d, c)
+	}
+}
+
+func (d *Device) commandFailed(cmd Command, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stats.CommandErrors == nil {
+		d.stats.CommandErrors = make(map[uint8]uint64)
+	}
+	d.stats.CommandErrors[cmd.Opcode]++
+	d.stats.LastCommandError = fmt.Sprintf("opcode %d: %s", cmd.Opcode, err)
+}
+
+// Applies the device's configuration, sending its commands in one write.
+func (d *Device) configure(sdr *SDR) error {
+	return sdr.Batch(func() error { return d.apply(sdr) })
+}
+
+func (d *Device) apply(sdr *SDR) (err error) {
+	cfg := d.Config
+	sdr.ConverterOffset = cfg.ConverterOffset
+	sdr.AutoDirectSampling = cfg.AutoDirectSampling
+	if cfg.SampleRate != 0 {
+		if err = sdr.SetSampleRate(cfg.SampleRate); err != nil {
+			return
+		}
+	}
+	if cfg.CenterFreq != 0 {
+		if err = sdr.SetCenterFreq(cfg.CenterFreq); err != nil {
+			return
+		}
+	}
+	if cfg.AutoGain || cfg.Gain != 0 {
+		if err = sdr.SetTunerAGC(cfg.AutoGain); err != nil {
+			return
+		}
+	}
+	if !cfg.AutoGain && cfg.Gain != 0 {
+		if err = sdr.SetGain(cfg.Gain); err != nil {
+			return
+		}
+	}
+	if cfg.AutoOffsetTuning && sdr.Info.Tuner.OffsetTuningHelps() {
+		if err = sdr.SetOffsetTuning(true); err != nil {
+			return
+		}
+	}
+	if cfg.FreqCorrection != 0 {
+		err = sdr.SetFreqCorrection(uint32(cfg.FreqCorrection))
+	}
+	return
+}
+
+// Reads blocks and delivers them to sinks, reconnecting on failure.
+func (d *Device) run() {
+	buf := make([]byte, d.Config.BlockSize)
+
+	for {
+		d.mu.Lock()
+		sdr := d.sdr
+		d.mu.Unlock()
+
+		blk, err := sdr.ReadBlock(buf)
+		if err == nil {
+			d.deliver(blk)
+			continue
+		}
+
+		d.mu.Lock()
+		if d.closed {
+			d.mu.Unlock()
+			return
+		}
+		d.stats.Connected = false
+		d.stats.LastError = err.Error()
+		d.down = time.Now()
+		d.mu.Unlock()
+		sdr.Close()
+
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-time.After(d.manager.ReconnectInterval):
+			}
+
+			start := time.Now()
+			err := d.connect(sdr)
+			d.mu.Lock()
+			d.stats.ReconnectAttempts++
+			d.stats.LastAttempt = time.Since(start)
+			if err == nil {
+				d.stats.Reconnects++
+				d.stats.LastOutage = time.Since(d.down)
+				d.stats.Downtime += d.stats.LastOutage
+				d.down = time.Time{}
+			} else {
+				d.stats.LastError = err.Error()
+			}
+			d.mu.Unlock()
+			if err == nil {
+				break
+			}
+		}
+	}
+}
+
+func (d *Device) deliver(blk Block) {
+	d.mu.Lock()
+	sinks := d.sinks
+	d.stats.Blocks++
+	d.stats.Bytes += uint64(len(blk.Samples))
+	d.stats.LastBlock = blk.Received
+	d.mu.Unlock()
+
+	for _, s := range sinks {
+		s.WriteBlock(blk)
+	}
+}
+
+// Adds a sink receiving the device's blocks.
+func (d *Device) Attach(s Sink) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sinks = append(append([]Sink(nil), d.sinks...), s)
+}
+
+// Removes a sink, without closing it.
+func (d *Device) Detach(s Sink) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sinks := make([]Sink, 0, len(d.sinks))
+	for _, other := range d.sinks {
+		if other != s {
+			sinks = append(sinks, other)
+		}
+	}
+	d.sinks = sinks
+}
+
+// Calls fn with the device's current connection, e.g. to retune it.
+// Settings made this way survive reconnection. While disconnected, calls
+// are queued up to Config.ControlQueue and replayed after reconnecting,
+// their errors then recorded in Stats.
+func (d *Device) Control(fn func(*SDR) error) error {
+	d.mu.Lock()
+	sdr, connected := d.sdr, d.stats.Connected
+	if !connected && len(d.queued) < d.Config.ControlQueue {
+		d.queued = append(d.queued, fn)
+		d.mu.Unlock()
+		return nil
+	}
+	d.mu.Unlock()
+
+	if !connected {
+		return fmt.Errorf("device %q is disconnected", d.Config.Name)
+	}
+	return fn(sdr)
+}
+
+// Returns the device's acquisition state.
+func (d *Device) Metadata() Metadata {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sdr.Metadata()
+}
+
+// Returns the serial reported by the current connection, or
+// Config.Serial if none was.
+func (d *Device) Serial() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sdr != nil && d.sdr.Serial() != "" {
+		return d.sdr.Serial()
+	}
+	return d.Config.Serial
+}
+
+// Returns the dongle information of the current connection.
+func (d *Device) Info() DongleInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sdr.Info
+}
+
+func (d *Device) Stats() DeviceStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.stats
+	if !d.down.IsZero() {
+		s.LastOutage = time.Since(d.down)
+		s.Downtime += s.LastOutage
+	}
+	if s.CommandErrors != nil {
+		s.CommandErrors = make(map[uint8]uint64, len(d.stats.CommandErrors))
+		for op, n := range d.stats.CommandErrors {
+			s.CommandErrors[op] = n
+		}
+	}
+	return s
+}
+
+func (d *Device) close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.stats.Connected = false
+	close(d.done)
+	sdr := d.sdr
+	d.mu.Unlock()
+
+	return sdr.Close()
+}
@@ -0,0 +1,378 @@
+// Package mdns discovers and advertises rtl_tcp servers on the local
+// network using multicast DNS service discovery (RFC 6762, RFC 6763).
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Service type advertised by rtl_tcp servers.
+const ServiceType = "_rtl_tcp._tcp.local."
+
+// Record time to live, in seconds.
+const ttl = 120
+
+// Interval between queries while discovering.
+const queryInterval = time.Second
+
+// Set on the class of a question to request a unicast response, and on
+// the class of a record to flush cached records of the same name.
+const classTopBit = 0x8000
+
+var group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// A discovered server.
+type Service struct {
+	Instance string            // Instance name, e.g. "attic"
+	Host     string            // Target host name
+	Addr     string            // Server address of the form "ip:port"
+	Text     map[string]string // Key/value pairs of the TXT record
+}
+
+// Returns the server's URI for backend.Open.
+func (s Service) URI() string {
+	return "rtltcp://" + s.Addr
+}
+
+// Browses for servers until ctx is done and returns those that answered.
+func Discover(ctx context.Context) ([]Service, error) {
+	// A one-shot query from an ephemeral port, answered directly to us.
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("Error opening mDNS socket: %s", err)
+	}
+	defer conn.Close()
+
+	query, err := buildQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(queryInterval)
+		defer t.Stop()
+		for {
+			conn.WriteTo(query, group)
+			select {
+			case <-t.C:
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.SetReadDeadline(time.Now())
+				return
+			}
+		}
+	}()
+
+	var r resolver
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+		r.add(buf[:n], src.IP)
+	}
+
+	return r.services(), nil
+}
+
+func buildQuery() ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	err := b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(ServiceType),
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET | classTopBit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// Accumulates records from responses and resolves them into services.
+type resolver struct {
+	instances map[string]bool
+	srv       map[string]dnsmessage.SRVResource
+	txt       map[string][]string
+	addrs     map[string]net.IP
+	sources   map[string]net.IP // Responder address per instance.
+}
+
+func (r *resolver) add(msg []byte, src net.IP) {
+	if r.instances == nil {
+		r.instances = make(map[string]bool)
+		r.srv = make(map[string]dnsmessage.SRVResource)
+		r.txt = make(map[string][]string)
+		r.addrs = make(map[string]net.IP)
+		r.sources = make(map[string]net.IP)
+	}
+
+	var p dnsmessage.Parser
+	hdr, err := p.Start(msg)
+	if err != nil || !hdr.Response {
+		return
+	}
+	if p.SkipAllQuestions() != nil {
+		return
+	}
+
+	// Records may appear in any section.
+	sections := []struct {
+		header func() (dnsmessage.ResourceHeader, error)
+		skip   func() error
+	}{
+		{p.AnswerHeader, p.SkipAnswer},
+		{p.AuthorityHeader, p.SkipAuthority},
+		{p.AdditionalHeader, p.SkipAdditional},
+	}
+	for _, sec := range sections {
+		for {
+			h, err := sec.header()
+			if err != nil {
+				break
+			}
+			name := strings.ToLower(h.Name.String())
+
+			switch h.Type {
+			case dnsmessage.TypePTR:
+				var rr dnsmessage.PTRResource
+				if rr, err = p.PTRResource(); err == nil && name == ServiceType {
+					inst := strings.ToLower(rr.PTR.String())
+					r.instances[inst] = true
+					r.sources[inst] = src
+				}
+			case dnsmessage.TypeSRV:
+				var rr dnsmessage.SRVResource
+				if rr, err = p.SRVResource(); err == nil {
+					r.srv[name] = rr
+				}
+			case dnsmessage.TypeTXT:
+				var rr dnsmessage.TXTResource
+				if rr, err = p.TXTResource(); err == nil {
+					r.txt[name] = rr.TXT
+				}
+			case dnsmessage.TypeA:
+				var rr dnsmessage.AResource
+				if rr, err = p.AResource(); err == nil {
+					r.addrs[name] = net.IP(rr.A[:])
+				}
+			default:
+				err = sec.skip()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (r *resolver) services() (services []Service) {
+	for inst := range r.instances {
+		srv, ok := r.srv[inst]
+		if !ok {
+			continue
+		}
+
+		s := Service{
+			Instance: strings.TrimSuffix(inst, "."+ServiceType),
+			Host:     srv.Target.String(),
+			Text:     make(map[string]string),
+		}
+
+		ip := r.addrs[strings.ToLower(s.Host)]
+		if ip == nil {
+			ip = r.sources[inst]
+		}
+		s.Addr = net.JoinHostPort(ip.String(), fmt.Sprint(srv.Port))
+
+		for _, kv := range r.txt[inst] {
+			k, v, _ := strings.Cut(kv, "=")
+			s.Text[k] = v
+		}
+
+		services = append(services, s)
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Instance < services[j].Instance
+	})
+	return
+}
+
+// Advertises a server listening on port as instance, answering queries
+// until ctx is done. Text is published as the service's TXT record.
+func Advertise(ctx context.Context, instance string, port int, text map[string]string) error {
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	a := &advertiser{
+		instance: strings.ReplaceAll(instance, ".", "-") + "." + ServiceType,
+		host:     strings.Split(host, ".")[0] + ".local.",
+		port:     uint16(port),
+		addrs:    localAddrs(),
+	}
+	for k, v := range text {
+		a.text = append(a.text, k+"="+v)
+	}
+	sort.Strings(a.text)
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return fmt.Errorf("Error joining mDNS group: %s", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	// Announce on startup.
+	if resp, err := a.response(0); err == nil {
+		conn.WriteTo(resp, group)
+	}
+
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		id, ok := a.matches(buf[:n])
+		if !ok {
+			continue
+		}
+
+		// Queries from other ports are one-shot, answered directly with the
+		// query's ID. Others are answered to the group.
+		dst := group
+		if src.Port != group.Port {
+			dst = src
+		} else {
+			id = 0
+		}
+		if resp, err := a.response(id); err == nil {
+			conn.WriteTo(resp, dst)
+		}
+	}
+}
+
+type advertiser struct {
+	instance string
+	host     string
+	port     uint16
+	text     []string
+	addrs    []net.IP
+}
+
+// Reports whether msg is a query for the advertised service or instance,
+// returning the query's ID.
+func (a *advertiser) matches(msg []byte) (uint16, bool) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(msg)
+	if err != nil || hdr.Response {
+		return 0, false
+	}
+
+	for {
+		q, err := p.Question()
+		if err != nil {
+			return 0, false
+		}
+		name := strings.ToLower(q.Name.String())
+		if name == ServiceType || name == strings.ToLower(a.instance) {
+			return hdr.ID, true
+		}
+	}
+}
+
+// Builds a response carrying the PTR, SRV, TXT and A records.
+func (a *advertiser) response(id uint16) ([]byte, error) {
+	inst, err := dnsmessage.NewName(a.instance)
+	if err != nil {
+		return nil, err
+	}
+	host, err := dnsmessage.NewName(a.host)
+	if err != nil {
+		return nil, err
+	}
+
+	rh := func(name dnsmessage.Name, flush bool) dnsmessage.ResourceHeader {
+		class := dnsmessage.ClassINET
+		if flush {
+			class |= classTopBit
+		}
+		return dnsmessage.ResourceHeader{Name: name, Class: class, TTL: ttl}
+	}
+
+	text := a.text
+	if len(text) == 0 {
+		// A TXT record must contain at least one string.
+		text = []string{""}
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, Authoritative: true})
+	b.EnableCompression()
+	steps := []func() error{
+		b.StartAnswers,
+		func() error {
+			return b.PTRResource(rh(dnsmessage.MustNewName(ServiceType), false), dnsmessage.PTRResource{PTR: inst})
+		},
+		b.StartAdditionals,
+		func() error {
+			return b.SRVResource(rh(inst, true), dnsmessage.SRVResource{Port: a.port, Target: host})
+		},
+		func() error {
+			return b.TXTResource(rh(inst, true), dnsmessage.TXTResource{TXT: text})
+		},
+	}
+	for _, ip := range a.addrs {
+		var rr dnsmessage.AResource
+		copy(rr.A[:], ip.To4())
+		steps = append(steps, func() error { return b.AResource(rh(host, true), rr) })
+	}
+
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// Returns the host's non-loopback IPv4 addresses.
+func localAddrs() (ips []net.IP) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			ips = append(ips, ipnet.IP.To4())
+		}
+	}
+	return
+}
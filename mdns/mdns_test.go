@@ -0,0 +1,47 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	a := &advertiser{
+		instance: "attic." + ServiceType,
+		host:     "pi.local.",
+		port:     1234,
+		text:     []string{"serial=00000001", "tuner=R820T"},
+		addrs:    []net.IP{net.IPv4(192, 168, 1, 20)},
+	}
+
+	query, err := buildQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.matches(query); !ok {
+		t.Fatal("advertiser ignored service query")
+	}
+
+	resp, err := a.response(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r resolver
+	r.add(resp, net.IPv4(10, 0, 0, 1))
+	services := r.services()
+	if len(services) != 1 {
+		t.Fatalf("got %d services, want 1", len(services))
+	}
+
+	s := services[0]
+	if s.Instance != "attic" || s.Host != "pi.local." || s.Addr != "192.168.1.20:1234" {
+		t.Errorf("service: %+v", s)
+	}
+	if s.Text["tuner"] != "R820T" || s.Text["serial"] != "00000001" {
+		t.Errorf("text: %v", s.Text)
+	}
+	if s.URI() != "rtltcp://192.168.1.20:1234" {
+		t.Errorf("uri: %s", s.URI())
+	}
+}
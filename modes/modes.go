@@ -0,0 +1,290 @@
+// Package modes receives Mode S transmissions, including ADS-B, from a
+// stream sampled at 2 MS/s: samples are converted to magnitudes, preambles
+// found by correlating against the pulse pattern, bits sliced by pulse
+// position and frames kept if their CRC checks, yielding raw 56 and 112-bit
+// frames.
+package modes
+
+import (
+	"context"
+	"encoding/hex"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Channel and sample rate of Mode S, two samples per 1 µs bit.
+const (
+	Freq       = 1090000000
+	SampleRate = 2000000
+)
+
+// Frame sizes in bits.
+const (
+	ShortBits = 56
+	LongBits  = 112
+)
+
+const (
+	preambleSamples = 16 // 8 µs.
+	// Samples from a preamble to the end of the longest frame.
+	frameSamples = preambleSamples + 2*LongBits
+	sampleTime   = time.Second / SampleRate
+)
+
+// Parity generator polynomial of Mode S, x^24 and the 24 bits of 0xfff409.
+const generator = 0x1fff409
+
+// Minimum correlation of a preamble with the pulse pattern, the fraction
+// by which the quiet samples fall short of the pulses.
+const DefaultCorrelation = 0.5
+
+// A received Mode S frame.
+type Frame struct {
+	Data []byte // 7 or 14 bytes, parity last.
+	// Index of the first preamble sample in the stream, see
+	// rtltcp.Block.Index.
+	Index uint64
+	// Estimated capture time of the preamble, see rtltcp.Metadata.Timestamp.
+	Time time.Time
+	// Mean magnitude of the frame's pulses, full scale being one.
+	Signal float64
+	// Checksum of the frame, see Residue. Zero for DF11, DF17 and DF18
+	// frames in their entirety, the aircraft address for formats whose
+	// parity is overlaid with it.
+	Parity uint32
+}
+
+// Returns the downlink format, the first five bits.
+func (f Frame) DF() int {
+	return int(f.Data[0] >> 3)
+}
+
+// Returns the aircraft address of DF11, DF17 and DF18 frames, which carry
+// it in the clear, and of other formats the address recovered from their
+// parity.
+func (f Frame) ICAO() uint32 {
+	switch f.DF() {
+	case 11, 17, 18:
+		return uint32(f.Data[1])<<16 | uint32(f.Data[2])<<8 | uint32(f.Data[3])
+	}
+	return f.Parity
+}
+
+// Returns the frame in hex, as in the *...; lines of AVR format.
+func (f Frame) String() string {
+	return strings.ToUpper(hex.EncodeToString(f.Data))
+}
+
+// Returns the length in bits of frames of downlink format df.
+func frameBits(df int) int {
+	if df >= 16 {
+		return LongBits
+	}
+	return ShortBits
+}
+
+// Returns the checksum of data, the parity computed over all but its last
+// 24 bits XORed with those bits: zero if intact, for formats with plain
+// parity.
+func Residue(data []byte) uint32 {
+	n := len(data) - 3
+	var crc uint32
+	for _, b := range data[:n] {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&(1<<24) != 0 {
+				crc ^= generator
+			}
+		}
+	}
+	return (crc ^ uint32(data[n])<<16 ^ uint32(data[n+1])<<8 ^ uint32(data[n+2])) & 0xffffff
+}
+
+// Magnitudes of each pair of 8-bit I and Q values, indexed by I<<8|Q, full
+// scale at 65535.
+var (
+	magOnce  sync.Once
+	magTable []uint16
+)
+
+// Appends the magnitude of each sample of interleaved 8-bit IQ src to dst,
+// full scale being 65535.
+func Magnitude(dst []uint16, src []byte) []uint16 {
+	magOnce.Do(func() {
+		magTable = make([]uint16, 1<<16)
+		full := math.Hypot(127.5, 127.5)
+		for i := range magTable {
+			v := math.Hypot(float64(i>>8)-127.5, float64(i&0xff)-127.5)
+			magTable[i] = uint16(math.Round(v / full * math.MaxUint16))
+		}
+	})
+	for i := 0; i+1 < len(src); i += 2 {
+		dst = append(dst, magTable[uint16(src[i])<<8|uint16(src[i+1])])
+	}
+	return dst
+}
+
+// Decoder finds Mode S frames in a stream of blocks sampled at 2 MS/s, on
+// frequency or after mixing the channel to DC.
+type Decoder struct {
+	// Also deliver frames of formats whose parity is overlaid with the
+	// aircraft address, DF0, 4, 5, 16, 20, 21 and 24. Their CRC can't be
+	// checked without knowing the address, so some are corrupt.
+	AddressParity bool
+	// Minimum correlation of preambles, DefaultCorrelation if zero.
+	Correlation float64
+
+	mag  []uint16 // Magnitudes not yet scanned, those carried first.
+	bits [LongBits / 8]byte
+}
+
+// Returns a decoder of frames with plain parity.
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// Reports whether a preamble starts at m[0]: pulses at 0, 1, 3.5 and 4.5
+// µs stand above their neighbours, and the samples between and after them
+// fall short of the pulses by the required correlation.
+func (d *Decoder) preamble(m []uint16) (pulse float64, ok bool) {
+	if !(m[0] > m[1] && m[1] < m[2] && m[2] > m[3] && m[3] < m[0] &&
+		m[4] < m[0] && m[5] < m[0] && m[6] < m[0] &&
+		m[7] > m[8] && m[8] < m[9] && m[9] > m[6]) {
+		return 0, false
+	}
+	pulse = float64(uint32(m[0])+uint32(m[2])+uint32(m[7])+uint32(m[9])) / 4
+	var quiet float64
+	for _, i := range [...]int{1, 3, 4, 5, 6, 8, 10, 11, 12, 13, 14, 15} {
+		quiet += float64(m[i])
+	}
+	quiet /= 12
+
+	corr := d.Correlation
+	if corr <= 0 {
+		corr = DefaultCorrelation
+	}
+	return pulse, quiet <= (1-corr)*pulse
+}
+
+// Slices the bits following a preamble at m[0], pulses in the first half of
+// a bit period being ones, and checks the frame. Returns nil if it's
+// rejected.
+func (d *Decoder) frame(m []uint16) (data []byte, parity uint32) {
+	data = d.bits[:]
+	for i := range data {
+		data[i] = 0
+	}
+	n := LongBits
+	for i := 0; i < n; i++ {
+		a, b := m[preambleSamples+2*i], m[preambleSamples+2*i+1]
+		if a == b {
+			return nil, 0
+		}
+		if a > b {
+			data[i/8] |= 0x80 >> (i % 8)
+		}
+		if i == 4 {
+			n = frameBits(int(data[0] >> 3))
+		}
+	}
+	data = data[:n/8]
+
+	parity = Residue(data)
+	// DF24 uses only its first two bits.
+	switch df := min(int(data[0]>>3), 24); df {
+	case 11:
+		// All-call replies may carry the interrogator's code.
+		if parity&^0x7f != 0 {
+			return nil, 0
+		}
+	case 17, 18:
+		if parity != 0 {
+			return nil, 0
+		}
+	case 0, 4, 5, 16, 20, 21, 24:
+		if !d.AddressParity {
+			return nil, 0
+		}
+	default:
+		return nil, 0
+	}
+	return append([]byte(nil), data...), parity
+}
+
+// Scans blk and appends the frames found to dst, returning the extended
+// slice. Samples of the end of the block are carried over to the next, so
+// frames straddling blocks are found. Carried samples are discarded after
+// gaps and retunes. Blocks sampled at a rate other than SampleRate are
+// skipped.
+func (d *Decoder) Process(dst []Frame, blk rtltcp.Block) []Frame {
+	if blk.SampleRate != 0 && blk.SampleRate != SampleRate {
+		d.mag = d.mag[:0]
+		return dst
+	}
+	if blk.Gap > 0 || blk.Segment != nil {
+		d.mag = d.mag[:0]
+	}
+
+	carried := len(d.mag)
+	d.mag = Magnitude(d.mag, blk.Samples)
+	m := d.mag
+
+	p := 0
+	for ; p+frameSamples <= len(m); p++ {
+		pulse, ok := d.preamble(m[p:])
+		if !ok {
+			continue
+		}
+		data, parity := d.frame(m[p:])
+		if data == nil {
+			continue
+		}
+		offset := p - carried
+		dst = append(dst, Frame{
+			Data:   data,
+			Index:  uint64(int64(blk.Index) + int64(offset)),
+			Time:   blk.Timestamp.Add(time.Duration(offset) * sampleTime),
+			Signal: pulse / math.MaxUint16,
+			Parity: parity,
+		})
+		p += preambleSamples + 2*8*len(data) - 1
+	}
+	d.mag = d.mag[:copy(d.mag, m[min(p, len(m)):])]
+	return dst
+}
+
+// Decodes blocks with d, delivering frames until blocks is closed or ctx is
+// done, then closing the returned channel. Each block is released once
+// scanned, so blocks from rtltcp.SDR.PooledBlocks may be given.
+func Frames(ctx context.Context, blocks <-chan rtltcp.Block, d *Decoder) <-chan Frame {
+	frames := make(chan Frame, 64)
+	go func() {
+		defer close(frames)
+		var found []Frame
+		for {
+			select {
+			case blk, ok := <-blocks:
+				if !ok {
+					return
+				}
+				found = d.Process(found[:0], blk)
+				blk.Release()
+				for _, f := range found {
+					select {
+					case frames <- f:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return frames
+}
@@ -0,0 +1,126 @@
+package modes
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// An airborne position of KLM1023, from The 1090 MHz Riddle.
+const df17 = "8D4840D6202CC371C32CE0576098"
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Sets the parity of data so its residue is xor.
+func withParity(data []byte, xor uint32) []byte {
+	n := len(data) - 3
+	data[n], data[n+1], data[n+2] = 0, 0, 0
+	p := Residue(data) ^ xor
+	data[n], data[n+1], data[n+2] = byte(p>>16), byte(p>>8), byte(p)
+	return data
+}
+
+// Returns 8-bit IQ of frames pulse position modulated at 2 MS/s, each
+// preceded by quiet samples, and the sample index of each preamble.
+func modulate(frames ...[]byte) (iq []byte, starts []uint64) {
+	pulse := func(on bool) {
+		if on {
+			iq = append(iq, 227, 127)
+		} else {
+			iq = append(iq, 128, 128)
+		}
+	}
+	for _, f := range frames {
+		for i := 0; i < 300; i++ {
+			pulse(false)
+		}
+		starts = append(starts, uint64(len(iq)/2))
+		for i := 0; i < preambleSamples; i++ {
+			pulse(i == 0 || i == 2 || i == 7 || i == 9)
+		}
+		for i := 0; i < 8*len(f); i++ {
+			one := f[i/8]&(0x80>>(i%8)) != 0
+			pulse(one)
+			pulse(!one)
+		}
+	}
+	for i := 0; i < 300; i++ {
+		pulse(false)
+	}
+	return
+}
+
+func TestResidue(t *testing.T) {
+	if r := Residue(mustHex(df17)); r != 0 {
+		t.Errorf("residue %06x of a valid frame", r)
+	}
+	corrupt := mustHex(df17)
+	corrupt[5] ^= 0x10
+	if r := Residue(corrupt); r == 0 {
+		t.Error("residue zero for a corrupt frame")
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	corrupt := mustHex(df17)
+	corrupt[6] ^= 1
+	df11 := withParity(mustHex("5D4840D6000000"), 5)       // All-call reply to interrogator 5.
+	df4 := withParity(mustHex("20001838000000"), 0x4840d6) // Altitude reply, address parity.
+	iq, starts := modulate(mustHex(df17), corrupt, df11, df4, mustHex(df17))
+
+	// Blocks of an odd size, so frames straddle them.
+	start := time.Now()
+	var blocks []rtltcp.Block
+	for i := 0; i < len(iq); i += 998 {
+		blocks = append(blocks, rtltcp.Block{
+			Metadata: rtltcp.Metadata{SampleRate: SampleRate, Timestamp: start.Add(time.Duration(i/2) * sampleTime)},
+			Samples:  iq[i:min(i+998, len(iq))],
+			Index:    uint64(i / 2),
+		})
+	}
+
+	for _, test := range []struct {
+		addressParity bool
+		frames        []string
+		starts        []uint64
+	}{
+		{false, []string{df17, hex.EncodeToString(df11), df17}, []uint64{starts[0], starts[2], starts[4]}},
+		{true, []string{df17, hex.EncodeToString(df11), hex.EncodeToString(df4), df17}, []uint64{starts[0], starts[2], starts[3], starts[4]}},
+	} {
+		d := NewDecoder()
+		d.AddressParity = test.addressParity
+		var frames []Frame
+		for _, blk := range blocks {
+			frames = d.Process(frames, blk)
+		}
+		if len(frames) != len(test.frames) {
+			t.Fatalf("decoded %v, expected %v", frames, test.frames)
+		}
+		for i, f := range frames {
+			if f.String() != strings.ToUpper(test.frames[i]) || f.Index != test.starts[i] || !f.Time.Equal(start.Add(time.Duration(f.Index)*sampleTime)) {
+				t.Errorf("frame %d: %s at %d, expected %s at %d", i, f, f.Index, test.frames[i], test.starts[i])
+			}
+			if f.ICAO() != 0x4840d6 || f.Signal < 0.5 {
+				t.Errorf("frame %d: address %06x, signal %.2f", i, f.ICAO(), f.Signal)
+			}
+		}
+	}
+
+	// A gap discards the samples carried over.
+	d := NewDecoder()
+	d.Process(nil, blocks[0])
+	gapped := blocks[1]
+	gapped.Gap = 1
+	if len(d.Process(nil, gapped)) != 0 {
+		t.Error("frame decoded across a gap")
+	}
+}
@@ -0,0 +1,372 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Defaults for AlertConfig.
+const (
+	DefaultLearn          = 30 * time.Second
+	DefaultAlertThreshold = 10 // dB.
+	DefaultHold           = time.Second
+)
+
+// Kinds of alert.
+type AlertKind string
+
+const (
+	AlertNew     AlertKind = "new"     // A signal absent from the baseline.
+	AlertMissing AlertKind = "missing" // A carrier of the baseline gone.
+)
+
+// A band watched for alerts.
+type Band struct {
+	Name      string
+	Low, High uint32 // Hz.
+}
+
+// Parameters of an Alerter.
+type AlertConfig struct {
+	// Bands alerted on, all of the stream if empty.
+	Bands []Band
+	// FFT size, the frequency resolution of the baseline, DefaultBins if
+	// zero.
+	Bins int
+	// Time the baseline of each tuning is learned over before alerting,
+	// DefaultLearn if zero.
+	Learn time.Duration
+	// Rise in dB over the baseline of a new signal, and over the noise
+	// floor of a carrier learned as expected, DefaultAlertThreshold if zero.
+	Threshold float64
+	// Time a change must persist before alerting and clearing, so brief
+	// bursts and fades don't alert, DefaultHold if zero.
+	Hold   time.Duration
+	Window dsp.WindowType
+}
+
+// Change of a signal relative to the baseline.
+type Alert struct {
+	Time time.Time `json:"time"`
+	Kind AlertKind `json:"kind"`
+	// True when raised, false when the signal returns to its baseline.
+	Active    bool    `json:"active"`
+	Band      string  `json:"band,omitempty"`
+	Freq      uint32  `json:"freq"`      // Center in Hz.
+	Bandwidth uint32  `json:"bandwidth"` // Hz.
+	Power     float64 `json:"power"`     // dBFS.
+	Baseline  float64 `json:"baseline"`  // dBFS in the same bandwidth.
+}
+
+// Alerter learns the spectrum of each tuning from the blocks written to it,
+// then calls back when a signal appears in a watched band or a carrier
+// present while learning disappears. It implements rtltcp.Sink.
+type Alerter struct {
+	// Called from WriteBlock with each alert raised or cleared.
+	OnAlert func(Alert)
+
+	cfg       AlertConfig
+	threshold float64 // Linear.
+	spec      *dsp.Spectrum
+	iq        []complex64
+	power     []float32
+	linear    []float64
+	baselines map[tuning]*baseline
+}
+
+// Centre frequency and sample rate a baseline was learned at.
+type tuning struct {
+	center, rate uint32
+}
+
+// Learned spectrum of a tuning and the alerts raised against it.
+type baseline struct {
+	start  time.Time
+	frames int       // Learned from, -1 once learned.
+	power  []float64 // Linear power per bin, summed while learning, then the mean.
+	floor  float64
+
+	watched  []string    // Band name per bin, nil if all are watched.
+	carrier  []bool      // Bins belonging to a carrier.
+	excess   []time.Time // Time each bin first exceeded the baseline.
+	carriers []*span
+	signals  []*span
+}
+
+// A run of bins, [lo, hi), alerted on.
+type span struct {
+	lo, hi int
+	band   string
+	// Since the change began, zero while there's none, and last seen.
+	since, seen time.Time
+	active      bool
+}
+
+// Returns an alerter watching cfg.Bands.
+func NewAlerter(cfg AlertConfig) (*Alerter, error) {
+	if cfg.Bins == 0 {
+		cfg.Bins = DefaultBins
+	}
+	if cfg.Bins&(cfg.Bins-1) != 0 {
+		return nil, errors.New("monitor: bins must be a power of two")
+	}
+	if cfg.Learn == 0 {
+		cfg.Learn = DefaultLearn
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = DefaultAlertThreshold
+	}
+	if cfg.Hold == 0 {
+		cfg.Hold = DefaultHold
+	}
+	for _, b := range cfg.Bands {
+		if b.Low >= b.High {
+			return nil, fmt.Errorf("monitor: band %q is empty", b.Name)
+		}
+	}
+	return &Alerter{
+		cfg:       cfg,
+		threshold: math.Pow(10, cfg.Threshold/10),
+		spec:      dsp.NewSpectrum(cfg.Bins, cfg.Window),
+		baselines: make(map[tuning]*baseline),
+	}, nil
+}
+
+// Discards every baseline, learning them again from the next block.
+func (a *Alerter) Relearn() {
+	a.baselines = make(map[tuning]*baseline)
+}
+
+// Learns the block's spectrum, or compares it to the baseline of its tuning.
+func (a *Alerter) WriteBlock(blk rtltcp.Block) error {
+	if blk.SampleRate == 0 {
+		return nil
+	}
+	a.iq = dsp.ConvertU8(a.iq[:0], blk.Samples)
+	a.power = a.spec.PowerDB(a.power[:0], a.iq)
+	if len(a.power) == 0 {
+		return nil
+	}
+	a.linear = a.linear[:0]
+	for _, p := range a.power {
+		a.linear = append(a.linear, math.Pow(10, float64(p)/10))
+	}
+
+	key := tuning{blk.CenterFreq, blk.SampleRate}
+	b, ok := a.baselines[key]
+	if !ok {
+		b = &baseline{start: blk.Timestamp, power: make([]float64, len(a.linear))}
+		a.baselines[key] = b
+	}
+	if b.frames >= 0 {
+		a.learn(b, blk)
+		return nil
+	}
+	a.compare(b, blk)
+	return nil
+}
+
+// Accumulates the spectrum, completing the baseline once learned for long
+// enough.
+func (a *Alerter) learn(b *baseline, blk rtltcp.Block) {
+	for i, p := range a.linear {
+		b.power[i] += p
+	}
+	b.frames++
+	if blk.Timestamp.Sub(b.start) < a.cfg.Learn {
+		return
+	}
+
+	n := len(b.power)
+	for i := range b.power {
+		b.power[i] /= float64(b.frames)
+	}
+	b.frames = -1
+	sorted := append([]float64(nil), b.power...)
+	sort.Float64s(sorted)
+	b.floor = sorted[n/2]
+
+	if len(a.cfg.Bands) > 0 {
+		b.watched = make([]string, n)
+		binWidth := float64(blk.SampleRate) / float64(n)
+		for i := range b.watched {
+			f := float64(blk.CenterFreq) + float64(i-n/2)*binWidth
+			b.watched[i] = "\x00" // Unwatched.
+			for _, band := range a.cfg.Bands {
+				if f >= float64(band.Low) && f <= float64(band.High) {
+					b.watched[i] = band.Name
+					break
+				}
+			}
+		}
+	}
+
+	b.carrier = make([]bool, n)
+	b.excess = make([]time.Time, n)
+	for i, p := range b.power {
+		b.carrier[i] = b.isWatched(i) && p > b.floor*a.threshold
+	}
+	for _, s := range runs(b.carrier) {
+		s.band = b.band(s.lo)
+		b.carriers = append(b.carriers, s)
+	}
+}
+
+func (b *baseline) isWatched(i int) bool {
+	return b.watched == nil || b.watched[i] != "\x00"
+}
+
+func (b *baseline) band(i int) string {
+	if b.watched == nil {
+		return ""
+	}
+	return b.watched[i]
+}
+
+// Alerts on signals new to the baseline and missing carriers.
+func (a *Alerter) compare(b *baseline, blk rtltcp.Block) {
+	now := blk.Timestamp
+	hold := a.cfg.Hold
+
+	// Bins exceeding the baseline for at least the hold time.
+	persistent := make([]bool, len(a.linear))
+	for i, p := range a.linear {
+		if !b.isWatched(i) || b.carrier[i] || p <= b.power[i]*a.threshold {
+			b.excess[i] = time.Time{}
+			continue
+		}
+		if b.excess[i].IsZero() {
+			b.excess[i] = now
+		}
+		persistent[i] = now.Sub(b.excess[i]) >= hold
+	}
+	for _, r := range runs(persistent) {
+		var s *span
+		for _, sig := range b.signals {
+			if r.lo < sig.hi && sig.lo < r.hi {
+				s = sig
+				break
+			}
+		}
+		if s == nil {
+			s = r
+			s.band = b.band(r.lo)
+			b.signals = append(b.signals, s)
+			a.alert(b, blk, AlertNew, true, s)
+		}
+		s.lo, s.hi, s.seen = min(s.lo, r.lo), max(s.hi, r.hi), now
+	}
+	active := b.signals[:0]
+	for _, s := range b.signals {
+		if now.Sub(s.seen) < hold {
+			active = append(active, s)
+			continue
+		}
+		a.alert(b, blk, AlertNew, false, s)
+	}
+	b.signals = active
+
+	// Carriers fallen closer to the noise floor than their baseline.
+	for _, c := range b.carriers {
+		power, base := sum(a.linear[c.lo:c.hi]), sum(b.power[c.lo:c.hi])
+		noise := b.floor * float64(c.hi-c.lo)
+		missing := db(power) < (db(base)+db(noise))/2
+		switch {
+		case !missing:
+			c.since = time.Time{}
+			if c.active {
+				c.active = false
+				a.alert(b, blk, AlertMissing, false, c)
+			}
+		case c.since.IsZero():
+			c.since = now
+		case !c.active && now.Sub(c.since) >= hold:
+			c.active = true
+			a.alert(b, blk, AlertMissing, true, c)
+		}
+	}
+}
+
+func (a *Alerter) alert(b *baseline, blk rtltcp.Block, kind AlertKind, active bool, s *span) {
+	if a.OnAlert == nil {
+		return
+	}
+	n := len(b.power)
+	binWidth := float64(blk.SampleRate) / float64(n)
+	center := float64(blk.CenterFreq) + (float64(s.lo+s.hi)/2-0.5-float64(n/2))*binWidth
+	a.OnAlert(Alert{
+		Time:      blk.Timestamp,
+		Kind:      kind,
+		Active:    active,
+		Band:      s.band,
+		Freq:      uint32(math.Round(center)),
+		Bandwidth: uint32(math.Round(float64(s.hi-s.lo) * binWidth)),
+		Power:     db(sum(a.linear[s.lo:s.hi])),
+		Baseline:  db(sum(b.power[s.lo:s.hi])),
+	})
+}
+
+// Returns the runs of set bins.
+func runs(set []bool) (spans []*span) {
+	for i := 0; i < len(set); i++ {
+		if !set[i] {
+			continue
+		}
+		lo := i
+		for i < len(set) && set[i] {
+			i++
+		}
+		spans = append(spans, &span{lo: lo, hi: i})
+	}
+	return spans
+}
+
+func sum(x []float64) (s float64) {
+	for _, v := range x {
+		s += v
+	}
+	return s
+}
+
+// Does nothing, baselines being kept in memory.
+func (a *Alerter) Close() error {
+	return nil
+}
+
+// Webhook posts alerts as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil.
+}
+
+// Posts a, failing unless the endpoint responds with success.
+func (w *Webhook) Post(a Alert) error {
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("Error posting alert: %s", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("monitor: webhook responded %s", resp.Status)
+	}
+	return nil
+}
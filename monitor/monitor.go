@@ -0,0 +1,262 @@
+// Package monitor measures the power of narrowband channels within a
+// stream, opening a squelch on each while a signal is present and
+// reporting how busy each channel was over regular intervals.
+package monitor
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Defaults for Config.
+const (
+	DefaultBins       = 1024
+	DefaultInterval   = 10 * time.Second
+	DefaultSquelch    = 10 // dB above the noise floor.
+	DefaultHysteresis = 3  // dB.
+)
+
+// A channel to monitor.
+type Channel struct {
+	Name      string
+	Freq      uint32 // Center frequency in Hz.
+	Bandwidth uint32 // Hz, at least one bin.
+	// Signal to noise ratio in dB opening the squelch, DefaultSquelch if
+	// zero.
+	Squelch float64
+}
+
+// Parameters of a Monitor.
+type Config struct {
+	Channels []Channel
+	// FFT size, the frequency resolution of measurements, DefaultBins if
+	// zero.
+	Bins int
+	// Time between reports, DefaultInterval if zero.
+	Interval time.Duration
+	// Drop in dB below the squelch level closing it again, so a signal
+	// hovering around the level doesn't chatter, DefaultHysteresis if zero.
+	Hysteresis float64
+	Window     dsp.WindowType
+}
+
+// Power of a channel in one block.
+type Measurement struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`
+	Freq    uint32    `json:"freq"`
+	Power   float64   `json:"power"` // dBFS.
+	Noise   float64   `json:"noise"` // dBFS in the channel's bandwidth.
+	SNR     float64   `json:"snr"`   // dB.
+	Open    bool      `json:"open"`  // Squelch state after the measurement.
+}
+
+// Summary of a channel over one interval.
+type Report struct {
+	Time    time.Time `json:"time"` // End of the interval.
+	Channel string    `json:"channel"`
+	Freq    uint32    `json:"freq"`
+	Power   float64   `json:"power"` // Mean, dBFS.
+	Peak    float64   `json:"peak"`  // dBFS.
+	Noise   float64   `json:"noise"` // Mean, dBFS.
+	SNR     float64   `json:"snr"`   // Of the mean power, dB.
+	// Fraction of measurements with the squelch open.
+	Occupancy float64 `json:"occupancy"`
+	// Times the squelch opened.
+	Openings int `json:"openings"`
+	// Measurements made, zero while the channel was outside the stream.
+	Measurements int `json:"measurements"`
+}
+
+// Squelch transition of a channel.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`
+	Freq    uint32    `json:"freq"`
+	Open    bool      `json:"open"`
+	Power   float64   `json:"power"` // dBFS.
+	SNR     float64   `json:"snr"`   // dB.
+	// Time the squelch was open, on closing.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// Monitor measures channels from blocks written to it, calling back with
+// each measurement, squelch transition and report. It implements
+// rtltcp.Sink, so it can take blocks from a Hub or Manager directly. Only
+// channels within a block's band are measured.
+type Monitor struct {
+	// Optional callbacks, called from WriteBlock.
+	OnMeasurement func(Measurement)
+	OnEvent       func(Event)
+	OnReport      func(Report)
+
+	cfg      Config
+	spec     *dsp.Spectrum
+	iq       []complex64
+	power    []float32
+	linear   []float64
+	sorted   []float64
+	channels []channelState
+	start    time.Time // Of the interval being reported on.
+}
+
+// State of one monitored channel.
+type channelState struct {
+	Channel
+	open   bool
+	opened time.Time
+
+	n, openCount, openings int
+	power, noise, peak     float64 // Linear sums and maximum over the interval.
+}
+
+// Returns a monitor of cfg.Channels.
+func New(cfg Config) (*Monitor, error) {
+	if len(cfg.Channels) == 0 {
+		return nil, errors.New("monitor: no channels")
+	}
+	if cfg.Bins == 0 {
+		cfg.Bins = DefaultBins
+	}
+	if cfg.Bins&(cfg.Bins-1) != 0 {
+		return nil, errors.New("monitor: bins must be a power of two")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Hysteresis == 0 {
+		cfg.Hysteresis = DefaultHysteresis
+	}
+
+	m := &Monitor{cfg: cfg, spec: dsp.NewSpectrum(cfg.Bins, cfg.Window)}
+	for _, c := range cfg.Channels {
+		if c.Squelch == 0 {
+			c.Squelch = DefaultSquelch
+		}
+		m.channels = append(m.channels, channelState{Channel: c})
+	}
+	return m, nil
+}
+
+// Measures every channel within the block's band.
+func (m *Monitor) WriteBlock(blk rtltcp.Block) error {
+	switch {
+	case m.start.IsZero():
+		m.start = blk.Timestamp
+	case blk.Timestamp.Sub(m.start) >= m.cfg.Interval:
+		m.report(blk.Timestamp)
+		m.start = blk.Timestamp
+	}
+
+	m.iq = dsp.ConvertU8(m.iq[:0], blk.Samples)
+	m.power = m.spec.PowerDB(m.power[:0], m.iq)
+	if len(m.power) > 0 && blk.SampleRate > 0 {
+		m.measure(blk)
+	}
+	return nil
+}
+
+func (m *Monitor) measure(blk rtltcp.Block) {
+	bins := len(m.power)
+	m.linear = m.linear[:0]
+	for _, p := range m.power {
+		m.linear = append(m.linear, math.Pow(10, float64(p)/10))
+	}
+	// The median bin is noise unless signals fill half the band.
+	m.sorted = append(m.sorted[:0], m.linear...)
+	sort.Float64s(m.sorted)
+	floor := m.sorted[bins/2]
+
+	binWidth := float64(blk.SampleRate) / float64(bins)
+	for i := range m.channels {
+		c := &m.channels[i]
+		offset := float64(c.Freq) - float64(blk.CenterFreq)
+		half := max(float64(c.Bandwidth), binWidth) / 2
+		lo := int(math.Round((offset-half)/binWidth)) + bins/2
+		hi := int(math.Round((offset+half)/binWidth)) + bins/2
+		if lo < 0 || hi > bins || lo >= hi {
+			continue
+		}
+
+		var power float64
+		for _, p := range m.linear[lo:hi] {
+			power += p
+		}
+		noise := floor * float64(hi-lo)
+		meas := Measurement{
+			Time:    blk.Timestamp,
+			Channel: c.Name,
+			Freq:    c.Freq,
+			Power:   db(power),
+			Noise:   db(noise),
+			SNR:     db(power / noise),
+		}
+
+		c.n++
+		c.power += power
+		c.noise += noise
+		c.peak = max(c.peak, power)
+
+		switch {
+		case !c.open && meas.SNR >= c.Squelch:
+			c.open, c.opened = true, blk.Timestamp
+			c.openings++
+			m.event(Event{Time: blk.Timestamp, Channel: c.Name, Freq: c.Freq, Open: true, Power: meas.Power, SNR: meas.SNR})
+		case c.open && meas.SNR < c.Squelch-m.cfg.Hysteresis:
+			c.open = false
+			m.event(Event{Time: blk.Timestamp, Channel: c.Name, Freq: c.Freq, Power: meas.Power, SNR: meas.SNR,
+				Duration: blk.Timestamp.Sub(c.opened)})
+		}
+		if c.open {
+			c.openCount++
+		}
+		meas.Open = c.open
+
+		if m.OnMeasurement != nil {
+			m.OnMeasurement(meas)
+		}
+	}
+}
+
+func (m *Monitor) event(e Event) {
+	if m.OnEvent != nil {
+		m.OnEvent(e)
+	}
+}
+
+// Reports on every channel and starts a new interval.
+func (m *Monitor) report(t time.Time) {
+	for i := range m.channels {
+		c := &m.channels[i]
+		r := Report{Time: t, Channel: c.Name, Freq: c.Freq, Openings: c.openings, Measurements: c.n}
+		if c.n > 0 {
+			r.Power = db(c.power / float64(c.n))
+			r.Peak = db(c.peak)
+			r.Noise = db(c.noise / float64(c.n))
+			r.SNR = r.Power - r.Noise
+			r.Occupancy = float64(c.openCount) / float64(c.n)
+		}
+		if m.OnReport != nil {
+			m.OnReport(r)
+		}
+		c.n, c.openCount, c.openings = 0, 0, 0
+		c.power, c.noise, c.peak = 0, 0, 0
+	}
+}
+
+// Reports on the interval in progress.
+func (m *Monitor) Close() error {
+	if !m.start.IsZero() {
+		m.report(time.Now())
+	}
+	return nil
+}
+
+func db(p float64) float64 {
+	return 10 * math.Log10(p)
+}
@@ -0,0 +1,149 @@
+package monitor
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+const rate, center, n = 1024000, 100000000, 16384
+
+// Returns a block of noise with a tone at each offset.
+func block(rng *rand.Rand, start time.Time, b int, offsets ...float64) rtltcp.Block {
+	buf := make([]byte, 2*n)
+	for i := 0; i < n; i++ {
+		re, im := 2*rng.NormFloat64(), 2*rng.NormFloat64()
+		for _, offset := range offsets {
+			phase := 2 * math.Pi * offset * float64(i) / rate
+			re += 40 * math.Cos(phase)
+			im += 40 * math.Sin(phase)
+		}
+		buf[2*i] = byte(math.Round(127.5 + re))
+		buf[2*i+1] = byte(math.Round(127.5 + im))
+	}
+	blk := rtltcp.Block{Samples: buf}
+	blk.CenterFreq, blk.SampleRate = center, rate
+	blk.Timestamp = start.Add(time.Duration(b) * n * time.Second / rate)
+	return blk
+}
+
+func TestMonitor(t *testing.T) {
+	m, err := New(Config{
+		Channels: []Channel{
+			{Name: "busy", Freq: center + 100000, Bandwidth: 12500},
+			{Name: "quiet", Freq: center - 200000, Bandwidth: 12500},
+			{Name: "outside", Freq: center + 1000000, Bandwidth: 12500},
+		},
+		Interval: 160 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []Report
+	var events []Event
+	m.OnReport = func(r Report) { reports = append(reports, r) }
+	m.OnEvent = func(e Event) { events = append(events, e) }
+
+	// Noise throughout, a tone on the busy channel for the first five of
+	// twenty blocks.
+	rng := rand.New(rand.NewSource(1))
+	start := time.Now()
+	for b := 0; b < 20; b++ {
+		var tones []float64
+		if b < 5 {
+			tones = append(tones, 100000)
+		}
+		if err := m.WriteBlock(block(rng, start, b, tones...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Close()
+
+	if len(events) != 2 || !events[0].Open || events[1].Open || events[0].Channel != "busy" {
+		t.Fatalf("events %+v", events)
+	}
+	if d := events[1].Duration; d != 5*n*time.Second/rate {
+		t.Errorf("open for %s", d)
+	}
+
+	// Blocks last 16ms, so ten to an interval.
+	if len(reports) != 6 {
+		t.Fatalf("%d reports", len(reports))
+	}
+	busy, quiet, outside := reports[0], reports[1], reports[2]
+	if busy.Measurements != 10 || busy.Openings != 1 || busy.Occupancy != 0.5 {
+		t.Errorf("busy %+v", busy)
+	}
+	if busy.SNR < 20 || busy.Peak < busy.Power {
+		t.Errorf("busy SNR %.1f dB, peak %.1f dBFS", busy.SNR, busy.Peak)
+	}
+	if quiet.Openings != 0 || quiet.Occupancy != 0 || math.Abs(quiet.SNR) > 3 {
+		t.Errorf("quiet %+v", quiet)
+	}
+	if outside.Measurements != 0 {
+		t.Errorf("outside measured %d times", outside.Measurements)
+	}
+	if reports[3].Occupancy != 0 {
+		t.Errorf("busy occupancy %g after closing", reports[3].Occupancy)
+	}
+}
+
+func TestAlerter(t *testing.T) {
+	a, err := NewAlerter(AlertConfig{
+		Bands: []Band{{Name: "watched", Low: center - 300000, High: center + 300000}},
+		Learn: 160 * time.Millisecond,
+		Hold:  40 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alerts []Alert
+	a.OnAlert = func(al Alert) { alerts = append(alerts, al) }
+
+	// A carrier at +100 kHz while learning, joined by one at -150 kHz and
+	// another outside the watched band, then the carrier fades and the new
+	// signal ends.
+	rng := rand.New(rand.NewSource(2))
+	start := time.Now()
+	for b := 0; b < 40; b++ {
+		tones := []float64{100000}
+		switch {
+		case b >= 30:
+			tones = nil
+		case b >= 20:
+			tones = []float64{-150000, 400000}
+		case b >= 12:
+			tones = append(tones, -150000, 400000)
+		}
+		a.WriteBlock(block(rng, start, b, tones...))
+	}
+
+	want := []struct {
+		kind   AlertKind
+		active bool
+		freq   float64
+		block  int
+	}{
+		{AlertNew, true, center - 150000, 15},
+		{AlertMissing, true, center + 100000, 23},
+		{AlertNew, false, center - 150000, 32},
+	}
+	if len(alerts) != len(want) {
+		t.Fatalf("alerts %+v", alerts)
+	}
+	for i, w := range want {
+		al := alerts[i]
+		if al.Kind != w.kind || al.Active != w.active || al.Band != "watched" || math.Abs(float64(al.Freq)-w.freq) > 1000 {
+			t.Errorf("alert %d: %+v, want %+v", i, al, w)
+		}
+		if at := start.Add(time.Duration(w.block) * n * time.Second / rate); !al.Time.Equal(at) {
+			t.Errorf("alert %d at %s, want %s", i, al.Time.Sub(start), at.Sub(start))
+		}
+	}
+	if al := alerts[0]; al.Power < al.Baseline+20 {
+		t.Errorf("new signal %.1f dBFS over a baseline of %.1f dBFS", al.Power, al.Baseline)
+	}
+}
@@ -0,0 +1,328 @@
+// Package mqtt publishes measurements and events to an MQTT broker, so
+// monitoring integrates with Home Assistant and other IoT stacks. It speaks
+// the publishing half of MQTT 3.1.1 at QoS 0 itself, without subscribing.
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults for Options.
+const (
+	DefaultPort      = "1883"
+	DefaultKeepAlive = 60 * time.Second
+)
+
+// Control packet types, in the high nibble of the first byte.
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPingreq    = 0xc0
+	packetPingresp   = 0xd0
+	packetDisconnect = 0xe0
+)
+
+// CONNECT flags.
+const (
+	connectClean    = 0x02
+	connectWill     = 0x04
+	connectRetain   = 0x20
+	connectPassword = 0x40
+	connectUsername = 0x80
+)
+
+// Flag of retained PUBLISH packets.
+const publishRetain = 0x01
+
+// Time allowed for the broker to acknowledge a connection.
+const connectTimeout = 10 * time.Second
+
+// A message published to a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	// Kept by the broker and delivered to later subscribers.
+	Retain bool
+}
+
+// Parameters of a connection.
+type Options struct {
+	// Client identifier, assigned by the broker if empty.
+	ClientID string
+	Username string
+	Password string
+	// Longest silence before pinging the broker, DefaultKeepAlive if zero.
+	// The broker is given it rounded up to whole seconds.
+	KeepAlive time.Duration
+	// Published by the broker if the connection is lost without Close.
+	Will *Message
+}
+
+// Client publishes messages over one connection to a broker. It is safe for
+// concurrent use.
+type Client struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+
+	mu   sync.Mutex
+	w    *bufio.Writer
+	last time.Time // Of the last packet sent.
+	err  error     // First write error, failing later publishes.
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// Connects to the broker at addr, DefaultPort if none is given.
+func Dial(addr string, opts Options) (*Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+	conn, err := net.DialTimeout("tcp", addr, connectTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to broker: %s", err)
+	}
+	c, err := NewClient(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Connects over an established transport, such as a TLS connection.
+func NewClient(conn net.Conn, opts Options) (*Client, error) {
+	if opts.KeepAlive < 0 {
+		return nil, fmt.Errorf("mqtt: negative keep alive %s", opts.KeepAlive)
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+
+	c := &Client{
+		conn:      conn,
+		keepAlive: opts.KeepAlive,
+		r:         bufio.NewReader(conn),
+		w:         bufio.NewWriter(conn),
+		done:      make(chan struct{}),
+	}
+	conn.SetDeadline(time.Now().Add(connectTimeout))
+	if err := c.connect(opts); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.wg.Add(2)
+	go c.read()
+	go c.ping()
+	return c, nil
+}
+
+// Sends CONNECT and waits for the broker's CONNACK.
+func (c *Client) connect(opts Options) error {
+	var body []byte
+	body = appendString(body, "MQTT")
+	flags := byte(connectClean)
+	if opts.Will != nil {
+		flags |= connectWill
+		if opts.Will.Retain {
+			flags |= connectRetain
+		}
+	}
+	if opts.Username != "" {
+		flags |= connectUsername
+	}
+	if opts.Password != "" {
+		flags |= connectPassword
+	}
+	secs := int((opts.KeepAlive + time.Second - 1) / time.Second)
+	if secs > 0xffff {
+		secs = 0xffff
+	}
+	body = append(body, 4, flags, byte(secs>>8), byte(secs))
+	body = appendString(body, opts.ClientID)
+	if opts.Will != nil {
+		body = appendString(body, opts.Will.Topic)
+		body = appendBytes(body, opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = appendString(body, opts.Password)
+	}
+	if err := c.send(packetConnect, body); err != nil {
+		return fmt.Errorf("Error sending connect: %s", err)
+	}
+
+	typ, ack, err := readPacket(c.r)
+	if err != nil {
+		return fmt.Errorf("Error reading connack: %s", err)
+	}
+	if typ&0xf0 != packetConnack || len(ack) != 2 {
+		return errors.New("mqtt: expected connack")
+	}
+	if ack[1] != 0 {
+		return fmt.Errorf("mqtt: connection refused: %s", refusal(ack[1]))
+	}
+	return nil
+}
+
+// Returns the reason given by a CONNACK return code.
+func refusal(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+// Publishes payload to topic at QoS 0.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	if topic == "" {
+		return errors.New("mqtt: empty topic")
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	flags := byte(0)
+	if retain {
+		flags |= publishRetain
+	}
+	return c.send(packetPublish|flags, body)
+}
+
+// Sends DISCONNECT, so the broker discards the will, and closes the
+// connection.
+func (c *Client) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.send(packetDisconnect, nil)
+		close(c.done)
+		err = c.conn.Close()
+		c.wg.Wait()
+	})
+	return err
+}
+
+// Writes one packet and flushes it.
+func (c *Client) send(typ byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+
+	c.w.WriteByte(typ)
+	c.w.Write(appendLength(nil, len(body)))
+	c.w.Write(body)
+	if err := c.w.Flush(); err != nil {
+		c.err = fmt.Errorf("Error writing to broker: %s", err)
+		return c.err
+	}
+	c.last = time.Now()
+	return nil
+}
+
+// Discards packets from the broker, PINGRESP being the only one expected,
+// until the connection closes.
+func (c *Client) read() {
+	defer c.wg.Done()
+	for {
+		if _, _, err := readPacket(c.r); err != nil {
+			c.mu.Lock()
+			if c.err == nil {
+				c.err = fmt.Errorf("Error reading from broker: %s", err)
+			}
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Pings the broker whenever nothing has been sent for half the keep alive
+// interval.
+func (c *Client) ping() {
+	defer c.wg.Done()
+	t := time.NewTicker(max(c.keepAlive/2, time.Millisecond))
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-t.C:
+			c.mu.Lock()
+			idle := now.Sub(c.last)
+			c.mu.Unlock()
+			if idle >= c.keepAlive/2 {
+				c.send(packetPingreq, nil)
+			}
+		}
+	}
+}
+
+// Reads one packet, returning its first byte and body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n, shift int
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return typ, body, err
+}
+
+// Appends the variable length encoding of a packet's remaining length.
+func appendLength(dst []byte, n int) []byte {
+	for {
+		b := byte(n & 0x7f)
+		if n >>= 7; n > 0 {
+			b |= 0x80
+		}
+		dst = append(dst, b)
+		if n == 0 {
+			return dst
+		}
+	}
+}
+
+// Appends a length prefixed UTF-8 string.
+func appendString(dst []byte, s string) []byte {
+	return appendBytes(dst, []byte(s))
+}
+
+// Appends length prefixed binary data.
+func appendBytes(dst, b []byte) []byte {
+	dst = append(dst, byte(len(b)>>8), byte(len(b)))
+	return append(dst, b...)
+}
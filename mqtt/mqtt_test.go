@@ -0,0 +1,196 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp/monitor"
+)
+
+// A packet received by the fake broker.
+type packet struct {
+	typ  byte
+	body []byte
+}
+
+// Accepts one connection, acknowledges it with code and forwards every
+// packet received.
+func fakeBroker(t *testing.T, code byte) (string, <-chan packet) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	packets := make(chan packet, 64)
+	go func() {
+		defer close(packets)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			typ, body, err := readPacket(r)
+			if err != nil {
+				return
+			}
+			switch typ & 0xf0 {
+			case packetConnect:
+				conn.Write([]byte{packetConnack, 2, 0, code})
+			case packetPingreq:
+				conn.Write([]byte{packetPingresp, 0})
+			}
+			packets <- packet{typ, body}
+		}
+	}()
+	return l.Addr().String(), packets
+}
+
+// Returns the topic and payload of a PUBLISH body.
+func topic(body []byte) (string, string) {
+	n := int(body[0])<<8 | int(body[1])
+	return string(body[2 : 2+n]), string(body[2+n:])
+}
+
+func TestPublisher(t *testing.T) {
+	addr, packets := fakeBroker(t, 0)
+	p, err := NewPublisher(addr, Options{ClientID: "test", Username: "u", Password: "p", KeepAlive: 100 * time.Millisecond}, "", "dongle/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := <-packets
+	if conn.typ != packetConnect {
+		t.Fatalf("first packet %#x", conn.typ)
+	}
+	flags := conn.body[7]
+	if want := byte(connectClean | connectWill | connectRetain | connectUsername | connectPassword); flags != want {
+		t.Errorf("connect flags %#x, want %#x", flags, want)
+	}
+	rest := conn.body[10:]
+	for _, want := range []string{"test", "rtltcp/dongle_1/availability", Offline, "u", "p"} {
+		n := int(rest[0])<<8 | int(rest[1])
+		if got := string(rest[2 : 2+n]); got != want {
+			t.Errorf("connect field %q, want %q", got, want)
+		}
+		rest = rest[2+n:]
+	}
+
+	p.Status(map[string]int{"lost": 0})
+	p.Event(monitor.Event{Channel: "a+b", Open: true})
+	p.Report(monitor.Report{Channel: "a+b", Occupancy: 0.25})
+	time.Sleep(150 * time.Millisecond) // Idle long enough to ping.
+	p.Close()
+
+	want := []struct {
+		topic  string
+		retain bool
+	}{
+		{"rtltcp/dongle_1/availability", true},
+		{"rtltcp/dongle_1/status", true},
+		{"rtltcp/dongle_1/a_b/squelch", false},
+		{"rtltcp/dongle_1/a_b/state", true},
+		{"rtltcp/dongle_1/a_b/report", false},
+	}
+	var pinged bool
+	var last string
+	for pkt := range packets {
+		switch pkt.typ & 0xf0 {
+		case packetPublish:
+			top, payload := topic(pkt.body)
+			last = payload
+			if len(want) == 0 {
+				continue
+			}
+			if top != want[0].topic || (pkt.typ&publishRetain != 0) != want[0].retain {
+				t.Errorf("published %q retain %t, want %+v", top, pkt.typ&publishRetain != 0, want[0])
+			}
+			if top == "rtltcp/dongle_1/a_b/report" {
+				var r monitor.Report
+				if err := json.Unmarshal([]byte(payload), &r); err != nil || r.Occupancy != 0.25 {
+					t.Errorf("report %s: %v", payload, err)
+				}
+			}
+			want = want[1:]
+		case packetPingreq:
+			pinged = true
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("missing %+v", want)
+	}
+	if !pinged {
+		t.Error("never pinged")
+	}
+	if last != Offline {
+		t.Errorf("last published %q", last)
+	}
+}
+
+func TestRefused(t *testing.T) {
+	addr, _ := fakeBroker(t, 5)
+	if _, err := Dial(addr, Options{}); err == nil || err.Error() != "mqtt: connection refused: not authorized" {
+		t.Errorf("dial returned %v", err)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	if _, err := NewClient(client, Options{KeepAlive: -time.Second}); err == nil {
+		t.Error("accepted a negative keep alive")
+	}
+
+	// Intervals too short to halve still tick, and reach the broker as a
+	// second rather than disabling its timeout.
+	addr, packets := fakeBroker(t, 0)
+	c, err := Dial(addr, Options{KeepAlive: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if conn := <-packets; conn.body[8] != 0 || conn.body[9] != 1 {
+		t.Errorf("keep alive sent as %d s", int(conn.body[8])<<8|int(conn.body[9]))
+	}
+	for pkt := range packets {
+		if pkt.typ&0xf0 == packetPingreq {
+			break
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 268435455} {
+		buf := appendLength(nil, n)
+		_, body, err := readPacket(bufio.NewReader(&lengthReader{prefix: append([]byte{0}, buf...), n: n}))
+		if err != nil || len(body) != n {
+			t.Errorf("length %d read as %d: %v", n, len(body), err)
+		}
+	}
+}
+
+// Reads prefix followed by n zeros.
+type lengthReader struct {
+	prefix []byte
+	n      int
+}
+
+func (r *lengthReader) Read(p []byte) (int, error) {
+	if len(r.prefix) > 0 {
+		c := copy(p, r.prefix)
+		r.prefix = r.prefix[c:]
+		return c, nil
+	}
+	if r.n == 0 {
+		return 0, net.ErrClosed
+	}
+	c := min(len(p), r.n)
+	clear(p[:c])
+	r.n -= c
+	return c, nil
+}
@@ -0,0 +1,105 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bemasher/rtltcp/monitor"
+)
+
+// Topic prefix of a Publisher if none is given.
+const DefaultPrefix = "rtltcp"
+
+// Payloads of the availability topic.
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+// Publisher publishes a monitor's reports and events and a device's status
+// under prefix/device/:
+//
+//	availability       online or offline, retained, offline also as the will
+//	status             JSON device status, retained
+//	<channel>/report   JSON monitor.Report per interval
+//	<channel>/squelch  JSON monitor.Event per squelch transition
+//	<channel>/state    ON or OFF, retained, for binary sensors
+//
+// Home Assistant's MQTT integration can read these with discovery-free
+// sensor configuration, using availability as the availability topic.
+type Publisher struct {
+	*Client
+	prefix string
+}
+
+// Connects to the broker at addr and announces device online. opts.Will is
+// replaced by the offline announcement.
+func NewPublisher(addr string, opts Options, prefix, device string) (*Publisher, error) {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	p := &Publisher{prefix: prefix + "/" + Level(device)}
+	opts.Will = &Message{Topic: p.Topic("availability"), Payload: []byte(Offline), Retain: true}
+
+	c, err := Dial(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.Client = c
+	if err := c.Publish(p.Topic("availability"), []byte(Online), true); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Returns the topic of the device's levels.
+func (p *Publisher) Topic(levels ...string) string {
+	return strings.Join(append([]string{p.prefix}, levels...), "/")
+}
+
+// Publishes v as the device's retained status.
+func (p *Publisher) Status(v interface{}) error {
+	return p.publishJSON(p.Topic("status"), v, true)
+}
+
+// Publishes a channel report.
+func (p *Publisher) Report(r monitor.Report) error {
+	return p.publishJSON(p.Topic(Level(r.Channel), "report"), r, false)
+}
+
+// Publishes a squelch transition and the channel's retained state.
+func (p *Publisher) Event(e monitor.Event) error {
+	if err := p.publishJSON(p.Topic(Level(e.Channel), "squelch"), e, false); err != nil {
+		return err
+	}
+	state := "OFF"
+	if e.Open {
+		state = "ON"
+	}
+	return p.Publish(p.Topic(Level(e.Channel), "state"), []byte(state), true)
+}
+
+func (p *Publisher) publishJSON(topic string, v interface{}, retain bool) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("Error encoding %s: %s", topic, err)
+	}
+	return p.Publish(topic, buf, retain)
+}
+
+// Announces the device offline and disconnects.
+func (p *Publisher) Close() error {
+	p.Publish(p.Topic("availability"), []byte(Offline), true)
+	return p.Client.Close()
+}
+
+// Returns name usable as a single topic level, replacing separators and
+// wildcards with underscores.
+func Level(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
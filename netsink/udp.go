@@ -0,0 +1,121 @@
+// Package netsink provides sinks which forward sample blocks to network
+// consumers.
+package netsink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Largest payload fitting an unfragmented IPv4 datagram on ethernet.
+const DefaultPayloadSize = 1472
+
+// Framing prepended to each UDP datagram.
+type Header int
+
+const (
+	// Datagrams contain only samples.
+	HeaderNone Header = iota
+	// Datagrams begin with a little-endian 64-bit sequence number, the
+	// layout gr-network's UDP source expects for its sequence header type.
+	HeaderSeq64
+)
+
+func (h Header) size() int {
+	if h == HeaderSeq64 {
+		return 8
+	}
+	return 0
+}
+
+// UDP streams samples as fixed size datagrams. Samples are repacked across
+// block boundaries so every datagram carries exactly PayloadSize bytes,
+// including the header.
+type UDP struct {
+	conn    net.Conn
+	header  Header
+	packet  []byte
+	pending int // Sample bytes accumulated in packet.
+	seq     uint64
+}
+
+// Returns a sink sending datagrams of payloadSize bytes to addr,
+// DefaultPayloadSize if zero. The bytes left after the header must be even,
+// whole samples.
+func DialUDP(addr string, header Header, payloadSize int) (*UDP, error) {
+	if payloadSize <= 0 {
+		payloadSize = DefaultPayloadSize
+	}
+	if payloadSize <= header.size() {
+		return nil, fmt.Errorf("payload size %d too small for header", payloadSize)
+	}
+	// Datagrams mustn't split a sample's I and Q.
+	if (payloadSize-header.size())%2 != 0 {
+		return nil, fmt.Errorf("payload size %d leaves an odd number of sample bytes", payloadSize)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Error dialing UDP consumer: %s", err)
+	}
+
+	return &UDP{
+		conn:   conn,
+		header: header,
+		packet: make([]byte, payloadSize),
+	}, nil
+}
+
+// Returns the sequence number of the next datagram.
+func (u *UDP) Sequence() uint64 {
+	return u.seq
+}
+
+func (u *UDP) WriteBlock(blk rtltcp.Block) error {
+	samples := blk.Samples
+	hdr := u.header.size()
+
+	for len(samples) > 0 {
+		n := copy(u.packet[hdr+u.pending:], samples)
+		u.pending += n
+		samples = samples[n:]
+
+		if hdr+u.pending == len(u.packet) {
+			if err := u.send(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (u *UDP) send() error {
+	hdr := u.header.size()
+	if u.header == HeaderSeq64 {
+		binary.LittleEndian.PutUint64(u.packet, u.seq)
+	}
+	u.seq++
+
+	_, err := u.conn.Write(u.packet[:hdr+u.pending])
+	u.pending = 0
+	if err != nil {
+		return fmt.Errorf("Error sending UDP datagram: %s", err)
+	}
+	return nil
+}
+
+// Sends any partial datagram and closes the socket.
+func (u *UDP) Close() error {
+	var err error
+	if u.pending > 0 {
+		err = u.send()
+	}
+	if cerr := u.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
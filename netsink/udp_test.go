@@ -0,0 +1,61 @@
+package netsink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+func TestUDP(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, err := DialUDP(l.LocalAddr().String(), HeaderSeq64, 25); err == nil {
+		t.Error("accepted a payload splitting samples")
+	}
+	u, err := DialUDP(l.LocalAddr().String(), HeaderSeq64, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks of 20 and 30 bytes repacked into 16 bytes of samples each.
+	src := make([]byte, 50)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	for _, b := range [][]byte{src[:20], src[20:]} {
+		if err := u.WriteBlock(rtltcp.Block{Samples: b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	for seq := uint64(0); seq < 4; seq++ {
+		buf := make([]byte, 64)
+		n, _, err := l.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := min(24, 8+len(src)-len(got)); n != want {
+			t.Errorf("datagram %d of %d bytes, want %d", seq, n, want)
+		}
+		if s := binary.LittleEndian.Uint64(buf); s != seq {
+			t.Errorf("datagram %d numbered %d", seq, s)
+		}
+		got = append(got, buf[8:n]...)
+	}
+	if !bytes.Equal(got, src) {
+		t.Errorf("received %v", got)
+	}
+}
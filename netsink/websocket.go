@@ -0,0 +1,333 @@
+package netsink
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Appended to a client's key to form the accept key, from RFC 6455.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes.
+const (
+	wsBinary = 0x2
+	wsClose  = 0x8
+	wsPing   = 0x9
+	wsPong   = 0xA
+)
+
+// Default and largest spectrum size a client may request.
+const (
+	DefaultFFTSize = 1024
+	MaxFFTSize     = 1 << 16
+)
+
+// Header of each frame sent to WebSocket clients.
+type WSHeader struct {
+	Type       string    `json:"type"` // "iq" or "spectrum"
+	CenterFreq uint32    `json:"center_freq"`
+	SampleRate uint32    `json:"sample_rate"`
+	Timestamp  time.Time `json:"timestamp"`
+	Bins       int       `json:"bins,omitempty"`
+}
+
+// WebSocket streams blocks to browser clients. Each binary message is a
+// 4-byte big-endian header length, a JSON WSHeader, then the payload. By
+// default clients receive raw IQ bytes. Connecting with ?mode=spectrum
+// delivers one averaged power spectrum per block instead, as little-endian
+// float32 dB values with DC at the center, and ?fft=N sets the number of
+// bins. Clients which fall behind miss messages.
+type WebSocket struct {
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+	spectra map[int]*dsp.Spectrum
+	iq      []complex64
+}
+
+type wsClient struct {
+	conn     net.Conn
+	spectrum bool
+	bins     int
+	queue    chan []byte
+}
+
+// Returns an empty WebSocket sink, serve it to accept clients.
+func NewWebSocket() *WebSocket {
+	return &WebSocket{
+		clients: make(map[*wsClient]struct{}),
+		spectra: make(map[int]*dsp.Spectrum),
+	}
+}
+
+// Upgrades the request to a WebSocket and streams to it until the client
+// disconnects.
+func (ws *WebSocket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client := &wsClient{
+		spectrum: r.URL.Query().Get("mode") == "spectrum",
+		bins:     DefaultFFTSize,
+		queue:    make(chan []byte, DefaultHWM),
+	}
+	if s := r.URL.Query().Get("fft"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 8 || n > MaxFFTSize || n&(n-1) != 0 {
+			http.Error(w, "fft must be a power of two between 8 and 65536", http.StatusBadRequest)
+			return
+		}
+		client.bins = n
+	}
+
+	conn, rw, err := wsUpgrade(w, r)
+	if err != nil {
+		return
+	}
+	client.conn = conn
+	defer conn.Close()
+
+	go client.write()
+	defer close(client.queue)
+
+	ws.mu.Lock()
+	ws.clients[client] = struct{}{}
+	ws.mu.Unlock()
+	defer func() {
+		ws.mu.Lock()
+		delete(ws.clients, client)
+		ws.mu.Unlock()
+	}()
+
+	// Service control frames until the client goes away.
+	for {
+		op, payload, err := wsReadFrame(rw.Reader)
+		if err != nil {
+			return
+		}
+		switch op {
+		case wsPing:
+			client.send(wsFrame(wsPong, payload))
+		case wsClose:
+			client.send(wsFrame(wsClose, payload))
+			return
+		}
+	}
+}
+
+// Queues a message without blocking, dropping it if the client is behind.
+func (c *wsClient) send(msg []byte) {
+	select {
+	case c.queue <- msg:
+	default:
+	}
+}
+
+func (c *wsClient) write() {
+	for msg := range c.queue {
+		c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := c.conn.Write(msg); err != nil {
+			c.conn.Close()
+			for range c.queue {
+			}
+			return
+		}
+	}
+}
+
+func (ws *WebSocket) WriteBlock(blk rtltcp.Block) error {
+	header := WSHeader{
+		CenterFreq: blk.CenterFreq,
+		SampleRate: blk.SampleRate,
+		Timestamp:  blk.Timestamp,
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	var iqMsg []byte
+	specMsgs := make(map[int][]byte)
+
+	for c := range ws.clients {
+		if !c.spectrum {
+			if iqMsg == nil {
+				header.Type = "iq"
+				iqMsg = wsFrame(wsBinary, wsPayload(header, blk.Samples))
+			}
+			c.send(iqMsg)
+			continue
+		}
+
+		msg, ok := specMsgs[c.bins]
+		if !ok {
+			msg = ws.spectrumMessage(header, blk, c.bins)
+			specMsgs[c.bins] = msg
+		}
+		if msg != nil {
+			c.send(msg)
+		}
+	}
+
+	return nil
+}
+
+func (ws *WebSocket) spectrumMessage(header WSHeader, blk rtltcp.Block, bins int) []byte {
+	spec, ok := ws.spectra[bins]
+	if !ok {
+		spec = dsp.NewSpectrum(bins, dsp.Hann)
+		ws.spectra[bins] = spec
+	}
+
+	ws.iq = dsp.ConvertU8(ws.iq[:0], blk.Samples)
+	power := spec.PowerDB(nil, ws.iq)
+	if len(power) == 0 {
+		return nil
+	}
+
+	payload := make([]byte, 4*len(power))
+	for i, p := range power {
+		binary.LittleEndian.PutUint32(payload[4*i:], math.Float32bits(p))
+	}
+
+	header.Type = "spectrum"
+	header.Bins = bins
+	return wsFrame(wsBinary, wsPayload(header, payload))
+}
+
+// Disconnects all clients.
+func (ws *WebSocket) Close() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for c := range ws.clients {
+		c.conn.Close()
+	}
+	return nil
+}
+
+func wsPayload(header WSHeader, data []byte) []byte {
+	h, _ := json.Marshal(header)
+	buf := make([]byte, 4, 4+len(h)+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(h)))
+	buf = append(buf, h...)
+	return append(buf, data...)
+}
+
+// Completes the server side of the opening handshake.
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		http.Error(w, "expected websocket upgrade", http.StatusBadRequest)
+		return nil, nil, errors.New("not a websocket request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return nil, nil, errors.New("missing websocket key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return nil, nil, errors.New("response can't be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, rw, nil
+}
+
+// Returns an unmasked, unfragmented server frame.
+func wsFrame(op byte, payload []byte) []byte {
+	n := len(payload)
+	frame := make([]byte, 0, n+10)
+	frame = append(frame, 0x80|op)
+	switch {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= math.MaxUint16:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	return append(frame, payload...)
+}
+
+// Largest frame accepted from a client.
+const wsMaxFrame = 1 << 16
+
+// Reads one client frame, unmasking its payload. Clients only send control
+// frames to this server, so large frames are rejected.
+func wsReadFrame(r io.Reader) (op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	op = hdr[0] & 0x0F
+	masked := hdr[1]&0x80 != 0
+
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxFrame {
+		return 0, nil, errors.New("websocket frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(r, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return
+}
@@ -0,0 +1,106 @@
+package netsink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+func TestWebSocket(t *testing.T) {
+	ws := NewWebSocket()
+	srv := httptest.NewServer(ws)
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain request: %v %v", resp, err)
+	}
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The example handshake of RFC 6455.
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %s %v", resp.Status, resp.Header)
+	}
+
+	// A masked ping is answered; the client is registered by then.
+	ping := []byte{0x80 | wsPing, 0x80 | 4, 1, 2, 3, 4}
+	ping = append(ping, []byte("ping")...)
+	for i := range ping[6:] {
+		ping[6+i] ^= ping[2+i%4]
+	}
+	if _, err := conn.Write(ping); err != nil {
+		t.Fatal(err)
+	}
+	if op, payload, err := wsReadFrame(r); err != nil || op != wsPong || string(payload) != "ping" {
+		t.Fatalf("pong %#x %q: %v", op, payload, err)
+	}
+
+	blk := rtltcp.Block{Samples: bytes.Repeat([]byte{1, 2}, 200)}
+	blk.CenterFreq = 100e6
+	blk.SampleRate = 2.4e6
+	if err := ws.WriteBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+	op, payload, err := wsReadFrame(r)
+	if err != nil || op != wsBinary {
+		t.Fatalf("message %#x: %v", op, err)
+	}
+	n := binary.BigEndian.Uint32(payload)
+	var h WSHeader
+	if err := json.Unmarshal(payload[4:4+n], &h); err != nil || h.Type != "iq" || h.CenterFreq != 100e6 {
+		t.Errorf("header %s: %v", payload[4:4+n], err)
+	}
+	if !bytes.Equal(payload[4+n:], blk.Samples) {
+		t.Errorf("payload of %d bytes", len(payload)-4-int(n))
+	}
+}
+
+func TestWSFrame(t *testing.T) {
+	for _, test := range []struct {
+		n      int
+		header []byte
+	}{
+		{125, []byte{0x82, 125}},
+		{126, []byte{0x82, 126, 0, 126}},
+		{127, []byte{0x82, 126, 0, 127}},
+		{65535, []byte{0x82, 126, 0xff, 0xff}},
+		{65536, []byte{0x82, 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+	} {
+		payload := bytes.Repeat([]byte{0x5a}, test.n)
+		frame := wsFrame(wsBinary, payload)
+		if !bytes.HasPrefix(frame, test.header) || len(frame) != len(test.header)+test.n {
+			t.Errorf("%d bytes: header %x, frame of %d bytes", test.n, frame[:min(len(frame), 10)], len(frame))
+			continue
+		}
+		op, got, err := wsReadFrame(bytes.NewReader(frame))
+		if err != nil || op != wsBinary || !bytes.Equal(got, payload) {
+			t.Errorf("%d bytes read back as %#x of %d bytes: %v", test.n, op, len(got), err)
+		}
+	}
+}
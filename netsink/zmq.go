@@ -0,0 +1,307 @@
+package netsink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Messages queued per subscriber before new messages are dropped, as with
+// ZeroMQ's send high water mark.
+const DefaultHWM = 64
+
+// ZMTP frame flags.
+const (
+	zmtpMore    = 0x01
+	zmtpLong    = 0x02
+	zmtpCommand = 0x04
+)
+
+// Header frame of tagged messages.
+type zmqHeader struct {
+	CenterFreq uint32    `json:"center_freq"`
+	SampleRate uint32    `json:"sample_rate"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// ZMQ publishes blocks on a ZeroMQ PUB socket, speaking ZMTP 3.0 with the
+// NULL security mechanism, so gr-zeromq's SUB source and other ZeroMQ
+// subscribers can connect directly. In raw mode each message is a single
+// frame of samples. Tagged messages have two frames: a JSON header carrying
+// the block's center frequency, sample rate and timestamp, then samples.
+// Subscribers which fall the high water mark of messages behind miss
+// messages rather than stalling the stream.
+type ZMQ struct {
+	Tagged bool
+
+	hwm  int
+	l    net.Listener
+	mu   sync.Mutex
+	subs map[*zmqSub]struct{}
+}
+
+type zmqSub struct {
+	conn   net.Conn
+	queue  chan [][]byte
+	mu     sync.Mutex
+	topics [][]byte
+}
+
+// Binds a PUB socket to addr, which may be given as a ZeroMQ endpoint such
+// as "tcp://*:5555", queueing up to hwm messages per subscriber,
+// DefaultHWM if zero.
+func ListenZMQ(addr string, tagged bool, hwm int) (*ZMQ, error) {
+	if hwm <= 0 {
+		hwm = DefaultHWM
+	}
+
+	addr = strings.TrimPrefix(addr, "tcp://")
+	addr = strings.Replace(addr, "*", "", 1)
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Error binding ZeroMQ publisher: %s", err)
+	}
+
+	z := &ZMQ{
+		Tagged: tagged,
+		hwm:    hwm,
+		l:      l,
+		subs:   make(map[*zmqSub]struct{}),
+	}
+	go z.accept()
+
+	return z, nil
+}
+
+// Returns the address the publisher is bound to.
+func (z *ZMQ) Addr() net.Addr {
+	return z.l.Addr()
+}
+
+func (z *ZMQ) accept() {
+	for {
+		conn, err := z.l.Accept()
+		if err != nil {
+			return
+		}
+		go z.serve(conn)
+	}
+}
+
+func (z *ZMQ) serve(conn net.Conn) {
+	defer conn.Close()
+
+	if err := zmtpHandshake(conn); err != nil {
+		log.Printf("zeromq handshake with %s: %s", conn.RemoteAddr(), err)
+		return
+	}
+
+	sub := &zmqSub{conn: conn, queue: make(chan [][]byte, z.hwm)}
+	go sub.write()
+	defer close(sub.queue)
+
+	// Deregistered before the queue is closed, so WriteBlock never sends on
+	// a closed queue.
+	z.mu.Lock()
+	z.subs[sub] = struct{}{}
+	z.mu.Unlock()
+	defer func() {
+		z.mu.Lock()
+		delete(z.subs, sub)
+		z.mu.Unlock()
+	}()
+
+	// Subscriptions arrive as messages whose first byte is 1 to subscribe
+	// or 0 to unsubscribe, followed by the topic prefix.
+	for {
+		flags, body, err := zmtpReadFrame(conn)
+		if err != nil {
+			return
+		}
+		if flags&zmtpCommand != 0 || len(body) == 0 {
+			continue
+		}
+
+		sub.mu.Lock()
+		topic := body[1:]
+		switch body[0] {
+		case 1:
+			sub.topics = append(sub.topics, append([]byte(nil), topic...))
+		case 0:
+			for i, t := range sub.topics {
+				if bytes.Equal(t, topic) {
+					sub.topics = append(sub.topics[:i], sub.topics[i+1:]...)
+					break
+				}
+			}
+		}
+		sub.mu.Unlock()
+	}
+}
+
+func (sub *zmqSub) matches(first []byte) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for _, t := range sub.topics {
+		if bytes.HasPrefix(first, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sub *zmqSub) write() {
+	for msg := range sub.queue {
+		for i, frame := range msg {
+			var flags byte
+			if i < len(msg)-1 {
+				flags = zmtpMore
+			}
+			if err := zmtpWriteFrame(sub.conn, flags, frame); err != nil {
+				sub.conn.Close()
+				for range sub.queue {
+				}
+				return
+			}
+		}
+	}
+}
+
+func (z *ZMQ) WriteBlock(blk rtltcp.Block) error {
+	msg := [][]byte{append([]byte(nil), blk.Samples...)}
+	if z.Tagged {
+		header, err := json.Marshal(zmqHeader{blk.CenterFreq, blk.SampleRate, blk.Timestamp})
+		if err != nil {
+			return err
+		}
+		msg = append([][]byte{header}, msg...)
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for sub := range z.subs {
+		if !sub.matches(msg[0]) {
+			continue
+		}
+		select {
+		case sub.queue <- msg:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Stops accepting subscribers and disconnects existing ones.
+func (z *ZMQ) Close() error {
+	err := z.l.Close()
+	z.mu.Lock()
+	for sub := range z.subs {
+		sub.conn.Close()
+	}
+	z.mu.Unlock()
+	return err
+}
+
+// Exchanges greetings and READY commands with a subscriber.
+func zmtpHandshake(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9] = 0xFF, 0x7F
+	greeting[10], greeting[11] = 3, 0
+	copy(greeting[12:], "NULL")
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(conn, peer); err != nil {
+		return err
+	}
+	if peer[0] != 0xFF || peer[9] != 0x7F || peer[10] < 3 {
+		return errors.New("peer is not ZMTP 3")
+	}
+	if mech := string(bytes.TrimRight(peer[12:32], "\x00")); mech != "NULL" {
+		return fmt.Errorf("unsupported security mechanism %q", mech)
+	}
+
+	var ready bytes.Buffer
+	ready.WriteByte(5)
+	ready.WriteString("READY")
+	ready.WriteByte(byte(len("Socket-Type")))
+	ready.WriteString("Socket-Type")
+	binary.Write(&ready, binary.BigEndian, uint32(len("PUB")))
+	ready.WriteString("PUB")
+	if err := zmtpWriteFrame(conn, zmtpCommand, ready.Bytes()); err != nil {
+		return err
+	}
+
+	flags, body, err := zmtpReadFrame(conn)
+	if err != nil {
+		return err
+	}
+	if flags&zmtpCommand == 0 || !bytes.HasPrefix(body, []byte("\x05READY")) {
+		return errors.New("expected READY command")
+	}
+
+	return nil
+}
+
+func zmtpWriteFrame(w io.Writer, flags byte, body []byte) error {
+	var hdr [9]byte
+	n := 2
+	if len(body) > 255 {
+		hdr[0] = flags | zmtpLong
+		binary.BigEndian.PutUint64(hdr[1:], uint64(len(body)))
+		n = 9
+	} else {
+		hdr[0] = flags
+		hdr[1] = byte(len(body))
+	}
+
+	if _, err := w.Write(hdr[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// Largest frame accepted from a subscriber, which only sends commands and
+// subscriptions.
+const zmtpMaxFrame = 1 << 16
+
+func zmtpReadFrame(r io.Reader) (flags byte, body []byte, err error) {
+	var hdr [9]byte
+	if _, err = io.ReadFull(r, hdr[:2]); err != nil {
+		return
+	}
+	flags = hdr[0]
+
+	size := uint64(hdr[1])
+	if flags&zmtpLong != 0 {
+		if _, err = io.ReadFull(r, hdr[2:9]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(hdr[1:9])
+	}
+	if size > zmtpMaxFrame {
+		return 0, nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+
+	body = make([]byte, size)
+	_, err = io.ReadFull(r, body)
+	return
+}
@@ -0,0 +1,106 @@
+package netsink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+func TestZMQ(t *testing.T) {
+	z, err := ListenZMQ("tcp://127.0.0.1:0", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	if z.hwm != DefaultHWM {
+		t.Errorf("high water mark %d, want %d", z.hwm, DefaultHWM)
+	}
+
+	conn, err := net.Dial("tcp", z.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Greetings of ZMTP 3.0 with the NULL mechanism, then READY commands.
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9], greeting[10] = 0xFF, 0x7F, 3
+	copy(greeting[12:], "NULL")
+	if _, err := conn.Write(greeting); err != nil {
+		t.Fatal(err)
+	}
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(conn, peer); err != nil {
+		t.Fatal(err)
+	}
+	if peer[0] != 0xFF || peer[9] != 0x7F || peer[10] != 3 || string(bytes.TrimRight(peer[12:32], "\x00")) != "NULL" {
+		t.Fatalf("greeting %x", peer)
+	}
+	flags, body, err := zmtpReadFrame(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags != zmtpCommand || !bytes.HasPrefix(body, []byte("\x05READY\x0bSocket-Type\x00\x00\x00\x03PUB")) {
+		t.Fatalf("READY %#x %q", flags, body)
+	}
+	var ready bytes.Buffer
+	ready.WriteString("\x05READY\x0bSocket-Type")
+	binary.Write(&ready, binary.BigEndian, uint32(3))
+	ready.WriteString("SUB")
+	if err := zmtpWriteFrame(conn, zmtpCommand, ready.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Subscribed to everything, blocks arrive once the subscription has.
+	if err := zmtpWriteFrame(conn, 0, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	type frame struct {
+		flags byte
+		body  []byte
+	}
+	frames := make(chan frame, 16)
+	go func() {
+		defer close(frames)
+		for {
+			flags, body, err := zmtpReadFrame(conn)
+			if err != nil {
+				return
+			}
+			frames <- frame{flags, body}
+		}
+	}()
+
+	blk := rtltcp.Block{Samples: bytes.Repeat([]byte{1, 2}, 200)}
+	blk.CenterFreq = 100e6
+	blk.SampleRate = 2.4e6
+	var header frame
+	for received := false; !received; {
+		if err := z.WriteBlock(blk); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case header, received = <-frames:
+			if !received {
+				t.Fatal("subscriber disconnected")
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	var h zmqHeader
+	if err := json.Unmarshal(header.body, &h); header.flags != zmtpMore || err != nil || h.CenterFreq != 100e6 || h.SampleRate != 2.4e6 {
+		t.Errorf("header frame %#x %s: %v", header.flags, header.body, err)
+	}
+	// Samples longer than 255 bytes take the long frame form.
+	if samples := <-frames; samples.flags != zmtpLong || !bytes.Equal(samples.body, blk.Samples) {
+		t.Errorf("samples frame %#x of %d bytes", samples.flags, len(samples.body))
+	}
+}
@@ -0,0 +1,98 @@
+package rtltcp
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Magic number of the header sent by relays packing samples to 4 bits, see
+// Pack4. Connect accepts it and the SDR unpacks transparently, so readers
+// always receive 8-bit samples.
+var PackedMagic = [...]byte{'R', 'T', 'L', '4'}
+
+// Packs interleaved 8-bit samples to 4 bits each, an I and Q pair per byte
+// with I in the high nibble, appending them to dst. A trailing unpaired
+// byte is dropped. Samples are dithered before truncation so quantization
+// error is spread as noise rather than harmonics, dither holds the state of
+// the dither generator and must be non-zero.
+func Pack4(dst, src []byte, dither *uint32) []byte {
+	for i := 0; i+1 < len(src); i += 2 {
+		// xorshift32, its top byte supplies one nibble per sample.
+		x := *dither
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		*dither = x
+
+		hi := quantize4(src[i], x>>28)
+		lo := quantize4(src[i+1], x>>24&0xF)
+		dst = append(dst, hi<<4|lo)
+	}
+	return dst
+}
+
+func quantize4(s byte, d uint32) byte {
+	v := (int(s) - 8 + int(d)) >> 4
+	if v < 0 {
+		v = 0
+	} else if v > 15 {
+		v = 15
+	}
+	return byte(v)
+}
+
+// Unpacks samples packed by Pack4, appending them to dst. Each nibble
+// expands to the center of the 8-bit range it represents.
+func Unpack4(dst, src []byte) []byte {
+	for _, b := range src {
+		dst = append(dst, b&0xF0|8, b<<4|8)
+	}
+	return dst
+}
+
+// Reads samples from the server, unpacking them if the server sends 4-bit
+// samples.
+func (sdr *SDR) Read(p []byte) (n int, err error) {
+	n, err = sdr.read(p)
+	atomic.AddUint64(&sdr.received, uint64(n))
+	return
+}
+
+func (sdr *SDR) read(p []byte) (n int, err error) {
+	if !sdr.packed {
+		return sdr.readConn(p)
+	}
+
+	if len(sdr.unpacked) == 0 {
+		if cap(sdr.scratch) < (len(p)+1)/2 {
+			sdr.scratch = make([]byte, (len(p)+1)/2)
+		}
+		n, err = sdr.readConn(sdr.scratch[:(len(p)+1)/2])
+		sdr.unpacked = Unpack4(sdr.unpacked[:0], sdr.scratch[:n])
+	}
+
+	n = copy(p, sdr.unpacked)
+	sdr.unpacked = sdr.unpacked[n:]
+	if len(sdr.unpacked) > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Reads from the connection, first returning bytes read ahead while
+// checking for a header extension.
+func (sdr *SDR) readConn(p []byte) (int, error) {
+	if len(sdr.pending) > 0 {
+		n := copy(p, sdr.pending)
+		sdr.pending = sdr.pending[n:]
+		return n, nil
+	}
+	return sdr.Conn.Read(p)
+}
+
+// Writes samples from the server to w until EOF or error, unpacking them
+// if the server sends 4-bit samples.
+func (sdr *SDR) WriteTo(w io.Writer) (int64, error) {
+	// Hide WriteTo from io.Copy so it reads through Read.
+	return io.Copy(w, struct{ io.Reader }{sdr})
+}
@@ -0,0 +1,47 @@
+package rtltcp
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoSamples is returned by Ping when the stream stalls.
+var ErrNoSamples = errors.New("no samples received")
+
+// Interval Ping checks for arrived samples at.
+const pingPoll = 10 * time.Millisecond
+
+// Checks the session is healthy: the current frequency correction is sent
+// again, which rtl_tcp ignores as unchanged, proving the connection accepts
+// writes, then samples must arrive within timeout. Samples are counted as
+// they are read, so the stream must be consumed meanwhile, e.g. by Blocks.
+func (sdr *SDR) Ping(timeout time.Duration) error {
+	sdr.mu.Lock()
+	cmd, ok := sdr.settings[uint32(FreqCorrection)<<16]
+	sdr.mu.Unlock()
+	if !ok {
+		cmd = Command{FreqCorrection, 0}
+	}
+
+	before := atomic.LoadUint64(&sdr.received)
+	sdr.Conn.SetWriteDeadline(time.Now().Add(timeout))
+	// Not retried, a stalled write is what's being checked for.
+	err := sdr.writeCommand(cmd, nil)
+	sdr.Conn.SetWriteDeadline(time.Time{})
+	if err != nil {
+		return fmt.Errorf("Error sending ping: %s", err)
+	}
+
+	t := time.NewTicker(pingPoll)
+	defer t.Stop()
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadUint64(&sdr.received) == before {
+		if time.Now().After(deadline) {
+			return ErrNoSamples
+		}
+		<-t.C
+	}
+	return nil
+}
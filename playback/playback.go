@@ -0,0 +1,215 @@
+// Package playback provides a source which reads recorded samples from
+// disk, standing in for a live rtl_tcp connection.
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/record"
+)
+
+// Returned when tuning to a frequency or rate absent from a recording.
+var ErrNotRecorded = errors.New("setting not present in recording")
+
+// Matches names written by record.Raw: <prefix>_<time>_<frequency>Hz.cu8
+var rawName = regexp.MustCompile(`_(\d{8}T\d{6}\.\d{3}Z)_(\d+)Hz\.cu8$`)
+
+// A span of the recording at one frequency.
+type capture struct {
+	offset int64 // Byte offset of the first sample.
+	freq   uint32
+	start  time.Time
+}
+
+// File plays back a raw or SigMF recording. Recordings are SigMF if the path
+// has a SigMF extension, otherwise raw unsigned 8-bit IQ. Raw recordings
+// carry no metadata, except what can be parsed from names written by
+// record.Raw, so SetCenterFreq and SetSampleRate only set the tags applied to
+// blocks. For SigMF, SetCenterFreq seeks to the first capture at the given
+// frequency and SetSampleRate must match the recorded rate.
+type File struct {
+	// Pace reads to the sample rate, as a live source would be.
+	Realtime bool
+	// Restart from the beginning at end of file instead of returning io.EOF.
+	Loop bool
+
+	file     *os.File
+	size     int64
+	pos      int64
+	sigmf    bool
+	rate     uint32
+	captures []capture
+
+	started time.Time // Wall time playback began, for pacing.
+	paced   int64     // Bytes delivered since playback began.
+
+	index uint64 // Samples delivered since opening, across loops.
+}
+
+var _ rtltcp.Source = (*File)(nil)
+
+// Opens the recording at path.
+func Open(path string) (*File, error) {
+	f := &File{}
+
+	ext := filepath.Ext(path)
+	if ext == record.SigMFDataExt || ext == record.SigMFMetaExt {
+		base := record.SigMFBase(path)
+		meta, err := record.ReadSigMFMeta(base + record.SigMFMetaExt)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading SigMF metadata: %s", err)
+		}
+		if meta.Global.Datatype != record.SigMFDatatype {
+			return nil, fmt.Errorf("unsupported SigMF datatype: %q", meta.Global.Datatype)
+		}
+
+		f.sigmf = true
+		f.rate = uint32(meta.Global.SampleRate)
+		for _, c := range meta.Captures {
+			start, _ := time.Parse(time.RFC3339Nano, c.Datetime)
+			f.captures = append(f.captures, capture{int64(c.SampleStart) * 2, uint32(c.Frequency), start})
+		}
+		sort.Slice(f.captures, func(i, j int) bool { return f.captures[i].offset < f.captures[j].offset })
+
+		path = base + record.SigMFDataExt
+	} else {
+		c := capture{}
+		if m := rawName.FindStringSubmatch(filepath.Base(path)); m != nil {
+			c.start, _ = time.Parse("20060102T150405.000Z", m[1])
+			freq, _ := strconv.ParseUint(m[2], 10, 32)
+			c.freq = uint32(freq)
+		}
+		f.captures = []capture{c}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	f.file, f.size = file, info.Size()
+	if len(f.captures) == 0 {
+		f.captures = []capture{{}}
+	}
+
+	return f, nil
+}
+
+// Returns the capture containing byte offset pos.
+func (f *File) capture(pos int64) capture {
+	i := sort.Search(len(f.captures), func(i int) bool { return f.captures[i].offset > pos })
+	if i == 0 {
+		return f.captures[0]
+	}
+	return f.captures[i-1]
+}
+
+func (f *File) SetCenterFreq(freq uint32) error {
+	if !f.sigmf {
+		f.captures[0].freq = freq
+		return nil
+	}
+
+	for _, c := range f.captures {
+		if c.freq == freq {
+			return f.seek(c.offset)
+		}
+	}
+	return fmt.Errorf("%w: %d Hz", ErrNotRecorded, freq)
+}
+
+func (f *File) SetSampleRate(rate uint32) error {
+	if f.sigmf && rate != f.rate {
+		return fmt.Errorf("%w: recorded at %d S/s, requested %d S/s", ErrNotRecorded, f.rate, rate)
+	}
+	f.rate = rate
+	return nil
+}
+
+func (f *File) seek(pos int64) error {
+	if _, err := f.file.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	f.pos = pos
+	return nil
+}
+
+func (f *File) ReadBlock(buf []byte) (blk rtltcp.Block, err error) {
+	c := f.capture(f.pos)
+	blk.CenterFreq = c.freq
+	blk.SampleRate = f.rate
+	if !c.start.IsZero() && f.rate != 0 {
+		blk.Timestamp = c.start.Add(time.Duration(float64((f.pos-c.offset)/2) / float64(f.rate) * float64(time.Second)))
+	}
+
+	n, err := io.ReadFull(f.file, buf)
+	f.pos += int64(n)
+
+	if f.Loop && n < len(buf) && (err == io.EOF || err == io.ErrUnexpectedEOF) && f.size > 0 {
+		if err = f.seek(0); err != nil {
+			return
+		}
+		var m int
+		m, err = io.ReadFull(f.file, buf[n:])
+		f.pos += int64(m)
+		n += m
+	}
+	if err != nil {
+		return
+	}
+
+	blk.Samples = buf
+	blk.Index = f.index
+	f.index += uint64(blk.Len())
+	blk.Received = time.Now()
+	if blk.Timestamp.IsZero() {
+		blk.Timestamp = blk.Received.Add(-blk.Duration())
+	}
+
+	if f.Realtime {
+		f.pace(n)
+	}
+
+	return
+}
+
+// Sleeps until n more bytes would have arrived from a live source.
+func (f *File) pace(n int) {
+	if f.rate == 0 {
+		return
+	}
+	if f.started.IsZero() {
+		f.started = time.Now()
+	}
+	f.paced += int64(n)
+	due := f.started.Add(time.Duration(float64(f.paced/2) / float64(f.rate) * float64(time.Second)))
+	time.Sleep(time.Until(due))
+}
+
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// Reports whether path names a file this package can play back.
+func Supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case record.SigMFDataExt, record.SigMFMetaExt, ".cu8", ".iq", ".bin", ".raw":
+		return true
+	}
+	return false
+}
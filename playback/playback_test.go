@@ -0,0 +1,70 @@
+package playback
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/record"
+)
+
+func TestSigMFPlayback(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "capture")
+	rec, err := record.NewSigMF(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blk := rtltcp.Block{Samples: make([]byte, 1000)}
+	blk.SampleRate = 1e6
+	blk.Timestamp = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, freq := range []uint32{100e6, 100e6, 200e6} {
+		for j := range blk.Samples {
+			blk.Samples[j] = byte(i)
+		}
+		blk.CenterFreq = freq
+		if err := rec.WriteBlock(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(base + record.SigMFMetaExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.SetSampleRate(2e6); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("mismatched sample rate: got %v, want ErrNotRecorded", err)
+	}
+
+	buf := make([]byte, 1000)
+	got, err := f.ReadBlock(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CenterFreq != 100e6 || got.SampleRate != 1e6 || !got.Timestamp.Equal(blk.Timestamp) {
+		t.Errorf("unexpected metadata: %+v", got.Metadata)
+	}
+
+	if err := f.SetCenterFreq(200e6); err != nil {
+		t.Fatal(err)
+	}
+	got, err = f.ReadBlock(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CenterFreq != 200e6 || got.Samples[0] != 2 {
+		t.Errorf("seek to 200 MHz capture: freq %d first sample %d", got.CenterFreq, got.Samples[0])
+	}
+
+	if _, err := f.ReadBlock(buf); err != io.EOF {
+		t.Errorf("read past end: got %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,74 @@
+package rtltcp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Reference counted sample buffer recycled through a pool.
+type buffer struct {
+	refs int32
+	data []byte
+	pool *sync.Pool
+}
+
+// Adds a reference to the block's buffer, for handing the block to another
+// consumer which will Release it as well. Does nothing for blocks not from
+// PooledBlocks.
+func (b Block) Retain() Block {
+	if b.buf != nil {
+		atomic.AddInt32(&b.buf.refs, 1)
+	}
+	return b
+}
+
+// Drops a reference to the block's buffer, returning it to its pool with
+// the last. The samples must not be used afterwards. Does nothing for
+// blocks not from PooledBlocks, so consumers may release every block.
+func (b Block) Release() {
+	if b.buf == nil {
+		return
+	}
+	switch refs := atomic.AddInt32(&b.buf.refs, -1); {
+	case refs == 0:
+		b.buf.pool.Put(b.buf)
+	case refs < 0:
+		panic("rtltcp: block released more often than retained")
+	}
+}
+
+// Starts a reader as BlocksContext delivering blocks whose buffers are
+// recycled, so streaming at high sample rates doesn't generate garbage
+// proportional to the data rate.
+//
+// Each block arrives holding one reference, owned by the receiver. The
+// receiver must call Release once done with the samples, and Retain before
+// passing the block to each additional consumer, each of which releases it
+// in turn. Blocks handed to a Sink may be released once WriteBlock returns.
+// Blocks never released are collected as usual, only the recycling is
+// lost.
+func (sdr *SDR) PooledBlocks(ctx context.Context, blockSize int) <-chan Block {
+	return sdr.startReader(ctx, blockSize, newBufferPool(blockSize))
+}
+
+// Pool of buffers of size bytes.
+type bufferPool struct {
+	sync.Pool
+	size int
+}
+
+func newBufferPool(size int) *bufferPool {
+	pool := &bufferPool{size: size}
+	pool.New = func() interface{} {
+		return &buffer{data: make([]byte, size), pool: &pool.Pool}
+	}
+	return pool
+}
+
+// Takes a buffer holding one reference from pool.
+func getBuffer(pool *bufferPool) *buffer {
+	pb := pool.Get().(*buffer)
+	pb.refs = 1
+	return pb
+}
@@ -0,0 +1,170 @@
+package rtltcp
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Profile is a named device configuration for an application, applied in
+// full by ApplyProfile. Modes are set as given, CenterFreq, SampleRate, PPM
+// and ConverterOffset left unchanged if zero.
+type Profile struct {
+	CenterFreq uint32  `json:"center_freq,omitempty"` // Hz.
+	SampleRate uint32  `json:"sample_rate,omitempty"` // Hz.
+	AutoGain   bool    `json:"auto_gain,omitempty"`
+	Gain       float64 `json:"gain_db,omitempty"` // Applied unless AutoGain, see SetGainDB.
+	PPM        int     `json:"ppm,omitempty"`     // Frequency correction.
+
+	AGC            bool `json:"rtl_agc,omitempty"` // RTL2832 AGC.
+	DirectSampling bool `json:"direct_sampling,omitempty"`
+	OffsetTuning   bool `json:"offset_tuning,omitempty"`
+	// Offset of a converter ahead of the dongle in Hz, see
+	// SDR.ConverterOffset.
+	ConverterOffset int64 `json:"converter_offset,omitempty"`
+}
+
+// Profiles available without a store, which a store may override.
+var BuiltinProfiles = map[string]Profile{
+	// Mode S and ADS-B at the full gain weak aircraft need.
+	"adsb": {CenterFreq: 1090e6, SampleRate: 2e6, Gain: 49.6},
+	// POCSAG and FLEX in the North American paging band.
+	"pager": {CenterFreq: 929.6125e6, SampleRate: 1.2e6, Gain: 40.2},
+	// The FM broadcast band, wide enough for several stations at once.
+	"fm-dx": {CenterFreq: 98e6, SampleRate: 2.4e6, Gain: 33.8},
+}
+
+// ProfileStore persists named profiles to a JSON file, next to the
+// calibration store by default.
+type ProfileStore struct {
+	store *jsonStore[Profile]
+}
+
+// Returns the file profiles are kept in by default, in DefaultConfigDir.
+func DefaultProfilePath() (string, error) {
+	dir, err := DefaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "profiles.json"), nil
+}
+
+// Opens the store at path, empty if the file doesn't exist yet.
+func OpenProfiles(path string) (*ProfileStore, error) {
+	store, err := openJSONStore[Profile](path, "profiles")
+	if err != nil {
+		return nil, err
+	}
+	return &ProfileStore{store}, nil
+}
+
+// Returns the profile named name and whether there is one, stored or
+// built in. A nil store has only the built in profiles.
+func (s *ProfileStore) Get(name string) (Profile, bool) {
+	if s != nil {
+		if p, ok := s.store.get(name); ok {
+			return p, ok
+		}
+	}
+	p, ok := BuiltinProfiles[name]
+	return p, ok
+}
+
+// Returns the names of stored and built in profiles, sorted.
+func (s *ProfileStore) Names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	if s != nil {
+		names = s.store.keys()
+		for _, name := range names {
+			seen[name] = true
+		}
+	}
+	for name := range BuiltinProfiles {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stores p as name and rewrites the file.
+func (s *ProfileStore) Put(name string, p Profile) error {
+	return s.store.put(name, p, false)
+}
+
+// Removes the stored profile name, revealing a built in one of the same
+// name if any.
+func (s *ProfileStore) Delete(name string) error {
+	return s.store.put(name, Profile{}, true)
+}
+
+// Applies the profile named name from Profiles, or the built in ones if
+// nil, sending its settings in a single write.
+func (sdr *SDR) ApplyProfile(name string) error {
+	p, ok := sdr.Profiles.Get(name)
+	if !ok {
+		return fmt.Errorf("rtltcp: unknown profile %q", name)
+	}
+	return sdr.Apply(p)
+}
+
+// Opens the profile store for Flags.Profile unless Profiles is set:
+// profiles.json next to Flags.Calibration if given, otherwise at
+// DefaultProfilePath. Without a configuration directory only the built in
+// profiles are available.
+func (sdr *SDR) openProfiles() (err error) {
+	if sdr.Profiles != nil {
+		return nil
+	}
+	path := filepath.Join(filepath.Dir(sdr.Flags.Calibration), "profiles.json")
+	if sdr.Flags.Calibration == "" {
+		if path, err = DefaultProfilePath(); err != nil {
+			return nil
+		}
+	}
+	sdr.Profiles, err = OpenProfiles(path)
+	return err
+}
+
+// Applies p, sending its settings in a single write.
+func (sdr *SDR) Apply(p Profile) error {
+	return sdr.Batch(func() error { return sdr.apply(p) })
+}
+
+func (sdr *SDR) apply(p Profile) (err error) {
+	if p.ConverterOffset != 0 {
+		sdr.ConverterOffset = p.ConverterOffset
+	}
+	if p.SampleRate != 0 {
+		if err = sdr.SetSampleRate(p.SampleRate); err != nil {
+			return
+		}
+	}
+	if p.CenterFreq != 0 {
+		if err = sdr.SetCenterFreq(p.CenterFreq); err != nil {
+			return
+		}
+	}
+	if p.AutoGain {
+		err = sdr.SetTunerAGC(true)
+	} else {
+		err = sdr.SetGainDB(p.Gain)
+	}
+	if err != nil {
+		return
+	}
+	if p.PPM != 0 {
+		if err = sdr.SetFreqCorrection(uint32(p.PPM)); err != nil {
+			return
+		}
+	}
+	if err = sdr.SetAGCMode(p.AGC); err != nil {
+		return
+	}
+	if err = sdr.SetDirectSampling(p.DirectSampling); err != nil {
+		return
+	}
+	return sdr.SetOffsetTuning(p.OffsetTuning)
+}
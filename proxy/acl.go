@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// Parses CIDR prefixes, accepting bare addresses as single hosts.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the address rules admit addr.
+func (l *Listener) permitted(addr netip.Addr) bool {
+	if contains(l.Deny, addr) {
+		return false
+	}
+	return len(l.Allow) == 0 || contains(l.Allow, addr)
+}
+
+// Counts a connection from addr, failing if it would exceed MaxPerIP.
+func (l *Listener) acquire(addr netip.Addr) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.MaxPerIP > 0 && l.active[addr] >= l.MaxPerIP {
+		return false
+	}
+	if l.active == nil {
+		l.active = make(map[netip.Addr]int)
+	}
+	l.active[addr]++
+	return true
+}
+
+func (l *Listener) release(addr netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[addr]--; l.active[addr] <= 0 {
+		delete(l.active, addr)
+	}
+}
+
+// A connection counted against its address's limit until closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// Accepts the next connection admitted by the address rules and limits,
+// closing refused connections, and wraps it in TLS if configured.
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ap, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+		if err != nil {
+			// Not an IP connection, address rules don't apply.
+			if l.TLS != nil {
+				conn = tls.Server(conn, l.TLS)
+			}
+			return conn, nil
+		}
+		addr := ap.Addr().Unmap()
+
+		if !l.permitted(addr) {
+			log.Printf("refused %s: not permitted", addr)
+			conn.Close()
+			continue
+		}
+		if !l.acquire(addr) {
+			log.Printf("refused %s: connection limit reached", addr)
+			conn.Close()
+			continue
+		}
+
+		conn = &limitedConn{Conn: conn, release: func() { l.release(addr) }}
+		if l.TLS != nil {
+			// The handshake happens on first use, off the accept loop.
+			conn = tls.Server(conn, l.TLS)
+		}
+		return conn, nil
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Statistics of a connected relay client.
+type ClientStats struct {
+	Addr      string    `json:"addr"`
+	Connected time.Time `json:"connected"`
+	ReadOnly  bool      `json:"read_only"`
+	BytesSent uint64    `json:"bytes_sent"`
+	// Blocks waiting in the client's queue.
+	Queued int `json:"queued_blocks"`
+	// Blocks missed because the client's queue was full.
+	Dropped  uint64 `json:"dropped_blocks"`
+	Commands uint64 `json:"commands"`
+	// Channel selected by the client, see rtltcp.SDR.SetChannel.
+	ChannelOffset     int32  `json:"channel_offset,omitempty"`
+	ChannelDecimation uint32 `json:"channel_decimation,omitempty"`
+	// Latest command received, its offset counting bytes sent to the client.
+	LastCommand *LogEntry `json:"last_command,omitempty"`
+}
+
+// Overall state of a relay.
+type RelayStatus struct {
+	Upstream  string        `json:"upstream"`
+	Connected bool          `json:"connected"` // Upstream connection is up.
+	Clients   []ClientStats `json:"clients"`
+	// Health of the upstream samples over the last complete histogram
+	// window, nil until one is.
+	Samples *rtltcp.Diagnosis `json:"samples,omitempty"`
+	// Reconnections finding a different dongle, and the last one found.
+	DongleChanges    uint64 `json:"dongle_changes"`
+	LastDongleChange string `json:"last_dongle_change,omitempty"`
+}
+
+// Returns statistics of every connected client, oldest first.
+func (r *Relay) Stats() []ClientStats {
+	r.init()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats()
+}
+
+func (r *Relay) stats() []ClientStats {
+	stats := make([]ClientStats, 0, len(r.clients))
+	for c := range r.clients {
+		s := ClientStats{
+			Addr:      c.conn.RemoteAddr().String(),
+			Connected: c.connected,
+			ReadOnly:  c.readOnly,
+			BytesSent: atomic.LoadUint64(&c.sent),
+			Queued:    len(c.queue),
+			Dropped:   c.dropped,
+			Commands:  c.commands,
+
+			ChannelOffset:     c.offset,
+			ChannelDecimation: c.decim,
+		}
+		if c.last != nil {
+			last := *c.last
+			s.LastCommand = &last
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Connected.Before(stats[j].Connected) })
+	return stats
+}
+
+// Returns the relay's state.
+func (r *Relay) Status() RelayStatus {
+	r.init()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := RelayStatus{
+		Upstream:         r.Upstream,
+		Connected:        r.upstream != nil,
+		Clients:          r.stats(),
+		DongleChanges:    r.dongleChanges,
+		LastDongleChange: r.lastDongleChange,
+	}
+	if r.lastHist != nil {
+		d := r.lastHist.Diagnose()
+		s.Samples = &d
+	}
+	return s
+}
+
+// Returns the histogram of upstream sample values over the last complete
+// window, nil until one is.
+func (r *Relay) Histogram() *rtltcp.Histogram {
+	r.init()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastHist == nil {
+		return nil
+	}
+	h := *r.lastHist
+	return &h
+}
+
+// Returns an HTTP handler for monitoring the relay, serving as JSON:
+//
+//	GET /status     RelayStatus
+//	GET /clients    ClientStats of every connected client
+//	GET /histogram  rtltcp.Histogram of upstream sample values
+//
+// It exposes client addresses and has no authentication of its own, so
+// should only be reachable by operators.
+func (r *Relay) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", r.adminJSON(func() interface{} { return r.Status() }))
+	mux.HandleFunc("/clients", r.adminJSON(func() interface{} { return r.Stats() }))
+	mux.HandleFunc("/histogram", r.adminJSON(func() interface{} { return r.Histogram() }))
+	return mux
+}
+
+func (r *Relay) adminJSON(value func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(value())
+	}
+}
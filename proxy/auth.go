@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Time a relay waits for a client's token handshake before treating it as a
+// legacy client.
+const DefaultAuthTimeout = time.Second
+
+// Treatment of clients which don't present a token to a listener requiring
+// one. Legacy rtl_tcp clients can't.
+type LegacyPolicy int
+
+const (
+	LegacyReject   LegacyPolicy = iota // Disconnect them.
+	LegacyAllow                        // Serve them as if authenticated.
+	LegacyReadOnly                     // Serve the stream but discard their commands.
+)
+
+func (p LegacyPolicy) String() string {
+	switch p {
+	case LegacyReject:
+		return "reject"
+	case LegacyAllow:
+		return "allow"
+	case LegacyReadOnly:
+		return "readonly"
+	}
+	return fmt.Sprintf("LegacyPolicy(%d)", int(p))
+}
+
+// Parses a policy name as returned by String.
+func ParseLegacyPolicy(s string) (LegacyPolicy, error) {
+	for _, p := range []LegacyPolicy{LegacyReject, LegacyAllow, LegacyReadOnly} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown legacy policy %q", s)
+}
+
+// ErrUnauthorized is returned when a client presents a wrong token or none
+// where one is required.
+var ErrUnauthorized = errors.New("proxy: unauthorized client")
+
+// Listener wraps a net.Listener with an access policy. Address rules and
+// connection limits are enforced by Accept, so they apply to any server,
+// tokens are checked by Relay.
+type Listener struct {
+	net.Listener
+
+	// Client networks admitted, all if empty. Deny takes precedence.
+	Allow []netip.Prefix
+	// Client networks refused.
+	Deny []netip.Prefix
+	// Concurrent connections allowed from one address, unlimited if zero.
+	MaxPerIP int
+
+	// Optional TLS configuration accepted connections are wrapped in. Set
+	// ClientAuth and ClientCAs to require client certificates.
+	TLS *tls.Config
+
+	// Pre-shared token clients must present, see rtltcp.WriteAuth. Empty
+	// admits every client without a handshake.
+	Token string
+	// Treatment of clients presenting no token.
+	Legacy LegacyPolicy
+	// DefaultAuthTimeout if zero.
+	AuthTimeout time.Duration
+
+	// Encoding of samples sent to clients, who choose one by choosing the
+	// listener. FormatU4 halves bandwidth at the cost of dynamic range and
+	// announces itself with rtltcp.PackedMagic, which only clients of this
+	// package accept. FormatS16 and FormatF32 announce themselves with
+	// S16Magic and F32Magic. FormatU8 keeps the upstream header.
+	Format SampleFormat
+	// Factor the sample rate is reduced by after low pass filtering, none
+	// if zero or one. Sample rate commands still set the upstream rate.
+	Decimation int
+
+	mu     sync.Mutex
+	active map[netip.Addr]int
+}
+
+// Access granted to a client.
+type access struct {
+	readOnly bool
+}
+
+// Authenticates a client, returning its access and the reader its commands
+// must be read from, which may hold bytes read ahead.
+func (l *Listener) authenticate(conn net.Conn) (access, *bufio.Reader, error) {
+	in := bufio.NewReader(conn)
+	if l == nil || l.Token == "" {
+		return access{}, in, nil
+	}
+
+	timeout := l.AuthTimeout
+	if timeout <= 0 {
+		timeout = DefaultAuthTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	// Legacy clients wait for the header in silence or open with a command,
+	// whose opcode never matches the handshake's first byte.
+	first, err := in.Peek(1)
+	var netErr net.Error
+	switch {
+	case err == nil && first[0] == rtltcp.AuthMagic[0]:
+		token, err := rtltcp.ReadAuth(in)
+		if err != nil {
+			return access{}, nil, fmt.Errorf("Error reading handshake: %s", err)
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(l.Token)) != 1 {
+			return access{}, nil, ErrUnauthorized
+		}
+		return access{}, in, nil
+	case err == nil, errors.As(err, &netErr) && netErr.Timeout():
+	default:
+		return access{}, nil, err
+	}
+
+	switch l.Legacy {
+	case LegacyAllow:
+		return access{}, in, nil
+	case LegacyReadOnly:
+		return access{readOnly: true}, in, nil
+	}
+	return access{}, nil, ErrUnauthorized
+}
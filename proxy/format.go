@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Encoding of the samples a listener sends its clients. Clients choose a
+// format by connecting to the listener serving it.
+type SampleFormat int
+
+const (
+	FormatU8  SampleFormat = iota // Unsigned 8-bit IQ, as sent by rtl_tcp.
+	FormatU4                      // 4-bit IQ packed by rtltcp.Pack4.
+	FormatS16                     // Signed 16-bit little-endian IQ.
+	FormatF32                     // 32-bit little-endian float IQ between -1 and 1.
+)
+
+// Magic numbers of the headers sent in FormatS16 and FormatF32, so clients
+// expecting 8-bit samples, including those of the rtltcp package, reject
+// the stream rather than misread it.
+var (
+	S16Magic = [...]byte{'R', 'S', '1', '6'}
+	F32Magic = [...]byte{'R', 'F', '3', '2'}
+)
+
+// Returns the magic number announcing f in place of the upstream's, false
+// for FormatU8, which keeps it.
+func (f SampleFormat) magic() ([4]byte, bool) {
+	switch f {
+	case FormatU4:
+		return rtltcp.PackedMagic, true
+	case FormatS16:
+		return S16Magic, true
+	case FormatF32:
+		return F32Magic, true
+	}
+	return [4]byte{}, false
+}
+
+func (f SampleFormat) String() string {
+	switch f {
+	case FormatU8:
+		return "u8"
+	case FormatU4:
+		return "u4"
+	case FormatS16:
+		return "s16"
+	case FormatF32:
+		return "f32"
+	}
+	return fmt.Sprintf("SampleFormat(%d)", int(f))
+}
+
+// Parses a format name as returned by String.
+func ParseSampleFormat(s string) (SampleFormat, error) {
+	for _, f := range []SampleFormat{FormatU8, FormatU4, FormatS16, FormatF32} {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sample format %q", s)
+}
+
+// Part of the upstream stream a client receives.
+type channel struct {
+	decim  int
+	offset float64 // Hz from the center frequency.
+	rate   float64 // Upstream sample rate, only needed when offset is set.
+}
+
+// Re-encodes one client's stream, holding filter state across blocks.
+type converter struct {
+	format SampleFormat
+	ddc    *dsp.DDC
+	dither uint32 // State of the FormatU4 dither generator.
+
+	iq, channel []complex64
+	samples     []byte // Decimated u8 samples for FormatU4.
+	out         []byte
+}
+
+// Returns a converter to format selecting ch, or nil if the upstream stream
+// needs no conversion.
+func newConverter(format SampleFormat, ch channel) *converter {
+	if ch.decim < 1 {
+		ch.decim = 1
+	}
+	if format == FormatU8 && ch.decim == 1 && ch.offset == 0 {
+		return nil
+	}
+
+	c := &converter{format: format, dither: 1}
+	if ch.decim > 1 || ch.offset != 0 {
+		c.ddc = dsp.NewDDC(ch.offset, ch.rate, ch.decim)
+	}
+	return c
+}
+
+// Converts a block of upstream u8 samples. The result is valid until the
+// next call.
+func (c *converter) convert(src []byte) []byte {
+	if c.format == FormatU4 && c.ddc == nil {
+		c.out = rtltcp.Pack4(c.out[:0], src, &c.dither)
+		return c.out
+	}
+
+	c.iq = dsp.ConvertU8(c.iq[:0], src)
+	iq := c.iq
+	if c.ddc != nil {
+		c.channel = c.ddc.Process(c.channel[:0], c.iq)
+		iq = c.channel
+	}
+
+	c.out = c.out[:0]
+	switch c.format {
+	case FormatU8, FormatU4:
+		c.samples = c.samples[:0]
+		for _, s := range iq {
+			c.samples = append(c.samples, toU8(real(s)), toU8(imag(s)))
+		}
+		if c.format == FormatU8 {
+			c.out = append(c.out, c.samples...)
+		} else {
+			c.out = rtltcp.Pack4(c.out, c.samples, &c.dither)
+		}
+	case FormatS16:
+		for _, s := range iq {
+			c.out = binary.LittleEndian.AppendUint16(c.out, uint16(toS16(real(s))))
+			c.out = binary.LittleEndian.AppendUint16(c.out, uint16(toS16(imag(s))))
+		}
+	case FormatF32:
+		for _, s := range iq {
+			c.out = binary.LittleEndian.AppendUint32(c.out, math.Float32bits(real(s)))
+			c.out = binary.LittleEndian.AppendUint32(c.out, math.Float32bits(imag(s)))
+		}
+	}
+	return c.out
+}
+
+func toU8(x float32) byte {
+	v := math.Round(float64(x)*127.5 + 127.5)
+	return byte(math.Max(0, math.Min(255, v)))
+}
+
+func toS16(x float32) int16 {
+	v := math.Round(float64(x) * 32767)
+	return int16(math.Max(-32768, math.Min(32767, v)))
+}
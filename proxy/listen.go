@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/rtlsdr"
+)
+
+// Listens on addr, a TCP address or a unix socket as parsed by
+// rtltcp.ParseAddr. A socket file left behind by a previous process is
+// replaced if nothing is listening on it, and removed when the listener is
+// closed.
+func Listen(addr string) (net.Listener, error) {
+	network, address := rtltcp.ParseAddr(addr)
+	if network == "unix" {
+		removeStale(address)
+	}
+	return net.Listen(network, address)
+}
+
+func removeStale(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		// In use, listening fails.
+		conn.Close()
+		return
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		os.Remove(path)
+	}
+}
+
+// Dials addr as parsed by rtltcp.ParseAddr, or opens the local dongle
+// addressed by an rtlsdr:// address, see rtlsdr.OpenAddr.
+func dial(addr string) (net.Conn, error) {
+	if strings.HasPrefix(addr, "rtlsdr://") {
+		return rtlsdr.Dial(addr)
+	}
+	network, address := rtltcp.ParseAddr(addr)
+	return net.DialTimeout(network, address, dialTimeout)
+}
@@ -0,0 +1,647 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Defaults for Relay.
+const (
+	DefaultQueueDepth        = 64 // Blocks.
+	DefaultReconnectInterval = 5 * time.Second
+	DefaultHistogramWindow   = 1 << 22 // Bytes, about a second at 2 MS/s.
+)
+
+// Time allowed for connecting upstream.
+const dialTimeout = 10 * time.Second
+
+// Time allowed for a client's TLS handshake.
+const handshakeTimeout = 10 * time.Second
+
+// Sample rate rtl_tcp starts with, until a client sets one.
+const defaultSampleRate = 2048000
+
+// Bounds on the channels a client may select. Decimation is capped so the
+// DDC's filter stays small and the channel rate stays usable.
+const (
+	maxChannelDecimation = 256
+	minChannelRate       = 4000 // Hz.
+)
+
+// Treatment of clients whose queue fills because they read slower than the
+// upstream delivers, or than their MaxClientRate allows.
+type SlowPolicy int
+
+const (
+	SlowDrop       SlowPolicy = iota // Drop blocks while the queue is full.
+	SlowDisconnect                   // Disconnect the client once its queue is full.
+	SlowDecimate                     // Drop every other block while the queue is over half full.
+)
+
+func (p SlowPolicy) String() string {
+	switch p {
+	case SlowDrop:
+		return "drop"
+	case SlowDisconnect:
+		return "disconnect"
+	case SlowDecimate:
+		return "decimate"
+	}
+	return fmt.Sprintf("SlowPolicy(%d)", int(p))
+}
+
+// Parses a policy name as returned by String.
+func ParseSlowPolicy(s string) (SlowPolicy, error) {
+	for _, p := range []SlowPolicy{SlowDrop, SlowDisconnect, SlowDecimate} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown slow client policy %q", s)
+}
+
+// ErrRelayClosed is returned by a relay's Serve and ServeConn after Close.
+var ErrRelayClosed = errors.New("proxy: relay closed")
+
+// Relay shares one upstream rtl_tcp connection among any number of clients.
+// Every client receives the upstream header followed by the live sample
+// stream, and commands from any client are forwarded upstream. Clients which
+// fall more than QueueDepth blocks behind are handled according to
+// SlowClients rather than stalling the others, so memory per client is
+// bounded by the queue.
+//
+// The upstream connection is made once the relay starts serving and is
+// re-established if lost, re-issuing the latest command of each kind.
+type Relay struct {
+	Upstream          string        // Address of the rtl_tcp server, see rtltcp.ParseAddr.
+	BlockSize         int           // Bytes per block, DefaultBlockSize if zero.
+	QueueDepth        int           // Blocks queued per client, DefaultQueueDepth if zero.
+	ReconnectInterval time.Duration // DefaultReconnectInterval if zero.
+	ReadOnly          bool          // Discard client commands.
+	MaxClientRate     int           // Bytes per second sent to each client, unlimited if zero.
+	SlowClients       SlowPolicy
+	// Bytes of upstream samples covered by each histogram of Status,
+	// DefaultHistogramWindow if zero.
+	HistogramWindow int
+
+	once      sync.Once
+	wg        sync.WaitGroup
+	ready     chan struct{} // Closed once the upstream header is known.
+	done      chan struct{} // Closed by Close.
+	mu        sync.Mutex
+	closed    bool
+	header    []byte
+	upstream  net.Conn
+	settings  map[uint32][]byte // Latest command of each kind.
+	clients   map[*relayClient]struct{}
+	listeners map[net.Listener]struct{}
+	hist      rtltcp.Histogram  // Of the window being accumulated.
+	lastHist  *rtltcp.Histogram // Of the last complete window.
+
+	dongleChanges    uint64 // Reconnections finding a different dongle.
+	lastDongleChange string
+}
+
+type relayClient struct {
+	conn  net.Conn
+	queue chan []byte
+	once  sync.Once
+	done  chan struct{}
+
+	sent uint64 // Bytes written, updated atomically.
+
+	// Guarded by the relay's mu.
+	connected time.Time
+	readOnly  bool
+	dropped   uint64
+	skip      bool // Decimating, the next block is dropped.
+	commands  uint64
+	last      *LogEntry
+	offset    int32  // Requested channel offset in Hz.
+	decim     uint32 // Requested channel decimation, the listener's if zero.
+}
+
+func (c *relayClient) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (r *Relay) init() {
+	r.once.Do(func() {
+		r.ready = make(chan struct{})
+		r.done = make(chan struct{})
+		r.settings = make(map[uint32][]byte)
+		r.clients = make(map[*relayClient]struct{})
+		r.listeners = make(map[net.Listener]struct{})
+
+		r.wg.Add(1)
+		go r.run()
+	})
+}
+
+// Listens on addr, which may be a unix socket, see Listen, and serves
+// clients.
+func (r *Relay) ListenAndServe(addr string) error {
+	l, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	return r.Serve(l)
+}
+
+// Serves clients concurrently until l fails or the relay is closed. The
+// listener is closed on return. If l is a *Listener its access policy is
+// applied to each client.
+func (r *Relay) Serve(l net.Listener) error {
+	r.init()
+	defer l.Close()
+	policy, _ := l.(*Listener)
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRelayClosed
+	}
+	r.listeners[l] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.listeners, l)
+		r.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-r.done:
+				return ErrRelayClosed
+			default:
+				return err
+			}
+		}
+
+		// Sessions are only added while open, so Close can wait for them.
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			return ErrRelayClosed
+		}
+		r.wg.Add(1)
+		r.mu.Unlock()
+
+		go func() {
+			defer r.wg.Done()
+			if err := r.serve(conn, policy); err != nil && err != ErrRelayClosed {
+				log.Printf("relay client %s: %s", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// Relays the stream to a client until it disconnects or the relay is
+// closed.
+func (r *Relay) ServeConn(conn net.Conn) error {
+	return r.serve(conn, nil)
+}
+
+func (r *Relay) serve(conn net.Conn, policy *Listener) error {
+	r.init()
+	defer conn.Close()
+
+	if tc, ok := conn.(*tls.Conn); ok {
+		tc.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tc.Handshake(); err != nil {
+			return fmt.Errorf("Error negotiating TLS: %s", err)
+		}
+		tc.SetDeadline(time.Time{})
+	}
+
+	acc, in, err := policy.authenticate(conn)
+	if err != nil {
+		return err
+	}
+	readOnly := r.ReadOnly || acc.readOnly
+	format := FormatU8
+	if policy != nil {
+		format = policy.Format
+	}
+
+	select {
+	case <-r.ready:
+	case <-r.done:
+		return ErrRelayClosed
+	}
+
+	depth := r.QueueDepth
+	if depth <= 0 {
+		depth = DefaultQueueDepth
+	}
+	c := &relayClient{
+		conn:      conn,
+		queue:     make(chan []byte, depth),
+		done:      make(chan struct{}),
+		connected: time.Now(),
+		readOnly:  readOnly,
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRelayClosed
+	}
+	r.clients[c] = struct{}{}
+	header := r.header
+	r.mu.Unlock()
+
+	log.Printf("relay client %s connected", conn.RemoteAddr())
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, c)
+		r.mu.Unlock()
+		c.close()
+		log.Printf("relay client %s disconnected", conn.RemoteAddr())
+	}()
+
+	// Commands flow client to upstream.
+	go func() {
+		defer c.close()
+		cmd := make([]byte, rtltcp.CommandLen)
+		for {
+			if _, err := io.ReadFull(in, cmd); err != nil {
+				return
+			}
+			var command rtltcp.Command
+			command.Decode(cmd)
+			r.mu.Lock()
+			c.commands++
+			c.last = &LogEntry{
+				Time:      time.Now(),
+				Offset:    int64(atomic.LoadUint64(&c.sent)),
+				Opcode:    command.Opcode,
+				Parameter: command.Parameter,
+			}
+			// Channel selection only affects this client, so is
+			// allowed even when read-only. Out of range requests are
+			// ignored.
+			switch rate := r.sampleRate(); command.Opcode {
+			case rtltcp.CmdChannelOffset:
+				if off := int32(command.Parameter); math.Abs(float64(off)) <= rate/2 {
+					c.offset = off
+				} else {
+					log.Printf("relay client %s: ignoring channel offset %d", conn.RemoteAddr(), off)
+				}
+			case rtltcp.CmdChannelDecimation:
+				if d := command.Parameter; d <= maxChannelDecimation && (d == 0 || rate/float64(d) >= minChannelRate) {
+					c.decim = d
+				} else {
+					log.Printf("relay client %s: ignoring channel decimation %d", conn.RemoteAddr(), d)
+				}
+			}
+			r.mu.Unlock()
+
+			if command.Opcode == rtltcp.CmdChannelOffset || command.Opcode == rtltcp.CmdChannelDecimation {
+				continue
+			}
+			if !readOnly {
+				r.forward(append([]byte(nil), cmd...))
+			}
+		}
+	}()
+
+	if magic, ok := format.magic(); ok {
+		header = append(magic[:], header[len(magic):]...)
+	}
+	n, err := conn.Write(header)
+	atomic.AddUint64(&c.sent, uint64(n))
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	ch := r.channel(c, policy)
+	r.mu.Unlock()
+	conv := newConverter(format, ch)
+
+	// Earliest time the next block may be sent when throttled.
+	var next time.Time
+	for {
+		select {
+		case buf := <-c.queue:
+			r.mu.Lock()
+			want := r.channel(c, policy)
+			r.mu.Unlock()
+			if want != ch {
+				ch, conv = want, newConverter(format, want)
+			}
+			if conv != nil {
+				buf = conv.convert(buf)
+			}
+			n, err := conn.Write(buf)
+			atomic.AddUint64(&c.sent, uint64(n))
+			if err != nil {
+				return err
+			}
+
+			if r.MaxClientRate <= 0 {
+				continue
+			}
+			if now := time.Now(); next.Before(now) {
+				next = now
+			}
+			next = next.Add(time.Duration(float64(n) / float64(r.MaxClientRate) * float64(time.Second)))
+			select {
+			case <-time.After(time.Until(next)):
+			case <-c.done:
+				return nil
+			case <-r.done:
+				return nil
+			}
+		case <-c.done:
+			return nil
+		case <-r.done:
+			return nil
+		}
+	}
+}
+
+// Returns the channel c receives under its listener's policy, which may be
+// nil. The caller must hold r.mu.
+func (r *Relay) channel(c *relayClient, policy *Listener) (ch channel) {
+	if policy != nil {
+		ch.decim = policy.Decimation
+	}
+	if c.decim > 0 {
+		ch.decim = int(c.decim)
+	}
+	if c.offset != 0 {
+		ch.offset = float64(c.offset)
+		ch.rate = r.sampleRate()
+	}
+	return ch
+}
+
+// Returns the upstream's sample rate, as last set by a client. The caller
+// must hold r.mu.
+func (r *Relay) sampleRate() float64 {
+	if cmd, ok := r.settings[uint32(rtltcp.SampleRate)<<16]; ok {
+		return float64(binary.BigEndian.Uint32(cmd[1:]))
+	}
+	return defaultSampleRate
+}
+
+// Returns the key of settings cmd replaces its predecessor under, IF gain
+// being set per stage.
+func settingKey(cmd []byte) uint32 {
+	key := uint32(cmd[0]) << 16
+	if cmd[0] == rtltcp.TunerIfGain {
+		key |= binary.BigEndian.Uint32(cmd[1:]) >> 16
+	}
+	return key
+}
+
+// Records cmd as the latest of its kind and sends it upstream if connected.
+func (r *Relay) forward(cmd []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings[settingKey(cmd)] = cmd
+	if r.upstream != nil {
+		if _, err := r.upstream.Write(cmd); err != nil {
+			// The reader notices the failure and reconnects.
+			r.upstream.Close()
+		}
+	}
+}
+
+// Maintains the upstream connection, distributing its blocks to clients.
+func (r *Relay) run() {
+	defer r.wg.Done()
+
+	interval := r.ReconnectInterval
+	if interval <= 0 {
+		interval = DefaultReconnectInterval
+	}
+
+	for {
+		if err := r.connect(); err != nil {
+			log.Printf("relay upstream %s: %s", r.Upstream, err)
+		} else {
+			r.mu.Lock()
+			conn := r.upstream
+			r.mu.Unlock()
+
+			err := r.pump(conn)
+			r.mu.Lock()
+			r.upstream = nil
+			r.mu.Unlock()
+			conn.Close()
+
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			log.Printf("relay upstream %s lost: %s", r.Upstream, err)
+		}
+
+		select {
+		case <-r.done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Dials upstream, reads its header and re-issues previous commands.
+func (r *Relay) connect() error {
+	conn, err := dial(r.Upstream)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		conn.Close()
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		conn.Close()
+		return ErrRelayClosed
+	}
+	if r.header != nil && !bytes.Equal(header[4:], r.header[4:]) {
+		r.dongleChanged(header)
+	}
+
+	keys := make([]uint32, 0, len(r.settings))
+	for key := range r.settings {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, key := range keys {
+		if _, err := conn.Write(r.settings[key]); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	if r.header == nil {
+		close(r.ready)
+	}
+	r.header = header
+	r.upstream = conn
+	log.Printf("relay upstream %s connected", r.Upstream)
+
+	return nil
+}
+
+// Revalidates the settings of the previous dongle against the one
+// described by header, so they're restored as the new dongle accepts them.
+// Clients connected before keep the header they were sent. The caller
+// must hold mu.
+func (r *Relay) dongleChanged(header []byte) {
+	var old, info rtltcp.DongleInfo
+	binary.Read(bytes.NewReader(r.header), binary.BigEndian, &old)
+	binary.Read(bytes.NewReader(header), binary.BigEndian, &info)
+
+	cmds := make([]rtltcp.Command, 0, len(r.settings))
+	for _, b := range r.settings {
+		var cmd rtltcp.Command
+		cmd.Decode(b)
+		cmds = append(cmds, cmd)
+	}
+	valid, adjusted := rtltcp.Revalidate(info, nil, cmds)
+	r.settings = make(map[uint32][]byte, len(valid))
+	for _, cmd := range valid {
+		b := make([]byte, rtltcp.CommandLen)
+		cmd.Encode(b)
+		r.settings[settingKey(b)] = b
+	}
+
+	change := rtltcp.DongleChange{Old: old, New: info, Adjusted: adjusted}
+	r.dongleChanges++
+	r.lastDongleChange = change.String()
+	log.Printf("relay upstream %s: %s", r.Upstream, change)
+}
+
+// Reads blocks from upstream and queues them to every client until reading
+// fails.
+func (r *Relay) pump(conn net.Conn) error {
+	size := r.BlockSize
+	if size <= 0 {
+		size = DefaultBlockSize
+	}
+
+	for {
+		// Each block is shared read-only by all clients.
+		buf := make([]byte, size)
+		n, err := io.ReadFull(conn, buf)
+		if n > 0 {
+			r.mu.Lock()
+			for c := range r.clients {
+				r.enqueue(c, buf[:n])
+			}
+			r.histogram(buf[:n])
+			r.mu.Unlock()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Counts buf into the current histogram, completing the window once full.
+// Called with mu held.
+func (r *Relay) histogram(buf []byte) {
+	window := r.HistogramWindow
+	if window <= 0 {
+		window = DefaultHistogramWindow
+	}
+	r.hist.Add(buf)
+	if 2*r.hist.Samples() >= uint64(window) {
+		last := r.hist
+		r.lastHist = &last
+		r.hist.Reset()
+	}
+}
+
+// Queues a block to a client, applying the slow client policy. Called with
+// mu held.
+func (r *Relay) enqueue(c *relayClient, buf []byte) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	if r.SlowClients == SlowDecimate && len(c.queue) > cap(c.queue)/2 {
+		if c.skip = !c.skip; c.skip {
+			c.dropped++
+			return
+		}
+	}
+
+	select {
+	case c.queue <- buf:
+	default:
+		c.dropped++
+		if r.SlowClients == SlowDisconnect {
+			log.Printf("relay client %s too slow, disconnecting", c.conn.RemoteAddr())
+			c.close()
+		}
+	}
+}
+
+// Returns the number of connected clients.
+func (r *Relay) Clients() int {
+	r.init()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.clients)
+}
+
+// Stops accepting clients, disconnects all clients and the upstream, and
+// waits for their sessions to end.
+func (r *Relay) Close() error {
+	r.init()
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	for l := range r.listeners {
+		l.Close()
+	}
+	for c := range r.clients {
+		c.close()
+	}
+	if r.upstream != nil {
+		r.upstream.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return nil
+}
@@ -0,0 +1,604 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Serves an rtl_tcp header followed by an endless stream of fill bytes,
+// reporting received commands on cmds.
+func fakeUpstream(t *testing.T, fill byte, cmds chan<- []byte) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte{'R', 'T', 'L', '0', 0, 0, 0, 5, 0, 0, 0, 29})
+				go func() {
+					for {
+						cmd := make([]byte, rtltcp.CommandLen)
+						if _, err := io.ReadFull(conn, cmd); err != nil {
+							return
+						}
+						cmds <- cmd
+					}
+				}()
+				block := bytes.Repeat([]byte{fill}, 4096)
+				for {
+					if _, err := conn.Write(block); err != nil {
+						return
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestRelay(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	r := &Relay{Upstream: fakeUpstream(t, 7, cmds), BlockSize: 1024}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- r.Serve(l) }()
+
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		clients = append(clients, conn)
+
+		buf := make([]byte, headerLen+1024)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:4]) != "RTL0" || buf[headerLen] != 7 {
+			t.Fatalf("client %d received %q", i, buf[:headerLen+1])
+		}
+	}
+
+	cmd := []byte{rtltcp.CenterFreq, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(cmd[1:], 433920000)
+	clients[1].Write(cmd)
+	select {
+	case got := <-cmds:
+		if !bytes.Equal(got, cmd) {
+			t.Errorf("upstream received %v, want %v", got, cmd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("command not forwarded upstream")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != ErrRelayClosed {
+		t.Errorf("Serve returned %v, want ErrRelayClosed", err)
+	}
+	clients[0].SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.Copy(io.Discard, clients[0]); err != nil {
+		t.Errorf("client not disconnected on close: %s", err)
+	}
+}
+
+func TestRelayAuth(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	r := &Relay{Upstream: fakeUpstream(t, 7, cmds), BlockSize: 1024}
+	defer r.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Listener{Listener: ln, Token: "secret", Legacy: LegacyReadOnly, AuthTimeout: 100 * time.Millisecond}
+	go r.Serve(l)
+
+	// Returns the first byte after the header, or an error if the client
+	// was disconnected.
+	session := func(token string, cmd []byte) (byte, error) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if token != "" {
+			rtltcp.WriteAuth(conn, token)
+		}
+		if cmd != nil {
+			conn.Write(cmd)
+		}
+		buf := make([]byte, headerLen+1)
+		_, err = io.ReadFull(conn, buf)
+		return buf[headerLen], err
+	}
+
+	if _, err := session("wrong", nil); err == nil {
+		t.Error("client with wrong token was served")
+	}
+	if b, err := session("secret", []byte{rtltcp.SampleRate, 0, 0x24, 0x9f, 0}); err != nil || b != 7 {
+		t.Errorf("authenticated client: %v", err)
+	}
+	select {
+	case <-cmds:
+	case <-time.After(time.Second):
+		t.Error("authenticated command not forwarded")
+	}
+
+	if b, err := session("", []byte{rtltcp.CenterFreq, 0, 0, 0, 1}); err != nil || b != 7 {
+		t.Errorf("legacy client: %v", err)
+	}
+	select {
+	case cmd := <-cmds:
+		t.Errorf("read only legacy command %v forwarded", cmd)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestListenerACL(t *testing.T) {
+	allow, err := ParsePrefixes([]string{"10.0.0.0/8", "192.168.1.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deny, err := ParsePrefixes([]string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Listener{Allow: allow, Deny: deny}
+	for addr, want := range map[string]bool{
+		"10.2.3.4":    true,
+		"10.1.2.3":    false,
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+	} {
+		if got := l.permitted(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("permitted(%s) = %v, want %v", addr, got, want)
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = &Listener{Listener: ln, MaxPerIP: 1}
+	defer l.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	first := dial()
+	defer first.Close()
+	served := <-accepted
+
+	second := dial()
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("connection over limit not refused: %v", err)
+	}
+
+	served.Close()
+	third := dial()
+	defer third.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Error("connection not accepted after another closed")
+	}
+}
+
+func TestRelayStats(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	r := &Relay{Upstream: fakeUpstream(t, 7, cmds), BlockSize: 1024, HistogramWindow: 2048}
+	defer r.Close()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go r.ServeConn(server)
+
+	if _, err := io.ReadFull(client, make([]byte, headerLen+4096)); err != nil {
+		t.Fatal(err)
+	}
+	client.Write([]byte{rtltcp.CenterFreq, 0x05, 0xf5, 0xe1, 0x00})
+	<-cmds
+
+	rec := httptest.NewRecorder()
+	r.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	var status RelayStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Connected || len(status.Clients) != 1 {
+		t.Fatalf("status = %+v", status)
+	}
+	c := status.Clients[0]
+	// The last block's write may not have been counted yet.
+	if c.BytesSent < headerLen+3072 || c.Commands != 1 {
+		t.Errorf("client stats = %+v", c)
+	}
+	if c.LastCommand == nil || c.LastCommand.Opcode != rtltcp.CenterFreq || c.LastCommand.Parameter != 100e6 {
+		t.Errorf("last command = %+v", c.LastCommand)
+	}
+
+	// Too short a window to judge bits, but far from centered.
+	if s := status.Samples; s == nil || s.OffsetI != -120.5 || len(s.Problems) != 1 {
+		t.Errorf("samples = %+v", status.Samples)
+	}
+}
+
+func TestRelaySlowClients(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	upstream := fakeUpstream(t, 7, cmds)
+
+	// Throttled to 64 kB/s, a client reading as fast as it can receives
+	// roughly 16 kB in a quarter second.
+	throttled := &Relay{Upstream: upstream, BlockSize: 1024, MaxClientRate: 64 << 10}
+	defer throttled.Close()
+	client, server := net.Pipe()
+	defer client.Close()
+	go throttled.ServeConn(server)
+
+	var n int
+	buf := make([]byte, 1024)
+	client.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+	for {
+		m, err := client.Read(buf)
+		n += m
+		if err != nil {
+			break
+		}
+	}
+	if n -= headerLen; n < 8<<10 || n > 24<<10 {
+		t.Errorf("throttled client received %d bytes in 250ms", n)
+	}
+
+	// A client which stops reading is disconnected once its queue fills.
+	strict := &Relay{Upstream: upstream, BlockSize: 1024, QueueDepth: 4, SlowClients: SlowDisconnect}
+	defer strict.Close()
+	client, server = net.Pipe()
+	defer client.Close()
+	go strict.ServeConn(server)
+
+	time.Sleep(100 * time.Millisecond)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.Copy(io.Discard, client); err != nil {
+		t.Errorf("slow client not disconnected: %s", err)
+	}
+}
+
+func TestRelayPack4(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	r := &Relay{Upstream: fakeUpstream(t, 0x77, cmds), BlockSize: 1024}
+	defer r.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Serve(&Listener{Listener: ln, Format: FormatU4})
+
+	sdr := rtltcp.SDR{Flags: rtltcp.Flags{ServerAddr: ln.Addr().String()}}
+	if err := sdr.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+
+	blk, err := sdr.ReadBlock(make([]byte, 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range blk.Samples {
+		if s != 0x68 && s != 0x78 {
+			t.Fatalf("sample %d of 0x77 unpacked as %#x", i, s)
+		}
+	}
+}
+
+func TestRelayFormatMagic(t *testing.T) {
+	r := &Relay{Upstream: fakeUpstream(t, 0x77, make(chan []byte, 4)), BlockSize: 1024}
+	defer r.Close()
+
+	for _, test := range []struct {
+		format SampleFormat
+		magic  string
+	}{
+		{FormatU8, "RTL0"},
+		{FormatU4, string(rtltcp.PackedMagic[:])},
+		{FormatS16, string(S16Magic[:])},
+		{FormatF32, string(F32Magic[:])},
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go r.Serve(&Listener{Listener: ln, Format: test.format})
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := make([]byte, 12)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if string(header[:4]) != test.magic || !bytes.Equal(header[4:], []byte{0, 0, 0, 5, 0, 0, 0, 29}) {
+			t.Errorf("%s header % x", test.format, header)
+		}
+	}
+}
+
+func TestRelayChannel(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	r := &Relay{Upstream: fakeUpstream(t, 0x77, cmds), BlockSize: 1024, ReadOnly: true}
+	defer r.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Serve(&Listener{Listener: ln})
+
+	sdr := rtltcp.SDR{Flags: rtltcp.Flags{ServerAddr: ln.Addr().String()}}
+	if err := sdr.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if err := sdr.SetChannel(-1000, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// Applied even though the relay is read-only, and never forwarded.
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := r.Stats()
+		if len(stats) == 1 && stats[0].ChannelOffset == -1000 && stats[0].ChannelDecimation == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("channel not selected: %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case cmd := <-cmds:
+		t.Errorf("forwarded % x upstream", cmd)
+	default:
+	}
+
+	// Shifted and filtered, so the constant upstream signal no longer is.
+	var blk rtltcp.Block
+	for i := 0; i < 8; i++ {
+		if blk, err = sdr.ReadBlock(make([]byte, 4096)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	varies := false
+	for _, s := range blk.Samples {
+		varies = varies || s != blk.Samples[0]
+	}
+	if !varies {
+		t.Errorf("channel samples constant at %#x", blk.Samples[0])
+	}
+}
+
+func TestRelayChannelBounds(t *testing.T) {
+	r := &Relay{Upstream: fakeUpstream(t, 0x77, make(chan []byte, 4)), BlockSize: 1024}
+	defer r.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Serve(&Listener{Listener: ln})
+
+	sdr := rtltcp.SDR{Flags: rtltcp.Flags{ServerAddr: ln.Addr().String()}}
+	if err := sdr.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if err := sdr.SetChannel(defaultSampleRate, 0xFFFFFFFF); err != nil {
+		t.Fatal(err)
+	}
+	if err := sdr.SetChannel(0, defaultSampleRate/minChannelRate+1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both requests are ignored and the relay keeps serving.
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := r.Stats()
+		if len(stats) == 1 && stats[0].Commands == 4 {
+			if stats[0].ChannelOffset != 0 || stats[0].ChannelDecimation != 0 {
+				t.Errorf("out of range channel selected: %+v", stats[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("commands not received: %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 8; i++ {
+		if _, err := sdr.ReadBlock(make([]byte, 4096)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConverter(t *testing.T) {
+	src := bytes.Repeat([]byte{255, 0}, 4096)
+
+	c := newConverter(FormatF32, channel{decim: 4})
+	var out []byte
+	for i := 0; i < 4; i++ {
+		out = append(out, c.convert(src)...)
+	}
+	// The filter may hold back up to a block of its own.
+	if want := 4 * len(src) / 2 / 4 * 8; len(out) > want || len(out) < want-1024 || len(out)%8 != 0 {
+		t.Fatalf("decimated to %d bytes, want about %d", len(out), want)
+	}
+	// Past the filter's transient DC passes unchanged.
+	last := out[len(out)-8:]
+	i := math.Float32frombits(binary.LittleEndian.Uint32(last))
+	q := math.Float32frombits(binary.LittleEndian.Uint32(last[4:]))
+	if math.Abs(float64(i-1)) > 1e-3 || math.Abs(float64(q+1)) > 1e-3 {
+		t.Errorf("f32 sample = (%f, %f), want (1, -1)", i, q)
+	}
+
+	out = newConverter(FormatS16, channel{}).convert(src[:4])
+	if got := int16(binary.LittleEndian.Uint16(out)); len(out) != 8 || got != 32767 {
+		t.Errorf("s16 = %v", out)
+	}
+}
+
+// Returns a self-signed certificate for 127.0.0.1 and a pool trusting it.
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestRelayTLS(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	r := &Relay{Upstream: fakeUpstream(t, 7, cmds), BlockSize: 1024}
+	defer r.Close()
+
+	cert, pool := selfSigned(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Serve(&Listener{Listener: ln, TLS: &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}})
+
+	connect := func(clientCert bool) error {
+		sdr := rtltcp.SDR{
+			Flags: rtltcp.Flags{ServerAddr: ln.Addr().String()},
+			TLS:   &tls.Config{RootCAs: pool},
+		}
+		if clientCert {
+			sdr.TLS.Certificates = []tls.Certificate{cert}
+		}
+		if err := sdr.Connect(nil); err != nil {
+			return err
+		}
+		defer sdr.Close()
+		_, err := sdr.ReadBlock(make([]byte, 1024))
+		return err
+	}
+
+	if err := connect(true); err != nil {
+		t.Errorf("client with certificate: %s", err)
+	}
+	if err := connect(false); err == nil {
+		t.Error("client without certificate was served")
+	}
+}
+
+func TestRelayUnix(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	r := &Relay{Upstream: fakeUpstream(t, 7, cmds), BlockSize: 1024}
+	defer r.Close()
+
+	// Leave a stale socket behind, as a crashed process would.
+	path := filepath.Join(t.TempDir(), "relay.sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Serve(l)
+
+	sdr := rtltcp.SDR{Flags: rtltcp.Flags{ServerAddr: "unix:" + path}}
+	if err := sdr.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if blk, err := sdr.ReadBlock(make([]byte, 1024)); err != nil || blk.Samples[0] != 7 {
+		t.Errorf("read over unix socket: %v", err)
+	}
+}
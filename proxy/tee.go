@@ -0,0 +1,217 @@
+// Package proxy provides servers which sit between rtl_tcp and its clients.
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Length of rtl_tcp's dongle information header.
+const headerLen = 12
+
+// Default bytes per block delivered to the tee's sink.
+const DefaultBlockSize = 16384
+
+// An entry in a tee's command log.
+type LogEntry struct {
+	Time      time.Time `json:"time"`
+	Offset    int64     `json:"offset"` // Stream byte offset at which the command was forwarded.
+	Opcode    uint8     `json:"opcode"`
+	Parameter uint32    `json:"parameter"`
+}
+
+func (e LogEntry) String() string {
+	return fmt.Sprintf("%s,%d,%d,%d", e.Time.UTC().Format(time.RFC3339Nano), e.Offset, e.Opcode, e.Parameter)
+}
+
+// Parses a command log written by Tee.
+func ReadLog(r io.Reader) (entries []LogEntry, err error) {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("command log line %d: expected 4 fields, got %d", line, len(fields))
+		}
+
+		var e LogEntry
+		var op, param uint64
+		e.Time, err = time.Parse(time.RFC3339Nano, fields[0])
+		if err == nil {
+			e.Offset, err = strconv.ParseInt(fields[1], 10, 64)
+		}
+		if err == nil {
+			op, err = strconv.ParseUint(fields[2], 10, 8)
+		}
+		if err == nil {
+			param, err = strconv.ParseUint(fields[3], 10, 32)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("command log line %d: %s", line, err)
+		}
+		e.Opcode, e.Parameter = uint8(op), uint32(param)
+
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Tee forwards a single rtl_tcp session between a client and an upstream
+// server without modification, while recording the sample stream to Sink
+// and every command the client sends to Log. Commands are also decoded to
+// tag recorded blocks with the client's tuning state.
+type Tee struct {
+	Upstream  string      // Address of the rtl_tcp server, see rtltcp.ParseAddr.
+	Sink      rtltcp.Sink // Optional sample recorder.
+	Log       io.Writer   // Optional command log, one LogEntry per line.
+	BlockSize int         // Bytes per recorded block, DefaultBlockSize if zero.
+
+	logMu sync.Mutex
+}
+
+// Listens on addr, which may be a unix socket, see Listen, and serves
+// clients.
+func (t *Tee) ListenAndServe(addr string) error {
+	l, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return t.Serve(l)
+}
+
+// Serves clients one at a time, as rtl_tcp does, until l fails.
+func (t *Tee) Serve(l net.Listener) error {
+	for {
+		client, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		if err := t.ServeConn(client); err != nil {
+			log.Printf("tee session from %s ended: %s", client.RemoteAddr(), err)
+		}
+	}
+}
+
+// Forwards a session between client and a new upstream connection until
+// either side disconnects.
+func (t *Tee) ServeConn(client net.Conn) error {
+	defer client.Close()
+
+	upstream, err := dial(t.Upstream)
+	if err != nil {
+		return fmt.Errorf("Error connecting to upstream: %s", err)
+	}
+	defer upstream.Close()
+
+	var (
+		offset int64
+		mu     sync.Mutex
+		state  rtltcp.Metadata
+	)
+
+	// Commands flow client to upstream.
+	go func() {
+		defer upstream.Close()
+		defer client.Close()
+
+		cmd := make([]byte, rtltcp.CommandLen)
+		for {
+			if _, err := io.ReadFull(client, cmd); err != nil {
+				return
+			}
+			if _, err := upstream.Write(cmd); err != nil {
+				return
+			}
+
+			var c rtltcp.Command
+			c.Decode(cmd)
+			e := LogEntry{
+				Time:      time.Now(),
+				Offset:    atomic.LoadInt64(&offset),
+				Opcode:    c.Opcode,
+				Parameter: c.Parameter,
+			}
+
+			mu.Lock()
+			switch e.Opcode {
+			case rtltcp.CenterFreq:
+				state.CenterFreq = e.Parameter
+			case rtltcp.SampleRate:
+				state.SampleRate = e.Parameter
+			case rtltcp.TunerGainMode:
+				state.AutoGain = e.Parameter == 0
+			case rtltcp.TunerGain:
+				state.Gain = e.Parameter
+			}
+			mu.Unlock()
+
+			t.writeLog(e)
+		}
+	}()
+
+	// Header and samples flow upstream to client.
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(upstream, header); err != nil {
+		return fmt.Errorf("Error reading upstream header: %s", err)
+	}
+	if _, err := client.Write(header); err != nil {
+		return err
+	}
+
+	size := t.BlockSize
+	if size <= 0 {
+		size = DefaultBlockSize
+	}
+	buf := make([]byte, size)
+	recording := t.Sink != nil
+
+	for {
+		n, err := io.ReadFull(upstream, buf)
+		if n > 0 {
+			if _, werr := client.Write(buf[:n]); werr != nil {
+				return werr
+			}
+
+			if recording {
+				mu.Lock()
+				blk := rtltcp.Block{Metadata: state, Samples: buf[:n], Index: uint64(atomic.LoadInt64(&offset)) / 2}
+				mu.Unlock()
+				blk.Received = time.Now()
+				blk.Timestamp = blk.Received.Add(-blk.Duration())
+
+				if werr := t.Sink.WriteBlock(blk); werr != nil {
+					log.Printf("tee recording stopped: %s", werr)
+					recording = false
+				}
+			}
+
+			atomic.AddInt64(&offset, int64(n))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (t *Tee) writeLog(e LogEntry) {
+	if t.Log == nil {
+		return
+	}
+
+	t.logMu.Lock()
+	defer t.logMu.Unlock()
+	if _, err := fmt.Fprintln(t.Log, e); err != nil {
+		log.Printf("tee command log: %s", err)
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Sink keeping the blocks written.
+type blockSink struct {
+	mu     sync.Mutex
+	data   []byte
+	blocks []rtltcp.Block
+}
+
+func (s *blockSink) WriteBlock(blk rtltcp.Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append(s.data, blk.Samples...)
+	blk.Samples = nil
+	s.blocks = append(s.blocks, blk)
+	return nil
+}
+
+func (s *blockSink) Close() error { return nil }
+
+// Writer safe to read while written.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTee(t *testing.T) {
+	cmds := make(chan []byte, 4)
+	sink := &blockSink{}
+	var cmdLog syncBuffer
+	tee := &Tee{Upstream: fakeUpstream(t, 7, cmds), Sink: sink, Log: &cmdLog, BlockSize: 1024}
+
+	client, server := net.Pipe()
+	served := make(chan error, 1)
+	go func() { served <- tee.ServeConn(server) }()
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(client, header); err != nil || string(header[:4]) != "RTL0" {
+		t.Fatalf("header %q: %v", header, err)
+	}
+	var received []byte
+	read := func(blocks int) {
+		buf := make([]byte, blocks*tee.BlockSize)
+		if _, err := io.ReadFull(client, buf); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, buf...)
+	}
+	read(4)
+
+	// Commands reach upstream unchanged, are logged and tag later blocks.
+	cmd := make([]byte, rtltcp.CommandLen)
+	rtltcp.Command{Opcode: rtltcp.CenterFreq, Parameter: 100e6}.Encode(cmd)
+	go client.Write(cmd)
+	if got := <-cmds; !bytes.Equal(got, cmd) {
+		t.Errorf("forwarded %x, want %x", got, cmd)
+	}
+	for deadline := time.Now().Add(time.Second); !strings.Contains(cmdLog.String(), ",1,100000000"); {
+		if time.Now().After(deadline) {
+			t.Fatalf("command log %q", cmdLog.String())
+		}
+		read(1)
+	}
+	read(2)
+
+	client.Close()
+	<-served
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if !bytes.Equal(sink.data, received) {
+		t.Errorf("recorded %d bytes, client received %d", len(sink.data), len(received))
+	}
+	if last := sink.blocks[len(sink.blocks)-1]; last.CenterFreq != 100e6 || last.Index != uint64(len(received)-tee.BlockSize)/2 {
+		t.Errorf("last block tuned to %d at %d", last.CenterFreq, last.Index)
+	}
+}
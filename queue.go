@@ -0,0 +1,117 @@
+package rtltcp
+
+import (
+	"errors"
+	"sync"
+)
+
+// Number of calls a CommandQueue holds when given a depth of zero.
+const DefaultCommandQueueDepth = 64
+
+var (
+	// Returned when a call finds the command queue full.
+	ErrQueueFull = errors.New("command queue full")
+	// Returned for calls made after the command queue is closed, or still
+	// queued when it was.
+	ErrQueueClosed = errors.New("command queue closed")
+)
+
+// CommandQueue makes calls on an SDR in order from a goroutine of its own,
+// so callers such as UI threads never block on socket writes over a slow
+// link. Each call returns a channel receiving the call's error once it's
+// made, which callers may wait on, select on or ignore.
+type CommandQueue struct {
+	sdr   *SDR
+	calls chan queuedCall
+	done  chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type queuedCall struct {
+	fn     func(*SDR) error
+	result chan error
+}
+
+// Starts a queue of up to depth calls on sdr, DefaultCommandQueueDepth if
+// zero.
+func NewCommandQueue(sdr *SDR, depth int) *CommandQueue {
+	if depth <= 0 {
+		depth = DefaultCommandQueueDepth
+	}
+	q := &CommandQueue{
+		sdr:   sdr,
+		calls: make(chan queuedCall, depth),
+		done:  make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Queues a call of fn, such as one setting the center frequency, after
+// those queued before it. Fails with ErrQueueFull rather than waiting for
+// room.
+func (q *CommandQueue) Do(fn func(*SDR) error) <-chan error {
+	result := make(chan error, 1)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		result <- ErrQueueClosed
+		return result
+	}
+	select {
+	case q.calls <- queuedCall{fn, result}:
+	default:
+		result <- ErrQueueFull
+	}
+	return result
+}
+
+// Queues a raw command. Like the setters' commands it's restored by
+// Restore, unlike them it leaves Metadata unchanged.
+func (q *CommandQueue) Execute(cmd Command) <-chan error {
+	return q.Do(func(sdr *SDR) error { return sdr.execute(cmd) })
+}
+
+// Returns the number of calls waiting to be made.
+func (q *CommandQueue) Pending() int {
+	return len(q.calls)
+}
+
+// Stops the queue without waiting for a call in progress. Calls still
+// queued fail with ErrQueueClosed. The SDR is left open.
+func (q *CommandQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+	return nil
+}
+
+func (q *CommandQueue) run() {
+	for {
+		select {
+		case c := <-q.calls:
+			select {
+			case <-q.done:
+				c.result <- ErrQueueClosed
+			default:
+				c.result <- c.fn(q.sdr)
+			}
+		case <-q.done:
+			// Calls are only queued before closing, so none follow these.
+			for {
+				select {
+				case c := <-q.calls:
+					c.result <- ErrQueueClosed
+				default:
+					return
+				}
+			}
+		}
+	}
+}
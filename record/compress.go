@@ -0,0 +1,201 @@
+package record
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Bytes compressed per job, large enough for good ratios and small enough
+// to bound the latency of data reaching disk.
+const compressChunkSize = 1 << 20
+
+// Codec compresses chunks independently. Concatenated compressed chunks
+// must decode as a single stream, which holds for multi-member gzip and
+// multi-frame zstd, so files are readable with the standard tools.
+type Codec interface {
+	// Extension appended to file names, including the leading dot.
+	Ext() string
+	Compress(dst io.Writer, src []byte) error
+}
+
+// Gzip compression at the given level, see compress/gzip.
+type Gzip int
+
+func (Gzip) Ext() string { return ".gz" }
+
+func (level Gzip) Compress(dst io.Writer, src []byte) error {
+	w, err := gzip.NewWriterLevel(dst, int(level))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Zstandard compression at the given level.
+type Zstd zstd.EncoderLevel
+
+func (Zstd) Ext() string { return ".zst" }
+
+func (level Zstd) Compress(dst io.Writer, src []byte) error {
+	w, err := zstd.NewWriter(dst, zstd.WithEncoderLevel(zstd.EncoderLevel(level)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+type compressResult struct {
+	data []byte
+	err  error
+}
+
+type compressJob struct {
+	data   []byte
+	result chan compressResult
+}
+
+// CompressWriter compresses written data on a pool of workers and writes
+// the results to the destination in order. Writes only block when every
+// worker is busy and the queue of pending chunks is full. Once a chunk
+// fails the chunks after it are dropped and writes fail.
+type CompressWriter struct {
+	dst   io.WriteCloser
+	codec Codec
+	buf   []byte
+
+	jobs  chan compressJob
+	order chan chan compressResult
+	done  chan struct{}
+
+	workers sync.WaitGroup
+	mu      sync.Mutex
+	err     error
+}
+
+// Returns a writer compressing to dst with the given number of workers,
+// one per CPU if zero. Closing the writer closes dst.
+func NewCompressWriter(dst io.WriteCloser, codec Codec, workers int) *CompressWriter {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	cw := &CompressWriter{
+		dst:   dst,
+		codec: codec,
+		buf:   make([]byte, 0, compressChunkSize),
+		jobs:  make(chan compressJob),
+		order: make(chan chan compressResult, 2*workers),
+		done:  make(chan struct{}),
+	}
+
+	cw.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go cw.work()
+	}
+	go cw.write()
+
+	return cw
+}
+
+func (cw *CompressWriter) work() {
+	defer cw.workers.Done()
+	for job := range cw.jobs {
+		var buf bytes.Buffer
+		err := cw.codec.Compress(&buf, job.data)
+		job.result <- compressResult{buf.Bytes(), err}
+	}
+}
+
+func (cw *CompressWriter) write() {
+	defer close(cw.done)
+	for result := range cw.order {
+		r := <-result
+		// Written chunks must follow on from each other.
+		if cw.getErr() != nil {
+			continue
+		}
+		err := r.err
+		if err == nil {
+			_, err = cw.dst.Write(r.data)
+		}
+		if err != nil {
+			cw.setErr(err)
+		}
+	}
+}
+
+func (cw *CompressWriter) setErr(err error) {
+	cw.mu.Lock()
+	if cw.err == nil {
+		cw.err = err
+	}
+	cw.mu.Unlock()
+}
+
+func (cw *CompressWriter) getErr() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.err
+}
+
+func (cw *CompressWriter) dispatch() {
+	job := compressJob{
+		data:   cw.buf,
+		result: make(chan compressResult, 1),
+	}
+	cw.order <- job.result
+	cw.jobs <- job
+	cw.buf = make([]byte, 0, compressChunkSize)
+}
+
+// Writes p, returning any error encountered writing earlier chunks.
+func (cw *CompressWriter) Write(p []byte) (n int, err error) {
+	if err := cw.getErr(); err != nil {
+		return 0, err
+	}
+
+	for len(p) > 0 {
+		c := copy(cw.buf[len(cw.buf):cap(cw.buf)], p)
+		cw.buf = cw.buf[:len(cw.buf)+c]
+		p = p[c:]
+		n += c
+
+		if len(cw.buf) == cap(cw.buf) {
+			if err := cw.getErr(); err != nil {
+				return n, err
+			}
+			cw.dispatch()
+		}
+	}
+
+	return n, nil
+}
+
+// Compresses any buffered data, waits for all chunks to be written and
+// closes the destination.
+func (cw *CompressWriter) Close() error {
+	if len(cw.buf) > 0 && cw.getErr() == nil {
+		cw.dispatch()
+	}
+	close(cw.jobs)
+	close(cw.order)
+	<-cw.done
+	cw.workers.Wait()
+
+	err := cw.getErr()
+	if cerr := cw.dst.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
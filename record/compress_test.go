@@ -0,0 +1,91 @@
+package record
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// Fails every write, counting them.
+type failWriter struct{ writes int }
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func (w *failWriter) Close() error { return nil }
+
+func TestCompressWriterOrder(t *testing.T) {
+	src := make([]byte, 5*compressChunkSize+12345)
+	rand.New(rand.NewSource(1)).Read(src[:len(src)/2])
+
+	for _, codec := range []Codec{Gzip(gzip.BestSpeed), Zstd(zstd.SpeedFastest)} {
+		var dst bytes.Buffer
+		cw := NewCompressWriter(nopCloser{&dst}, codec, 4)
+
+		// Odd write sizes so chunks straddle writes.
+		for p := src; len(p) > 0; {
+			n := 100003
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := cw.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := cw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var r io.Reader
+		switch codec.(type) {
+		case Gzip:
+			r, _ = gzip.NewReader(&dst)
+		case Zstd:
+			zr, _ := zstd.NewReader(&dst)
+			defer zr.Close()
+			r = zr
+		}
+
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, src) {
+			t.Errorf("%T: decompressed stream differs from input", codec)
+		}
+	}
+}
+
+func TestCompressWriterError(t *testing.T) {
+	dst := &failWriter{}
+	cw := NewCompressWriter(dst, Gzip(gzip.BestSpeed), 2)
+
+	// Writes fail soon after the first chunk does, rather than queueing
+	// the rest.
+	chunk := make([]byte, compressChunkSize)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = cw.Write(chunk)
+	}
+	if err == nil {
+		t.Error("writes kept succeeding after a failed chunk")
+	}
+	if err := cw.Close(); err == nil {
+		t.Error("closed without error")
+	}
+	if dst.writes != 1 {
+		t.Errorf("%d writes to the destination, expected 1", dst.writes)
+	}
+}
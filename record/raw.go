@@ -0,0 +1,182 @@
+package record
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Layout of timestamps in raw recording file names.
+const rawTimeLayout = "20060102T150405.000Z"
+
+// Raw records blocks as headerless interleaved unsigned 8-bit IQ, rotating
+// to a new file when the current one exceeds MaxSize bytes or MaxDuration of
+// sample time, and whenever the center frequency or sample rate changes.
+// Files are named <prefix>_<start time>_<frequency>Hz.cu8. Each completed
+// file is appended to <prefix>.index as a line of comma separated name,
+// start time, center frequency, sample rate and size in bytes.
+//
+// If Codec is set files are compressed on Workers goroutines, with the
+// codec's extension appended to their names. Sizes and rotation limits
+// always refer to uncompressed bytes.
+type Raw struct {
+	// Rotation limits, zero disables each.
+	MaxSize     int64
+	MaxDuration time.Duration
+
+	// Optional compression, with one worker per CPU if Workers is zero.
+	Codec   Codec
+	Workers int
+
+	dir, prefix string
+	index       *os.File
+
+	out   io.WriteCloser
+	w     *bufio.Writer
+	name  string
+	meta  rtltcp.Metadata
+	start time.Time
+	size  int64
+}
+
+// Returns a recorder writing files in dir, which is created if necessary.
+func NewRaw(dir, prefix string) (*Raw, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating recording directory: %s", err)
+	}
+
+	index, err := os.OpenFile(filepath.Join(dir, prefix+".index"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening recording index: %s", err)
+	}
+
+	return &Raw{dir: dir, prefix: prefix, index: index}, nil
+}
+
+// Returns the path of the file currently being written, if any.
+func (r *Raw) Current() string {
+	if r.out == nil {
+		return ""
+	}
+	return filepath.Join(r.dir, r.name)
+}
+
+func (r *Raw) WriteBlock(blk rtltcp.Block) error {
+	// Samples ahead of a retune belong to the current file.
+	if before, after := blk.Split(); r.out != nil && len(before.Samples) > 0 {
+		if err := r.write(before); err != nil {
+			return err
+		}
+		blk = after
+	}
+	return r.write(blk)
+}
+
+func (r *Raw) write(blk rtltcp.Block) error {
+	if r.out == nil || r.rotate(blk) {
+		if err := r.open(blk); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.w.Write(blk.Samples)
+	r.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("Error writing raw recording: %s", err)
+	}
+
+	return nil
+}
+
+// Reports whether blk should begin a new file.
+func (r *Raw) rotate(blk rtltcp.Block) bool {
+	if blk.CenterFreq != r.meta.CenterFreq || blk.SampleRate != r.meta.SampleRate {
+		return true
+	}
+	if r.MaxSize > 0 && r.size+int64(len(blk.Samples)) > r.MaxSize {
+		return true
+	}
+	if r.MaxDuration > 0 && duration(r.size+int64(len(blk.Samples)), r.meta.SampleRate) > r.MaxDuration {
+		return true
+	}
+	return false
+}
+
+func (r *Raw) open(blk rtltcp.Block) error {
+	if err := r.finish(); err != nil {
+		return err
+	}
+
+	start := blk.Timestamp
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	r.name = fmt.Sprintf("%s_%s_%dHz.cu8", r.prefix, start.UTC().Format(rawTimeLayout), blk.CenterFreq)
+	if r.Codec != nil {
+		r.name += r.Codec.Ext()
+	}
+
+	file, err := os.Create(filepath.Join(r.dir, r.name))
+	if err != nil {
+		return fmt.Errorf("Error creating raw recording: %s", err)
+	}
+
+	r.out = file
+	if r.Codec != nil {
+		r.out = NewCompressWriter(file, r.Codec, r.Workers)
+	}
+	r.w = bufio.NewWriter(r.out)
+	r.meta = blk.Metadata
+	r.start = start
+	r.size = 0
+
+	return nil
+}
+
+// Closes the current file and records it in the index.
+func (r *Raw) finish() error {
+	if r.out == nil {
+		return nil
+	}
+
+	err := r.w.Flush()
+	if cerr := r.out.Close(); err == nil {
+		err = cerr
+	}
+	r.out = nil
+	if err != nil {
+		return fmt.Errorf("Error closing raw recording: %s", err)
+	}
+
+	_, err = fmt.Fprintf(r.index, "%s,%s,%d,%d,%d\n",
+		r.name, r.start.UTC().Format(time.RFC3339Nano), r.meta.CenterFreq, r.meta.SampleRate, r.size,
+	)
+	if err != nil {
+		return fmt.Errorf("Error writing recording index: %s", err)
+	}
+
+	return nil
+}
+
+// Closes the current file and the index.
+func (r *Raw) Close() error {
+	err := r.finish()
+	if cerr := r.index.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Returns the sample time spanned by n bytes of interleaved IQ.
+func duration(n int64, rate uint32) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(n/2) / float64(rate) * float64(time.Second))
+}
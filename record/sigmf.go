@@ -0,0 +1,286 @@
+// Package record provides sinks which write sample blocks received from
+// rtl_tcp to disk.
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// SigMF specification version written to metadata files.
+const SigMFVersion = "1.0.0"
+
+// SigMF datatype of rtl_tcp's interleaved unsigned 8-bit IQ.
+const SigMFDatatype = "cu8"
+
+// File extensions of a SigMF recording's two halves.
+const (
+	SigMFDataExt = ".sigmf-data"
+	SigMFMetaExt = ".sigmf-meta"
+)
+
+// Top level of a SigMF metadata file.
+type SigMFMeta struct {
+	Global      SigMFGlobal       `json:"global"`
+	Captures    []SigMFCapture    `json:"captures"`
+	Annotations []SigMFAnnotation `json:"annotations"`
+}
+
+// Global SigMF fields describing the whole recording.
+type SigMFGlobal struct {
+	Datatype    string  `json:"core:datatype"`
+	SampleRate  float64 `json:"core:sample_rate,omitempty"`
+	Version     string  `json:"core:version"`
+	Description string  `json:"core:description,omitempty"`
+	Author      string  `json:"core:author,omitempty"`
+	Recorder    string  `json:"core:recorder,omitempty"`
+	HW          string  `json:"core:hw,omitempty"`
+}
+
+// Marks the start of a contiguous segment recorded at one frequency.
+type SigMFCapture struct {
+	SampleStart uint64  `json:"core:sample_start"`
+	Frequency   float64 `json:"core:frequency,omitempty"`
+	Datetime    string  `json:"core:datetime,omitempty"`
+}
+
+// Describes a span of samples and the band they occupy.
+type SigMFAnnotation struct {
+	SampleStart   uint64  `json:"core:sample_start"`
+	SampleCount   uint64  `json:"core:sample_count"`
+	FreqLowerEdge float64 `json:"core:freq_lower_edge,omitempty"`
+	FreqUpperEdge float64 `json:"core:freq_upper_edge,omitempty"`
+	Label         string  `json:"core:label,omitempty"`
+}
+
+// Reads and decodes the metadata file at path.
+func ReadSigMFMeta(path string) (meta SigMFMeta, err error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(buf, &meta)
+	return
+}
+
+// Returns the recording name shared by both files, with any SigMF
+// extension removed.
+func SigMFBase(path string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(path, SigMFDataExt), SigMFMetaExt)
+}
+
+// SigMF records blocks as a SigMF data file, writing the accompanying
+// metadata file on Close. A new capture and annotation begin whenever the
+// center frequency changes between blocks. The sample rate is global to a
+// recording, so a change of rate closes it and starts another, named with
+// a counter: base_1, base_2 and so on.
+//
+// If Codec is set the data file is compressed on Workers goroutines, with
+// the codec's extension appended to its name. SigMF readers expect it
+// decompressed, which the standard tools do.
+type SigMF struct {
+	// Optional descriptive fields copied into the global metadata.
+	Description string
+	Author      string
+	HW          string
+
+	// Optional compression, with one worker per CPU if Workers is zero. Set
+	// before the first block.
+	Codec   Codec
+	Workers int
+
+	base string
+	name string // Of the current recording, base with its counter.
+	part int
+	data io.WriteCloser
+	w    *bufio.Writer
+
+	meta    SigMFMeta
+	samples uint64
+	last    rtltcp.Metadata
+	started bool
+}
+
+// Creates base+".sigmf-data" and returns a sink writing to it.
+func NewSigMF(base string) (*SigMF, error) {
+	base = SigMFBase(base)
+	s := &SigMF{base: base, name: base, meta: newSigMFMeta()}
+	if err := s.create(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSigMFMeta() SigMFMeta {
+	return SigMFMeta{
+		Global: SigMFGlobal{
+			Datatype: SigMFDatatype,
+			Version:  SigMFVersion,
+			Recorder: "rtltcp",
+		},
+		Captures:    []SigMFCapture{},
+		Annotations: []SigMFAnnotation{},
+	}
+}
+
+// Creates the data file of the current recording, compressed if Codec is
+// set.
+func (s *SigMF) create() error {
+	name := s.name + SigMFDataExt
+	if s.Codec != nil {
+		name += s.Codec.Ext()
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("Error creating SigMF data file: %s", err)
+	}
+	s.data = file
+	if s.Codec != nil {
+		s.data = NewCompressWriter(file, s.Codec, s.Workers)
+	}
+	s.w = bufio.NewWriter(s.data)
+	return nil
+}
+
+// Returns the name of the current recording, without extension.
+func (s *SigMF) Name() string {
+	return s.name
+}
+
+// Returns the number of samples written to the current recording.
+func (s *SigMF) Samples() uint64 {
+	return s.samples
+}
+
+func (s *SigMF) WriteBlock(blk rtltcp.Block) error {
+	// Samples ahead of a retune belong to the previous capture.
+	if before, after := blk.Split(); s.started && len(before.Samples) > 0 {
+		if err := s.write(before); err != nil {
+			return err
+		}
+		blk = after
+	}
+	return s.write(blk)
+}
+
+func (s *SigMF) write(blk rtltcp.Block) error {
+	if s.started && blk.SampleRate != s.last.SampleRate {
+		if err := s.next(); err != nil {
+			return err
+		}
+	}
+	if !s.started && s.part == 0 && s.Codec != nil {
+		if err := s.compress(); err != nil {
+			return err
+		}
+	}
+	if !s.started || blk.CenterFreq != s.last.CenterFreq || blk.SampleRate != s.last.SampleRate {
+		s.retune(blk.Metadata)
+	}
+
+	if _, err := s.w.Write(blk.Samples); err != nil {
+		return fmt.Errorf("Error writing SigMF data: %s", err)
+	}
+	s.samples += uint64(blk.Len())
+
+	return nil
+}
+
+func (s *SigMF) retune(m rtltcp.Metadata) {
+	s.closeAnnotation()
+
+	if s.meta.Global.SampleRate == 0 {
+		s.meta.Global.SampleRate = float64(m.SampleRate)
+	}
+
+	capture := SigMFCapture{
+		SampleStart: s.samples,
+		Frequency:   float64(m.CenterFreq),
+	}
+	if !m.Timestamp.IsZero() {
+		capture.Datetime = m.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	s.meta.Captures = append(s.meta.Captures, capture)
+
+	annotation := SigMFAnnotation{
+		SampleStart: s.samples,
+		Label:       fmt.Sprintf("%d Hz @ %d S/s", m.CenterFreq, m.SampleRate),
+	}
+	if m.CenterFreq != 0 && m.SampleRate != 0 {
+		annotation.FreqLowerEdge = float64(m.CenterFreq) - float64(m.SampleRate)/2
+		annotation.FreqUpperEdge = float64(m.CenterFreq) + float64(m.SampleRate)/2
+	}
+	s.meta.Annotations = append(s.meta.Annotations, annotation)
+
+	s.last = m
+	s.started = true
+}
+
+// Replaces the data file, still empty, with one compressed by Codec.
+func (s *SigMF) compress() error {
+	if err := s.data.Close(); err != nil {
+		return fmt.Errorf("Error closing SigMF data file: %s", err)
+	}
+	os.Remove(s.name + SigMFDataExt)
+	return s.create()
+}
+
+// Closes the current recording and starts the next.
+func (s *SigMF) next() error {
+	if err := s.finish(); err != nil {
+		return err
+	}
+	s.part++
+	s.name = fmt.Sprintf("%s_%d", s.base, s.part)
+	s.meta = newSigMFMeta()
+	s.samples = 0
+	s.started = false
+	return s.create()
+}
+
+// Fills in the sample count of the open annotation.
+func (s *SigMF) closeAnnotation() {
+	if n := len(s.meta.Annotations); n > 0 {
+		a := &s.meta.Annotations[n-1]
+		a.SampleCount = s.samples - a.SampleStart
+	}
+}
+
+// Flushes the data file and writes the metadata file.
+func (s *SigMF) Close() error {
+	return s.finish()
+}
+
+// Flushes and closes the current data file and writes its metadata file.
+func (s *SigMF) finish() error {
+	s.closeAnnotation()
+	s.meta.Global.Description = s.Description
+	s.meta.Global.Author = s.Author
+	s.meta.Global.HW = s.HW
+
+	err := s.w.Flush()
+	if cerr := s.data.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("Error closing SigMF data file: %s", err)
+	}
+
+	buf, err := json.MarshalIndent(s.meta, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(s.name+SigMFMetaExt, buf, 0644); err != nil {
+		return fmt.Errorf("Error writing SigMF metadata: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package record
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+func TestSigMF(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "capture")
+
+	s, err := NewSigMF(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.HW = "R820T"
+
+	blk := rtltcp.Block{Samples: make([]byte, 2048)}
+	blk.CenterFreq = 100e6
+	blk.SampleRate = 2.4e6
+	blk.Timestamp = time.Now()
+
+	for i := 0; i < 3; i++ {
+		if err := s.WriteBlock(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blk.CenterFreq = 101e6
+	if err := s.WriteBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+
+	// A retune a quarter of the way into a block starts the capture there.
+	old := blk.Metadata
+	blk.CenterFreq = 102e6
+	blk.Segment = &rtltcp.Segment{Old: old, New: blk.Metadata, Offset: 256}
+	if err := s.WriteBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(base + SigMFDataExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 5*2048 {
+		t.Errorf("data size %d, want %d", info.Size(), 5*2048)
+	}
+
+	meta, err := ReadSigMFMeta(base + SigMFMetaExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.Global.Datatype != SigMFDatatype || meta.Global.SampleRate != 2.4e6 || meta.Global.HW != "R820T" {
+		t.Errorf("unexpected global: %+v", meta.Global)
+	}
+	if len(meta.Captures) != 3 || meta.Captures[1].SampleStart != 3*1024 || meta.Captures[1].Frequency != 101e6 || meta.Captures[2].SampleStart != 4*1024+256 {
+		t.Errorf("unexpected captures: %+v", meta.Captures)
+	}
+	if len(meta.Annotations) != 3 || meta.Annotations[0].SampleCount != 3*1024 || meta.Annotations[1].SampleCount != 1024+256 || meta.Annotations[2].SampleCount != 768 {
+		t.Errorf("unexpected annotations: %+v", meta.Annotations)
+	}
+}
+
+func TestSigMFCompressed(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "capture")
+
+	s, err := NewSigMF(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Codec = Gzip(gzip.BestSpeed)
+
+	blk := rtltcp.Block{Samples: bytes.Repeat([]byte{127, 128}, 1024)}
+	blk.CenterFreq = 100e6
+	blk.SampleRate = 2.4e6
+	for i := 0; i < 3; i++ {
+		if err := s.WriteBlock(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(base + SigMFDataExt); err == nil {
+		t.Error("uncompressed data file left behind")
+	}
+	f, err := os.Open(base + SigMFDataExt + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Repeat(blk.Samples, 3)) {
+		t.Errorf("decompressed %d bytes, expected the %d written", len(data), 3*len(blk.Samples))
+	}
+
+	meta, err := ReadSigMFMeta(base + SigMFMetaExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Annotations) != 1 || meta.Annotations[0].SampleCount != 3*1024 {
+		t.Errorf("unexpected annotations: %+v", meta.Annotations)
+	}
+}
+
+func TestSigMFSampleRate(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "capture")
+
+	s, err := NewSigMF(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blk := rtltcp.Block{Samples: make([]byte, 2048)}
+	blk.CenterFreq = 100e6
+	blk.SampleRate = 2.4e6
+	if err := s.WriteBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+
+	// A change of rate a quarter of the way into a block starts the next
+	// recording there.
+	old := blk.Metadata
+	blk.SampleRate = 1e6
+	blk.Segment = &rtltcp.Segment{Old: old, New: blk.Metadata, Offset: 256}
+	if err := s.WriteBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name() != base+"_1" {
+		t.Errorf("recording to %s after the change of rate", s.Name())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name    string
+		rate    float64
+		samples uint64
+	}{
+		{base, 2.4e6, 1024 + 256},
+		{base + "_1", 1e6, 768},
+	} {
+		info, err := os.Stat(c.name + SigMFDataExt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(info.Size()) != 2*c.samples {
+			t.Errorf("%s: data size %d, want %d", c.name, info.Size(), 2*c.samples)
+		}
+		meta, err := ReadSigMFMeta(c.name + SigMFMetaExt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Global.SampleRate != c.rate {
+			t.Errorf("%s: sample rate %f, want %f", c.name, meta.Global.SampleRate, c.rate)
+		}
+		if len(meta.Captures) != 1 || meta.Captures[0].SampleStart != 0 || len(meta.Annotations) != 1 || meta.Annotations[0].SampleCount != c.samples {
+			t.Errorf("%s: unexpected captures %+v and annotations %+v", c.name, meta.Captures, meta.Annotations)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package record
+
+import (
+	"math"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Trigger records only bursts of signal. When a block's level exceeds
+// Threshold a new sink is opened with NewSink, the PreTrigger blocks leading
+// up to it are written, and recording continues until the level has stayed
+// below Threshold for Hold.
+type Trigger struct {
+	// Level in dBFS above which recording starts.
+	Threshold float64
+	// Duration of signal retained from before the trigger.
+	PreTrigger time.Duration
+	// Duration the level must remain below threshold to stop recording.
+	Hold time.Duration
+
+	// Returns the level of a block in dBFS, MeanPower if nil.
+	Detector func(rtltcp.Block) float64
+
+	// Called with the triggering block to open a sink for each burst.
+	NewSink func(rtltcp.Block) (rtltcp.Sink, error)
+
+	sink    rtltcp.Sink
+	pre     []rtltcp.Block
+	preDur  time.Duration
+	quiet   time.Duration
+	lastLvl float64
+}
+
+// Returns the mean power of a block in dBFS.
+func MeanPower(blk rtltcp.Block) float64 {
+	var sum float64
+	for _, s := range blk.Samples {
+		v := (float64(s) - 127.5) / 127.5
+		sum += v * v
+	}
+	return 10 * math.Log10(sum/float64(blk.Len())+1e-20)
+}
+
+// Returns the power of the strongest sample in a block in dBFS.
+func PeakPower(blk rtltcp.Block) float64 {
+	var peak float64
+	for i := 0; i+1 < len(blk.Samples); i += 2 {
+		re := (float64(blk.Samples[i]) - 127.5) / 127.5
+		im := (float64(blk.Samples[i+1]) - 127.5) / 127.5
+		peak = math.Max(peak, re*re+im*im)
+	}
+	return 10 * math.Log10(peak+1e-20)
+}
+
+// Reports whether a burst is currently being recorded.
+func (t *Trigger) Active() bool {
+	return t.sink != nil
+}
+
+// Returns the level of the most recent block in dBFS.
+func (t *Trigger) Level() float64 {
+	return t.lastLvl
+}
+
+func (t *Trigger) WriteBlock(blk rtltcp.Block) error {
+	detect := t.Detector
+	if detect == nil {
+		detect = MeanPower
+	}
+	t.lastLvl = detect(blk)
+	above := t.lastLvl > t.Threshold
+
+	if t.sink == nil {
+		if !above {
+			t.buffer(blk)
+			return nil
+		}
+		return t.start(blk)
+	}
+
+	if above {
+		t.quiet = 0
+	} else {
+		t.quiet += blk.Duration()
+	}
+
+	if err := t.sink.WriteBlock(blk); err != nil {
+		return err
+	}
+
+	if t.quiet >= t.Hold && !above {
+		return t.stop()
+	}
+
+	return nil
+}
+
+// Retains a copy of blk in the pre-trigger buffer, discarding blocks older
+// than PreTrigger.
+func (t *Trigger) buffer(blk rtltcp.Block) {
+	if t.PreTrigger <= 0 {
+		return
+	}
+
+	blk.Samples = append([]byte(nil), blk.Samples...)
+	t.pre = append(t.pre, blk)
+	t.preDur += blk.Duration()
+
+	for len(t.pre) > 1 && t.preDur-t.pre[0].Duration() >= t.PreTrigger {
+		t.preDur -= t.pre[0].Duration()
+		t.pre = t.pre[1:]
+	}
+}
+
+func (t *Trigger) start(blk rtltcp.Block) (err error) {
+	first := blk
+	if len(t.pre) > 0 {
+		first = t.pre[0]
+	}
+
+	if t.sink, err = t.NewSink(first); err != nil {
+		t.sink = nil
+		return err
+	}
+
+	for _, b := range t.pre {
+		if err = t.sink.WriteBlock(b); err != nil {
+			return err
+		}
+	}
+	t.pre, t.preDur, t.quiet = t.pre[:0], 0, 0
+
+	return t.sink.WriteBlock(blk)
+}
+
+func (t *Trigger) stop() error {
+	err := t.sink.Close()
+	t.sink = nil
+	t.quiet = 0
+	return err
+}
+
+// Closes the current burst's sink, if any.
+func (t *Trigger) Close() error {
+	t.pre = nil
+	if t.sink == nil {
+		return nil
+	}
+	return t.stop()
+}
@@ -0,0 +1,89 @@
+package record
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Sink keeping the indices of the blocks written.
+type indexSink struct {
+	indices []uint64
+	closed  bool
+}
+
+func (s *indexSink) WriteBlock(blk rtltcp.Block) error {
+	s.indices = append(s.indices, blk.Index)
+	return nil
+}
+
+func (s *indexSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestTrigger(t *testing.T) {
+	var sinks []*indexSink
+	var firsts []uint64
+	trig := &Trigger{
+		Threshold:  -20,
+		PreTrigger: 3 * time.Millisecond,
+		Hold:       2 * time.Millisecond,
+		NewSink: func(blk rtltcp.Block) (rtltcp.Sink, error) {
+			firsts = append(firsts, blk.Index)
+			sinks = append(sinks, &indexSink{})
+			return sinks[len(sinks)-1], nil
+		},
+	}
+
+	// Blocks of 1 ms at 1 MS/s, indexed by their position in the pattern.
+	quiet := bytes.Repeat([]byte{127, 128}, 1000)
+	loud := bytes.Repeat([]byte{0, 255}, 1000)
+	pattern := "qqqqqqqqqqLLqLqqqqqqqLq"
+	for i, c := range pattern {
+		blk := rtltcp.Block{Samples: quiet, Index: uint64(i)}
+		blk.SampleRate = 1e6
+		if c == 'L' {
+			blk.Samples = loud
+		}
+		if err := trig.WriteBlock(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !trig.Active() {
+		t.Error("second burst not being recorded")
+	}
+	if err := trig.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each burst opens with 3 ms from before it, and is held until 2 ms of
+	// quiet follow the last loud block, the quiet block at 12 not ending
+	// the first.
+	want := [][]uint64{
+		{7, 8, 9, 10, 11, 12, 13, 14, 15},
+		{18, 19, 20, 21, 22},
+	}
+	if len(sinks) != len(want) {
+		t.Fatalf("%d bursts, want %d", len(sinks), len(want))
+	}
+	for i, s := range sinks {
+		if !equalIndices(s.indices, want[i]) || !s.closed || firsts[i] != want[i][0] {
+			t.Errorf("burst %d: blocks %v closed %t opened at %d, want %v", i, s.indices, s.closed, firsts[i], want[i])
+		}
+	}
+}
+
+func equalIndices(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Size of the ds64 chunk body, reserved as a JUNK chunk until the file is
+// known to need RF64.
+const ds64Size = 28
+
+// Byte offsets of fields patched when the recording is closed.
+const (
+	wavRiffSize  = 4
+	wavJunkID    = 12
+	wavJunkBody  = 20
+	wavAuxiStop  = wavJunkBody + ds64Size + 8 + 16 + 8 + 16
+	wavDataSize  = wavAuxiStop + 16 + 9*4 + 4
+	wavHeaderLen = wavDataSize + 4
+)
+
+// Windows SYSTEMTIME as stored in the auxi chunk.
+type systemTime struct {
+	Year, Month, DayOfWeek, Day, Hour, Minute, Second, Milliseconds uint16
+}
+
+func newSystemTime(t time.Time) systemTime {
+	t = t.UTC()
+	return systemTime{
+		uint16(t.Year()), uint16(t.Month()), uint16(t.Weekday()), uint16(t.Day()),
+		uint16(t.Hour()), uint16(t.Minute()), uint16(t.Second()), uint16(t.Nanosecond() / 1e6),
+	}
+}
+
+// Body of the auxi chunk used by SpectraVue, SDR# and HDSDR to carry the
+// tuning state of a recording.
+type auxi struct {
+	StartTime, StopTime systemTime
+
+	CenterFreq  uint32
+	ADFrequency uint32
+	IFFrequency uint32
+	Bandwidth   uint32
+	IQOffset    uint32
+	Unused      [4]uint32
+}
+
+// WAV records blocks as a two channel 8-bit PCM WAV file, which is the
+// native layout of rtl_tcp's samples. The auxi chunk records the center
+// frequency and start and stop times so SDR# and HDSDR can tune their
+// display to match. Recordings exceeding the 4 GiB WAV limit are converted
+// to RF64 when closed. The center frequency and sample rate are taken from
+// the first block, later changes aren't represented. WAV files aren't
+// compressed, their header being rewritten on Close; see Raw and SigMF.
+type WAV struct {
+	file *os.File
+	w    *bufio.Writer
+
+	aux   auxi
+	size  uint64
+	start time.Time
+}
+
+// Creates the file at path and returns a sink writing to it.
+func NewWAV(path string) (*WAV, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating WAV file: %s", err)
+	}
+
+	return &WAV{
+		file: file,
+		w:    bufio.NewWriter(file),
+	}, nil
+}
+
+func (wav *WAV) WriteBlock(blk rtltcp.Block) error {
+	if wav.start.IsZero() {
+		if err := wav.writeHeader(blk.Metadata); err != nil {
+			return err
+		}
+	}
+
+	n, err := wav.w.Write(blk.Samples)
+	wav.size += uint64(n)
+	if err != nil {
+		return fmt.Errorf("Error writing WAV data: %s", err)
+	}
+
+	return nil
+}
+
+func (wav *WAV) writeHeader(m rtltcp.Metadata) error {
+	if m.SampleRate == 0 {
+		return errors.New("sample rate must be set before recording WAV")
+	}
+
+	wav.start = m.Timestamp
+	if wav.start.IsZero() {
+		wav.start = time.Now()
+	}
+
+	wav.aux = auxi{
+		StartTime:   newSystemTime(wav.start),
+		CenterFreq:  m.CenterFreq,
+		ADFrequency: m.SampleRate,
+		Bandwidth:   m.SampleRate,
+	}
+
+	// Sizes are patched on Close.
+	w := wav.w
+	w.WriteString("RIFF")
+	binary.Write(w, binary.LittleEndian, uint32(0))
+	w.WriteString("WAVE")
+
+	w.WriteString("JUNK")
+	binary.Write(w, binary.LittleEndian, uint32(ds64Size))
+	w.Write(make([]byte, ds64Size))
+
+	w.WriteString("fmt ")
+	binary.Write(w, binary.LittleEndian, struct {
+		Size                 uint32
+		Format, Channels     uint16
+		SampleRate, ByteRate uint32
+		BlockAlign, Bits     uint16
+	}{16, 1, 2, m.SampleRate, m.SampleRate * 2, 2, 8})
+
+	w.WriteString("auxi")
+	binary.Write(w, binary.LittleEndian, uint32(binary.Size(wav.aux)))
+	binary.Write(w, binary.LittleEndian, wav.aux)
+
+	w.WriteString("data")
+	err := binary.Write(w, binary.LittleEndian, uint32(0))
+	if err != nil {
+		return fmt.Errorf("Error writing WAV header: %s", err)
+	}
+
+	return nil
+}
+
+// Flushes samples and patches the header with final sizes and stop time.
+func (wav *WAV) Close() (err error) {
+	defer func() {
+		if cerr := wav.file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if wav.start.IsZero() {
+		return nil
+	}
+
+	if err = wav.w.Flush(); err != nil {
+		return fmt.Errorf("Error writing WAV data: %s", err)
+	}
+
+	// Data chunks of odd length are padded to keep chunks word aligned.
+	if wav.size%2 == 1 {
+		if _, err = wav.file.Write([]byte{0}); err != nil {
+			return
+		}
+	}
+
+	stop := wav.start.Add(duration(int64(wav.size), wav.aux.ADFrequency))
+	riffSize := uint64(wavHeaderLen-8) + wav.size + wav.size%2
+
+	patch := func(offset int64, v interface{}) {
+		if err == nil {
+			_, err = wav.file.Seek(offset, io.SeekStart)
+		}
+		if err == nil {
+			err = binary.Write(wav.file, binary.LittleEndian, v)
+		}
+	}
+
+	patch(wavAuxiStop, newSystemTime(stop))
+
+	if riffSize <= math.MaxUint32 {
+		patch(wavRiffSize, uint32(riffSize))
+		patch(wavDataSize, uint32(wav.size))
+	} else {
+		// Convert to RF64, the reserved JUNK chunk becomes ds64.
+		patch(0, [4]byte{'R', 'F', '6', '4'})
+		patch(wavRiffSize, uint32(math.MaxUint32))
+		patch(wavJunkID, [4]byte{'d', 's', '6', '4'})
+		patch(wavJunkBody, struct {
+			RiffSize, DataSize, SampleCount uint64
+			TableLength                     uint32
+		}{riffSize, wav.size, wav.size / 2, 0})
+		patch(wavDataSize, uint32(math.MaxUint32))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Error finalizing WAV header: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Returns the chunks of a RIFF or RF64 file by ID, and the offset of each
+// body.
+func wavChunks(t *testing.T, buf []byte) (chunks map[string][]byte, offsets map[string]int) {
+	t.Helper()
+	if id := string(buf[:4]); (id != "RIFF" && id != "RF64") || string(buf[8:12]) != "WAVE" {
+		t.Fatalf("not a WAV file: %q", buf[:12])
+	}
+	chunks, offsets = map[string][]byte{}, map[string]int{}
+	for p := 12; p+8 <= len(buf); {
+		id := string(buf[p : p+4])
+		size := int(binary.LittleEndian.Uint32(buf[p+4:]))
+		if id == "data" && size == 0xffffffff {
+			size = len(buf) - p - 8
+		}
+		if p+8+size > len(buf) {
+			t.Fatalf("chunk %q of %d bytes overruns the file", id, size)
+		}
+		chunks[id], offsets[id] = buf[p+8:p+8+size], p+8
+		p += 8 + size + size%2
+	}
+	return chunks, offsets
+}
+
+func TestWAV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.wav")
+	wav, err := NewWAV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 5, 6, 7, 8, 9, 500e6, time.UTC)
+	blk := rtltcp.Block{Samples: bytes.Repeat([]byte{1, 2}, 1000)}
+	blk.CenterFreq = 100e6
+	blk.SampleRate = 1e6
+	blk.Timestamp = start
+	for i := 0; i < 3; i++ {
+		if err := wav.WriteBlock(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wav.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != wavHeaderLen+6000 {
+		t.Fatalf("file of %d bytes, want %d", len(buf), wavHeaderLen+6000)
+	}
+	if size := binary.LittleEndian.Uint32(buf[4:]); int(size) != len(buf)-8 {
+		t.Errorf("RIFF size %d, want %d", size, len(buf)-8)
+	}
+
+	chunks, offsets := wavChunks(t, buf)
+	if len(chunks["JUNK"]) != ds64Size {
+		t.Errorf("JUNK chunk of %d bytes", len(chunks["JUNK"]))
+	}
+	if fmtChunk := chunks["fmt "]; len(fmtChunk) != 16 ||
+		binary.LittleEndian.Uint16(fmtChunk[2:]) != 2 || binary.LittleEndian.Uint32(fmtChunk[4:]) != 1e6 {
+		t.Errorf("fmt chunk %x", fmtChunk)
+	}
+
+	var aux auxi
+	if err := binary.Read(bytes.NewReader(chunks["auxi"]), binary.LittleEndian, &aux); err != nil {
+		t.Fatal(err)
+	}
+	if aux.CenterFreq != 100e6 || aux.ADFrequency != 1e6 {
+		t.Errorf("auxi tuned to %d Hz at %d S/s", aux.CenterFreq, aux.ADFrequency)
+	}
+	// 3000 samples at 1 MS/s.
+	if aux.StartTime != newSystemTime(start) || aux.StopTime != newSystemTime(start.Add(3*time.Millisecond)) {
+		t.Errorf("auxi spans %+v to %+v", aux.StartTime, aux.StopTime)
+	}
+
+	if offsets["data"] != wavHeaderLen || len(chunks["data"]) != 6000 || !bytes.Equal(chunks["data"][:2], []byte{1, 2}) {
+		t.Errorf("data chunk of %d bytes at %d", len(chunks["data"]), offsets["data"])
+	}
+}
+
+func TestWAVRF64(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.wav")
+	wav, err := NewWAV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk := rtltcp.Block{Samples: make([]byte, 2000)}
+	blk.SampleRate = 1e6
+	if err := wav.WriteBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+	// Closed as if past the 4 GiB limit, without writing as much.
+	wav.w.Flush()
+	wav.size = 5 << 30
+	if err := wav.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:4]) != "RF64" || binary.LittleEndian.Uint32(buf[4:]) != 0xffffffff {
+		t.Fatalf("header %q", buf[:8])
+	}
+	chunks, _ := wavChunks(t, buf)
+	var ds64 struct {
+		RiffSize, DataSize, SampleCount uint64
+		TableLength                     uint32
+	}
+	if err := binary.Read(bytes.NewReader(chunks["ds64"]), binary.LittleEndian, &ds64); err != nil {
+		t.Fatal(err)
+	}
+	if ds64.RiffSize != wavHeaderLen-8+5<<30 || ds64.DataSize != 5<<30 || ds64.SampleCount != 5<<29 {
+		t.Errorf("ds64 %+v", ds64)
+	}
+	if _, ok := chunks["data"]; !ok {
+		t.Error("no data chunk")
+	}
+}
@@ -0,0 +1,55 @@
+package rtltcp
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Retry policy for command writes failing with temporary network errors,
+// such as a write deadline expiring while a congested link drains. A write
+// cut short is resumed where it stopped, so the server never sees a partial
+// command.
+type RetryPolicy struct {
+	Attempts int           // Retries after the first write fails.
+	Backoff  time.Duration // Wait before the first retry, doubling after each.
+	// Deadline of each attempt, none if zero. Without one writes block
+	// until the link recovers or fails for good.
+	Timeout time.Duration
+}
+
+// Reports whether err is worth retrying.
+func temporary(err error) bool {
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		return false
+	}
+	if netErr.Timeout() {
+		return true
+	}
+	t, ok := netErr.(interface{ Temporary() bool })
+	return ok && t.Temporary()
+}
+
+// Writes b under policy p, which may be nil to try once. The caller must
+// hold wmu.
+func (sdr *SDR) writeLocked(b []byte, p *RetryPolicy) error {
+	if p != nil && p.Timeout > 0 {
+		defer sdr.Conn.SetWriteDeadline(time.Time{})
+	}
+
+	for attempt := 0; ; attempt++ {
+		if p != nil && p.Timeout > 0 {
+			sdr.Conn.SetWriteDeadline(time.Now().Add(p.Timeout))
+		}
+		n, err := sdr.Conn.Write(b)
+		if err == nil {
+			return nil
+		}
+		b = b[n:]
+		if p == nil || attempt >= p.Attempts || !temporary(err) {
+			return err
+		}
+		time.Sleep(p.Backoff << attempt)
+	}
+}
@@ -0,0 +1,624 @@
+// Remote control and streaming of an rtl_tcp dongle.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: rtltcp.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetStateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStateRequest) Reset() {
+	*x = GetStateRequest{}
+	mi := &file_rtltcp_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStateRequest) ProtoMessage() {}
+
+func (x *GetStateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStateRequest.ProtoReflect.Descriptor instead.
+func (*GetStateRequest) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{0}
+}
+
+type State struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Tuner      string                 `protobuf:"bytes,1,opt,name=tuner,proto3" json:"tuner,omitempty"`
+	GainCount  uint32                 `protobuf:"varint,2,opt,name=gain_count,json=gainCount,proto3" json:"gain_count,omitempty"`
+	CenterFreq uint32                 `protobuf:"varint,3,opt,name=center_freq,json=centerFreq,proto3" json:"center_freq,omitempty"`
+	SampleRate uint32                 `protobuf:"varint,4,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
+	AutoGain   bool                   `protobuf:"varint,5,opt,name=auto_gain,json=autoGain,proto3" json:"auto_gain,omitempty"`
+	// Manual gain in tenths of dB.
+	Gain          uint32 `protobuf:"varint,6,opt,name=gain,proto3" json:"gain,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *State) Reset() {
+	*x = State{}
+	mi := &file_rtltcp_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *State) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*State) ProtoMessage() {}
+
+func (x *State) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use State.ProtoReflect.Descriptor instead.
+func (*State) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *State) GetTuner() string {
+	if x != nil {
+		return x.Tuner
+	}
+	return ""
+}
+
+func (x *State) GetGainCount() uint32 {
+	if x != nil {
+		return x.GainCount
+	}
+	return 0
+}
+
+func (x *State) GetCenterFreq() uint32 {
+	if x != nil {
+		return x.CenterFreq
+	}
+	return 0
+}
+
+func (x *State) GetSampleRate() uint32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+func (x *State) GetAutoGain() bool {
+	if x != nil {
+		return x.AutoGain
+	}
+	return false
+}
+
+func (x *State) GetGain() uint32 {
+	if x != nil {
+		return x.Gain
+	}
+	return 0
+}
+
+type SetFrequencyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Frequency     uint32                 `protobuf:"varint,1,opt,name=frequency,proto3" json:"frequency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetFrequencyRequest) Reset() {
+	*x = SetFrequencyRequest{}
+	mi := &file_rtltcp_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetFrequencyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetFrequencyRequest) ProtoMessage() {}
+
+func (x *SetFrequencyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetFrequencyRequest.ProtoReflect.Descriptor instead.
+func (*SetFrequencyRequest) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetFrequencyRequest) GetFrequency() uint32 {
+	if x != nil {
+		return x.Frequency
+	}
+	return 0
+}
+
+type SetSampleRateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SampleRate    uint32                 `protobuf:"varint,1,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetSampleRateRequest) Reset() {
+	*x = SetSampleRateRequest{}
+	mi := &file_rtltcp_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetSampleRateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetSampleRateRequest) ProtoMessage() {}
+
+func (x *SetSampleRateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetSampleRateRequest.ProtoReflect.Descriptor instead.
+func (*SetSampleRateRequest) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SetSampleRateRequest) GetSampleRate() uint32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+type SetGainRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Enables tuner AGC, gain is ignored when set.
+	Auto bool `protobuf:"varint,1,opt,name=auto,proto3" json:"auto,omitempty"`
+	// Manual gain in tenths of dB.
+	Gain          uint32 `protobuf:"varint,2,opt,name=gain,proto3" json:"gain,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetGainRequest) Reset() {
+	*x = SetGainRequest{}
+	mi := &file_rtltcp_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetGainRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetGainRequest) ProtoMessage() {}
+
+func (x *SetGainRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetGainRequest.ProtoReflect.Descriptor instead.
+func (*SetGainRequest) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SetGainRequest) GetAuto() bool {
+	if x != nil {
+		return x.Auto
+	}
+	return false
+}
+
+func (x *SetGainRequest) GetGain() uint32 {
+	if x != nil {
+		return x.Gain
+	}
+	return 0
+}
+
+type StreamSamplesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamSamplesRequest) Reset() {
+	*x = StreamSamplesRequest{}
+	mi := &file_rtltcp_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamSamplesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamSamplesRequest) ProtoMessage() {}
+
+func (x *StreamSamplesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamSamplesRequest.ProtoReflect.Descriptor instead.
+func (*StreamSamplesRequest) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{5}
+}
+
+type SampleBlock struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	CenterFreq uint32                 `protobuf:"varint,1,opt,name=center_freq,json=centerFreq,proto3" json:"center_freq,omitempty"`
+	SampleRate uint32                 `protobuf:"varint,2,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
+	// Estimated capture time of the first sample.
+	TimestampUnixNano int64 `protobuf:"varint,3,opt,name=timestamp_unix_nano,json=timestampUnixNano,proto3" json:"timestamp_unix_nano,omitempty"`
+	// Interleaved unsigned 8-bit IQ.
+	Samples       []byte `protobuf:"bytes,4,opt,name=samples,proto3" json:"samples,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SampleBlock) Reset() {
+	*x = SampleBlock{}
+	mi := &file_rtltcp_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SampleBlock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SampleBlock) ProtoMessage() {}
+
+func (x *SampleBlock) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SampleBlock.ProtoReflect.Descriptor instead.
+func (*SampleBlock) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SampleBlock) GetCenterFreq() uint32 {
+	if x != nil {
+		return x.CenterFreq
+	}
+	return 0
+}
+
+func (x *SampleBlock) GetSampleRate() uint32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+func (x *SampleBlock) GetTimestampUnixNano() int64 {
+	if x != nil {
+		return x.TimestampUnixNano
+	}
+	return 0
+}
+
+func (x *SampleBlock) GetSamples() []byte {
+	if x != nil {
+		return x.Samples
+	}
+	return nil
+}
+
+type StreamSpectrumRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of bins, a power of two. Defaults to 1024.
+	Bins          uint32 `protobuf:"varint,1,opt,name=bins,proto3" json:"bins,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamSpectrumRequest) Reset() {
+	*x = StreamSpectrumRequest{}
+	mi := &file_rtltcp_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamSpectrumRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamSpectrumRequest) ProtoMessage() {}
+
+func (x *StreamSpectrumRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamSpectrumRequest.ProtoReflect.Descriptor instead.
+func (*StreamSpectrumRequest) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamSpectrumRequest) GetBins() uint32 {
+	if x != nil {
+		return x.Bins
+	}
+	return 0
+}
+
+type Spectrum struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	CenterFreq        uint32                 `protobuf:"varint,1,opt,name=center_freq,json=centerFreq,proto3" json:"center_freq,omitempty"`
+	SampleRate        uint32                 `protobuf:"varint,2,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
+	TimestampUnixNano int64                  `protobuf:"varint,3,opt,name=timestamp_unix_nano,json=timestampUnixNano,proto3" json:"timestamp_unix_nano,omitempty"`
+	// Power of each bin in dB, from lowest frequency to highest.
+	PowerDb       []float32 `protobuf:"fixed32,4,rep,packed,name=power_db,json=powerDb,proto3" json:"power_db,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Spectrum) Reset() {
+	*x = Spectrum{}
+	mi := &file_rtltcp_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Spectrum) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Spectrum) ProtoMessage() {}
+
+func (x *Spectrum) ProtoReflect() protoreflect.Message {
+	mi := &file_rtltcp_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Spectrum.ProtoReflect.Descriptor instead.
+func (*Spectrum) Descriptor() ([]byte, []int) {
+	return file_rtltcp_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Spectrum) GetCenterFreq() uint32 {
+	if x != nil {
+		return x.CenterFreq
+	}
+	return 0
+}
+
+func (x *Spectrum) GetSampleRate() uint32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+func (x *Spectrum) GetTimestampUnixNano() int64 {
+	if x != nil {
+		return x.TimestampUnixNano
+	}
+	return 0
+}
+
+func (x *Spectrum) GetPowerDb() []float32 {
+	if x != nil {
+		return x.PowerDb
+	}
+	return nil
+}
+
+var File_rtltcp_proto protoreflect.FileDescriptor
+
+const file_rtltcp_proto_rawDesc = "" +
+	"\n" +
+	"\frtltcp.proto\x12\x06rtltcp\"\x11\n" +
+	"\x0fGetStateRequest\"\xaf\x01\n" +
+	"\x05State\x12\x14\n" +
+	"\x05tuner\x18\x01 \x01(\tR\x05tuner\x12\x1d\n" +
+	"\n" +
+	"gain_count\x18\x02 \x01(\rR\tgainCount\x12\x1f\n" +
+	"\vcenter_freq\x18\x03 \x01(\rR\n" +
+	"centerFreq\x12\x1f\n" +
+	"\vsample_rate\x18\x04 \x01(\rR\n" +
+	"sampleRate\x12\x1b\n" +
+	"\tauto_gain\x18\x05 \x01(\bR\bautoGain\x12\x12\n" +
+	"\x04gain\x18\x06 \x01(\rR\x04gain\"3\n" +
+	"\x13SetFrequencyRequest\x12\x1c\n" +
+	"\tfrequency\x18\x01 \x01(\rR\tfrequency\"7\n" +
+	"\x14SetSampleRateRequest\x12\x1f\n" +
+	"\vsample_rate\x18\x01 \x01(\rR\n" +
+	"sampleRate\"8\n" +
+	"\x0eSetGainRequest\x12\x12\n" +
+	"\x04auto\x18\x01 \x01(\bR\x04auto\x12\x12\n" +
+	"\x04gain\x18\x02 \x01(\rR\x04gain\"\x16\n" +
+	"\x14StreamSamplesRequest\"\x99\x01\n" +
+	"\vSampleBlock\x12\x1f\n" +
+	"\vcenter_freq\x18\x01 \x01(\rR\n" +
+	"centerFreq\x12\x1f\n" +
+	"\vsample_rate\x18\x02 \x01(\rR\n" +
+	"sampleRate\x12.\n" +
+	"\x13timestamp_unix_nano\x18\x03 \x01(\x03R\x11timestampUnixNano\x12\x18\n" +
+	"\asamples\x18\x04 \x01(\fR\asamples\"+\n" +
+	"\x15StreamSpectrumRequest\x12\x12\n" +
+	"\x04bins\x18\x01 \x01(\rR\x04bins\"\x97\x01\n" +
+	"\bSpectrum\x12\x1f\n" +
+	"\vcenter_freq\x18\x01 \x01(\rR\n" +
+	"centerFreq\x12\x1f\n" +
+	"\vsample_rate\x18\x02 \x01(\rR\n" +
+	"sampleRate\x12.\n" +
+	"\x13timestamp_unix_nano\x18\x03 \x01(\x03R\x11timestampUnixNano\x12\x19\n" +
+	"\bpower_db\x18\x04 \x03(\x02R\apowerDb2\xf0\x02\n" +
+	"\x03SDR\x122\n" +
+	"\bGetState\x12\x17.rtltcp.GetStateRequest\x1a\r.rtltcp.State\x12:\n" +
+	"\fSetFrequency\x12\x1b.rtltcp.SetFrequencyRequest\x1a\r.rtltcp.State\x12<\n" +
+	"\rSetSampleRate\x12\x1c.rtltcp.SetSampleRateRequest\x1a\r.rtltcp.State\x120\n" +
+	"\aSetGain\x12\x16.rtltcp.SetGainRequest\x1a\r.rtltcp.State\x12D\n" +
+	"\rStreamSamples\x12\x1c.rtltcp.StreamSamplesRequest\x1a\x13.rtltcp.SampleBlock0\x01\x12C\n" +
+	"\x0eStreamSpectrum\x12\x1d.rtltcp.StreamSpectrumRequest\x1a\x10.rtltcp.Spectrum0\x01B Z\x1egithub.com/bemasher/rtltcp/rpcb\x06proto3"
+
+var (
+	file_rtltcp_proto_rawDescOnce sync.Once
+	file_rtltcp_proto_rawDescData []byte
+)
+
+func file_rtltcp_proto_rawDescGZIP() []byte {
+	file_rtltcp_proto_rawDescOnce.Do(func() {
+		file_rtltcp_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_rtltcp_proto_rawDesc), len(file_rtltcp_proto_rawDesc)))
+	})
+	return file_rtltcp_proto_rawDescData
+}
+
+var file_rtltcp_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_rtltcp_proto_goTypes = []any{
+	(*GetStateRequest)(nil),       // 0: rtltcp.GetStateRequest
+	(*State)(nil),                 // 1: rtltcp.State
+	(*SetFrequencyRequest)(nil),   // 2: rtltcp.SetFrequencyRequest
+	(*SetSampleRateRequest)(nil),  // 3: rtltcp.SetSampleRateRequest
+	(*SetGainRequest)(nil),        // 4: rtltcp.SetGainRequest
+	(*StreamSamplesRequest)(nil),  // 5: rtltcp.StreamSamplesRequest
+	(*SampleBlock)(nil),           // 6: rtltcp.SampleBlock
+	(*StreamSpectrumRequest)(nil), // 7: rtltcp.StreamSpectrumRequest
+	(*Spectrum)(nil),              // 8: rtltcp.Spectrum
+}
+var file_rtltcp_proto_depIdxs = []int32{
+	0, // 0: rtltcp.SDR.GetState:input_type -> rtltcp.GetStateRequest
+	2, // 1: rtltcp.SDR.SetFrequency:input_type -> rtltcp.SetFrequencyRequest
+	3, // 2: rtltcp.SDR.SetSampleRate:input_type -> rtltcp.SetSampleRateRequest
+	4, // 3: rtltcp.SDR.SetGain:input_type -> rtltcp.SetGainRequest
+	5, // 4: rtltcp.SDR.StreamSamples:input_type -> rtltcp.StreamSamplesRequest
+	7, // 5: rtltcp.SDR.StreamSpectrum:input_type -> rtltcp.StreamSpectrumRequest
+	1, // 6: rtltcp.SDR.GetState:output_type -> rtltcp.State
+	1, // 7: rtltcp.SDR.SetFrequency:output_type -> rtltcp.State
+	1, // 8: rtltcp.SDR.SetSampleRate:output_type -> rtltcp.State
+	1, // 9: rtltcp.SDR.SetGain:output_type -> rtltcp.State
+	6, // 10: rtltcp.SDR.StreamSamples:output_type -> rtltcp.SampleBlock
+	8, // 11: rtltcp.SDR.StreamSpectrum:output_type -> rtltcp.Spectrum
+	6, // [6:12] is the sub-list for method output_type
+	0, // [0:6] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_rtltcp_proto_init() }
+func file_rtltcp_proto_init() {
+	if File_rtltcp_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_rtltcp_proto_rawDesc), len(file_rtltcp_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_rtltcp_proto_goTypes,
+		DependencyIndexes: file_rtltcp_proto_depIdxs,
+		MessageInfos:      file_rtltcp_proto_msgTypes,
+	}.Build()
+	File_rtltcp_proto = out.File
+	file_rtltcp_proto_goTypes = nil
+	file_rtltcp_proto_depIdxs = nil
+}
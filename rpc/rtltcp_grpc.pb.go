@@ -0,0 +1,332 @@
+// Remote control and streaming of an rtl_tcp dongle.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: rtltcp.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SDR_GetState_FullMethodName       = "/rtltcp.SDR/GetState"
+	SDR_SetFrequency_FullMethodName   = "/rtltcp.SDR/SetFrequency"
+	SDR_SetSampleRate_FullMethodName  = "/rtltcp.SDR/SetSampleRate"
+	SDR_SetGain_FullMethodName        = "/rtltcp.SDR/SetGain"
+	SDR_StreamSamples_FullMethodName  = "/rtltcp.SDR/StreamSamples"
+	SDR_StreamSpectrum_FullMethodName = "/rtltcp.SDR/StreamSpectrum"
+)
+
+// SDRClient is the client API for SDR service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SDRClient interface {
+	// Returns the dongle's identity and current settings.
+	GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*State, error)
+	// Set the center frequency in Hz.
+	SetFrequency(ctx context.Context, in *SetFrequencyRequest, opts ...grpc.CallOption) (*State, error)
+	// Set the sample rate in Hz.
+	SetSampleRate(ctx context.Context, in *SetSampleRateRequest, opts ...grpc.CallOption) (*State, error)
+	// Select tuner AGC or a manual gain.
+	SetGain(ctx context.Context, in *SetGainRequest, opts ...grpc.CallOption) (*State, error)
+	// Streams raw sample blocks until the client cancels.
+	StreamSamples(ctx context.Context, in *StreamSamplesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SampleBlock], error)
+	// Streams one averaged power spectrum per block until the client cancels.
+	StreamSpectrum(ctx context.Context, in *StreamSpectrumRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Spectrum], error)
+}
+
+type sDRClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSDRClient(cc grpc.ClientConnInterface) SDRClient {
+	return &sDRClient{cc}
+}
+
+func (c *sDRClient) GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*State, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(State)
+	err := c.cc.Invoke(ctx, SDR_GetState_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sDRClient) SetFrequency(ctx context.Context, in *SetFrequencyRequest, opts ...grpc.CallOption) (*State, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(State)
+	err := c.cc.Invoke(ctx, SDR_SetFrequency_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sDRClient) SetSampleRate(ctx context.Context, in *SetSampleRateRequest, opts ...grpc.CallOption) (*State, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(State)
+	err := c.cc.Invoke(ctx, SDR_SetSampleRate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sDRClient) SetGain(ctx context.Context, in *SetGainRequest, opts ...grpc.CallOption) (*State, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(State)
+	err := c.cc.Invoke(ctx, SDR_SetGain_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sDRClient) StreamSamples(ctx context.Context, in *StreamSamplesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SampleBlock], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SDR_ServiceDesc.Streams[0], SDR_StreamSamples_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamSamplesRequest, SampleBlock]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SDR_StreamSamplesClient = grpc.ServerStreamingClient[SampleBlock]
+
+func (c *sDRClient) StreamSpectrum(ctx context.Context, in *StreamSpectrumRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Spectrum], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SDR_ServiceDesc.Streams[1], SDR_StreamSpectrum_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamSpectrumRequest, Spectrum]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SDR_StreamSpectrumClient = grpc.ServerStreamingClient[Spectrum]
+
+// SDRServer is the server API for SDR service.
+// All implementations must embed UnimplementedSDRServer
+// for forward compatibility.
+type SDRServer interface {
+	// Returns the dongle's identity and current settings.
+	GetState(context.Context, *GetStateRequest) (*State, error)
+	// Set the center frequency in Hz.
+	SetFrequency(context.Context, *SetFrequencyRequest) (*State, error)
+	// Set the sample rate in Hz.
+	SetSampleRate(context.Context, *SetSampleRateRequest) (*State, error)
+	// Select tuner AGC or a manual gain.
+	SetGain(context.Context, *SetGainRequest) (*State, error)
+	// Streams raw sample blocks until the client cancels.
+	StreamSamples(*StreamSamplesRequest, grpc.ServerStreamingServer[SampleBlock]) error
+	// Streams one averaged power spectrum per block until the client cancels.
+	StreamSpectrum(*StreamSpectrumRequest, grpc.ServerStreamingServer[Spectrum]) error
+	mustEmbedUnimplementedSDRServer()
+}
+
+// UnimplementedSDRServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSDRServer struct{}
+
+func (UnimplementedSDRServer) GetState(context.Context, *GetStateRequest) (*State, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedSDRServer) SetFrequency(context.Context, *SetFrequencyRequest) (*State, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetFrequency not implemented")
+}
+func (UnimplementedSDRServer) SetSampleRate(context.Context, *SetSampleRateRequest) (*State, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetSampleRate not implemented")
+}
+func (UnimplementedSDRServer) SetGain(context.Context, *SetGainRequest) (*State, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetGain not implemented")
+}
+func (UnimplementedSDRServer) StreamSamples(*StreamSamplesRequest, grpc.ServerStreamingServer[SampleBlock]) error {
+	return status.Error(codes.Unimplemented, "method StreamSamples not implemented")
+}
+func (UnimplementedSDRServer) StreamSpectrum(*StreamSpectrumRequest, grpc.ServerStreamingServer[Spectrum]) error {
+	return status.Error(codes.Unimplemented, "method StreamSpectrum not implemented")
+}
+func (UnimplementedSDRServer) mustEmbedUnimplementedSDRServer() {}
+func (UnimplementedSDRServer) testEmbeddedByValue()             {}
+
+// UnsafeSDRServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SDRServer will
+// result in compilation errors.
+type UnsafeSDRServer interface {
+	mustEmbedUnimplementedSDRServer()
+}
+
+func RegisterSDRServer(s grpc.ServiceRegistrar, srv SDRServer) {
+	// If the following call panics, it indicates UnimplementedSDRServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SDR_ServiceDesc, srv)
+}
+
+func _SDR_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SDRServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SDR_GetState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SDRServer).GetState(ctx, req.(*GetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SDR_SetFrequency_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetFrequencyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SDRServer).SetFrequency(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SDR_SetFrequency_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SDRServer).SetFrequency(ctx, req.(*SetFrequencyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SDR_SetSampleRate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetSampleRateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SDRServer).SetSampleRate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SDR_SetSampleRate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SDRServer).SetSampleRate(ctx, req.(*SetSampleRateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SDR_SetGain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetGainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SDRServer).SetGain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SDR_SetGain_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SDRServer).SetGain(ctx, req.(*SetGainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SDR_StreamSamples_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamSamplesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SDRServer).StreamSamples(m, &grpc.GenericServerStream[StreamSamplesRequest, SampleBlock]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SDR_StreamSamplesServer = grpc.ServerStreamingServer[SampleBlock]
+
+func _SDR_StreamSpectrum_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamSpectrumRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SDRServer).StreamSpectrum(m, &grpc.GenericServerStream[StreamSpectrumRequest, Spectrum]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SDR_StreamSpectrumServer = grpc.ServerStreamingServer[Spectrum]
+
+// SDR_ServiceDesc is the grpc.ServiceDesc for SDR service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SDR_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rtltcp.SDR",
+	HandlerType: (*SDRServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetState",
+			Handler:    _SDR_GetState_Handler,
+		},
+		{
+			MethodName: "SetFrequency",
+			Handler:    _SDR_SetFrequency_Handler,
+		},
+		{
+			MethodName: "SetSampleRate",
+			Handler:    _SDR_SetSampleRate_Handler,
+		},
+		{
+			MethodName: "SetGain",
+			Handler:    _SDR_SetGain_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSamples",
+			Handler:       _SDR_StreamSamples_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamSpectrum",
+			Handler:       _SDR_StreamSpectrum_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rtltcp.proto",
+}
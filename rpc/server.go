@@ -0,0 +1,198 @@
+// Package rpc provides a gRPC service for controlling and streaming from an
+// SDR, defined in rtltcp.proto.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative rtltcp.proto
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Blocks queued per streaming client before blocks are dropped.
+const streamQueue = 16
+
+// Default and largest number of spectrum bins a client may request.
+const (
+	defaultBins = 1024
+	maxBins     = 1 << 16
+)
+
+// Server bridges the SDR service to a connected SDR. Control calls are
+// applied to the SDR directly. Blocks reach streaming clients through the
+// server's WriteBlock, so the server is attached to the SDR's stream as a
+// sink. Clients that fall behind miss blocks rather than stalling others.
+type Server struct {
+	UnimplementedSDRServer
+
+	sdr *rtltcp.SDR
+
+	mu      sync.Mutex
+	streams map[chan rtltcp.Block]struct{}
+}
+
+// Returns a server controlling sdr. Register it on a grpc.Server with
+// RegisterSDRServer.
+func NewServer(sdr *rtltcp.SDR) *Server {
+	return &Server{
+		sdr:     sdr,
+		streams: make(map[chan rtltcp.Block]struct{}),
+	}
+}
+
+func (s *Server) state() *State {
+	m := s.sdr.Metadata()
+	return &State{
+		Tuner:      s.sdr.Info.Tuner.String(),
+		GainCount:  s.sdr.Info.GainCount,
+		CenterFreq: m.CenterFreq,
+		SampleRate: m.SampleRate,
+		AutoGain:   m.AutoGain,
+		Gain:       m.Gain,
+	}
+}
+
+func (s *Server) GetState(ctx context.Context, req *GetStateRequest) (*State, error) {
+	return s.state(), nil
+}
+
+func (s *Server) SetFrequency(ctx context.Context, req *SetFrequencyRequest) (*State, error) {
+	if err := s.sdr.SetCenterFreq(req.Frequency); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "setting frequency: %s", err)
+	}
+	return s.state(), nil
+}
+
+func (s *Server) SetSampleRate(ctx context.Context, req *SetSampleRateRequest) (*State, error) {
+	if err := s.sdr.SetSampleRate(req.SampleRate); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "setting sample rate: %s", err)
+	}
+	return s.state(), nil
+}
+
+func (s *Server) SetGain(ctx context.Context, req *SetGainRequest) (*State, error) {
+	err := s.sdr.SetTunerAGC(req.Auto)
+	if err == nil && !req.Auto {
+		err = s.sdr.SetGain(req.Gain)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "setting gain: %s", err)
+	}
+	return s.state(), nil
+}
+
+// Registers a stream and returns its queue and a function to remove it.
+func (s *Server) subscribe() (chan rtltcp.Block, func()) {
+	ch := make(chan rtltcp.Block, streamQueue)
+	s.mu.Lock()
+	s.streams[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.streams, ch)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) StreamSamples(req *StreamSamplesRequest, stream SDR_StreamSamplesServer) error {
+	blocks, cancel := s.subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case blk, ok := <-blocks:
+			if !ok {
+				return status.Error(codes.Unavailable, "server closed")
+			}
+			err := stream.Send(&SampleBlock{
+				CenterFreq:        blk.CenterFreq,
+				SampleRate:        blk.SampleRate,
+				TimestampUnixNano: blk.Timestamp.UnixNano(),
+				Samples:           blk.Samples,
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (s *Server) StreamSpectrum(req *StreamSpectrumRequest, stream SDR_StreamSpectrumServer) error {
+	bins := int(req.Bins)
+	if bins == 0 {
+		bins = defaultBins
+	}
+	if bins < 8 || bins > maxBins || bins&(bins-1) != 0 {
+		return status.Errorf(codes.InvalidArgument, "bins must be a power of two between 8 and %d", maxBins)
+	}
+
+	spec := dsp.NewSpectrum(bins, dsp.Hann)
+	var iq []complex64
+
+	blocks, cancel := s.subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case blk, ok := <-blocks:
+			if !ok {
+				return status.Error(codes.Unavailable, "server closed")
+			}
+			iq = dsp.ConvertU8(iq[:0], blk.Samples)
+			power := spec.PowerDB(nil, iq)
+			if len(power) == 0 {
+				continue
+			}
+			err := stream.Send(&Spectrum{
+				CenterFreq:        blk.CenterFreq,
+				SampleRate:        blk.SampleRate,
+				TimestampUnixNano: blk.Timestamp.UnixNano(),
+				PowerDb:           power,
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// Delivers a block to all streaming clients.
+func (s *Server) WriteBlock(blk rtltcp.Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.streams) == 0 {
+		return nil
+	}
+
+	blk.Samples = append([]byte(nil), blk.Samples...)
+	for ch := range s.streams {
+		select {
+		case ch <- blk:
+		default:
+		}
+	}
+	return nil
+}
+
+// Ends all streams.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.streams {
+		close(ch)
+		delete(s.streams, ch)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+//go:build rtlsdr && cgo
+
+package rtlsdr
+
+/*
+#cgo pkg-config: librtlsdr
+#include <stdlib.h>
+#include <rtl-sdr.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// librtlsdr device handle.
+type handle struct {
+	dev *C.rtlsdr_dev_t
+}
+
+// Returns an error for a negative librtlsdr return code.
+func check(r C.int) error {
+	if r < 0 {
+		return fmt.Errorf("librtlsdr error %d", int(r))
+	}
+	return nil
+}
+
+func boolInt(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func devices() ([]DeviceInfo, error) {
+	n := int(C.rtlsdr_get_device_count())
+	devices := make([]DeviceInfo, 0, n)
+	var manufacturer, product, serial [256]C.char
+	for i := 0; i < n; i++ {
+		dev := DeviceInfo{Index: i, Name: C.GoString(C.rtlsdr_get_device_name(C.uint32_t(i)))}
+		if C.rtlsdr_get_device_usb_strings(C.uint32_t(i), &manufacturer[0], &product[0], &serial[0]) == 0 {
+			dev.Manufacturer = C.GoString(&manufacturer[0])
+			dev.Product = C.GoString(&product[0])
+			dev.Serial = C.GoString(&serial[0])
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+func open(index int) (*handle, error) {
+	h := new(handle)
+	if err := check(C.rtlsdr_open(&h.dev, C.uint32_t(index))); err != nil {
+		return nil, fmt.Errorf("Error opening dongle %d: %s", index, err)
+	}
+	return h, nil
+}
+
+func (h *handle) tuner() rtltcp.Tuner {
+	// librtlsdr's enum numbers tuners as rtl_tcp's header does.
+	return rtltcp.Tuner(C.rtlsdr_get_tuner_type(h.dev))
+}
+
+func (h *handle) gains() []int {
+	n := C.rtlsdr_get_tuner_gains(h.dev, nil)
+	if n <= 0 {
+		return nil
+	}
+	buf := make([]C.int, n)
+	n = C.rtlsdr_get_tuner_gains(h.dev, &buf[0])
+	gains := make([]int, 0, n)
+	for _, g := range buf[:max(n, 0)] {
+		gains = append(gains, int(g))
+	}
+	return gains
+}
+
+func (h *handle) resetBuffer() error {
+	return check(C.rtlsdr_reset_buffer(h.dev))
+}
+
+func (h *handle) setCenterFreq(freq uint32) error {
+	return check(C.rtlsdr_set_center_freq(h.dev, C.uint32_t(freq)))
+}
+
+func (h *handle) setSampleRate(rate uint32) error {
+	return check(C.rtlsdr_set_sample_rate(h.dev, C.uint32_t(rate)))
+}
+
+func (h *handle) setGainMode(manual bool) error {
+	return check(C.rtlsdr_set_tuner_gain_mode(h.dev, boolInt(manual)))
+}
+
+func (h *handle) setGain(gain int) error {
+	return check(C.rtlsdr_set_tuner_gain(h.dev, C.int(gain)))
+}
+
+func (h *handle) setFreqCorrection(ppm int) error {
+	return check(C.rtlsdr_set_freq_correction(h.dev, C.int(ppm)))
+}
+
+func (h *handle) setIFGain(stage, gain int) error {
+	return check(C.rtlsdr_set_tuner_if_gain(h.dev, C.int(stage), C.int(gain)))
+}
+
+func (h *handle) setTestMode(on bool) error {
+	return check(C.rtlsdr_set_testmode(h.dev, boolInt(on)))
+}
+
+func (h *handle) setAGCMode(on bool) error {
+	return check(C.rtlsdr_set_agc_mode(h.dev, boolInt(on)))
+}
+
+func (h *handle) setDirectSampling(mode int) error {
+	return check(C.rtlsdr_set_direct_sampling(h.dev, C.int(mode)))
+}
+
+func (h *handle) setOffsetTuning(on bool) error {
+	return check(C.rtlsdr_set_offset_tuning(h.dev, boolInt(on)))
+}
+
+// Sets either crystal frequency, leaving the other as it is if zero.
+func (h *handle) setXtalFreq(rtl, tuner uint32) error {
+	var curRTL, curTuner C.uint32_t
+	if err := check(C.rtlsdr_get_xtal_freq(h.dev, &curRTL, &curTuner)); err != nil {
+		return err
+	}
+	if rtl != 0 {
+		curRTL = C.uint32_t(rtl)
+	}
+	if tuner != 0 {
+		curTuner = C.uint32_t(tuner)
+	}
+	return check(C.rtlsdr_set_xtal_freq(h.dev, curRTL, curTuner))
+}
+
+func (h *handle) readSync(buf []byte) (int, error) {
+	var n C.int
+	err := check(C.rtlsdr_read_sync(h.dev, unsafe.Pointer(&buf[0]), C.int(len(buf)), &n))
+	return int(n), err
+}
+
+func (h *handle) close() error {
+	return check(C.rtlsdr_close(h.dev))
+}
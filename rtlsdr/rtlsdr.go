@@ -0,0 +1,325 @@
+// Package rtlsdr drives a locally attached dongle through librtlsdr,
+// presenting it through the same source interface as a connection to
+// rtl_tcp, so applications can run against local or remote hardware with
+// one code path.
+//
+// The bindings use cgo and are only built with the rtlsdr build tag, with
+// librtlsdr and its headers installed where pkg-config finds them:
+//
+//	go build -tags rtlsdr ./...
+//
+// Without the tag the package still builds, but Open and Devices fail with
+// ErrUnsupported.
+package rtlsdr
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Returned by Open and Devices when built without librtlsdr.
+var ErrUnsupported = errors.New("rtlsdr: built without librtlsdr, rebuild with -tags rtlsdr")
+
+// Bytes the dongle buffers ahead of reads, which librtlsdr's synchronous
+// reads leave to the kernel's USB transfers.
+const bufferDepth = 16 * 16384
+
+// Largest synchronous read, a multiple of librtlsdr's 512 byte USB packets.
+const maxRead = 256 * 1024
+
+// A dongle attached to this host.
+type DeviceInfo struct {
+	Index        int
+	Name         string
+	Manufacturer string
+	Product      string
+	Serial       string
+}
+
+// Returns the dongles attached to this host.
+func Devices() ([]DeviceInfo, error) {
+	return devices()
+}
+
+// Device is an open dongle.
+type Device struct {
+	// Header rtl_tcp would send for the dongle, tuner and gain count.
+	Info rtltcp.DongleInfo
+
+	mu      sync.Mutex // Serializes librtlsdr calls.
+	h       *handle
+	gains   []int  // Tenths of a dB, lowest first, per rtlsdr_get_tuner_gains.
+	pending []byte // Samples read beyond the last block.
+	scratch []byte
+	index   uint64 // Samples delivered since opening.
+
+	stateMu sync.Mutex
+	state   rtltcp.Metadata
+}
+
+var _ rtltcp.Source = (*Device)(nil)
+
+// Opens the dongle at index, per Devices.
+func Open(index int) (*Device, error) {
+	h, err := open(index)
+	if err != nil {
+		return nil, err
+	}
+	d := &Device{h: h, scratch: make([]byte, maxRead)}
+	d.Info = rtltcp.DongleInfo{Tuner: h.tuner()}
+	copy(d.Info.Magic[:], "RTL0")
+	d.gains = h.gains()
+	d.Info.GainCount = uint32(len(d.gains))
+	if err := h.resetBuffer(); err != nil {
+		h.close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Opens the dongle with the given serial.
+func OpenSerial(serial string) (*Device, error) {
+	devices, err := Devices()
+	if err != nil {
+		return nil, err
+	}
+	for _, dev := range devices {
+		if dev.Serial == serial {
+			return Open(dev.Index)
+		}
+	}
+	return nil, fmt.Errorf("rtlsdr: no dongle with serial %q", serial)
+}
+
+// Returns the gains in tenths of a dB the tuner accepts, lowest first.
+func (d *Device) Gains() []int {
+	return append([]int(nil), d.gains...)
+}
+
+// Returns the capabilities of the dongle's tuner, with the gains librtlsdr
+// reports for it.
+func (d *Device) Capabilities() rtltcp.Capabilities {
+	c := d.Info.Tuner.Capabilities()
+	if len(d.gains) > 0 {
+		c.Gains = d.Gains()
+	}
+	return c
+}
+
+// Returns a snapshot of the acquisition state as of the last setting.
+func (d *Device) Metadata() rtltcp.Metadata {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+	return d.state
+}
+
+func (d *Device) update(fn func(*rtltcp.Metadata)) {
+	d.stateMu.Lock()
+	fn(&d.state)
+	d.stateMu.Unlock()
+}
+
+// Calls fn holding the librtlsdr lock, wrapping a failure with what was
+// being set.
+func (d *Device) call(what string, fn func(*handle) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.h == nil {
+		return errors.New("rtlsdr: device closed")
+	}
+	if err := fn(d.h); err != nil {
+		return fmt.Errorf("Error setting %s: %s", what, err)
+	}
+	return nil
+}
+
+// Set the center frequency in Hz.
+func (d *Device) SetCenterFreq(freq uint32) error {
+	err := d.call("center frequency", func(h *handle) error { return h.setCenterFreq(freq) })
+	if err == nil {
+		d.update(func(m *rtltcp.Metadata) { m.CenterFreq = freq })
+	}
+	return err
+}
+
+// Set the sample rate in Hz.
+func (d *Device) SetSampleRate(rate uint32) error {
+	err := d.call("sample rate", func(h *handle) error { return h.setSampleRate(rate) })
+	if err == nil {
+		d.update(func(m *rtltcp.Metadata) { m.SampleRate = rate })
+	}
+	return err
+}
+
+// Set the tuner AGC, true to enable, as rtltcp.SDR.SetTunerAGC.
+func (d *Device) SetTunerAGC(enabled bool) error {
+	err := d.call("gain mode", func(h *handle) error { return h.setGainMode(!enabled) })
+	if err == nil {
+		d.update(func(m *rtltcp.Metadata) { m.AutoGain = enabled })
+	}
+	return err
+}
+
+// Select manual tuner gain, or with false the tuner AGC, as
+// rtltcp.SDR.SetManualGainMode.
+func (d *Device) SetManualGainMode(manual bool) error {
+	return d.SetTunerAGC(!manual)
+}
+
+// Set the tuner AGC, true to enable.
+//
+// Deprecated: Use SetTunerAGC, which behaves the same, or SetManualGainMode.
+func (d *Device) SetGainMode(auto bool) error {
+	return d.SetTunerAGC(auto)
+}
+
+// Set gain in tenths of dB. (197 => 19.7dB)
+func (d *Device) SetGain(gain uint32) error {
+	err := d.call("gain", func(h *handle) error { return h.setGain(int(int32(gain))) })
+	if err == nil {
+		d.update(func(m *rtltcp.Metadata) { m.Gain = gain })
+	}
+	return err
+}
+
+// Set gain by index into Gains.
+func (d *Device) SetGainByIndex(idx uint32) error {
+	if idx >= uint32(len(d.gains)) {
+		return fmt.Errorf("invalid gain index: %d", idx)
+	}
+	return d.SetGain(uint32(int32(d.gains[idx])))
+}
+
+// Set frequency correction in ppm.
+func (d *Device) SetFreqCorrection(ppm int) error {
+	return d.call("frequency correction", func(h *handle) error { return h.setFreqCorrection(ppm) })
+}
+
+// Set tuner intermediate frequency stage and gain in tenths of a dB.
+func (d *Device) SetTunerIfGain(stage, gain int) error {
+	return d.call("IF gain", func(h *handle) error { return h.setIFGain(stage, gain) })
+}
+
+// Set test mode, true for enabled.
+func (d *Device) SetTestMode(state bool) error {
+	return d.call("test mode", func(h *handle) error { return h.setTestMode(state) })
+}
+
+// Set RTL AGC mode, true for enabled.
+func (d *Device) SetAGCMode(state bool) error {
+	return d.call("AGC mode", func(h *handle) error { return h.setAGCMode(state) })
+}
+
+// Set direct sampling mode: 0 off, 1 the I branch, 2 the Q branch.
+func (d *Device) SetDirectSampling(mode int) error {
+	return d.call("direct sampling", func(h *handle) error { return h.setDirectSampling(mode) })
+}
+
+// Set offset tuning, true for enabled.
+func (d *Device) SetOffsetTuning(state bool) error {
+	return d.call("offset tuning", func(h *handle) error { return h.setOffsetTuning(state) })
+}
+
+// Set RTL xtal frequency.
+func (d *Device) SetRTLXtalFreq(freq uint32) error {
+	return d.call("RTL xtal frequency", func(h *handle) error { return h.setXtalFreq(freq, 0) })
+}
+
+// Set tuner xtal frequency.
+func (d *Device) SetTunerXtalFreq(freq uint32) error {
+	return d.call("tuner xtal frequency", func(h *handle) error { return h.setXtalFreq(0, freq) })
+}
+
+// Applies a command of the rtl_tcp protocol as rtl_tcp would.
+func (d *Device) Execute(cmd rtltcp.Command) error {
+	p := cmd.Parameter
+	switch cmd.Opcode {
+	case rtltcp.CenterFreq:
+		return d.SetCenterFreq(p)
+	case rtltcp.SampleRate:
+		return d.SetSampleRate(p)
+	case rtltcp.TunerGainMode:
+		// rtl_tcp's parameter selects manual gain when set.
+		return d.SetManualGainMode(p != 0)
+	case rtltcp.TunerGain:
+		return d.SetGain(p)
+	case rtltcp.FreqCorrection:
+		return d.SetFreqCorrection(int(int32(p)))
+	case rtltcp.TunerIfGain:
+		return d.SetTunerIfGain(int(p>>16), int(int16(p)))
+	case rtltcp.TestMode:
+		return d.SetTestMode(p != 0)
+	case rtltcp.AGCMode:
+		return d.SetAGCMode(p != 0)
+	case rtltcp.DirectSampling:
+		return d.SetDirectSampling(int(p))
+	case rtltcp.OffsetTuning:
+		return d.SetOffsetTuning(p != 0)
+	case rtltcp.RTLXtalFreq:
+		return d.SetRTLXtalFreq(p)
+	case rtltcp.TunerXtalFreq:
+		return d.SetTunerXtalFreq(p)
+	case rtltcp.GainByIndex:
+		return d.SetGainByIndex(p)
+	}
+	return fmt.Errorf("rtlsdr: unknown opcode %d", cmd.Opcode)
+}
+
+// Fills buf with samples and returns it as a block tagged with the current
+// acquisition state.
+func (d *Device) ReadBlock(buf []byte) (blk rtltcp.Block, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.h == nil {
+		return blk, errors.New("rtlsdr: device closed")
+	}
+
+	n := copy(buf, d.pending)
+	d.pending = d.pending[n:]
+	for n < len(buf) {
+		// Whole packets, the excess kept for the next block.
+		want := min(maxRead, (len(buf)-n+511)/512*512)
+		got, err := d.h.readSync(d.scratch[:want])
+		if err != nil {
+			return blk, fmt.Errorf("Error reading samples: %s", err)
+		}
+		c := copy(buf[n:], d.scratch[:got])
+		n += c
+		d.pending = append(d.pending[:0], d.scratch[c:got]...)
+	}
+
+	blk.Metadata = d.Metadata()
+	blk.Samples = buf
+	blk.Index = d.index
+	d.index += uint64(blk.Len())
+	blk.Received = time.Now()
+	if rate := blk.SampleRate; rate > 0 {
+		samples := (len(buf) + bufferDepth) / 2
+		blk.Timestamp = blk.Received.Add(-time.Duration(float64(samples) / float64(rate) * float64(time.Second)))
+	} else {
+		blk.Timestamp = blk.Received
+	}
+	return blk, nil
+}
+
+// Discards samples buffered by librtlsdr, so a new stream starts fresh.
+func (d *Device) resetBuffer() error {
+	d.pending = d.pending[:0]
+	return d.call("buffer reset", func(h *handle) error { return h.resetBuffer() })
+}
+
+// Closes the dongle.
+func (d *Device) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.h == nil {
+		return nil
+	}
+	err := d.h.close()
+	d.h = nil
+	return err
+}
@@ -0,0 +1,117 @@
+package rtlsdr
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Opens the first attached dongle when built with the rtlsdr tag, skipping
+// if there is none.
+func openTest(t *testing.T) *Device {
+	devices, err := Devices()
+	if errors.Is(err, ErrUnsupported) {
+		if _, err := Open(0); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("open returned %v", err)
+		}
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) == 0 {
+		t.Skip("no dongle attached")
+	}
+
+	d, err := Open(devices[0].Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestDevice(t *testing.T) {
+	d := openTest(t)
+	if !d.Info.Valid() || int(d.Info.GainCount) != len(d.Gains()) {
+		t.Errorf("info %s with %d gains", d.Info, len(d.Gains()))
+	}
+
+	for _, cmd := range []rtltcp.Command{
+		{Opcode: rtltcp.SampleRate, Parameter: 1024000},
+		{Opcode: rtltcp.CenterFreq, Parameter: 100e6},
+		{Opcode: rtltcp.TunerGainMode, Parameter: 1},
+		{Opcode: rtltcp.GainByIndex, Parameter: d.Info.GainCount - 1},
+		{Opcode: rtltcp.TestMode, Parameter: 1},
+	} {
+		if err := d.Execute(cmd); err != nil {
+			t.Fatalf("%+v: %s", cmd, err)
+		}
+	}
+	md := d.Metadata()
+	if md.SampleRate != 1024000 || md.CenterFreq != 100e6 || md.AutoGain || int(md.Gain) != d.Gains()[d.Info.GainCount-1] {
+		t.Errorf("metadata %+v", md)
+	}
+
+	// Test mode counts up, across reads not multiples of a USB packet.
+	buf := make([]byte, 1000)
+	var last byte
+	for i := 0; i < 3; i++ {
+		blk, err := d.ReadBlock(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, b := range blk.Samples {
+			if (i > 0 || j > 0) && b != last+1 {
+				t.Fatalf("block %d byte %d is %d after %d", i, j, b, last)
+			}
+			last = b
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	d := openTest(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go (&Server{Device: d, Token: "secret"}).Serve(l)
+
+	var sdr rtltcp.SDR
+	sdr.Flags.Token = "secret"
+	if err := sdr.ConnectAddr(l.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if sdr.Info != d.Info {
+		t.Errorf("header %s, dongle %s", sdr.Info, d.Info)
+	}
+
+	if err := sdr.SetTestMode(true); err != nil {
+		t.Fatal(err)
+	}
+	// Samples before the command took effect are skipped, then the test
+	// counter runs on.
+	buf := make([]byte, 4096)
+	for deadline := time.Now().Add(time.Second); ; {
+		blk, err := sdr.ReadBlock(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counting := true
+		for i := 1; i < len(blk.Samples); i++ {
+			counting = counting && blk.Samples[i] == blk.Samples[i-1]+1
+		}
+		if counting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("test mode never took effect")
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package rtlsdr
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Time allowed for a client to present its token.
+const authTimeout = 10 * time.Second
+
+// Opens the dongle addressed by addr: rtlsdr://index, or
+// rtlsdr://?serial=s to select one by serial.
+func OpenAddr(addr string) (*Device, error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme != "rtlsdr" {
+		return nil, fmt.Errorf("rtlsdr: invalid dongle address %q", addr)
+	}
+	if serial := u.Query().Get("serial"); serial != "" {
+		return OpenSerial(serial)
+	}
+	index := 0
+	if u.Host != "" {
+		if index, err = strconv.Atoi(u.Host); err != nil {
+			return nil, fmt.Errorf("rtlsdr: invalid dongle index %q", u.Host)
+		}
+	}
+	return Open(index)
+}
+
+// Server serves a local dongle over the rtl_tcp protocol in place of the
+// rtl_tcp binary. As with rtl_tcp, clients are served one at a time, the
+// next accepted once the last disconnects.
+type Server struct {
+	Device *Device
+	// Bytes per write to the client, rtltcp.DefaultBlockSize if zero.
+	BlockSize int
+	// Token clients must present, see rtltcp.WriteAuth. None if empty.
+	Token string
+	// Discard commands from clients.
+	ReadOnly bool
+}
+
+// Serves clients accepted from l until accepting fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		if err := s.ServeConn(conn); err != nil {
+			log.Printf("rtlsdr client %s: %s", conn.RemoteAddr(), err)
+		}
+	}
+}
+
+// Serves one client until it disconnects or streaming fails.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	if s.Token != "" {
+		conn.SetReadDeadline(time.Now().Add(authTimeout))
+		token, err := rtltcp.ReadAuth(conn)
+		if err != nil {
+			return fmt.Errorf("Error reading token: %s", err)
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			return errors.New("rtlsdr: invalid token")
+		}
+		conn.SetReadDeadline(time.Time{})
+	}
+
+	d := s.Device
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, d.Info)
+	if _, err := conn.Write(header.Bytes()); err != nil {
+		return fmt.Errorf("Error writing header: %s", err)
+	}
+	if err := d.resetBuffer(); err != nil {
+		return err
+	}
+
+	go s.commands(conn)
+
+	size := s.BlockSize
+	if size <= 0 {
+		size = rtltcp.DefaultBlockSize
+	}
+	buf := make([]byte, size)
+	for {
+		blk, err := d.ReadBlock(buf)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Write(blk.Samples); err != nil {
+			// The client went away, which ends the session normally.
+			return nil
+		}
+	}
+}
+
+// Applies commands read from conn until it closes, closing it to end the
+// stream if the client goes away.
+func (s *Server) commands(conn net.Conn) {
+	var buf [rtltcp.CommandLen]byte
+	for {
+		if _, err := io.ReadFull(conn, buf[:]); err != nil {
+			conn.Close()
+			return
+		}
+		if s.ReadOnly {
+			continue
+		}
+		var cmd rtltcp.Command
+		cmd.Decode(buf[:])
+		if err := s.Device.Execute(cmd); err != nil {
+			// rtl_tcp has no way to report failures, so log them.
+			log.Printf("rtlsdr client %s: %s", conn.RemoteAddr(), err)
+		}
+	}
+}
+
+// Opens the dongle at addr, per OpenAddr, and returns a connection to a
+// Server streaming from it, for code speaking the rtl_tcp protocol such as
+// proxy.Relay. Closing the connection closes the dongle.
+func Dial(addr string) (net.Conn, error) {
+	d, err := OpenAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	client, server := net.Pipe()
+	go func() {
+		(&Server{Device: d}).ServeConn(server)
+		d.Close()
+	}()
+	return client, nil
+}
@@ -0,0 +1,28 @@
+//go:build !rtlsdr || !cgo
+
+package rtlsdr
+
+import "github.com/bemasher/rtltcp"
+
+// Stands in for the librtlsdr device handle.
+type handle struct{}
+
+func devices() ([]DeviceInfo, error) { return nil, ErrUnsupported }
+func open(int) (*handle, error)      { return nil, ErrUnsupported }
+
+func (*handle) tuner() rtltcp.Tuner              { return 0 }
+func (*handle) gains() []int                     { return nil }
+func (*handle) resetBuffer() error               { return ErrUnsupported }
+func (*handle) setCenterFreq(uint32) error       { return ErrUnsupported }
+func (*handle) setSampleRate(uint32) error       { return ErrUnsupported }
+func (*handle) setGainMode(bool) error           { return ErrUnsupported }
+func (*handle) setGain(int) error                { return ErrUnsupported }
+func (*handle) setFreqCorrection(int) error      { return ErrUnsupported }
+func (*handle) setIFGain(int, int) error         { return ErrUnsupported }
+func (*handle) setTestMode(bool) error           { return ErrUnsupported }
+func (*handle) setAGCMode(bool) error            { return ErrUnsupported }
+func (*handle) setDirectSampling(int) error      { return ErrUnsupported }
+func (*handle) setOffsetTuning(bool) error       { return ErrUnsupported }
+func (*handle) setXtalFreq(uint32, uint32) error { return ErrUnsupported }
+func (*handle) readSync([]byte) (int, error)     { return 0, ErrUnsupported }
+func (*handle) close() error                     { return nil }
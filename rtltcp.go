@@ -2,46 +2,216 @@
 package rtltcp
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bemasher/rtltcp/si"
 )
 
 var dongleMagic = [...]byte{'R', 'T', 'L', '0'}
 
-// Contains dongle information and an embedded tcp connection to the spectrum server
+// Contains dongle information and an embedded connection to the spectrum server
 type SDR struct {
-	*net.TCPConn
+	net.Conn
 	Flags Flags
 	Info  DongleInfo
+
+	// Optional TLS configuration the connection is wrapped in, built from
+	// the TLS flags if nil and Flags.TLS is set.
+	TLS *tls.Config
+
+	// TCP keepalive period, the system default if zero and disabled if
+	// negative. Flags.KeepAlive if zero.
+	KeepAlive time.Duration
+	// Size of the socket receive buffer in bytes, the system default if
+	// zero. Flags.ReadBuffer if zero. High sample rates over lossy links
+	// such as Wi-Fi need several megabytes to ride out stalls.
+	ReadBuffer int
+
+	// Bytes per block read by Blocks and PooledBlocks when given zero, two
+	// per sample. Flags.BlockSize if zero, sized to the sample rate if
+	// both are, see ReadBlockSize. Small blocks suit demodulators wanting
+	// low latency, large ones recorders wanting throughput.
+	BlockSize int
+	// Time spanned by blocks sized to the sample rate, Flags.BlockDuration
+	// if zero and DefaultBlockDuration if both are. Readers resize their
+	// blocks when SetSampleRate is called.
+	BlockDuration time.Duration
+
+	// Handling of servers sending no header or an unrecognized one,
+	// HeaderStrict rejecting them. Info is DefaultDongleInfo for those.
+	Header HeaderMode
+	// Time the server is given to send the header, DefaultHeaderTimeout if
+	// zero, or LenientTimeout in HeaderLenient mode. The context's deadline
+	// applies if sooner.
+	HeaderTimeout time.Duration
+	// Wire format of the header and commands, for servers deviating from
+	// rtl_tcp's. DefaultCodec if nil, parsed from Flags.Protocol if set.
+	Codec Codec
+
+	// Check for an identity extension following the header, see
+	// WriteIdentity. Servers without one delay the check by up to
+	// IdentityTimeout if they don't stream immediately.
+	ExtendedHeader bool
+
+	// Optional dialer making the connection instead of a direct TCP dial,
+	// such as an *ssh.Client from the sshdial package. The server address
+	// is resolved by the dialer, so names resolve at its end.
+	Dialer Dialer
+
+	// Bytes buffered between the dongle and this client, used to estimate
+	// the capture time of received blocks. rtl_tcp delivers samples in USB
+	// transfers of DefaultBufferDepth bytes, socket buffers add more.
+	// DefaultBufferDepth if zero, none if negative.
+	BufferDepth int
+
+	// Optional external time reference used to correct block timestamps.
+	Discipline Discipline
+
+	// Frequency shift in Hz of an up or downconverter ahead of the dongle,
+	// e.g. 125e6 for a Ham-It-Up. Frequencies given to and reported by the
+	// SDR are RF frequencies, the dongle is tuned to RF plus this offset.
+	ConverterOffset int64
+
+	// Optional policy for retrying command writes failing temporarily.
+	Retry *RetryPolicy
+
+	// Optional store of per-dongle calibrations, applied on connect. Opened
+	// from Flags.Calibration if nil and the flag is set.
+	Calibrations *CalibrationStore
+	// Enable offset tuning on connecting to a dongle whose tuner it helps,
+	// see Tuner.OffsetTuningHelps. Flags.AutoOffsetTuning if false.
+	AutoOffsetTuning bool
+	// Branch switched to for direct sampling when tuning the dongle below
+	// DirectSamplingCutoff, switching back when tuning above it, so HF and
+	// VHF are tuned alike on dongles which sample HF directly. Off, the
+	// default, leaves direct sampling alone. Flags.AutoDirectSampling if
+	// off.
+	AutoDirectSampling DirectSamplingBranch
+	// Frequency in Hz below which AutoDirectSampling samples directly,
+	// DefaultDirectSamplingCutoff if zero.
+	DirectSamplingCutoff uint32
+
+	// Optional store of named profiles, see ApplyProfile. Only the built in
+	// profiles are available if nil.
+	Profiles *ProfileStore
+
+	// Drop blocks the background reader can't queue instead of waiting for
+	// the receiver, so a slow consumer loses samples here, accounted for,
+	// rather than unnoticed in rtl_tcp's buffers. See Block.Gap.
+	DropOnOverflow bool
+	// Optional callback invoked by the background reader with the number of
+	// samples dropped each time it drops a block. It must not block.
+	OnGap func(samples uint64)
+	// Optional callback invoked by Restore when the dongle differs from the
+	// one settings are restored from, see DongleChange.
+	OnDongleChange func(DongleChange)
+	// Optional callback invoked with each command whose write fails, each
+	// of a batch if Flush fails.
+	OnCommandError func(Command, error)
+
+	mu       sync.Mutex
+	state    Metadata           // Acquisition state as of the last command issued.
+	segment  *Segment           // Boundary not yet attached to a block.
+	settings map[uint32]Command // Last command of each kind, for Restore.
+	err      error              // First error encountered by the background reader.
+	holding  bool               // Commands are held in held until Flush.
+	held     bytes.Buffer
+
+	wmu    sync.Mutex
+	cmdBuf []byte // Encoding of the command being sent.
+
+	received uint64 // Bytes returned by Read, updated atomically.
+	lost     uint64 // Samples dropped by the background reader, updated atomically.
+
+	// Background reader started by Blocks, for Shutdown.
+	stopReader context.CancelFunc
+	readerDone chan struct{}
+	blocks     <-chan Block
+
+	// Identity sent by the server, see ExtendedHeader.
+	identity Identity
+	pending  []byte // Samples read while checking for the extension.
+
+	server     ServerType // Implementation of the server, see ServerType.
+	headerless bool       // No header was received, see Header.
+
+	addr        string      // Address dialed, see CalibrationKey.
+	calibration Calibration // Applied on connect.
+
+	// Set when the server sends 4-bit samples, see Pack4.
+	packed   bool
+	scratch  []byte // Packed samples read.
+	unpacked []byte // Unpacked samples not yet returned by Read.
+
+	iq []byte // Bytes read by ReadIQInto.
 }
 
 // Give an address of the form "127.0.0.1:1234" connects to the spectrum
 // server at the given address or returns an error. The user is responsible
 // for closing this connection. If addr is nil, use "127.0.0.1:1234" or
-// command line flag value.
+// command line flag value, which may name a unix socket, see ParseAddr.
+// See Dial for the connection made.
 func (sdr *SDR) Connect(addr *net.TCPAddr) (err error) {
-	if addr == nil {
-		if sdr.Flags.ServerAddr == "" {
-			sdr.Flags.ServerAddr = "127.0.0.1:1234"
+	if addr != nil {
+		return sdr.Dial("tcp", addr.String())
+	}
+	if sdr.Flags.ServerAddr == "" {
+		sdr.Flags.ServerAddr = "127.0.0.1:1234"
+	}
+	return sdr.ConnectAddr(sdr.Flags.ServerAddr)
+}
+
+// Connects to the server at addr, "host:port" or a unix socket as parsed by
+// ParseAddr. See Dial.
+func (sdr *SDR) ConnectAddr(addr string) error {
+	return sdr.Dial(ParseAddr(addr))
+}
+
+// Connects to the server at address on network, as DialContext without a
+// deadline.
+func (sdr *SDR) Dial(network, address string) error {
+	return sdr.DialContext(context.Background(), network, address)
+}
+
+// Connects to the server at address on network, "tcp" or "unix", and reads
+// its header, giving up when ctx is done. Host names are resolved when dialing, trying each address in
+// turn, so reconnects follow DNS changes and round-robin records. If
+// Flags.Token is set it's presented to the server before the header is
+// read, see WriteAuth. The connection is made by Dialer if set, through
+// Flags.Proxy if set, and wrapped in TLS if TLS or Flags.TLS is set. The
+// header is decoded by Codec.
+func (sdr *SDR) DialContext(ctx context.Context, network, address string) (err error) {
+	if sdr.Codec == nil && sdr.Flags.Protocol != "" {
+		if sdr.Codec, err = ParseProtocol(sdr.Flags.Protocol); err != nil {
+			return
 		}
+	}
 
-		// Parse and resolve rtl_tcp server address.
-		addr, err = net.ResolveTCPAddr("tcp", sdr.Flags.ServerAddr)
-		if err != nil {
+	dialer := sdr.Dialer
+	if sdr.Flags.Proxy != "" {
+		if dialer, err = ProxyDialer(sdr.Flags.Proxy, dialer); err != nil {
 			return
 		}
 	}
 
-	sdr.TCPConn, err = net.DialTCP("tcp", nil, addr)
+	conn, err := dialContext(ctx, dialer, network, address)
 	if err != nil {
 		err = fmt.Errorf("Error connecting to spectrum server: %s", err)
 		return
 	}
+	sdr.Conn = conn
 
 	// If we exit this function due to an error, close the connection.
 	defer func() {
@@ -50,57 +220,183 @@ func (sdr *SDR) Connect(addr *net.TCPAddr) (err error) {
 		}
 	}()
 
-	err = binary.Read(sdr.TCPConn, binary.BigEndian, &sdr.Info)
+	if err = sdr.tuneSocket(conn); err != nil {
+		return
+	}
+
+	// The handshakes and header are bounded by the context too.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	host, _, _ := net.SplitHostPort(address)
+	cfg, err := sdr.tlsConfig(host)
 	if err != nil {
-		err = fmt.Errorf("Error getting dongle information: %s", err)
 		return
 	}
+	if cfg != nil {
+		conn := tls.Client(sdr.Conn, cfg)
+		sdr.Conn = conn
+		if err = conn.HandshakeContext(ctx); err != nil {
+			err = fmt.Errorf("Error negotiating TLS: %s", err)
+			return
+		}
+	}
+
+	if sdr.Flags.Token != "" {
+		if err = WriteAuth(sdr.Conn, sdr.Flags.Token); err != nil {
+			err = fmt.Errorf("Error sending token: %s", err)
+			return
+		}
+	}
+
+	// Stream positions count from the start of each connection.
+	atomic.StoreUint64(&sdr.received, 0)
+	sdr.mu.Lock()
+	sdr.segment = nil
+	sdr.mu.Unlock()
+
+	sdr.identity, sdr.pending = Identity{}, nil
+	if err = sdr.readHeader(ctx); err != nil {
+		return
+	}
+
+	sdr.packed = sdr.Info.Magic == PackedMagic
+	sdr.unpacked = nil
+
+	if sdr.ExtendedHeader && !sdr.headerless {
+		err = sdr.readIdentity(ctx)
+	}
+	sdr.server = sdr.fingerprint()
+
+	sdr.addr, sdr.calibration = address, Calibration{}
+	if sdr.Calibrations == nil && sdr.Flags.Calibration != "" {
+		if sdr.Calibrations, err = OpenCalibrations(sdr.Flags.Calibration); err != nil {
+			return
+		}
+	}
+	if sdr.Calibrations != nil {
+		if c, ok := sdr.Calibrations.Get(sdr.CalibrationKey()); ok {
+			if err = sdr.applyCalibration(c); err != nil {
+				err = fmt.Errorf("Error applying calibration: %s", err)
+				return
+			}
+		}
+	}
 
-	if !sdr.Info.Valid() {
-		err = fmt.Errorf("Invalid magic number: expected %q received %q", dongleMagic, sdr.Info.Magic)
+	if (sdr.AutoOffsetTuning || sdr.Flags.AutoOffsetTuning) && sdr.Info.Tuner.OffsetTuningHelps() {
+		if err = sdr.SetOffsetTuning(true); err != nil {
+			err = fmt.Errorf("Error enabling offset tuning: %s", err)
+			return
+		}
 	}
 
 	return
 }
 
+// Dialer makes connections to servers. *net.Dialer, *ssh.Client and the
+// dialers of golang.org/x/net/proxy implement it. Dialers also implementing
+// ContextDialer are used through it.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// ContextDialer is implemented by dialers honoring cancellation, such as
+// *net.Dialer, which controls source address binding, keepalive and other
+// socket options.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// DialFunc adapts a function such as net.Dialer.DialContext to a Dialer.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f DialFunc) Dial(network, address string) (net.Conn, error) {
+	return f(context.Background(), network, address)
+}
+
+func (f DialFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
 type Flags struct {
-	ServerAddr     string
-	CenterFreq     si.ScientificNotation
-	SampleRate     si.ScientificNotation
-	TunerGainMode  bool
-	TunerGain      float64
-	FreqCorrection int
-	TestMode       bool
-	AgcMode        bool
-	DirectSampling bool
-	OffsetTuning   bool
-	RtlXtalFreq    uint
-	TunerXtalFreq  uint
-	GainByIndex    uint
+	ServerAddr         string
+	Token              string // Presented to relays requiring authentication.
+	Proxy              string // SOCKS5 or HTTP proxy URL to connect through, see ProxyDialer.
+	KeepAlive          time.Duration
+	ReadBuffer         int
+	BlockSize          int
+	BlockDuration      time.Duration
+	TLS                bool   // Connect over TLS.
+	TLSCert            string // Client certificate file, PEM.
+	TLSKey             string // Client certificate key file, PEM.
+	TLSCA              string // CA certificates trusted instead of the system's, PEM.
+	Calibration        string // Calibration store file, see CalibrationStore.
+	Profile            string // Name of a profile applied before other flags.
+	Protocol           string // Name of a protocol variant, see Protocols.
+	AutoOffsetTuning   bool
+	AutoDirectSampling uint
+	CenterFreq         si.ScientificNotation
+	SampleRate         si.ScientificNotation
+	TunerGainMode      bool
+	TunerGain          float64
+	FreqCorrection     int
+	TestMode           bool
+	AgcMode            bool
+	DirectSampling     bool
+	OffsetTuning       bool
+	RtlXtalFreq        uint
+	TunerXtalFreq      uint
+	GainByIndex        uint
+	ConverterOffset    si.ScientificNotation
 }
 
 // Registers command line flags for rtltcp commands.
 func (sdr *SDR) RegisterFlags() {
-	flag.StringVar(&sdr.Flags.ServerAddr, "server", "127.0.0.1:1234", "address or hostname of rtl_tcp instance")
+	flag.StringVar(&sdr.Flags.ServerAddr, "server", "127.0.0.1:1234", "address or hostname of rtl_tcp instance, or unix:path of a socket")
+	flag.StringVar(&sdr.Flags.Token, "token", "", "token presented to relays requiring authentication")
+	flag.StringVar(&sdr.Flags.Proxy, "proxy", "", "connect through proxy socks5://host:port or http://host:port")
+	flag.DurationVar(&sdr.Flags.KeepAlive, "keepalive", 0, "TCP keepalive period, negative to disable")
+	flag.IntVar(&sdr.Flags.ReadBuffer, "rcvbuf", 0, "socket receive buffer size in bytes")
+	flag.IntVar(&sdr.Flags.BlockSize, "blocksize", 0, "bytes per block read from the server, sized to the sample rate if 0")
+	flag.DurationVar(&sdr.Flags.BlockDuration, "blockduration", 0, "time spanned by blocks sized to the sample rate, 20ms if 0")
+	flag.BoolVar(&sdr.Flags.TLS, "tls", false, "connect over TLS")
+	flag.StringVar(&sdr.Flags.TLSCert, "tlscert", "", "client certificate file for TLS")
+	flag.StringVar(&sdr.Flags.TLSKey, "tlskey", "", "client certificate key file for TLS")
+	flag.StringVar(&sdr.Flags.TLSCA, "tlsca", "", "CA certificates to verify the TLS server with")
+	flag.StringVar(&sdr.Flags.Protocol, "protocol", "", "wire protocol variant of the server: rtl_tcp, le, le-cmd or padded")
+	flag.StringVar(&sdr.Flags.Calibration, "calibration", "", "file of per-dongle calibrations applied on connect")
+	flag.StringVar(&sdr.Flags.Profile, "profile", "", "name of a device profile to apply, such as adsb, pager or fm-dx")
 	flag.Var(&sdr.Flags.CenterFreq, "centerfreq", "center frequency to receive on")
 	flag.Lookup("centerfreq").DefValue = "100M"
 	flag.Var(&sdr.Flags.SampleRate, "samplerate", "sample rate")
 	flag.Lookup("samplerate").DefValue = "2.4M"
-	flag.BoolVar(&sdr.Flags.TunerGainMode, "tunergainmode", false, "enable/disable tuner gain")
+	flag.BoolVar(&sdr.Flags.TunerGainMode, "tunergainmode", false, "enable/disable the tuner AGC")
 	flag.Float64Var(&sdr.Flags.TunerGain, "tunergain", 0.0, "set tuner gain in dB")
 	flag.IntVar(&sdr.Flags.FreqCorrection, "freqcorrection", 0, "frequency correction in ppm")
 	flag.BoolVar(&sdr.Flags.TestMode, "testmode", false, "enable/disable test mode")
 	flag.BoolVar(&sdr.Flags.AgcMode, "agcmode", false, "enable/disable rtl agc")
 	flag.BoolVar(&sdr.Flags.DirectSampling, "directsampling", false, "enable/disable direct sampling")
 	flag.BoolVar(&sdr.Flags.OffsetTuning, "offsettuning", false, "enable/disable offset tuning")
+	flag.BoolVar(&sdr.Flags.AutoOffsetTuning, "autooffsettuning", false, "enable offset tuning on tuners it helps, overridden by -offsettuning")
+	flag.UintVar(&sdr.Flags.AutoDirectSampling, "autodirectsampling", 0, "sample HF directly on branch 1 (I) or 2 (Q) when tuning below 24 MHz, 0 to disable")
 	flag.UintVar(&sdr.Flags.RtlXtalFreq, "rtlxtalfreq", 0, "set rtl xtal frequency")
 	flag.UintVar(&sdr.Flags.TunerXtalFreq, "tunerxtalfreq", 0, "set tuner xtal frequency")
 	flag.UintVar(&sdr.Flags.GainByIndex, "gainbyindex", 0, "set gain by index")
+	flag.Var(&sdr.Flags.ConverterOffset, "converteroffset", "frequency offset of an up or downconverter")
 }
 
-// Parses flags and executes commands associated with each flag. Should only
-// be called once connected to rtl_tcp.
-func (sdr SDR) HandleFlags() (err error) {
+// Parses flags and executes commands associated with each flag, sending
+// them in a single write. Should only be called once connected to rtl_tcp.
+func (sdr *SDR) HandleFlags() (err error) {
+	sdr.Hold()
+	defer func() {
+		if ferr := sdr.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+
 	// Catch any errors panicked while visiting flags.
 	defer func() {
 		if r := recover(); r != nil {
@@ -108,6 +404,25 @@ func (sdr SDR) HandleFlags() (err error) {
 		}
 	}()
 
+	// Other flags override the profile.
+	if sdr.Flags.Profile != "" {
+		if err = sdr.openProfiles(); err != nil {
+			return
+		}
+		p, ok := sdr.Profiles.Get(sdr.Flags.Profile)
+		if !ok {
+			return fmt.Errorf("unknown profile %q", sdr.Flags.Profile)
+		}
+		if err = sdr.apply(p); err != nil {
+			return
+		}
+	}
+
+	// The offset must be known before tuning.
+	if sdr.Flags.ConverterOffset != 0 {
+		sdr.ConverterOffset = int64(sdr.Flags.ConverterOffset)
+	}
+
 	flag.CommandLine.Visit(func(f *flag.Flag) {
 		var err error
 		switch f.Name {
@@ -116,7 +431,7 @@ func (sdr SDR) HandleFlags() (err error) {
 		case "samplerate":
 			err = sdr.SetSampleRate(uint32(sdr.Flags.SampleRate))
 		case "tunergainmode":
-			err = sdr.SetGainMode(sdr.Flags.TunerGainMode)
+			err = sdr.SetTunerAGC(sdr.Flags.TunerGainMode)
 		case "tunergain":
 			err = sdr.SetGain(uint32(sdr.Flags.TunerGain * 10.0))
 		case "freqcorrection":
@@ -167,129 +482,388 @@ type Tuner uint32
 
 func (t Tuner) String() string {
 	switch t {
-	case 1:
+	case TunerE4000:
 		return "E4000"
-	case 2:
+	case TunerFC0012:
 		return "FC0012"
-	case 3:
+	case TunerFC0013:
 		return "FC0013"
-	case 4:
+	case TunerFC2580:
 		return "FC2580"
-	case 5:
+	case TunerR820T:
 		return "R820T"
-	case 6:
+	case TunerR828D:
 		return "R828D"
 	}
 	return "UNKNOWN"
 }
 
-func (sdr SDR) execute(cmd command) (err error) {
-	return binary.Write(sdr.TCPConn, binary.BigEndian, cmd)
+func (sdr *SDR) execute(cmd Command) (err error) {
+	sdr.mu.Lock()
+	holding := sdr.holding
+	if holding {
+		codec := sdr.codec()
+		buf := make([]byte, codec.CommandLen())
+		codec.EncodeCommand(buf, cmd)
+		sdr.held.Write(buf)
+	}
+	sdr.mu.Unlock()
+
+	if !holding {
+		if err = sdr.writeCommand(cmd, sdr.Retry); err != nil {
+			sdr.commandFailed(cmd, err)
+			return
+		}
+	}
+
+	// IF gain is set per stage, other settings replace their predecessor.
+	key := uint32(cmd.Opcode) << 16
+	if cmd.Opcode == TunerIfGain {
+		key |= cmd.Parameter >> 16
+	}
+
+	sdr.mu.Lock()
+	if sdr.settings == nil {
+		sdr.settings = make(map[uint32]Command)
+	}
+	sdr.settings[key] = cmd
+	sdr.mu.Unlock()
+
+	return
+}
+
+// Holds subsequent commands until Flush, so a burst of settings goes out in
+// one write, and usually one TCP segment, rather than one per command. The
+// acquisition state reflects held commands immediately.
+func (sdr *SDR) Hold() {
+	sdr.mu.Lock()
+	sdr.holding = true
+	sdr.mu.Unlock()
+}
+
+// Sends the commands held since Hold in a single write and stops holding.
+func (sdr *SDR) Flush() error {
+	sdr.mu.Lock()
+	buf := append([]byte(nil), sdr.held.Bytes()...)
+	sdr.held.Reset()
+	sdr.holding = false
+	sdr.mu.Unlock()
+
+	if len(buf) == 0 {
+		return nil
+	}
+	sdr.wmu.Lock()
+	err := sdr.writeLocked(buf, sdr.Retry)
+	sdr.wmu.Unlock()
+	if err != nil {
+		codec := sdr.codec()
+		for b := buf; len(b) >= codec.CommandLen(); b = b[codec.CommandLen():] {
+			cmd, _ := codec.DecodeCommand(b)
+			sdr.commandFailed(cmd, err)
+		}
+		return fmt.Errorf("Error sending commands: %s", err)
+	}
+	return nil
+}
+
+func (sdr *SDR) commandFailed(cmd Command, err error) {
+	if sdr.OnCommandError != nil {
+		sdr.OnCommandError(cmd, err)
+	}
+}
+
+// Calls fn holding the commands it issues, then flushes them, even if fn
+// fails. Returns the first error of either.
+func (sdr *SDR) Batch(fn func() error) error {
+	sdr.Hold()
+	err := fn()
+	if ferr := sdr.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// Re-issues every setting previously applied to other, in command order, so
+// a new connection resumes where a lost one left off. The converter offset
+// and OnDongleChange, unless set, are copied as well. The settings are sent
+// in a single write. If the server now has a different dongle the settings
+// are first revalidated against it: gains are moved to the nearest it
+// accepts, settings its tuner lacks and the frequency correction of the old
+// dongle are dropped, and OnDongleChange is called with what changed.
+func (sdr *SDR) Restore(other *SDR) (err error) {
+	other.mu.Lock()
+	keys := make([]uint32, 0, len(other.settings))
+	for key := range other.settings {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	cmds := make([]Command, len(keys))
+	for i, key := range keys {
+		cmds[i] = other.settings[key]
+	}
+	state := other.state
+	other.mu.Unlock()
+
+	sdr.ConverterOffset = other.ConverterOffset
+	sdr.AutoDirectSampling, sdr.DirectSamplingCutoff = other.AutoDirectSampling, other.DirectSamplingCutoff
+	if sdr.OnDongleChange == nil {
+		sdr.OnDongleChange = other.OnDongleChange
+	}
+	change, changed := sdr.dongleChange(other)
+	if changed {
+		cmds, change.Adjusted = Revalidate(sdr.Info, sdr.Gains(), cmds)
+		for _, cmd := range cmds {
+			if cmd.Opcode == TunerGain {
+				state.Gain = cmd.Parameter
+			}
+		}
+	}
+
+	err = sdr.Batch(func() error {
+		for _, cmd := range cmds {
+			if err := sdr.execute(cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error restoring settings: %s", err)
+	}
+	sdr.update(func(m *Metadata) { *m = state })
+
+	if changed && sdr.OnDongleChange != nil {
+		sdr.OnDongleChange(change)
+	}
+	return
 }
 
-type command struct {
-	command   uint8
+// A command sent by clients to the server, an opcode and a big-endian
+// parameter.
+type Command struct {
+	Opcode    uint8
 	Parameter uint32
 }
 
-// Command constants defined in rtl_tcp.c
+// Size of an encoded command.
+const CommandLen = 5
+
+// Encodes the command into b, which must hold CommandLen bytes.
+func (c Command) Encode(b []byte) {
+	b[0] = c.Opcode
+	binary.BigEndian.PutUint32(b[1:], c.Parameter)
+}
+
+// Decodes the command at the start of b.
+func (c *Command) Decode(b []byte) error {
+	if len(b) < CommandLen {
+		return fmt.Errorf("command of %d bytes, expected %d", len(b), CommandLen)
+	}
+	c.Opcode = b[0]
+	c.Parameter = binary.BigEndian.Uint32(b[1:])
+	return nil
+}
+
+// Sends a single command under retry policy p, which may be nil. The
+// encoding buffer is reused rather than allocated, since scanners may
+// retune hundreds of times per second.
+func (sdr *SDR) writeCommand(cmd Command, p *RetryPolicy) error {
+	sdr.wmu.Lock()
+	defer sdr.wmu.Unlock()
+	codec := sdr.codec()
+	if n := codec.CommandLen(); len(sdr.cmdBuf) != n {
+		sdr.cmdBuf = make([]byte, n)
+	}
+	codec.EncodeCommand(sdr.cmdBuf, cmd)
+	return sdr.writeLocked(sdr.cmdBuf, p)
+}
+
+// Opcodes of the commands defined in rtl_tcp.c.
 const (
-	centerFreq = iota + 1
-	sampleRate
-	tunerGainMode
-	tunerGain
-	freqCorrection
-	tunerIfGain
-	testMode
-	agcMode
-	directSampling
-	offsetTuning
-	rtlXtalFreq
-	tunerXtalFreq
-	gainByIndex
+	CenterFreq = iota + 1
+	SampleRate
+	TunerGainMode
+	TunerGain
+	FreqCorrection
+	TunerIfGain
+	TestMode
+	AGCMode
+	DirectSampling
+	OffsetTuning
+	RTLXtalFreq
+	TunerXtalFreq
+	GainByIndex
 )
 
 // Set the center frequency in Hz.
-func (sdr SDR) SetCenterFreq(freq uint32) (err error) {
-	return sdr.execute(command{centerFreq, freq})
+func (sdr *SDR) SetCenterFreq(freq uint32) (err error) {
+	tuned := int64(freq) + sdr.ConverterOffset
+	if tuned < 0 || tuned > math.MaxUint32 {
+		return fmt.Errorf("frequency %d Hz out of range with converter offset %d Hz", freq, sdr.ConverterOffset)
+	}
+	if err = sdr.switchDirectSampling(uint32(tuned)); err != nil {
+		return
+	}
+	if err = sdr.execute(Command{CenterFreq, uint32(tuned)}); err == nil {
+		sdr.update(func(m *Metadata) { m.CenterFreq = freq })
+	}
+	return
 }
 
 // Set the sample rate in Hz.
-func (sdr SDR) SetSampleRate(rate uint32) (err error) {
-	return sdr.execute(command{sampleRate, rate})
+func (sdr *SDR) SetSampleRate(rate uint32) (err error) {
+	if err = sdr.execute(Command{SampleRate, rate}); err == nil {
+		sdr.update(func(m *Metadata) { m.SampleRate = rate })
+	}
+	return
 }
 
 // Set gain in tenths of dB. (197 => 19.7dB)
-func (sdr SDR) SetGain(gain uint32) (err error) {
-	return sdr.execute(command{tunerGain, gain})
+func (sdr *SDR) SetGain(gain uint32) (err error) {
+	if err = sdr.execute(Command{TunerGain, gain}); err == nil {
+		sdr.update(func(m *Metadata) { m.Gain = gain })
+	}
+	return
 }
 
-// Set the Tuner AGC, true to enable.
-func (sdr SDR) SetGainMode(state bool) (err error) {
-	if state {
-		return sdr.execute(command{tunerGainMode, 0})
+// Set the tuner AGC, true to enable. Sends set_tuner_gain_mode with 0,
+// rtl_tcp's automatic gain, to enable and 1, manual gain, to disable. Not
+// to be confused with the RTL2832's digital AGC, see SetAGCMode.
+func (sdr *SDR) SetTunerAGC(enabled bool) (err error) {
+	if enabled {
+		err = sdr.execute(Command{TunerGainMode, 0})
+	} else {
+		err = sdr.execute(Command{TunerGainMode, 1})
 	}
-	return sdr.execute(command{tunerGainMode, 1})
+	if err == nil {
+		sdr.update(func(m *Metadata) { m.AutoGain = enabled })
+	}
+	return
+}
+
+// Select manual tuner gain, set by SetGain, or with false the tuner AGC.
+// Sends set_tuner_gain_mode with 1 for manual and 0 for automatic gain,
+// the inverse of SetTunerAGC.
+func (sdr *SDR) SetManualGainMode(manual bool) error {
+	return sdr.SetTunerAGC(!manual)
 }
 
-// Set gain by index, must be <= DongleInfo.GainCount
-func (sdr SDR) SetGainByIndex(idx uint32) (err error) {
-	if idx > sdr.Info.GainCount {
+// Set the tuner AGC, true to enable.
+//
+// Deprecated: The parameter reads as the inverse of set_tuner_gain_mode's.
+// Use SetTunerAGC, which behaves the same, or SetManualGainMode.
+func (sdr *SDR) SetGainMode(state bool) error {
+	return sdr.SetTunerAGC(state)
+}
+
+// Set gain by index, must be less than DongleInfo.GainCount.
+func (sdr *SDR) SetGainByIndex(idx uint32) (err error) {
+	if idx >= sdr.Info.GainCount {
 		return fmt.Errorf("invalid gain index: %d", idx)
 	}
-	return sdr.execute(command{gainByIndex, idx})
+	return sdr.execute(Command{GainByIndex, idx})
 }
 
 // Set frequency correction in ppm.
-func (sdr SDR) SetFreqCorrection(ppm uint32) (err error) {
-	return sdr.execute(command{freqCorrection, ppm})
+func (sdr *SDR) SetFreqCorrection(ppm uint32) (err error) {
+	return sdr.execute(Command{FreqCorrection, ppm})
 }
 
 // Set tuner intermediate frequency stage and gain.
-func (sdr SDR) SetTunerIfGain(stage, gain uint16) (err error) {
-	return sdr.execute(command{tunerIfGain, (uint32(stage) << 16) | uint32(gain)})
+func (sdr *SDR) SetTunerIfGain(stage, gain uint16) (err error) {
+	return sdr.execute(Command{TunerIfGain, (uint32(stage) << 16) | uint32(gain)})
 }
 
 // Set test mode, true for enabled.
-func (sdr SDR) SetTestMode(state bool) (err error) {
+func (sdr *SDR) SetTestMode(state bool) (err error) {
 	if state {
-		return sdr.execute(command{testMode, 1})
+		return sdr.execute(Command{TestMode, 1})
 	}
-	return sdr.execute(command{testMode, 0})
+	return sdr.execute(Command{TestMode, 0})
 }
 
 // Set RTL AGC mode, true for enabled.
-func (sdr SDR) SetAGCMode(state bool) (err error) {
+func (sdr *SDR) SetAGCMode(state bool) (err error) {
 	if state {
-		return sdr.execute(command{agcMode, 1})
+		return sdr.execute(Command{AGCMode, 1})
 	}
-	return sdr.execute(command{agcMode, 0})
+	return sdr.execute(Command{AGCMode, 0})
 }
 
-// Set direct sampling mode.
-func (sdr SDR) SetDirectSampling(state bool) (err error) {
+// Set direct sampling mode, of the I branch if enabled.
+func (sdr *SDR) SetDirectSampling(state bool) (err error) {
 	if state {
-		return sdr.execute(command{directSampling, 1})
+		return sdr.execute(Command{DirectSampling, 1})
+	}
+	return sdr.execute(Command{DirectSampling, 0})
+}
+
+// Branch of the RTL2832 ADC sampled in direct sampling mode, the parameter
+// of set_direct_sampling.
+type DirectSamplingBranch uint32
+
+const (
+	DirectSamplingOff DirectSamplingBranch = iota
+	DirectSamplingI
+	DirectSamplingQ // The branch of RTL-SDR Blog dongles' HF input.
+)
+
+// Frequency below which AutoDirectSampling switches to direct sampling, the
+// bottom of the R820T's range.
+const DefaultDirectSamplingCutoff = 24e6
+
+// Set direct sampling of branch b, or disable it.
+func (sdr *SDR) SetDirectSamplingBranch(b DirectSamplingBranch) error {
+	return sdr.execute(Command{DirectSampling, uint32(b)})
+}
+
+// Switches direct sampling on or off for tuning the dongle to tuned Hz, if
+// AutoDirectSampling is set and the mode must change.
+func (sdr *SDR) switchDirectSampling(tuned uint32) error {
+	branch := sdr.AutoDirectSampling
+	if branch == DirectSamplingOff {
+		branch = DirectSamplingBranch(sdr.Flags.AutoDirectSampling)
+	}
+	if branch == DirectSamplingOff {
+		return nil
+	}
+	cutoff := sdr.DirectSamplingCutoff
+	if cutoff == 0 {
+		cutoff = DefaultDirectSamplingCutoff
+	}
+
+	want := DirectSamplingOff
+	if tuned < cutoff {
+		want = branch
+	}
+	sdr.mu.Lock()
+	current := DirectSamplingBranch(sdr.settings[uint32(DirectSampling)<<16].Parameter)
+	sdr.mu.Unlock()
+	if want == current {
+		return nil
+	}
+	if err := sdr.SetDirectSamplingBranch(want); err != nil {
+		return fmt.Errorf("Error switching direct sampling: %s", err)
 	}
-	return sdr.execute(command{directSampling, 0})
+	return nil
 }
 
 // Set offset tuning, true for enabled.
-func (sdr SDR) SetOffsetTuning(state bool) (err error) {
+func (sdr *SDR) SetOffsetTuning(state bool) (err error) {
 	if state {
-		return sdr.execute(command{offsetTuning, 1})
+		return sdr.execute(Command{OffsetTuning, 1})
 	}
-	return sdr.execute(command{offsetTuning, 0})
+	return sdr.execute(Command{OffsetTuning, 0})
 }
 
 // Set RTL xtal frequency.
-func (sdr SDR) SetRTLXtalFreq(freq uint32) (err error) {
-	return sdr.execute(command{rtlXtalFreq, freq})
+func (sdr *SDR) SetRTLXtalFreq(freq uint32) (err error) {
+	return sdr.execute(Command{RTLXtalFreq, freq})
 }
 
 // Set tuner xtal frequency.
-func (sdr SDR) SetTunerXtalFreq(freq uint32) (err error) {
-	return sdr.execute(command{tunerXtalFreq, freq})
+func (sdr *SDR) SetTunerXtalFreq(freq uint32) (err error) {
+	return sdr.execute(Command{TunerXtalFreq, freq})
 }
 
 func init() {
@@ -1,10 +1,26 @@
 package rtltcp
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp/dsp"
 )
 
 func Example_sDR() {
@@ -28,7 +44,7 @@ func Example_sDR() {
 	buf := make([]byte, 16384)
 
 	// Read the entire array. This is usually done in a loop.
-	_, err = io.ReadFull(sdr, buf)
+	_, err = io.ReadFull(&sdr, buf)
 	if err != nil {
 		log.Fatal("Error reading samples:", err)
 	}
@@ -36,3 +52,1956 @@ func Example_sDR() {
 	// Do something with data in buf...
 
 }
+
+// Serves the dongle header, reports received commands on cmds and streams
+// n bytes of value fill before closing the connection.
+func fakeServer(t *testing.T, n int, fill byte, cmds chan<- Command) string {
+	return scriptedServer(t, dongleScript{Samples: n, Fill: fill, Linger: 50 * time.Millisecond, Cmds: cmds})
+}
+
+// Canned response of a scripted dongle to a command.
+type reply struct {
+	Send   []byte // Written to the client, amid any samples.
+	Hangup bool   // Close the connection after sending.
+}
+
+// Behavior of a fake dongle on one connection. The zero value sends a valid
+// header and hangs up.
+type dongleScript struct {
+	Delay  time.Duration // Wait before sending the header.
+	Header []byte        // Sent in place of the default header, which may be truncated or carry the wrong magic.
+
+	Samples int           // Bytes streamed after the header.
+	Fill    byte          // Value of each sample byte.
+	Chunk   int           // Size of each write of samples, all at once if zero.
+	Pace    time.Duration // Wait between chunks, slowing the client's reads.
+	Linger  time.Duration // Wait after the samples before hanging up.
+
+	Replies map[uint8]reply // Responses to commands by opcode.
+	Cmds    chan<- Command  // Receives each command read, if not nil.
+}
+
+// Default header of a fake dongle, an R820T.
+func fakeHeader() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, DongleInfo{Magic: dongleMagic, Tuner: 5, GainCount: 29})
+	return buf.Bytes()
+}
+
+// Serves fake dongles following scripts, the first connection the first
+// script and so on, repeating the last for any further connections.
+func scriptedServer(t *testing.T, scripts ...dongleScript) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go scripts[min(i, len(scripts)-1)].serve(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func (s dongleScript) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var wmu sync.Mutex
+	write := func(b []byte) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		_, err := conn.Write(b)
+		return err
+	}
+
+	time.Sleep(s.Delay)
+	header := s.Header
+	if header == nil {
+		header = fakeHeader()
+	}
+	if write(header) != nil {
+		return
+	}
+
+	go func() {
+		var buf [CommandLen]byte
+		for {
+			if _, err := io.ReadFull(conn, buf[:]); err != nil {
+				return
+			}
+			var cmd Command
+			cmd.Decode(buf[:])
+			if s.Cmds != nil {
+				s.Cmds <- cmd
+			}
+			if r, ok := s.Replies[cmd.Opcode]; ok {
+				write(r.Send)
+				if r.Hangup {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	chunk := s.Chunk
+	if chunk <= 0 {
+		chunk = max(s.Samples, 1)
+	}
+	samples := bytes.Repeat([]byte{s.Fill}, s.Samples)
+	for len(samples) > 0 {
+		n := min(chunk, len(samples))
+		if write(samples[:n]) != nil {
+			return
+		}
+		samples = samples[n:]
+		if len(samples) > 0 {
+			time.Sleep(s.Pace)
+		}
+	}
+	time.Sleep(s.Linger)
+}
+
+func TestScriptedDongle(t *testing.T) {
+	header := fakeHeader()
+	for _, test := range []struct {
+		name    string
+		script  dongleScript
+		connect error            // Expected from connecting.
+		do      func(*SDR) error // Called once connected.
+		read    []byte           // Expected before the connection closes.
+	}{
+		{"delayed header", dongleScript{Delay: 200 * time.Millisecond}, ErrHeaderTimeout, nil, nil},
+		{"slow header", dongleScript{Delay: 20 * time.Millisecond, Samples: 4, Fill: 1}, nil, nil, []byte{1, 1, 1, 1}},
+		{"truncated header", dongleScript{Header: header[:7]}, ErrShortHeader, nil, nil},
+		{"wrong magic", dongleScript{Header: append([]byte("RTL1"), header[4:]...)}, ErrBadMagic, nil, nil},
+		{"mid-stream disconnect", dongleScript{Samples: 1000, Fill: 2}, nil, nil, bytes.Repeat([]byte{2}, 1000)},
+		{"slow stream", dongleScript{Samples: 256, Fill: 3, Chunk: 16, Pace: 2 * time.Millisecond}, nil, nil, bytes.Repeat([]byte{3}, 256)},
+		{
+			"canned response",
+			dongleScript{Linger: time.Second, Replies: map[uint8]reply{TestMode: {Send: []byte{4, 5}, Hangup: true}}},
+			nil, func(sdr *SDR) error { return sdr.SetTestMode(true) }, []byte{4, 5},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sdr := SDR{HeaderTimeout: 100 * time.Millisecond}
+			err := sdr.ConnectAddr(scriptedServer(t, test.script))
+			if !errors.Is(err, test.connect) {
+				t.Fatalf("connect: %v, expected %v", err, test.connect)
+			}
+			if err != nil {
+				return
+			}
+			defer sdr.Close()
+
+			if test.do != nil {
+				if err := test.do(&sdr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			buf, err := io.ReadAll(&sdr)
+			if err != nil || !bytes.Equal(buf, test.read) {
+				t.Errorf("read % x, %v", buf, err)
+			}
+		})
+	}
+}
+
+func TestReconnectScripted(t *testing.T) {
+	header := fakeHeader()
+	addr := scriptedServer(t,
+		dongleScript{Samples: 2048},
+		dongleScript{Header: append([]byte("RTL1"), header[4:]...)},
+		dongleScript{Header: header[:7]},
+		dongleScript{Samples: 1 << 20, Chunk: 1024, Pace: 10 * time.Millisecond},
+	)
+
+	m := NewManager()
+	m.ReconnectInterval = 10 * time.Millisecond
+	defer m.Close()
+	d, err := m.Add(DeviceConfig{Name: "attic", Addr: addr, BlockSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two failed attempts come before the reconnection.
+	deadline := time.Now().Add(2 * time.Second)
+	for d.Stats().Reconnects == 0 || d.Stats().Blocks < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no reconnect: %+v", d.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := d.Stats()
+	if stats.Reconnects != 1 || !stats.Connected || !strings.Contains(stats.LastError, ErrShortHeader.Error()) {
+		t.Errorf("stats: %+v", stats)
+	}
+	if stats.ReconnectAttempts != 3 || stats.HandshakeFailures != 2 || stats.LastAttempt <= 0 || stats.Downtime < 30*time.Millisecond || stats.LastOutage != stats.Downtime {
+		t.Errorf("reconnect stats: %+v", stats)
+	}
+
+	// Commands failing alone or in a batch are counted by opcode.
+	d.Control(func(sdr *SDR) error {
+		sdr.Conn.Close()
+		sdr.SetCenterFreq(100e6)
+		return sdr.Batch(func() error {
+			sdr.SetCenterFreq(101e6)
+			return sdr.SetSampleRate(2.4e6)
+		})
+	})
+	stats = d.Stats()
+	if len(stats.CommandErrors) != 2 || stats.CommandErrors[CenterFreq] != 2 || stats.CommandErrors[SampleRate] != 1 || !strings.HasPrefix(stats.LastCommandError, "opcode 2:") {
+		t.Errorf("command errors %v, last %q", stats.CommandErrors, stats.LastCommandError)
+	}
+	if total := m.Stats(); total.ReconnectAttempts < 3 || total.HandshakeFailures != 2 || total.CommandErrors != 3 {
+		t.Errorf("manager stats: %+v", total)
+	}
+}
+
+func TestStream(t *testing.T) {
+	first := make(chan Command, 64)
+	cmds := make(chan Command, 64)
+	addr := scriptedServer(t,
+		dongleScript{Samples: 4096, Linger: 50 * time.Millisecond, Cmds: first},
+		dongleScript{Samples: 1 << 20, Chunk: 1024, Pace: 10 * time.Millisecond, Cmds: cmds},
+	)
+
+	reconnected := make(chan error, 1)
+	s, err := NewStream(context.Background(), addr, StreamConfig{
+		CenterFreq:        100e6,
+		BlockSize:         1024,
+		ReconnectInterval: 100 * time.Millisecond,
+		OnReconnect:       func(err error) { reconnected <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Retune(101e6); err != nil {
+		t.Fatal(err)
+	}
+	// Without a gain configured the server's is left alone.
+	for cmd := range first {
+		if cmd.Opcode == TunerGainMode || cmd.Opcode == TunerGain {
+			t.Errorf("sent %+v without a gain configured", cmd)
+		}
+		if cmd.Opcode == CenterFreq && cmd.Parameter == 101e6 {
+			break
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		if blk := <-s.Blocks(); blk.Len() != 512 || blk.Index != uint64(i*512) {
+			t.Fatalf("block %d: %d samples at %d", i, blk.Len(), blk.Index)
+		}
+	}
+
+	// Retuning while disconnected takes effect on reconnecting.
+	deadline := time.Now().Add(time.Second)
+	for s.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("stream never disconnected")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := s.Retune(102e6); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Control(func(*SDR) error { return nil }); err == nil {
+		t.Error("expected error controlling disconnected stream")
+	}
+	select {
+	case err := <-reconnected:
+		if err == nil {
+			t.Error("reconnected without cause")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream never reconnected")
+	}
+	if s.Err() != nil || s.Metadata().CenterFreq != 102e6 {
+		t.Errorf("after reconnecting: err %v, %+v", s.Err(), s.Metadata())
+	}
+
+	// The retune made while connected is restored before the later one.
+	var freqs []uint32
+	for len(freqs) < 2 {
+		if cmd := <-cmds; cmd.Opcode == CenterFreq {
+			freqs = append(freqs, cmd.Parameter)
+		}
+	}
+	if freqs[0] != 101e6 || freqs[1] != 102e6 {
+		t.Errorf("tuned %v after reconnecting", freqs)
+	}
+
+	if blk := <-s.Blocks(); blk.Metadata.CenterFreq != 102e6 {
+		t.Errorf("block tuned to %d", blk.Metadata.CenterFreq)
+	}
+	s.Close()
+	for range s.Blocks() {
+	}
+}
+
+func TestFailover(t *testing.T) {
+	cmds1 := make(chan Command, 16)
+	cmds2 := make(chan Command, 16)
+	primary := fakeServer(t, 1024, 1, cmds1)
+	backup := fakeServer(t, 1<<20, 2, cmds2)
+
+	f, err := NewFailover(primary, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var switched string
+	f.OnSwitch = func(addr string, err error) { switched = addr }
+
+	if err := f.SetCenterFreq(100e6); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-cmds1; cmd.Opcode != CenterFreq || cmd.Parameter != 100e6 {
+		t.Fatalf("primary received %+v", cmd)
+	}
+
+	buf := make([]byte, 512)
+	for i := 0; i < 4; i++ {
+		blk, err := f.ReadBlock(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blk.CenterFreq != 100e6 {
+			t.Errorf("block %d tagged %d Hz", i, blk.CenterFreq)
+		}
+	}
+
+	if switched != backup || f.Active() != backup {
+		t.Fatalf("active server %s, want %s", f.Active(), backup)
+	}
+	if buf[0] != 2 {
+		t.Errorf("samples not from backup: %d", buf[0])
+	}
+	if cmd := <-cmds2; cmd.Opcode != CenterFreq || cmd.Parameter != 100e6 {
+		t.Errorf("settings not restored, backup received %+v", cmd)
+	}
+}
+
+func TestFailoverProbe(t *testing.T) {
+	packed := fakeHeader()
+	copy(packed, PackedMagic[:])
+	bad := fakeHeader()
+	copy(bad, "XXXX")
+
+	// Probes accept any header a switch would.
+	for _, test := range []struct {
+		header []byte
+		ok     bool
+	}{
+		{fakeHeader(), true},
+		{packed, true},
+		{bad, false},
+		{fakeHeader()[:4], false},
+	} {
+		addr := scriptedServer(t, dongleScript{Header: test.header, Linger: time.Second})
+		if ok := probe(addr, 100*time.Millisecond); ok != test.ok {
+			t.Errorf("probe of % x: %v, want %v", test.header, ok, test.ok)
+		}
+	}
+}
+
+// Counts delivered blocks.
+type countSink struct {
+	mu     sync.Mutex
+	blocks int
+}
+
+func (c *countSink) WriteBlock(Block) error {
+	c.mu.Lock()
+	c.blocks++
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *countSink) Close() error { return nil }
+
+func TestManager(t *testing.T) {
+	cmds := make(chan Command, 64)
+	addr := fakeServer(t, 4096, 0, cmds)
+
+	m := NewManager()
+	m.ReconnectInterval = 10 * time.Millisecond
+	defer m.Close()
+
+	d, err := m.Add(DeviceConfig{Name: "attic", Addr: addr, Serial: "00000001", CenterFreq: 433.92e6, BlockSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Add(DeviceConfig{Name: "attic", Addr: addr}); err == nil {
+		t.Error("expected error adding duplicate name")
+	}
+	if m.BySerial("00000001") != d || m.Device("attic") != d {
+		t.Error("device lookup failed")
+	}
+
+	var sink countSink
+	d.Attach(&sink)
+
+	// Each connection streams 4 blocks then drops, wait for a reconnect.
+	deadline := time.Now().Add(2 * time.Second)
+	for d.Stats().Reconnects == 0 || d.Stats().Blocks < 8 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no reconnect: %+v", d.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Configuration is applied on every connection, leaving the gain
+	// alone when not configured.
+	var tunes int
+	for len(cmds) > 0 {
+		switch cmd := <-cmds; cmd.Opcode {
+		case CenterFreq:
+			if cmd.Parameter == 433.92e6 {
+				tunes++
+			}
+		case TunerGainMode, TunerGain:
+			t.Errorf("default config sent %+v", cmd)
+		}
+	}
+	if tunes < 2 {
+		t.Errorf("center frequency applied %d times, want at least 2", tunes)
+	}
+
+	stats := m.Stats()
+	if len(stats.Devices) != 1 || stats.Blocks == 0 || stats.Bytes != stats.Blocks*1024 {
+		t.Errorf("stats: %+v", stats)
+	}
+	sink.mu.Lock()
+	if sink.blocks == 0 {
+		t.Error("sink received no blocks")
+	}
+	sink.mu.Unlock()
+}
+
+func TestManagerSerial(t *testing.T) {
+	header := bytes.NewBuffer(fakeHeader())
+	WriteIdentity(header, Identity{Serial: "00000007"})
+	addr := scriptedServer(t, dongleScript{Header: header.Bytes(), Samples: 1 << 20, Linger: time.Second})
+
+	m := NewManager()
+	defer m.Close()
+	d, err := m.Add(DeviceConfig{Name: "attic", Addr: addr, Serial: "00000001", ExtendedHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reported serial takes precedence over the configured one.
+	if m.BySerial("00000007") != d || m.BySerial("00000001") != nil {
+		t.Errorf("looked up by serial %q", d.Serial())
+	}
+}
+
+func TestAssign(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	for _, cfg := range []DeviceConfig{
+		{Name: "a", CenterFreq: 100e6, SampleRate: 2e6},
+		{Name: "b", CenterFreq: 100e6, SampleRate: 2e6},
+		{Name: "c", CenterFreq: 100e6, SampleRate: 2e6},
+	} {
+		cfg.Addr = fakeServer(t, 1<<24, 0, make(chan Command, 64))
+		if _, err := m.Add(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	channels := []Channel{
+		{Name: "fm1", Freq: 100.3e6, Bandwidth: 200e3},
+		{Name: "fm2", Freq: 99.5e6, Bandwidth: 200e3},
+		{Name: "ism1", Freq: 433.92e6, Bandwidth: 25e3},
+		{Name: "ism2", Freq: 434.5e6, Bandwidth: 25e3},
+		{Name: "far", Freq: 900e6, Bandwidth: 25e3},
+	}
+
+	got, err := m.Assign(channels)
+	if err == nil || !strings.Contains(err.Error(), "far") {
+		t.Errorf("expected error for unplaceable channel, got %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("got %d assignments, want 4", len(got))
+	}
+
+	// FM channels are spread over devices already tuned there, leaving one
+	// device to retune for both ISM channels.
+	if got[0].Device == got[1].Device {
+		t.Error("fm channels not spread across devices")
+	}
+	if got[2].Device != got[3].Device || got[2].Device == got[0].Device || got[2].Device == got[1].Device {
+		t.Error("ism channels not packed onto the idle device")
+	}
+	for _, a := range got {
+		md := a.Device.Metadata()
+		if int64(a.Channel.Freq)-int64(md.CenterFreq) != a.Offset {
+			t.Errorf("%s: offset %d inconsistent with center %d", a.Channel.Name, a.Offset, md.CenterFreq)
+		}
+		if a.Offset > 800e3 || a.Offset < -800e3 {
+			t.Errorf("%s: offset %d outside usable band", a.Channel.Name, a.Offset)
+		}
+	}
+}
+
+func TestConverterOffset(t *testing.T) {
+	cmds := make(chan Command, 4)
+	sdr, err := dial(fakeServer(t, 1024, 1, cmds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+
+	sdr.ConverterOffset = 125e6
+	if err := sdr.SetCenterFreq(7e6); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-cmds; cmd.Parameter != 132e6 {
+		t.Errorf("dongle tuned to %d, want %d", cmd.Parameter, uint32(132e6))
+	}
+	if freq := sdr.Metadata().CenterFreq; freq != 7e6 {
+		t.Errorf("reported frequency %d, want %d", freq, uint32(7e6))
+	}
+
+	sdr.ConverterOffset = -125e6
+	if err := sdr.SetCenterFreq(7e6); err == nil {
+		t.Error("expected error tuning below zero")
+	}
+}
+
+func TestE4000IFGain(t *testing.T) {
+	for _, g := range []E4000IFGain{E4000Sensitivity, E4000Neutral, E4000Linearity} {
+		if err := g.Validate(); err != nil {
+			t.Errorf("%v: %s", g, err)
+		}
+	}
+	if err := (E4000IFGain{6, 9, 9, 2, 3, 4}).Validate(); err == nil {
+		t.Error("expected error for invalid stage 6 gain")
+	}
+
+	cmds := make(chan Command, 8)
+	sdr, err := dial(fakeServer(t, 1024, 1, cmds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+
+	if err := sdr.SetE4000IFGain(E4000Neutral); err == nil {
+		t.Error("expected error for R820T tuner")
+	}
+
+	sdr.Info.Tuner = TunerE4000
+	if err := sdr.SetE4000IFGain(E4000Linearity); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-cmds; cmd.Parameter != 1<<16|uint32(uint16(0xffe2)) {
+		t.Errorf("stage 1 parameter %#x, want %#x", cmd.Parameter, 1<<16|0xffe2)
+	}
+}
+
+func TestAutoOffsetTuning(t *testing.T) {
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, DongleInfo{Magic: dongleMagic, Tuner: TunerE4000, GainCount: 14})
+
+	for _, test := range []struct {
+		header []byte
+		sent   bool
+	}{
+		{header.Bytes(), true},
+		{fakeHeader(), false}, // R820T
+	} {
+		cmds := make(chan Command, 4)
+		sdr := SDR{AutoOffsetTuning: true}
+		if err := sdr.ConnectAddr(scriptedServer(t, dongleScript{Header: test.header, Linger: time.Second, Cmds: cmds})); err != nil {
+			t.Fatal(err)
+		}
+		sdr.SetCenterFreq(100e6)
+		sdr.Close()
+
+		want := []Command{{CenterFreq, 100e6}}
+		if test.sent {
+			want = append([]Command{{OffsetTuning, 1}}, want...)
+		}
+		for _, w := range want {
+			if cmd := <-cmds; cmd != w {
+				t.Errorf("%s: sent %+v, want %+v", sdr.Info.Tuner, cmd, w)
+			}
+		}
+	}
+}
+
+func TestAutoDirectSampling(t *testing.T) {
+	cmds := make(chan Command, 16)
+	sdr, err := dial(fakeServer(t, 1024, 1, cmds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	sdr.AutoDirectSampling = DirectSamplingQ
+
+	for _, test := range []struct {
+		freq uint32
+		want []Command
+	}{
+		{7e6, []Command{{DirectSampling, 2}, {CenterFreq, 7e6}}},
+		{14e6, []Command{{CenterFreq, 14e6}}},
+		{100e6, []Command{{DirectSampling, 0}, {CenterFreq, 100e6}}},
+		{144e6, []Command{{CenterFreq, 144e6}}},
+	} {
+		if err := sdr.SetCenterFreq(test.freq); err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range test.want {
+			if cmd := <-cmds; cmd != w {
+				t.Errorf("%d Hz: sent %+v, want %+v", test.freq, cmd, w)
+			}
+		}
+		if m := sdr.Metadata(); m.CenterFreq != test.freq {
+			t.Errorf("center frequency %d, want %d", m.CenterFreq, test.freq)
+		}
+	}
+
+	// An upconverter moves HF above the cutoff.
+	sdr.ConverterOffset = 125e6
+	if err := sdr.SetCenterFreq(7e6); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-cmds; cmd != (Command{CenterFreq, 132e6}) {
+		t.Errorf("sent %+v, want center frequency 132 MHz", cmd)
+	}
+
+	// Restoring onto a new connection keeps switching.
+	sdr.ConverterOffset = 0
+	if err := sdr.SetCenterFreq(144e6); err != nil {
+		t.Fatal(err)
+	}
+	<-cmds
+	restored := make(chan Command, 16)
+	next, err := dial(fakeServer(t, 1024, 1, restored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	if err := next.Restore(sdr); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []Command{{CenterFreq, 144e6}, {DirectSampling, 0}} {
+		if cmd := <-restored; cmd != w {
+			t.Errorf("restored %+v, want %+v", cmd, w)
+		}
+	}
+	if err := next.SetCenterFreq(7e6); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []Command{{DirectSampling, 2}, {CenterFreq, 7e6}} {
+		if cmd := <-restored; cmd != w {
+			t.Errorf("after restoring sent %+v, want %+v", cmd, w)
+		}
+	}
+}
+
+func TestR820TGain(t *testing.T) {
+	cmds := make(chan Command, 8)
+	sdr, err := dial(fakeServer(t, 1024, 1, cmds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+
+	if err := sdr.SetR820TGain(R820TGain{Gain: 150}); err == nil {
+		t.Error("expected error for unsupported gain")
+	}
+	if err := sdr.SetR820TGain(R820TWeakSignal); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Command{{TunerGainMode, 1}, {TunerGain, 496}, {AGCMode, 0}}
+	for _, w := range want {
+		if cmd := <-cmds; cmd != w {
+			t.Errorf("got %+v, want %+v", cmd, w)
+		}
+	}
+	if md := sdr.Metadata(); md.AutoGain || md.Gain != 496 {
+		t.Errorf("metadata %+v", md)
+	}
+}
+
+func TestPack4(t *testing.T) {
+	src := bytes.Repeat([]byte{100, 200}, 5000)
+	dither := uint32(1)
+	packed := Pack4(nil, src, &dither)
+	if len(packed) != len(src)/2 {
+		t.Fatalf("packed %d bytes to %d", len(src), len(packed))
+	}
+
+	// Dithering keeps the mean of reconstructed samples unbiased.
+	out := Unpack4(nil, packed)
+	var sum [2]float64
+	for i, s := range out {
+		sum[i%2] += float64(s)
+	}
+	for i, want := range []float64{100, 200} {
+		if mean := sum[i] / float64(len(out)/2); math.Abs(mean-want) > 0.5 {
+			t.Errorf("mean of %v unpacked as %.2f", want, mean)
+		}
+	}
+
+	// Full-scale samples saturate rather than wrap, whatever the dither.
+	for s := 249; s <= 255; s++ {
+		src := bytes.Repeat([]byte{byte(s)}, 1<<16)
+		for i, u := range Unpack4(nil, Pack4(nil, src, &dither)) {
+			if u < 0xE0 {
+				t.Fatalf("%d unpacked as %d at sample %d", s, u, i)
+			}
+		}
+	}
+}
+
+func TestProxyDialer(t *testing.T) {
+	cmds := make(chan Command, 4)
+	server := fakeServer(t, 1024, 3, cmds)
+
+	// An HTTP proxy supporting only CONNECT, with credentials.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+				up, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer up.Close()
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\n")
+				go io.Copy(up, conn)
+				io.Copy(conn, up)
+			}()
+		}
+	}()
+
+	sdr := SDR{Flags: Flags{ServerAddr: server, Proxy: "http://user:pass@" + ln.Addr().String()}}
+	if err := sdr.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	blk, err := sdr.ReadBlock(make([]byte, 1024))
+	if err != nil || blk.Samples[0] != 3 {
+		t.Fatalf("read through proxy: %v", err)
+	}
+
+	sdr = SDR{Flags: Flags{ServerAddr: server, Proxy: "http://" + ln.Addr().String()}}
+	if err := sdr.Connect(nil); err == nil {
+		sdr.Close()
+		t.Error("connected without proxy credentials")
+	}
+}
+
+func TestConnectAddr(t *testing.T) {
+	cmds := make(chan Command, 4)
+	_, port, _ := net.SplitHostPort(fakeServer(t, 1024, 4, cmds))
+
+	// localhost may resolve to ::1 first, which nothing listens on.
+	var sdr SDR
+	if err := sdr.ConnectAddr(net.JoinHostPort("localhost", port)); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if !sdr.Info.Valid() {
+		t.Errorf("header = %s", sdr.Info)
+	}
+}
+
+func TestDialFunc(t *testing.T) {
+	cmds := make(chan Command, 4)
+	server := fakeServer(t, 1024, 4, cmds)
+
+	var dials int
+	d := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	sdr := SDR{Dialer: DialFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		dials++
+		return d.DialContext(ctx, network, address)
+	})}
+	if err := sdr.ConnectAddr(server); err != nil {
+		t.Fatal(err)
+	}
+	sdr.Close()
+	if dials != 1 {
+		t.Errorf("dialer called %d times", dials)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sdr.DialContext(ctx, "tcp", server); err == nil {
+		sdr.Close()
+		t.Error("dialed with a cancelled context")
+	}
+}
+
+func TestSocketOptions(t *testing.T) {
+	cmds := make(chan Command, 4)
+	server := fakeServer(t, 1024, 4, cmds)
+
+	for _, keepAlive := range []time.Duration{-1, 15 * time.Second} {
+		sdr := SDR{KeepAlive: keepAlive, ReadBuffer: 1 << 20}
+		if err := sdr.ConnectAddr(server); err != nil {
+			t.Fatalf("keepalive %s: %s", keepAlive, err)
+		}
+		sdr.Close()
+	}
+}
+
+func TestCodec(t *testing.T) {
+	for name, codec := range Protocols {
+		cmd := Command{CenterFreq, 0x01020304}
+		b := make([]byte, codec.CommandLen())
+		codec.EncodeCommand(b, cmd)
+		if got, err := codec.DecodeCommand(b); err != nil || got != cmd {
+			t.Errorf("%s: decoded %+v, %v", name, got, err)
+		}
+	}
+	b := make([]byte, 8)
+	Protocols["padded"].EncodeCommand(b, Command{CenterFreq, 0x01020304})
+	if want := []byte{1, 0, 0, 0, 4, 3, 2, 1}; !bytes.Equal(b, want) {
+		t.Errorf("padded command % x, expected % x", b, want)
+	}
+	if _, err := ParseProtocol("ebcdic"); err == nil {
+		t.Error("expected error for unknown protocol")
+	}
+
+	// A server sending and expecting little-endian fields.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		header := append([]byte("RTL0"), 5, 0, 0, 0, 29, 0, 0, 0)
+		conn.Write(header)
+		buf := make([]byte, 2*CommandLen)
+		io.ReadFull(conn, buf)
+		received <- buf
+	}()
+
+	sdr := SDR{Flags: Flags{Protocol: "le"}}
+	if err := sdr.ConnectAddr(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if sdr.Info.Tuner != TunerR820T || sdr.Info.GainCount != 29 {
+		t.Errorf("decoded header %+v", sdr.Info)
+	}
+	sdr.Batch(func() error {
+		sdr.SetCenterFreq(0x05f5e100)
+		return sdr.SetSampleRate(0x00249f00)
+	})
+	if buf, want := <-received, []byte{1, 0x00, 0xe1, 0xf5, 0x05, 2, 0x00, 0x9f, 0x24, 0x00}; !bytes.Equal(buf, want) {
+		t.Errorf("commands sent as % x, expected % x", buf, want)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	sdr := SDR{Conn: client}
+	defer sdr.Close()
+
+	go sdr.Batch(func() error {
+		sdr.SetSampleRate(2400000)
+		sdr.SetCenterFreq(100000000)
+		return sdr.SetTunerAGC(true)
+	})
+
+	// A pipe delivers each write separately.
+	buf := make([]byte, 64)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 15 || buf[0] != SampleRate || buf[5] != CenterFreq || buf[10] != TunerGainMode {
+		t.Errorf("batch written as % x", buf[:n])
+	}
+}
+
+func TestReadBlockContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	sdr := SDR{Conn: client}
+	defer sdr.Close()
+
+	// Nothing is ever sent, so only cancellation ends the reads.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sdr.ReadBlockContext(ctx, make([]byte, 16)); err != context.DeadlineExceeded {
+		t.Errorf("ReadBlockContext returned %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	blocks := sdr.BlocksContext(ctx, 16)
+	cancel()
+	select {
+	case _, ok := <-blocks:
+		if ok {
+			t.Error("block received")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reader not stopped by cancellation")
+	}
+	if err := sdr.Err(); err != context.Canceled {
+		t.Errorf("Err = %v", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	cmds := make(chan Command, 4)
+	server := fakeServer(t, 1<<16, 5, cmds)
+
+	var sdr SDR
+	if err := sdr.ConnectAddr(server); err != nil {
+		t.Fatal(err)
+	}
+	blocks := sdr.Blocks(1024)
+
+	// Let the reader fill its queue without consuming it.
+	time.Sleep(50 * time.Millisecond)
+	sink := new(countSink)
+	if err := sdr.Shutdown(context.Background(), Drain, sink); err != nil {
+		t.Fatal(err)
+	}
+	if sink.blocks != DefaultQueueDepth {
+		t.Errorf("drained %d blocks, want %d", sink.blocks, DefaultQueueDepth)
+	}
+	if _, ok := <-blocks; ok {
+		t.Error("blocks channel open after shutdown")
+	}
+	if _, err := sdr.Write([]byte{0}); err == nil {
+		t.Error("connection open after shutdown")
+	}
+}
+
+func TestPing(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	sdr := SDR{Conn: client}
+	defer sdr.Close()
+
+	// Answer the ping's command with samples.
+	go func() {
+		cmd := make([]byte, 5)
+		if _, err := io.ReadFull(server, cmd); err != nil || cmd[0] != FreqCorrection {
+			return
+		}
+		server.Write(make([]byte, 512))
+		io.Copy(io.Discard, server)
+	}()
+	go io.Copy(io.Discard, &sdr)
+
+	if err := sdr.Ping(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := sdr.Ping(50 * time.Millisecond); err != ErrNoSamples {
+		t.Errorf("stalled stream pinged: %v", err)
+	}
+}
+
+func TestReadIQ(t *testing.T) {
+	client, server := net.Pipe()
+	sdr := SDR{Conn: client}
+	defer sdr.Close()
+
+	go func() {
+		server.Write([]byte{255, 0, 0})
+		server.Write([]byte{255, 128})
+		server.Close()
+	}()
+
+	iq, err := sdr.ReadIQ(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iq[0] != complex(1, -1) || iq[1] != complex(-1, 1) {
+		t.Errorf("read %v", iq)
+	}
+	if iq, err = sdr.ReadIQ(2); err != io.EOF || len(iq) != 0 {
+		t.Errorf("read %v after half a sample: %v", iq, err)
+	}
+}
+
+func TestSegment(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+	sdr := SDR{Conn: client}
+	defer sdr.Close()
+
+	read := func(before func()) (blk Block) {
+		t.Helper()
+		done := make(chan error)
+		go func() {
+			var err error
+			blk, err = sdr.ReadBlock(make([]byte, 512))
+			done <- err
+		}()
+		server.Write(make([]byte, 256))
+		for atomic.LoadUint64(&sdr.received)%512 != 256 {
+			time.Sleep(time.Millisecond)
+		}
+		before()
+		server.Write(make([]byte, 256))
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	// Settings made before reading start the stream with a boundary.
+	sdr.SetSampleRate(2.4e6)
+	if blk := read(func() {}); blk.Index != 0 || blk.Segment == nil || blk.Segment.Index != 0 || blk.Segment.Offset != 0 {
+		t.Errorf("first block at %d, segment %+v", blk.Index, blk.Segment)
+	}
+
+	// Retuned halfway through the second block.
+	blk := read(func() { sdr.SetCenterFreq(100e6) })
+	seg := blk.Segment
+	if blk.Index != 256 || seg == nil || seg.Index != 384 || seg.Offset != 128 || seg.Old.CenterFreq != 0 || seg.Old.SampleRate != 2.4e6 || seg.New.CenterFreq != 100e6 {
+		t.Fatalf("segment %+v", seg)
+	}
+	before, after := blk.Split()
+	if len(before.Samples) != 256 || before.CenterFreq != 0 || len(after.Samples) != 256 || after.CenterFreq != 100e6 || after.Segment.Offset != 0 {
+		t.Errorf("split %+v, %+v", before.Metadata, after.Metadata)
+	}
+
+	// Changing and changing back marks nothing.
+	blk = read(func() {
+		sdr.SetCenterFreq(101e6)
+		sdr.SetCenterFreq(100e6)
+	})
+	if blk.Segment != nil {
+		t.Errorf("segment %+v", blk.Segment)
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	for rate, want := range map[uint32]int{0: DefaultBufferDepth, 1e3: 512, 250e3: 10240, 2.4e6: 96256} {
+		if n := BlockSizeFor(rate); n != want {
+			t.Errorf("%d S/s: %d bytes, want %d", rate, n, want)
+		}
+	}
+
+	sdr, err := dial(fakeServer(t, 1<<20, 0, make(chan Command, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	sdr.SetSampleRate(250e3)
+	if n := sdr.ReadBlockSize(); n != 10240 {
+		t.Errorf("sized to the sample rate: %d bytes", n)
+	}
+	sdr.Flags.BlockSize = 2048
+	if n := sdr.ReadBlockSize(); n != 2048 {
+		t.Errorf("sized by flag: %d bytes", n)
+	}
+	sdr.BlockSize = 1024
+	if blk := <-sdr.Blocks(0); len(blk.Samples) != 1024 {
+		t.Errorf("block of %d bytes", len(blk.Samples))
+	}
+	sdr.Shutdown(context.Background(), Discard)
+
+	// Blocks sized to a duration follow the sample rate.
+	sdr, err = dial(fakeServer(t, 1<<20, 0, make(chan Command, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	sdr.BlockDuration = 10 * time.Millisecond
+	sdr.SetSampleRate(256e3)
+	blocks := sdr.PooledBlocks(context.Background(), 0)
+	blk := <-blocks
+	if len(blk.Samples) != 5120 {
+		t.Errorf("block of %d bytes at 256 kS/s", len(blk.Samples))
+	}
+	blk.Release()
+	sdr.SetSampleRate(512e3)
+	for i := 0; len(blk.Samples) != 10240; i++ {
+		if i > DefaultQueueDepth+1 {
+			t.Fatalf("block of %d bytes after switching to 512 kS/s", len(blk.Samples))
+		}
+		blk = <-blocks
+		blk.Release()
+	}
+}
+
+func TestBlockTimestamp(t *testing.T) {
+	sdr, err := dial(fakeServer(t, 1<<20, 0, make(chan Command, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	sdr.SetSampleRate(1e6)
+
+	// Captured the block's duration plus rtl_tcp's buffering before it's
+	// received, 2000 and 262144 bytes at 2 bytes per µs.
+	for _, test := range []struct {
+		depth int
+		want  time.Duration
+	}{
+		{0, 132072 * time.Microsecond},
+		{-1, 1000 * time.Microsecond},
+		{8000, 5000 * time.Microsecond},
+	} {
+		sdr.BufferDepth = test.depth
+		blk, err := sdr.ReadBlock(make([]byte, 2000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := blk.Received.Sub(blk.Timestamp); d != test.want {
+			t.Errorf("buffer depth %d: captured %s before received, want %s", test.depth, d, test.want)
+		}
+	}
+}
+
+func TestPooledBlocks(t *testing.T) {
+	cmds := make(chan Command, 4)
+	server := fakeServer(t, 1<<14, 7, cmds)
+
+	var sdr SDR
+	if err := sdr.ConnectAddr(server); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	blocks := sdr.PooledBlocks(ctx, 1024)
+	for i := 0; i < 4; i++ {
+		blk := <-blocks
+		if len(blk.Samples) != 1024 || blk.Samples[0] != 7 {
+			t.Fatalf("block %d: %d bytes of %d", i, len(blk.Samples), blk.Samples[0])
+		}
+		blk.Retain().Release()
+		blk.Release()
+	}
+
+	blk := <-blocks
+	blk.Release()
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic releasing a block twice")
+		}
+	}()
+	blk.Release()
+}
+
+// Accepts and discards writes.
+type discardConn struct{ net.Conn }
+
+func (discardConn) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestCommandAllocs(t *testing.T) {
+	sdr := SDR{Conn: discardConn{}}
+	sdr.execute(Command{CenterFreq, 100e6})
+
+	allocs := testing.AllocsPerRun(100, func() {
+		sdr.execute(Command{CenterFreq, 101e6})
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per command", allocs)
+	}
+}
+
+func TestDropOnOverflow(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	var gaps uint64
+	sdr := SDR{Conn: client, DropOnOverflow: true, OnGap: func(n uint64) { atomic.AddUint64(&gaps, n) }}
+	defer sdr.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	blocks := sdr.BlocksContext(ctx, 1024)
+
+	// Overflow the queue before consuming it.
+	server.Write(make([]byte, (DefaultQueueDepth+3)*1024))
+	for start := time.Now(); sdr.Lost() < 3*512; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("%d samples lost", sdr.Lost())
+		}
+	}
+	var next uint64
+	for i := 0; i < DefaultQueueDepth; i++ {
+		blk := <-blocks
+		if blk.Gap != 0 || blk.Index != next {
+			t.Errorf("block %d at %d follows a gap of %d", i, blk.Index, blk.Gap)
+		}
+		next = blk.Index + uint64(blk.Len())
+	}
+
+	go server.Write(make([]byte, 1024))
+	blk := <-blocks
+	if blk.Gap != 3*512 || sdr.Lost() != blk.Gap || atomic.LoadUint64(&gaps) != blk.Gap {
+		t.Errorf("gap of %d samples, %d lost, %d reported", blk.Gap, sdr.Lost(), gaps)
+	}
+	if blk.Index != next+blk.Gap {
+		t.Errorf("block at %d after a gap of %d, expected %d", blk.Index, blk.Gap, next+blk.Gap)
+	}
+}
+
+func TestHub(t *testing.T) {
+	cmds := make(chan Command, 4)
+	server := fakeServer(t, 1<<16, 9, cmds)
+
+	var sdr SDR
+	if err := sdr.ConnectAddr(server); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+
+	hub := NewHub(&sdr, 1024)
+	all := hub.Subscribe(1, OverflowWait)
+	slow := hub.Subscribe(2, OverflowDrop)
+	closed := hub.Subscribe(0, OverflowDrop)
+	closed.Close()
+
+	errs := make(chan error, 1)
+	go func() { errs <- hub.Run(context.Background()) }()
+
+	var n int
+	for blk := range all.C {
+		if blk.Samples[0] != 9 || blk.Gap != 0 {
+			t.Fatalf("block %d: sample %d after a gap of %d", n, blk.Samples[0], blk.Gap)
+		}
+		blk.Release()
+		n++
+	}
+	if n != 64 {
+		t.Errorf("received %d blocks, want 64", n)
+	}
+	if err := <-errs; err != io.EOF {
+		t.Errorf("hub stopped by %v", err)
+	}
+
+	var queued int
+	for blk := range slow.C {
+		queued++
+		blk.Release()
+	}
+	if queued != 2 || slow.Dropped() != 62*512 {
+		t.Errorf("slow subscriber queued %d blocks, dropped %d samples", queued, slow.Dropped())
+	}
+	if _, ok := <-closed.C; ok {
+		t.Error("closed subscription received a block")
+	}
+}
+
+func TestDongleInfoJSON(t *testing.T) {
+	info := DongleInfo{Magic: dongleMagic, Tuner: TunerE4000, GainCount: 14}
+	buf, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"magic":"RTL0","tuner":"E4000","gain_count":14,"freq_min":52000000,"freq_max":2200000000,"gains":[-10,15,40,65,90,115,140,165,190,215,240,290,340,420]}`
+	if string(buf) != want {
+		t.Errorf("marshaled as %s", buf)
+	}
+
+	var got DongleInfo
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != info {
+		t.Errorf("unmarshaled %s, want %s", got, info)
+	}
+	if len(TunerR820T.Gains()) != 29 {
+		t.Errorf("%d R820T gains", len(TunerR820T.Gains()))
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	r820t := TunerR820T.Capabilities()
+	if r820t.FreqMin != 24e6 || len(r820t.Gains) != 29 || r820t.IFStages != 0 || r820t.OffsetTuning || !r820t.DirectSampling || r820t.Bandwidths[0] != 8e6 {
+		t.Errorf("R820T: %+v", r820t)
+	}
+	if e4000 := TunerE4000.Capabilities(); e4000.IFStages != 6 || !e4000.OffsetTuning || len(e4000.Gains) != 14 {
+		t.Errorf("E4000: %+v", e4000)
+	}
+	if unknown := Tuner(0).Capabilities(); unknown.Gains != nil || unknown.FreqMax != 0 || unknown.DirectSampling {
+		t.Errorf("unknown: %+v", unknown)
+	}
+
+	// Gains reported by the server replace the tuner's table.
+	sdr := SDR{Info: DongleInfo{Magic: dongleMagic, Tuner: TunerFC0013, GainCount: 2}, identity: Identity{Gains: []int{0, 100}}}
+	c := sdr.Capabilities()
+	if len(c.Gains) != 2 || c.FreqMax != 1100e6 {
+		t.Errorf("FC0013 with reported gains: %+v", c)
+	}
+	buf, err := json.Marshal(c)
+	if err != nil || !strings.HasPrefix(string(buf), `{"tuner":"FC0013","freq_min":22000000`) {
+		t.Errorf("marshaled as %s, %v", buf, err)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		binary.Write(conn, binary.BigEndian, DongleInfo{Magic: dongleMagic, Tuner: TunerR820T, GainCount: 29})
+		WriteIdentity(conn, Identity{Serial: "00000001", Name: "RTL2838UHIDIR", Gains: []int{-10, 0, 150, 496}})
+		conn.Write([]byte{1, 2, 3, 4})
+		io.Copy(io.Discard, conn)
+	}()
+
+	sdr := SDR{ExtendedHeader: true}
+	if err := sdr.ConnectAddr(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if sdr.Serial() != "00000001" || sdr.Name() != "RTL2838UHIDIR" {
+		t.Errorf("identity %q, %q", sdr.Serial(), sdr.Name())
+	}
+	// The reported table takes precedence over the tuner's.
+	if gains := fmt.Sprint(sdr.Gains()); gains != "[-10 0 150 496]" {
+		t.Errorf("gains %s", gains)
+	}
+	if err := sdr.SetGainDB(14); err != nil || sdr.Metadata().Gain != 150 {
+		t.Errorf("set gain %d: %v", sdr.Metadata().Gain, err)
+	}
+
+	// Without an extension the bytes read while checking are samples.
+	plain := SDR{ExtendedHeader: true}
+	if err := plain.ConnectAddr(fakeServer(t, 4, 6, make(chan Command, 4))); err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(&plain, buf); err != nil || !bytes.Equal(buf, []byte{6, 6, 6, 6}) || plain.Serial() != "" {
+		t.Errorf("read % x, %v, serial %q", buf, err, plain.Serial())
+	}
+}
+
+func TestServerType(t *testing.T) {
+	serve := func(magic [4]byte, id *Identity) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			binary.Write(conn, binary.BigEndian, DongleInfo{Magic: magic, Tuner: TunerR820T, GainCount: 29})
+			if id != nil {
+				WriteIdentity(conn, *id)
+			}
+			conn.Write([]byte{1, 2, 3, 4})
+			io.Copy(io.Discard, conn)
+		}()
+		return ln.Addr().String()
+	}
+
+	for _, test := range []struct {
+		magic  [4]byte
+		id     *Identity
+		server ServerType
+	}{
+		{dongleMagic, nil, ServerRTLTCP},
+		{PackedMagic, nil, ServerRelay},
+		{rspMagic, nil, ServerRSPTCP},
+		{dongleMagic, &Identity{Serial: "00000001"}, ServerRelay},
+		{dongleMagic, &Identity{Server: "rsp_tcp 0.3"}, ServerRSPTCP},
+	} {
+		sdr := SDR{ExtendedHeader: true}
+		if err := sdr.ConnectAddr(serve(test.magic, test.id)); err != nil {
+			t.Fatal(err)
+		}
+		sdr.Close()
+		if sdr.ServerType() != test.server {
+			t.Errorf("%q %+v: server %s, expected %s", test.magic, test.id, sdr.ServerType(), test.server)
+		}
+		cmds := sdr.Commands()
+		if !cmds.Has(CenterFreq) || cmds.Has(CmdChannelOffset) != (test.server == ServerRelay) {
+			t.Errorf("%s: commands %x", test.server, cmds)
+		}
+	}
+	if serverCommands[ServerRSPTCP].Has(TestMode) {
+		t.Error("rsp_tcp accepts test mode")
+	}
+}
+
+func TestLenientHeader(t *testing.T) {
+	serve := func(send []byte) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Write(send)
+			io.Copy(io.Discard, conn)
+		}()
+		return ln.Addr().String()
+	}
+
+	samples := bytes.Repeat([]byte{0x80, 0x7f}, 8)
+	strict := SDR{}
+	if err := strict.ConnectAddr(serve(samples)); err == nil {
+		strict.Close()
+		t.Error("strict handshake accepted samples as a header")
+	}
+
+	for _, test := range []struct {
+		mode HeaderMode
+		send []byte
+	}{
+		{HeaderLenient, samples},
+		{HeaderLenient, samples[:4]}, // Times out short of a header.
+		{HeaderNone, samples},
+	} {
+		sdr := SDR{Header: test.mode}
+		if err := sdr.ConnectAddr(serve(test.send)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(test.send))
+		_, err := io.ReadFull(&sdr, buf)
+		sdr.Close()
+		if err != nil || !bytes.Equal(buf, test.send) {
+			t.Errorf("mode %d: read % x, %v", test.mode, buf, err)
+		}
+		if sdr.Info != DefaultDongleInfo || sdr.ServerType() != ServerUnknown {
+			t.Errorf("mode %d: info %s, server %s", test.mode, sdr.Info, sdr.ServerType())
+		}
+	}
+
+	// A set timeout overrides LenientTimeout.
+	start := time.Now()
+	short := SDR{Header: HeaderLenient, HeaderTimeout: 50 * time.Millisecond}
+	if err := short.ConnectAddr(serve(samples[:4])); err != nil {
+		t.Fatal(err)
+	}
+	short.Close()
+	if elapsed := time.Since(start); elapsed >= LenientTimeout {
+		t.Errorf("lenient handshake took %s", elapsed)
+	}
+
+	// A valid header is still read as one.
+	sdr := SDR{Header: HeaderLenient}
+	if err := sdr.ConnectAddr(fakeServer(t, 4, 6, make(chan Command, 4))); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if sdr.ServerType() != ServerRTLTCP {
+		t.Errorf("server %s", sdr.ServerType())
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	serve := func(send []byte, hangup bool) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Write(send)
+			if !hangup {
+				io.Copy(io.Discard, conn)
+			}
+		}()
+		return ln.Addr().String()
+	}
+
+	header := []byte("RTL0\x00\x00\x00\x05\x00\x00\x00\x1d")
+	for _, test := range []struct {
+		send   []byte
+		hangup bool
+		err    error
+	}{
+		{header[:5], false, ErrHeaderTimeout},
+		{header[:5], true, ErrShortHeader},
+		{nil, true, ErrShortHeader},
+		{append([]byte("rtl0"), header[4:]...), false, ErrBadMagic},
+	} {
+		sdr := SDR{HeaderTimeout: 50 * time.Millisecond}
+		err := sdr.ConnectAddr(serve(test.send, test.hangup))
+		if !errors.Is(err, test.err) {
+			t.Errorf("% x: error %v, expected %v", test.send, err, test.err)
+		}
+	}
+
+	sdr := SDR{HeaderTimeout: 50 * time.Millisecond}
+	if err := sdr.ConnectAddr(serve(header, false)); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if sdr.Info.Tuner != TunerR820T || sdr.Info.GainCount != 29 {
+		t.Errorf("info %s", sdr.Info)
+	}
+}
+
+func FuzzDecodeDongleInfo(f *testing.F) {
+	f.Add([]byte("RTL0\x00\x00\x00\x05\x00\x00\x00\x1d"))
+	f.Add([]byte("RTL4\x00\x00\x00\x01\x00\x00\x00\x0e\x80\x7f"))
+	f.Add([]byte("RTL0\x00\x00"))
+	f.Add([]byte("RSP0\x00\x00\x00\xff\x00\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		info, err := DecodeDongleInfo(b)
+		switch {
+		case len(b) < headerLen:
+			if !errors.Is(err, ErrShortHeader) {
+				t.Fatalf("% x: error %v", b, err)
+			}
+			return
+		case err != nil && !errors.Is(err, ErrBadMagic):
+			t.Fatalf("% x: error %v", b, err)
+		}
+
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, info)
+		if !bytes.Equal(buf.Bytes(), b[:headerLen]) {
+			t.Fatalf("% x: decoded %s", b, info)
+		}
+		if (err == nil) != (info.Valid() || info.Magic == PackedMagic || info.Magic == rspMagic) {
+			t.Fatalf("% x: error %v", b, err)
+		}
+	})
+}
+
+func TestCommandEncoding(t *testing.T) {
+	var buf [CommandLen]byte
+	Command{TunerIfGain, 2<<16 | 90}.Encode(buf[:])
+	if !bytes.Equal(buf[:], []byte{0x06, 0, 2, 0, 90}) {
+		t.Errorf("encoded % x", buf)
+	}
+
+	var cmd Command
+	if err := cmd.Decode(buf[:]); err != nil || cmd != (Command{TunerIfGain, 2<<16 | 90}) {
+		t.Errorf("decoded %+v, %v", cmd, err)
+	}
+	if err := cmd.Decode(buf[:4]); err == nil {
+		t.Error("decoded a truncated command")
+	}
+}
+
+func TestGainMode(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	sdr := SDR{Conn: client}
+	defer sdr.Close()
+
+	for _, test := range []struct {
+		set  func() error
+		wire uint32 // Parameter of set_tuner_gain_mode.
+		auto bool
+	}{
+		{func() error { return sdr.SetTunerAGC(true) }, 0, true},
+		{func() error { return sdr.SetTunerAGC(false) }, 1, false},
+		{func() error { return sdr.SetManualGainMode(true) }, 1, false},
+		{func() error { return sdr.SetManualGainMode(false) }, 0, true},
+		{func() error { return sdr.SetGainMode(true) }, 0, true},
+	} {
+		errs := make(chan error, 1)
+		go func() { errs <- test.set() }()
+		var buf [CommandLen]byte
+		if _, err := io.ReadFull(server, buf[:]); err != nil {
+			t.Fatal(err)
+		}
+		var cmd Command
+		cmd.Decode(buf[:])
+		if err := <-errs; err != nil || cmd != (Command{TunerGainMode, test.wire}) || sdr.Metadata().AutoGain != test.auto {
+			t.Errorf("sent %+v, %v, auto gain %t, want parameter %d", cmd, err, sdr.Metadata().AutoGain, test.wire)
+		}
+	}
+}
+
+// Accepts one byte of each of its first fails writes, then times out.
+type flakyConn struct {
+	net.Conn
+	fails   int
+	written bytes.Buffer
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func (c *flakyConn) Write(p []byte) (int, error) {
+	if c.fails > 0 && len(p) > 1 {
+		c.fails--
+		c.written.Write(p[:1])
+		return 1, timeoutError{}
+	}
+	return c.written.Write(p)
+}
+
+func (c *flakyConn) SetWriteDeadline(time.Time) error { return nil }
+
+func TestRetry(t *testing.T) {
+	conn := &flakyConn{fails: 2}
+	sdr := SDR{Conn: conn, Retry: &RetryPolicy{Attempts: 2, Timeout: time.Second}}
+	if err := sdr.SetCenterFreq(100e6); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(conn.written.Bytes(), []byte{CenterFreq, 0x05, 0xf5, 0xe1, 0x00}) {
+		t.Errorf("wrote % x", conn.written.Bytes())
+	}
+
+	conn = &flakyConn{fails: 1}
+	sdr = SDR{Conn: conn}
+	if err := sdr.SetCenterFreq(100e6); err == nil {
+		t.Error("write succeeded without a retry policy")
+	}
+}
+
+func TestCommandQueue(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	sdr := SDR{Conn: client}
+	defer sdr.Close()
+	q := NewCommandQueue(&sdr, 2)
+	defer q.Close()
+
+	// Nothing is read yet, so the first call stalls writing.
+	first := q.Do(func(sdr *SDR) error { return sdr.SetCenterFreq(100e6) })
+	for q.Pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	results := []<-chan error{
+		first,
+		q.Do(func(sdr *SDR) error { return sdr.SetSampleRate(2.4e6) }),
+		q.Execute(Command{Opcode: TunerGain, Parameter: 496}),
+	}
+	if err := <-q.Execute(Command{Opcode: TestMode, Parameter: 1}); err != ErrQueueFull {
+		t.Errorf("queued beyond depth: %v", err)
+	}
+
+	want := []Command{{CenterFreq, 100e6}, {SampleRate, 2.4e6}, {TunerGain, 496}}
+	for i, w := range want {
+		var buf [CommandLen]byte
+		if _, err := io.ReadFull(server, buf[:]); err != nil {
+			t.Fatal(err)
+		}
+		var cmd Command
+		cmd.Decode(buf[:])
+		if err := <-results[i]; cmd != w || err != nil {
+			t.Errorf("sent %+v, %v, want %+v", cmd, err, w)
+		}
+	}
+	if m := sdr.Metadata(); m.CenterFreq != 100e6 || m.SampleRate != 2.4e6 {
+		t.Errorf("metadata %+v", m)
+	}
+
+	// Calls still queued when closing fail.
+	q.Execute(Command{Opcode: TestMode, Parameter: 1})
+	for q.Pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	queued := q.Execute(Command{Opcode: TestMode, Parameter: 0})
+	q.Close()
+	if err := <-queued; err != ErrQueueClosed {
+		t.Errorf("queued call closed with %v", err)
+	}
+	if err := <-q.Execute(Command{Opcode: TestMode, Parameter: 0}); err != ErrQueueClosed {
+		t.Errorf("call after closing: %v", err)
+	}
+}
+
+func TestControlQueue(t *testing.T) {
+	d := &Device{Config: DeviceConfig{Name: "attic", Addr: fakeServer(t, 4, 0, make(chan Command, 4)), ControlQueue: 1}}
+	var replayed bool
+	if err := d.Control(func(sdr *SDR) error { replayed = true; return sdr.SetCenterFreq(100e6) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Control(func(*SDR) error { return nil }); err == nil {
+		t.Error("queued past ControlQueue")
+	}
+
+	if err := d.connect(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer d.sdr.Close()
+	if !replayed || d.sdr.Metadata().CenterFreq != 100e6 {
+		t.Errorf("replayed %v, tuned to %d Hz", replayed, d.sdr.Metadata().CenterFreq)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	buf := make([]byte, 2*stuckMinSamples)
+	for i := range buf {
+		// Noise short of full scale with the lowest bit stuck high.
+		buf[i] = byte(2+i*37%250) | 1
+	}
+	h.Add(buf[:3])
+	h.Add(buf[3:])
+	if h.Samples() != stuckMinSamples {
+		t.Fatalf("counted %d samples", h.Samples())
+	}
+	d := h.Diagnose()
+	if d.StuckHigh != 1 || d.StuckLow != 0 || math.Abs(d.OffsetI) > 1 || len(d.Problems) != 1 {
+		t.Errorf("diagnosis %+v", d)
+	}
+
+	// Offset and clipped.
+	h.Reset()
+	for i := range buf {
+		buf[i] = byte(60 + i%196)
+	}
+	h.Add(buf)
+	if d := h.Diagnose(); d.OffsetI < DCOffsetLimit || d.Clipped < ClipLimit || len(d.Problems) != 2 {
+		t.Errorf("diagnosis %+v", d)
+	}
+}
+
+func TestVerifyLink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	cmds := make(chan Command, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		binary.Write(conn, binary.BigEndian, DongleInfo{Magic: dongleMagic, Tuner: 5, GainCount: 29})
+		var buf [CommandLen]byte
+		io.ReadFull(conn, buf[:])
+		var cmd Command
+		cmd.Decode(buf[:])
+		cmds <- cmd
+		go func() {
+			for {
+				if _, err := io.ReadFull(conn, buf[:]); err != nil {
+					return
+				}
+				var cmd Command
+				cmd.Decode(buf[:])
+				cmds <- cmd
+			}
+		}()
+
+		// Noise in transit, then the counter skipping 10 bytes once.
+		conn.Write(bytes.Repeat([]byte{0x7f}, 1000))
+		counter := make([]byte, 1<<16)
+		for i := range counter {
+			counter[i] = byte(i)
+		}
+		conn.Write(counter[:40000])
+		conn.Write(counter[40010:])
+		for {
+			if _, err := conn.Write(counter); err != nil {
+				return
+			}
+		}
+	}()
+
+	var sdr SDR
+	if err := sdr.ConnectAddr(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	r, err := sdr.VerifyLink(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || r.Gaps != 1 || r.Dropped != 10 || len(r.GapOffsets) != 1 || r.Bytes == 0 {
+		t.Errorf("report %+v", r)
+	}
+	for _, state := range []uint32{1, 0} {
+		if cmd := <-cmds; cmd.Opcode != TestMode || cmd.Parameter != state {
+			t.Errorf("received %+v, expected test mode %d", cmd, state)
+		}
+	}
+	if _, ok := sdr.settings[uint32(TestMode)<<16]; ok {
+		t.Error("test mode remembered after restoring it")
+	}
+}
+
+func TestCalibrationStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rtltcp", "calibration.json")
+	store, err := OpenCalibrations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds := make(chan Command, 8)
+	addr := fakeServer(t, 1<<16, 0x80, cmds)
+	want := Calibration{PPM: 42, Gain: 49.6, Balance: dsp.IQBalance{Gain: 0.1}}
+	if err := store.Put(addr, want); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopened, as by a later session, and applied on connect.
+	sdr := SDR{Flags: Flags{Calibration: path}}
+	if err := sdr.ConnectAddr(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if c := sdr.Calibration(); c.PPM != want.PPM || c.Gain != want.Gain || c.Balance != want.Balance {
+		t.Errorf("applied %+v", c)
+	}
+	for _, want := range []Command{{FreqCorrection, 42}, {TunerGainMode, 1}, {TunerGain, 496}} {
+		if cmd := <-cmds; cmd != want {
+			t.Errorf("received %+v, expected %+v", cmd, want)
+		}
+	}
+	iq, err := sdr.ReadIQ(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := imag(iq[0]); math.Abs(float64(q)-float64(imag(dsp.ConvertU8(nil, []byte{0x80, 0x80})[0]))/1.1) > 1e-6 {
+		t.Errorf("Q %g not corrected", q)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	store, err := OpenProfiles(filepath.Join(t.TempDir(), "profiles.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("noaa", Profile{CenterFreq: 137.1e6, SampleRate: 1.024e6, AutoGain: true}); err != nil {
+		t.Fatal(err)
+	}
+	if names := fmt.Sprint(store.Names()); names != "[adsb fm-dx noaa pager]" {
+		t.Errorf("profiles %s", names)
+	}
+
+	cmds := make(chan Command, 8)
+	sdr := SDR{Profiles: store}
+	if err := sdr.ConnectAddr(fakeServer(t, 4, 0, cmds)); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if err := sdr.ApplyProfile("noaa"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []Command{{SampleRate, 1.024e6}, {CenterFreq, 137.1e6}, {TunerGainMode, 0}, {AGCMode, 0}, {DirectSampling, 0}, {OffsetTuning, 0}} {
+		if cmd := <-cmds; cmd != want {
+			t.Errorf("received %+v, expected %+v", cmd, want)
+		}
+	}
+	if err := sdr.ApplyProfile("adsb"); err != nil || sdr.Metadata().CenterFreq != 1090e6 {
+		t.Errorf("built in profile: %v", err)
+	}
+	if err := sdr.ApplyProfile("ais"); err == nil {
+		t.Error("applied an unknown profile")
+	}
+}
+
+func TestDongleChange(t *testing.T) {
+	cmds := make(chan Command, 16)
+	addr := fakeServer(t, 0, 0, cmds)
+
+	// Settings of an E4000, held as they were never sent.
+	old := &SDR{Info: DongleInfo{Magic: dongleMagic, Tuner: TunerE4000, GainCount: 14}}
+	old.Hold()
+	old.SetCenterFreq(100e6)
+	old.SetManualGainMode(true)
+	old.SetGain(420)
+	old.SetTunerIfGain(1, 60)
+	old.SetOffsetTuning(true)
+	old.SetFreqCorrection(30)
+
+	var changes []DongleChange
+	old.OnDongleChange = func(c DongleChange) { changes = append(changes, c) }
+
+	var sdr SDR
+	if err := sdr.ConnectAddr(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if err := sdr.Restore(old); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].Old.Tuner != TunerE4000 || changes[0].New.Tuner != TunerR820T || len(changes[0].Adjusted) != 4 {
+		t.Fatalf("changes %+v", changes)
+	}
+	if g := sdr.Metadata().Gain; g != 421 {
+		t.Errorf("metadata gain %d", g)
+	}
+
+	want := []Command{{CenterFreq, 100e6}, {TunerGainMode, 1}, {TunerGain, 421}}
+	for _, w := range want {
+		select {
+		case cmd := <-cmds:
+			if cmd != w {
+				t.Errorf("restored %+v, want %+v", cmd, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("missing %+v", w)
+		}
+	}
+	select {
+	case cmd := <-cmds:
+		t.Errorf("restored %+v", cmd)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The same dongle again restores everything, without a change.
+	var again SDR
+	if err := again.ConnectAddr(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if err := again.Restore(&sdr); err != nil || len(changes) != 1 {
+		t.Errorf("restore to the same dongle: %v, %d changes", err, len(changes))
+	}
+}
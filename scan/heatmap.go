@@ -0,0 +1,199 @@
+package scan
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Colors interpolated between by Heatmap, from weakest to strongest.
+var palette = []color.RGBA{
+	{0, 0, 0, 255},
+	{0, 0, 160, 255},
+	{0, 160, 255, 255},
+	{255, 255, 0, 255},
+	{255, 0, 0, 255},
+	{255, 255, 255, 255},
+}
+
+// Returns the color of v, between 0 and 1, on the palette.
+func colorAt(v float64) color.RGBA {
+	v = math.Max(0, math.Min(1, v)) * float64(len(palette)-1)
+	i := int(v)
+	if i >= len(palette)-1 {
+		return palette[len(palette)-1]
+	}
+	frac := v - float64(i)
+	lo, hi := palette[i], palette[i+1]
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + frac*(float64(b)-float64(a)) + 0.5) }
+	return color.RGBA{mix(lo.R, hi.R), mix(lo.G, hi.G), mix(lo.B, hi.B), 255}
+}
+
+// Returns the lowest and highest power in sweeps.
+func powerRange(sweeps []Sweep) (lo, hi float32) {
+	lo, hi = float32(math.Inf(1)), float32(math.Inf(-1))
+	for _, s := range sweeps {
+		for _, r := range s {
+			for _, p := range r.Power {
+				lo, hi = min(lo, p), max(hi, p)
+			}
+		}
+	}
+	return
+}
+
+// Renders sweeps as an image with one row per sweep, oldest first, and one
+// column per bin in frequency order. Color spans the weakest to the
+// strongest bin.
+func Heatmap(sweeps []Sweep) *image.RGBA {
+	width := 0
+	for _, s := range sweeps {
+		n := 0
+		for _, r := range s {
+			n += len(r.Power)
+		}
+		width = max(width, n)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, len(sweeps)))
+	lo, hi := powerRange(sweeps)
+	scale := float64(hi - lo)
+	if scale == 0 {
+		scale = 1
+	}
+
+	for y, s := range sweeps {
+		x := 0
+		for _, r := range s {
+			for _, p := range r.Power {
+				img.SetRGBA(x, y, colorAt(float64(p-lo)/scale))
+				x++
+			}
+		}
+	}
+
+	return img
+}
+
+// Dimensions of the annotations drawn by Plot, in pixels.
+const (
+	plotMargin  = 8
+	plotTick    = 4
+	plotMinSize = 160 // Plot areas smaller than this are scaled up.
+	barWidth    = 16
+	labelSpace  = 48 // Minimum distance between adjacent labels.
+)
+
+// Returns a round step of 1, 2 or 5 times a power of ten, at least span/n.
+func niceStep(span, n float64) float64 {
+	raw := span / n
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if m*mag >= raw {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// Returns the decimal places needed to print multiples of step.
+func decimals(step float64) int {
+	return max(0, -int(math.Floor(math.Log10(step)+1e-9)))
+}
+
+// Renders sweeps like heatmap.py, frequency increasing to the right and
+// time downward, with labeled frequency and time axes and a colorbar in dB.
+// Small scans are scaled up so the labels stay legible.
+func Plot(sweeps []Sweep) *image.RGBA {
+	heat := Heatmap(sweeps)
+	cols, rows := heat.Bounds().Dx(), heat.Bounds().Dy()
+	face := basicfont.Face7x13
+	lineHeight := face.Metrics().Height.Ceil()
+
+	xScale := max(1, (plotMinSize+cols-1)/max(cols, 1))
+	yScale := max(1, (plotMinSize+rows-1)/max(rows, 1))
+	plotW, plotH := cols*xScale, rows*yScale
+
+	left := plotMargin + font.MeasureString(face, "00:00:00").Ceil() + plotTick
+	top := plotMargin + lineHeight/2
+	barLeft := left + plotW + 2*plotMargin
+	width := barLeft + barWidth + plotTick + font.MeasureString(face, "-000 dB").Ceil() + plotMargin
+	height := top + plotH + plotTick + lineHeight + plotMargin
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.Black, image.Point{}, draw.Src)
+	for y := 0; y < plotH; y++ {
+		for x := 0; x < plotW; x++ {
+			img.SetRGBA(left+x, top+y, heat.RGBAAt(x/xScale, y/yScale))
+		}
+	}
+
+	d := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	label := func(s string, x, y int, alignRight bool) {
+		if alignRight {
+			x -= d.MeasureString(s).Ceil()
+		}
+		d.Dot = fixed.P(x, y+face.Metrics().Ascent.Ceil()/2)
+		d.DrawString(s)
+	}
+	tick := func(x0, y0, x1, y1 int) {
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	if len(sweeps) == 0 || len(sweeps[0]) == 0 {
+		return img
+	}
+
+	// Frequency axis along the bottom, in MHz.
+	first := sweeps[0][0]
+	low, step := float64(first.Low), first.Step
+	high := low + float64(cols)*step
+	fstep := niceStep(high-low, float64(plotW)/(2*labelSpace))
+	for k := math.Ceil(low / fstep); k*fstep <= high; k++ {
+		f := k * fstep
+		x := left + int((f-low)/step*float64(xScale))
+		tick(x, top+plotH, x, top+plotH+plotTick)
+		s := strconv.FormatFloat(f/1e6, 'f', decimals(fstep/1e6), 64) + "M"
+		label(s, x-d.MeasureString(s).Ceil()/2, top+plotH+plotTick+lineHeight/2+2, false)
+	}
+
+	// Time of a sweep every labelSpace pixels down the left.
+	every := max(1, (labelSpace+yScale-1)/yScale)
+	for i := 0; i < rows; i += every {
+		y := top + i*yScale + yScale/2
+		tick(left-plotTick, y, left-1, y)
+		t := sweeps[i][0].Time.Local().Format("15:04:05")
+		label(t, left-plotTick-2, y, true)
+	}
+
+	// Colorbar on the right, strongest at the top.
+	lo, hi := powerRange(sweeps)
+	scale := float64(hi - lo)
+	if scale == 0 {
+		scale = 1
+	}
+	for y := 0; y < plotH; y++ {
+		c := colorAt(1 - float64(y)/float64(max(plotH-1, 1)))
+		for x := 0; x < barWidth; x++ {
+			img.SetRGBA(barLeft+x, top+y, c)
+		}
+	}
+	dbStep := niceStep(scale, float64(plotH)/labelSpace)
+	for k := math.Ceil(float64(lo) / dbStep); k*dbStep <= float64(hi); k++ {
+		db := k * dbStep
+		y := top + int((1-(db-float64(lo))/scale)*float64(plotH-1))
+		tick(barLeft+barWidth, y, barLeft+barWidth+plotTick-1, y)
+		label(strconv.FormatFloat(db, 'f', decimals(dbStep), 64)+" dB", barLeft+barWidth+plotTick+2, y, false)
+	}
+
+	return img
+}
@@ -0,0 +1,313 @@
+// Package scan sweeps a source across a frequency range too wide to receive
+// at once, measuring power in fixed width bins the way rtl_power does.
+package scan
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Defaults for Config.
+const (
+	DefaultSampleRate  = 2400000
+	DefaultCrop        = 0.2
+	DefaultSettle      = 1 << 16
+	DefaultIntegration = 100 * time.Millisecond
+)
+
+// Parameters of a sweep.
+type Config struct {
+	Start, Stop uint32  // Bounds of the range in Hz.
+	BinSize     float64 // Requested bin width in Hz, rounded down to fit a power of two FFT.
+
+	SampleRate uint32 // Hz per hop, DefaultSampleRate if zero.
+	// Fraction of each hop discarded at its edges, where the anti-aliasing
+	// filter rolls off. DefaultCrop if zero, negative for none.
+	Crop float64
+	// Bytes discarded after each retune while the tuner settles,
+	// DefaultSettle if zero, negative for none.
+	Settle int
+	// Time averaged per hop, DefaultIntegration if zero.
+	Integration time.Duration
+
+	Window dsp.WindowType
+
+	// Goroutines FFTs of a hop are spread across, one if zero.
+	Workers int
+}
+
+// Power measured over part of the range during one hop, equivalent to a
+// line of rtl_power output.
+type Row struct {
+	Time      time.Time // Capture time of the hop's first sample.
+	Low, High uint32    // Hz, of the first bin's lower and last bin's upper edge.
+	Step      float64   // Bin width in Hz.
+	Samples   int       // FFT frames averaged.
+	Power     []float32 // dB per bin from Low upward.
+}
+
+// A sweep of the entire range, hop by hop in increasing frequency.
+type Sweep []Row
+
+// Scanner retunes a source across a range and measures its spectrum.
+type Scanner struct {
+	Config Config
+
+	src   rtltcp.Source
+	spec  *dsp.Spectrum
+	bins  int       // FFT size.
+	keep  int       // Bins kept per hop.
+	step  float64   // Bin width.
+	lows  []float64 // Lower edge of each hop's first kept bin.
+	buf   []byte
+	iq    []complex64
+	power []float32
+}
+
+// Returns a scanner sweeping src according to cfg.
+func New(src rtltcp.Source, cfg Config) (*Scanner, error) {
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = DefaultSampleRate
+	}
+	if cfg.Crop == 0 {
+		cfg.Crop = DefaultCrop
+	} else if cfg.Crop < 0 {
+		cfg.Crop = 0
+	}
+	if cfg.Settle == 0 {
+		cfg.Settle = DefaultSettle
+	} else if cfg.Settle < 0 {
+		cfg.Settle = 0
+	}
+	if cfg.Integration == 0 {
+		cfg.Integration = DefaultIntegration
+	}
+
+	if cfg.Stop <= cfg.Start {
+		return nil, errors.New("scan: stop frequency must exceed start")
+	}
+	if cfg.BinSize <= 0 {
+		return nil, errors.New("scan: bin size must be positive")
+	}
+	if cfg.Crop >= 1 {
+		return nil, errors.New("scan: crop must be less than 1")
+	}
+
+	s := &Scanner{Config: cfg, src: src}
+
+	s.bins = 2
+	for float64(cfg.SampleRate)/float64(s.bins) > cfg.BinSize {
+		s.bins <<= 1
+	}
+	s.step = float64(cfg.SampleRate) / float64(s.bins)
+	s.keep = int(float64(s.bins) * (1 - cfg.Crop))
+	if s.keep < 1 {
+		s.keep = 1
+	}
+	s.spec = dsp.NewSpectrum(s.bins, cfg.Window)
+	s.spec.Workers = cfg.Workers
+
+	// Place hops so kept bins tile the range without gaps.
+	width := float64(s.keep) * s.step
+	for low := float64(cfg.Start); low < float64(cfg.Stop); low += width {
+		s.lows = append(s.lows, low)
+	}
+
+	if err := src.SetSampleRate(cfg.SampleRate); err != nil {
+		return nil, fmt.Errorf("Error setting sample rate: %s", err)
+	}
+
+	return s, nil
+}
+
+// Stops the goroutines transforming spectra, see Config.Workers. The source
+// is left open.
+func (s *Scanner) Close() error {
+	return s.spec.Close()
+}
+
+// Returns the number of hops per sweep.
+func (s *Scanner) Hops() int {
+	return len(s.lows)
+}
+
+// Returns the bin width in Hz.
+func (s *Scanner) Step() float64 {
+	return s.step
+}
+
+// Returns the distance in Hz from a hop's center frequency down to the
+// lower edge of its first kept bin, less than a Hz off once the center is
+// rounded. Bin i of n is centered on
+// center + (i - n/2) * step.
+func (s *Scanner) edge() float64 {
+	first := (s.bins - s.keep) / 2
+	return (float64(s.bins/2-first) + 0.5) * s.step
+}
+
+// Measures the entire range once.
+func (s *Scanner) Sweep() (Sweep, error) {
+	sweep := make(Sweep, 0, len(s.lows))
+	for _, low := range s.lows {
+		row, err := s.hop(low)
+		if err != nil {
+			return sweep, err
+		}
+		sweep = append(sweep, row)
+	}
+	return sweep, nil
+}
+
+// Tunes so the first kept bin begins at low and measures the kept bins.
+func (s *Scanner) hop(low float64) (row Row, err error) {
+	center := uint32(math.Round(low + s.edge()))
+	if err = s.src.SetCenterFreq(center); err != nil {
+		return row, fmt.Errorf("Error tuning to %d Hz: %s", center, err)
+	}
+
+	if s.Config.Settle > 0 {
+		if cap(s.buf) < s.Config.Settle {
+			s.buf = make([]byte, s.Config.Settle)
+		}
+		if _, err = s.src.ReadBlock(s.buf[:s.Config.Settle]); err != nil {
+			return row, err
+		}
+	}
+
+	frames := int(s.Config.Integration.Seconds() * float64(s.Config.SampleRate) / float64(s.bins))
+	if frames < 1 {
+		frames = 1
+	}
+	n := 2 * frames * s.bins
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	blk, err := s.src.ReadBlock(s.buf[:n])
+	if err != nil {
+		return row, err
+	}
+
+	s.iq = dsp.ConvertU8(s.iq[:0], blk.Samples)
+	s.power = s.spec.PowerDB(s.power[:0], s.iq)
+
+	first := (s.bins - s.keep) / 2
+	power := s.power[first : first+s.keep]
+
+	// Drop bins of the last hop that begin past the range.
+	if over := low + float64(len(power))*s.step - float64(s.Config.Stop); over > 0 {
+		power = power[:len(power)-int(over/s.step)]
+	}
+
+	row = Row{
+		Time:    blk.Timestamp,
+		Low:     uint32(math.Round(low)),
+		High:    uint32(math.Round(low + float64(len(power))*s.step)),
+		Step:    s.step,
+		Samples: frames,
+		Power:   append([]float32(nil), power...),
+	}
+	if row.Time.IsZero() {
+		row.Time = blk.Received
+	}
+
+	return row, nil
+}
+
+// Writes rows in rtl_power's CSV format: date, time, low and high edge in
+// Hz, bin width in Hz, number of samples and dB per bin.
+func WriteCSV(w io.Writer, rows []Row) error {
+	for _, r := range rows {
+		t := r.Time.Local()
+		if _, err := fmt.Fprintf(w, "%s, %s, %d, %d, %.2f, %d", t.Format("2006-01-02"),
+			t.Format("15:04:05"), r.Low, r.High, r.Step, r.Samples); err != nil {
+			return err
+		}
+		for _, p := range r.Power {
+			if _, err := fmt.Fprintf(w, ", %.2f", p); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads rows in rtl_power's CSV format, as written by WriteCSV. Times are
+// read in the local time zone, as rtl_power writes them.
+func ReadCSV(r io.Reader) (rows []Row, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<24)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		row, err := parseCSVRow(sc.Text())
+		if err != nil {
+			return rows, fmt.Errorf("line %d: %s", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, sc.Err()
+}
+
+func parseCSVRow(line string) (row Row, err error) {
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) < 7 {
+		return row, fmt.Errorf("expected at least 7 fields, got %d", len(fields))
+	}
+
+	if row.Time, err = time.ParseInLocation("2006-01-02 15:04:05", fields[0]+" "+fields[1], time.Local); err != nil {
+		return
+	}
+	low, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return
+	}
+	high, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return
+	}
+	row.Low, row.High = uint32(low), uint32(high)
+	if row.Step, err = strconv.ParseFloat(fields[4], 64); err != nil {
+		return
+	}
+	if row.Samples, err = strconv.Atoi(fields[5]); err != nil {
+		return
+	}
+
+	row.Power = make([]float32, len(fields)-6)
+	for i, f := range fields[6:] {
+		p, err := strconv.ParseFloat(f, 32)
+		if err != nil {
+			return row, err
+		}
+		row.Power[i] = float32(p)
+	}
+	return row, nil
+}
+
+// Groups rows into sweeps, a sweep ending wherever the next row doesn't
+// continue upward in frequency.
+func Sweeps(rows []Row) (sweeps []Sweep) {
+	for i, r := range rows {
+		if i == 0 || r.Low <= rows[i-1].Low {
+			sweeps = append(sweeps, nil)
+		}
+		sweeps[len(sweeps)-1] = append(sweeps[len(sweeps)-1], r)
+	}
+	return
+}
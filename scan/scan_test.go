@@ -0,0 +1,112 @@
+package scan
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp/synth"
+)
+
+func TestSweep(t *testing.T) {
+	const tone = 100.35e6
+
+	src := synth.New(0, 0, synth.Tone{Freq: tone, Amplitude: 0.5})
+	s, err := New(src, Config{
+		Start:       99e6,
+		Stop:        102e6,
+		BinSize:     10e3,
+		Integration: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Hops() != 2 {
+		t.Errorf("got %d hops, want 2", s.Hops())
+	}
+
+	sweep, err := s.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var peak float32 = -math.MaxFloat32
+	var peakFreq float64
+	for i, r := range sweep {
+		if i > 0 && r.Low != sweep[i-1].High {
+			t.Errorf("row %d starts at %d, previous ended at %d", i, r.Low, sweep[i-1].High)
+		}
+		for j, p := range r.Power {
+			if p > peak {
+				peak, peakFreq = p, float64(r.Low)+(float64(j)+0.5)*r.Step
+			}
+		}
+	}
+	if last := sweep[len(sweep)-1]; sweep[0].Low != 99e6 || last.High < 102e6 || float64(last.High) >= 102e6+last.Step {
+		t.Errorf("sweep covers %d to %d Hz", sweep[0].Low, sweep[len(sweep)-1].High)
+	}
+	if math.Abs(peakFreq-tone) > s.Step() {
+		t.Errorf("peak at %.0f Hz, want %.0f Hz", peakFreq, tone)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, sweep); err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(strings.SplitN(buf.String(), "\n", 2)[0], ", ")
+	if fields[2] != "99000000" || len(fields) != 6+len(sweep[0].Power) {
+		t.Errorf("unexpected CSV line: %q", fields[:6])
+	}
+
+	img := Heatmap([]Sweep{sweep, sweep})
+	if b := img.Bounds(); b.Dy() != 2 || b.Dx() == 0 {
+		t.Errorf("heatmap bounds %v", b)
+	}
+
+	buf.Reset()
+	WriteCSV(&buf, sweep)
+	WriteCSV(&buf, sweep)
+	rows, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sweeps := Sweeps(rows)
+	if len(sweeps) != 2 || len(sweeps[1]) != len(sweep) || sweeps[1][0].Low != sweep[0].Low ||
+		!sweeps[1][0].Time.Equal(sweep[0].Time.Truncate(time.Second)) {
+		t.Fatalf("read back %d sweeps", len(sweeps))
+	}
+	if p, q := sweeps[0][1].Power[3], sweep[1].Power[3]; math.Abs(float64(p-q)) > 0.005 {
+		t.Errorf("read back %g dB, wrote %g dB", p, q)
+	}
+
+	// Axes and colorbar surround the heatmap.
+	plot := Plot(sweeps)
+	if b := plot.Bounds(); b.Dx() <= img.Bounds().Dx() || b.Dy() < plotMinSize {
+		t.Errorf("plot bounds %v", b)
+	}
+}
+
+func TestMeasureSettle(t *testing.T) {
+	const lag = 20480
+
+	src := synth.New(0, 0, synth.Tone{Freq: 100.3e6, Amplitude: 0.5}, &synth.Noise{Power: 1e-3, Seed: 1})
+	src.Lag = lag
+	s, err := MeasureSettle(src, SettleConfig{From: 100e6, To: 101e6, Observe: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Samples < lag || s.Samples > lag+DefaultSettleBins {
+		t.Errorf("settled after %d samples, want %d", s.Samples, lag)
+	}
+	if want := time.Duration(float64(s.Samples) / DefaultSampleRate * float64(time.Second)); s.Duration != want {
+		t.Errorf("duration %s, want %s", s.Duration, want)
+	}
+
+	// Noise alone looks the same everywhere.
+	noise := synth.New(0, 0, &synth.Noise{Power: 1e-3, Seed: 1})
+	if _, err := MeasureSettle(noise, SettleConfig{From: 100e6, To: 101e6}); err == nil {
+		t.Error("measured settling between indistinguishable spectra")
+	}
+}
@@ -0,0 +1,172 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/dsp"
+)
+
+// Defaults for SettleConfig.
+const (
+	DefaultSettleBins    = 256
+	DefaultSettleObserve = 250 * time.Millisecond
+)
+
+// Parameters of a settle time measurement.
+type SettleConfig struct {
+	From, To   uint32 // Frequencies in Hz retuned between, with distinct spectra.
+	SampleRate uint32 // Hz, DefaultSampleRate if zero.
+	// FFT size, which is the time resolution of the measurement,
+	// DefaultSettleBins if zero.
+	Bins int
+	// Time observed after retuning, which must exceed the settle time,
+	// DefaultSettleObserve if zero.
+	Observe time.Duration
+
+	Window dsp.WindowType
+}
+
+// Time a retune took to be reflected by the stream.
+type Settle struct {
+	// Samples received after the command was sent before the spectrum
+	// matched the new frequency. Scanners should discard at least this
+	// many, see Config.Settle.
+	Samples int
+	// Duration of those samples at the sample rate.
+	Duration time.Duration
+	// Time from sending the command to receiving the first sample at the
+	// new frequency, including samples in transit.
+	Latency time.Duration
+}
+
+// Measures the time src takes to settle when retuned from cfg.From to
+// cfg.To. Reference spectra of both frequencies are measured first, then
+// each frame received after retuning is classified as resembling one or the
+// other, the stream considered settled from the point best separating the
+// two. Frequencies with similar spectra, such as two with only noise, can't
+// be told apart and fail the measurement.
+func MeasureSettle(src rtltcp.Source, cfg SettleConfig) (s Settle, err error) {
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = DefaultSampleRate
+	}
+	if cfg.Bins == 0 {
+		cfg.Bins = DefaultSettleBins
+	}
+	if cfg.Observe == 0 {
+		cfg.Observe = DefaultSettleObserve
+	}
+	frames := int(cfg.Observe.Seconds() * float64(cfg.SampleRate) / float64(cfg.Bins))
+	if frames < 2 {
+		return s, errors.New("scan: settle observation shorter than two frames")
+	}
+
+	if err = src.SetSampleRate(cfg.SampleRate); err != nil {
+		return s, fmt.Errorf("Error setting sample rate: %s", err)
+	}
+
+	m := settleMeter{
+		src:  src,
+		spec: dsp.NewSpectrum(cfg.Bins, cfg.Window),
+		buf:  make([]byte, 2*frames*cfg.Bins),
+	}
+	to, err := m.reference(cfg.To)
+	if err != nil {
+		return s, err
+	}
+	from, err := m.reference(cfg.From)
+	if err != nil {
+		return s, err
+	}
+	if distance(from, to) < settleContrast {
+		return s, fmt.Errorf("scan: spectra at %d and %d Hz are indistinguishable", cfg.From, cfg.To)
+	}
+
+	// Frame by frame, each timestamped as it arrives.
+	isNew := make([]bool, frames)
+	arrived := make([]time.Time, frames)
+	frame := make([]byte, 2*cfg.Bins)
+	start := time.Now()
+	if err = src.SetCenterFreq(cfg.To); err != nil {
+		return s, fmt.Errorf("Error tuning to %d Hz: %s", cfg.To, err)
+	}
+	for i := range isNew {
+		blk, err := src.ReadBlock(frame)
+		if err != nil {
+			return s, err
+		}
+		m.iq = dsp.ConvertU8(m.iq[:0], blk.Samples)
+		m.power = m.spec.PowerDB(m.power[:0], m.iq)
+		isNew[i] = distance(m.power, to) < distance(m.power, from)
+		arrived[i] = blk.Received
+	}
+
+	// The split misclassifying fewest frames, old ones belonging before it.
+	split, errs := 0, 0
+	for _, n := range isNew {
+		if !n {
+			errs++
+		}
+	}
+	best := errs
+	for i, n := range isNew {
+		if n {
+			errs++
+		} else {
+			errs--
+		}
+		if errs < best {
+			split, best = i+1, errs
+		}
+	}
+	if split >= frames || best > (frames-split)/10 {
+		return s, fmt.Errorf("scan: not settled within %s", cfg.Observe)
+	}
+
+	s.Samples = split * cfg.Bins
+	s.Duration = time.Duration(float64(s.Samples) / float64(cfg.SampleRate) * float64(time.Second))
+	s.Latency = arrived[split].Sub(start)
+	return s, nil
+}
+
+// Mean difference in dB between the bins of two spectra needed to tell
+// them apart.
+const settleContrast = 1
+
+// Measures reference spectra.
+type settleMeter struct {
+	src   rtltcp.Source
+	spec  *dsp.Spectrum
+	buf   []byte
+	iq    []complex64
+	power []float32
+}
+
+// Tunes to freq, discards a window of samples and returns the spectrum
+// averaged over the next.
+func (m *settleMeter) reference(freq uint32) ([]float32, error) {
+	if err := m.src.SetCenterFreq(freq); err != nil {
+		return nil, fmt.Errorf("Error tuning to %d Hz: %s", freq, err)
+	}
+	if _, err := m.src.ReadBlock(m.buf); err != nil {
+		return nil, err
+	}
+	blk, err := m.src.ReadBlock(m.buf)
+	if err != nil {
+		return nil, err
+	}
+	m.iq = dsp.ConvertU8(m.iq[:0], blk.Samples)
+	return m.spec.PowerDB(nil, m.iq), nil
+}
+
+// Returns the mean absolute difference between two spectra in dB.
+func distance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += math.Abs(float64(a[i] - b[i]))
+	}
+	return sum / float64(len(a))
+}
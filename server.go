@@ -0,0 +1,97 @@
+package rtltcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Magic number of the header rsp_tcp sends in extended mode, its tuner
+// field holding the RSP's hardware version instead of a Tuner.
+var rspMagic = [...]byte{'R', 'S', 'P', '0'}
+
+// Implementation of a server, as told by Connect from its header and
+// identity extension. rsp_tcp outside extended mode sends a header
+// indistinguishable from rtl_tcp's, so it's only recognized when an
+// identity extension names it. Other servers with rtl_tcp's header, such
+// as rtl_tcp_andro, are reported as ServerRTLTCP.
+type ServerType int
+
+const (
+	ServerUnknown ServerType = iota
+	ServerRTLTCP             // osmocom rtl_tcp or a compatible server.
+	ServerRSPTCP             // rsp_tcp serving an SDRplay RSP.
+	ServerRelay              // A relay of the proxy package.
+)
+
+func (t ServerType) String() string {
+	switch t {
+	case ServerUnknown:
+		return "unknown"
+	case ServerRTLTCP:
+		return "rtl_tcp"
+	case ServerRSPTCP:
+		return "rsp_tcp"
+	case ServerRelay:
+		return "relay"
+	}
+	return fmt.Sprintf("ServerType(%d)", int(t))
+}
+
+// Set of command opcodes.
+type CommandSet [4]uint64
+
+func commandSet(opcodes ...uint8) (s CommandSet) {
+	for _, op := range opcodes {
+		s[op/64] |= 1 << (op % 64)
+	}
+	return
+}
+
+// Reports whether the set holds opcode.
+func (s CommandSet) Has(opcode uint8) bool {
+	return s[opcode/64]&(1<<(opcode%64)) != 0
+}
+
+var rtltcpOpcodes = []uint8{CenterFreq, SampleRate, TunerGainMode, TunerGain,
+	FreqCorrection, TunerIfGain, TestMode, AGCMode, DirectSampling,
+	OffsetTuning, RTLXtalFreq, TunerXtalFreq, GainByIndex}
+
+// Commands each type of server acts upon. rsp_tcp ignores those setting
+// RTL2832 and tuner specifics, relays add channel selection.
+var serverCommands = map[ServerType]CommandSet{
+	ServerUnknown: commandSet(rtltcpOpcodes...),
+	ServerRTLTCP:  commandSet(rtltcpOpcodes...),
+	ServerRSPTCP: commandSet(CenterFreq, SampleRate, TunerGainMode, TunerGain,
+		FreqCorrection, AGCMode, GainByIndex),
+	ServerRelay: commandSet(append(rtltcpOpcodes[:len(rtltcpOpcodes):len(rtltcpOpcodes)],
+		CmdChannelOffset, CmdChannelDecimation)...),
+}
+
+// Tells the server's implementation from the header and identity read.
+// Servers sending 4-bit samples or an identity extension are built on this
+// package unless the extension names other software.
+func (sdr *SDR) fingerprint() ServerType {
+	server := strings.ToLower(sdr.identity.Server)
+	switch {
+	case sdr.headerless:
+		return ServerUnknown
+	case strings.Contains(server, "rsp_tcp"), sdr.Info.Magic == rspMagic:
+		return ServerRSPTCP
+	case sdr.packed, !sdr.identity.empty():
+		return ServerRelay
+	case sdr.Info.Valid():
+		return ServerRTLTCP
+	}
+	return ServerUnknown
+}
+
+// Returns the implementation of the server, as fingerprinted by Connect.
+func (sdr *SDR) ServerType() ServerType {
+	return sdr.server
+}
+
+// Returns the commands the server acts upon, so callers can avoid sending
+// ones it would ignore or misinterpret.
+func (sdr *SDR) Commands() CommandSet {
+	return serverCommands[sdr.server]
+}
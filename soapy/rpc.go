@@ -0,0 +1,240 @@
+package soapy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Framing of RPC messages, from SoapyRemoteDefs.hpp.
+const (
+	headerWord  = 0x53525043 // "SRPC"
+	trailerWord = 0x43505253 // "CPRS"
+	rpcVersion  = 0x00000500
+	rpcHeader   = 12
+	maxMessage  = 1 << 20
+)
+
+// Type tags preceding each packed value.
+const (
+	typeChar      = 0
+	typeBool      = 1
+	typeInt32     = 2
+	typeInt64     = 3
+	typeFloat64   = 4
+	typeString    = 6
+	typeKwargs    = 11
+	typeException = 13
+	typeVoid      = 14
+	typeCall      = 15
+	typeSizeList  = 19
+)
+
+// Remote calls used by the client.
+const (
+	callMake             = 1
+	callUnmake           = 2
+	callHangup           = 3
+	callGetHardwareKey   = 101
+	callSetupStream      = 300
+	callCloseStream      = 301
+	callActivateStream   = 302
+	callDeactivateStream = 303
+	callSetGainMode      = 701
+	callSetGain          = 703
+	callSetFrequency     = 800
+	callGetFrequency     = 802
+	callSetSampleRate    = 900
+	callGetSampleRate    = 901
+)
+
+// Direction of a channel or stream.
+const directionRX = 1
+
+// Builds the payload of a request.
+type packer []byte
+
+func (p *packer) tag(t byte) {
+	*p = append(*p, t)
+}
+
+func (p *packer) Call(call int32) {
+	p.tag(typeCall)
+	p.Int32(call)
+}
+
+func (p *packer) Char(v byte) {
+	p.tag(typeChar)
+	*p = append(*p, v)
+}
+
+func (p *packer) Bool(v bool) {
+	p.tag(typeBool)
+	if v {
+		*p = append(*p, 1)
+	} else {
+		*p = append(*p, 0)
+	}
+}
+
+func (p *packer) Int32(v int32) {
+	p.tag(typeInt32)
+	*p = binary.BigEndian.AppendUint32(*p, uint32(v))
+}
+
+func (p *packer) Int64(v int64) {
+	p.tag(typeInt64)
+	*p = binary.BigEndian.AppendUint64(*p, uint64(v))
+}
+
+// Doubles are sent portably as an exponent and a 53-bit mantissa.
+func (p *packer) Float64(v float64) {
+	p.tag(typeFloat64)
+	frac, exp := math.Frexp(v)
+	p.Int32(int32(exp))
+	p.Int64(int64(math.Ldexp(frac, 53)))
+}
+
+func (p *packer) String(v string) {
+	p.tag(typeString)
+	p.Int32(int32(len(v)))
+	*p = append(*p, v...)
+}
+
+func (p *packer) Kwargs(v map[string]string) {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	p.tag(typeKwargs)
+	p.Int32(int32(len(keys)))
+	for _, k := range keys {
+		p.String(k)
+		p.String(v[k])
+	}
+}
+
+func (p *packer) SizeList(v []int) {
+	p.tag(typeSizeList)
+	p.Int32(int32(len(v)))
+	for _, n := range v {
+		p.Int32(int32(n))
+	}
+}
+
+// Frames the payload with header and trailer.
+func (p packer) frame() []byte {
+	n := rpcHeader + len(p) + 4
+	buf := make([]byte, rpcHeader, n)
+	binary.BigEndian.PutUint32(buf[0:], headerWord)
+	binary.BigEndian.PutUint32(buf[4:], rpcVersion)
+	binary.BigEndian.PutUint32(buf[8:], uint32(n))
+	buf = append(buf, p...)
+	return binary.BigEndian.AppendUint32(buf, trailerWord)
+}
+
+// Reads values from the payload of a reply. The first decoding error is
+// kept and returned by Err, later reads return zero values.
+type unpacker struct {
+	buf []byte
+	err error
+}
+
+// Reads one framed message from r.
+func readMessage(r *bufio.Reader) (*unpacker, error) {
+	var hdr [rpcHeader]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(hdr[0:]) != headerWord {
+		return nil, errors.New("soapy: invalid message header")
+	}
+
+	length := binary.BigEndian.Uint32(hdr[8:])
+	if length < rpcHeader+4 || length > maxMessage {
+		return nil, fmt.Errorf("soapy: invalid message length: %d", length)
+	}
+
+	buf := make([]byte, length-rpcHeader)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(buf[len(buf)-4:]) != trailerWord {
+		return nil, errors.New("soapy: invalid message trailer")
+	}
+
+	u := &unpacker{buf: buf[:len(buf)-4]}
+
+	// Failed calls reply with an exception in place of their result.
+	if len(u.buf) > 0 && u.buf[0] == typeException {
+		u.buf = u.buf[1:]
+		return nil, fmt.Errorf("soapy: remote error: %s", u.String())
+	}
+	if len(u.buf) > 0 && u.buf[0] == typeVoid {
+		u.buf = u.buf[1:]
+	}
+
+	return u, nil
+}
+
+func (u *unpacker) take(n int) []byte {
+	if u.err != nil {
+		return make([]byte, n)
+	}
+	if len(u.buf) < n {
+		u.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	b := u.buf[:n]
+	u.buf = u.buf[n:]
+	return b
+}
+
+func (u *unpacker) expect(t byte) {
+	if got := u.take(1)[0]; u.err == nil && got != t {
+		u.err = fmt.Errorf("soapy: expected type %d, got %d", t, got)
+	}
+}
+
+func (u *unpacker) Int32() int32 {
+	u.expect(typeInt32)
+	return int32(binary.BigEndian.Uint32(u.take(4)))
+}
+
+func (u *unpacker) Int64() int64 {
+	u.expect(typeInt64)
+	return int64(binary.BigEndian.Uint64(u.take(8)))
+}
+
+func (u *unpacker) Float64() float64 {
+	u.expect(typeFloat64)
+	exp := u.Int32()
+	mant := u.Int64()
+	return math.Ldexp(float64(mant), int(exp)-53)
+}
+
+func (u *unpacker) String() string {
+	u.expect(typeString)
+	return u.str()
+}
+
+func (u *unpacker) str() string {
+	n := u.Int32()
+	if n < 0 || int(n) > len(u.buf) {
+		if u.err == nil {
+			u.err = io.ErrUnexpectedEOF
+		}
+		return ""
+	}
+	return string(u.take(int(n)))
+}
+
+func (u *unpacker) Err() error {
+	return u.err
+}
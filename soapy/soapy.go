@@ -0,0 +1,412 @@
+// Package soapy provides a client for SoapyRemote servers, presenting
+// remote SoapySDR devices through the same source interface as rtl_tcp.
+//
+// Control uses SoapyRemote's RPC protocol over TCP. Samples are requested
+// in CS8 format and streamed over UDP with the protocol's flow control,
+// then offset to unsigned 8-bit IQ so blocks match those from rtl_tcp.
+package soapy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Default SoapyRemote service port.
+const DefaultPort = "55132"
+
+// Stream endpoint defaults, from SoapyRemoteDefs.hpp.
+const (
+	DefaultMTU    = 1500
+	DefaultWindow = 42 * 1024 * 1024
+)
+
+// Size of the header preceding each stream datagram.
+const datagramHeader = 24
+
+// Client controls and streams from a single device on a SoapyRemote
+// server.
+type Client struct {
+	// Hardware key reported by the device, e.g. "R820T".
+	HardwareKey string
+
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // Serializes calls.
+
+	stream   *net.UDPConn
+	status   *net.UDPConn
+	streamID int32
+	active   bool
+	window   uint32 // Datagrams the server may send ahead of our ack.
+	lastSeq  uint32
+	ackedSeq uint32
+	dropped  uint64
+
+	datagram []byte
+	pending  []byte // Unconsumed samples of the last datagram.
+	index    uint64 // Samples delivered since connecting.
+
+	stateMu sync.Mutex
+	state   rtltcp.Metadata
+}
+
+var _ rtltcp.Source = (*Client)(nil)
+
+// Connects to the server at addr and makes the device selected by args,
+// e.g. {"driver": "rtlsdr"}. If addr has no port DefaultPort is used.
+func Dial(addr string, args map[string]string) (*Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to SoapyRemote server: %s", err)
+	}
+
+	c := &Client{conn: conn, r: bufio.NewReader(conn)}
+
+	var p packer
+	p.Call(callMake)
+	p.Kwargs(args)
+	if _, err := c.call(p); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error making device: %s", err)
+	}
+
+	if err := c.query(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reads the device's identity and current tuning.
+func (c *Client) query() error {
+	var p packer
+	p.Call(callGetHardwareKey)
+	u, err := c.call(p)
+	if err != nil {
+		return err
+	}
+	c.HardwareKey = u.String()
+
+	p = nil
+	p.Call(callGetFrequency)
+	p.Char(directionRX)
+	p.Int32(0)
+	if u, err = c.call(p); err != nil {
+		return err
+	}
+	freq := u.Float64()
+
+	p = nil
+	p.Call(callGetSampleRate)
+	p.Char(directionRX)
+	p.Int32(0)
+	if u, err = c.call(p); err != nil {
+		return err
+	}
+	rate := u.Float64()
+
+	c.stateMu.Lock()
+	c.state.CenterFreq = uint32(freq)
+	c.state.SampleRate = uint32(rate)
+	c.stateMu.Unlock()
+
+	return u.Err()
+}
+
+// Sends a request and reads its reply.
+func (c *Client) call(p packer) (*unpacker, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.conn.Write(p.frame()); err != nil {
+		return nil, err
+	}
+	return readMessage(c.r)
+}
+
+// Calls a setter on the first RX channel.
+func (c *Client) set(call int32, values func(*packer)) error {
+	var p packer
+	p.Call(call)
+	p.Char(directionRX)
+	p.Int32(0)
+	values(&p)
+	_, err := c.call(p)
+	return err
+}
+
+func (c *Client) SetCenterFreq(freq uint32) error {
+	err := c.set(callSetFrequency, func(p *packer) {
+		p.Float64(float64(freq))
+		p.Kwargs(nil)
+	})
+	if err != nil {
+		return fmt.Errorf("Error setting center frequency: %s", err)
+	}
+
+	c.stateMu.Lock()
+	c.state.CenterFreq = freq
+	c.stateMu.Unlock()
+	return nil
+}
+
+func (c *Client) SetSampleRate(rate uint32) error {
+	err := c.set(callSetSampleRate, func(p *packer) {
+		p.Float64(float64(rate))
+	})
+	if err != nil {
+		return fmt.Errorf("Error setting sample rate: %s", err)
+	}
+
+	c.stateMu.Lock()
+	c.state.SampleRate = rate
+	c.stateMu.Unlock()
+	return nil
+}
+
+// Set the overall gain in dB.
+func (c *Client) SetGain(gain float64) error {
+	err := c.set(callSetGain, func(p *packer) { p.Float64(gain) })
+	if err != nil {
+		return fmt.Errorf("Error setting gain: %s", err)
+	}
+
+	c.stateMu.Lock()
+	c.state.Gain = uint32(gain * 10)
+	c.stateMu.Unlock()
+	return nil
+}
+
+// Enable or disable automatic gain.
+func (c *Client) SetGainMode(auto bool) error {
+	err := c.set(callSetGainMode, func(p *packer) { p.Bool(auto) })
+	if err != nil {
+		return fmt.Errorf("Error setting gain mode: %s", err)
+	}
+
+	c.stateMu.Lock()
+	c.state.AutoGain = auto
+	c.stateMu.Unlock()
+	return nil
+}
+
+// Returns the number of stream datagrams lost in transit.
+func (c *Client) Dropped() uint64 {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.dropped
+}
+
+// Sets up and activates a receive stream. The server connects its stream
+// and status sockets to ports bound here and replies with its own stream
+// port, to which flow control acks are sent.
+func (c *Client) startStream() (err error) {
+	host, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+	ip := net.ParseIP(host)
+
+	if c.stream, err = net.ListenUDP("udp", &net.UDPAddr{IP: ip}); err != nil {
+		return
+	}
+	if c.status, err = net.ListenUDP("udp", &net.UDPAddr{IP: ip}); err != nil {
+		return
+	}
+	c.stream.SetReadBuffer(4 << 20)
+
+	port := func(conn *net.UDPConn) string {
+		return strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+	}
+
+	var p packer
+	p.Call(callSetupStream)
+	p.Char(directionRX)
+	p.String("CS8")
+	p.SizeList([]int{0})
+	p.Kwargs(map[string]string{
+		"remote:mtu":    strconv.Itoa(DefaultMTU),
+		"remote:window": strconv.Itoa(DefaultWindow),
+	})
+	p.String(port(c.stream))
+	p.String(port(c.status))
+
+	u, err := c.call(p)
+	if err != nil {
+		return fmt.Errorf("Error setting up stream: %s", err)
+	}
+	c.streamID = u.Int32()
+	serverPort := u.String()
+	if err = u.Err(); err != nil {
+		return
+	}
+
+	serverHost, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	server, err := net.ResolveUDPAddr("udp", net.JoinHostPort(serverHost, serverPort))
+	if err != nil {
+		return
+	}
+
+	// Rebind the stream socket as connected so acks reach the server.
+	laddr := c.stream.LocalAddr().(*net.UDPAddr)
+	c.stream.Close()
+	if c.stream, err = net.DialUDP("udp", laddr, server); err != nil {
+		return
+	}
+	c.stream.SetReadBuffer(4 << 20)
+
+	c.window = DefaultWindow / DefaultMTU
+	c.datagram = make([]byte, 1<<16)
+	if err = c.ack(); err != nil {
+		return
+	}
+
+	p = nil
+	p.Call(callActivateStream)
+	p.Int32(c.streamID)
+	p.Int32(0) // Flags.
+	p.Int64(0) // Time.
+	p.Int32(0) // Elements.
+	if u, err = c.call(p); err != nil {
+		return fmt.Errorf("Error activating stream: %s", err)
+	}
+	if ret := u.Int32(); u.Err() == nil && ret != 0 {
+		return fmt.Errorf("Error activating stream: code %d", ret)
+	}
+
+	c.active = true
+	return u.Err()
+}
+
+// Acknowledges received datagrams, opening the server's send window.
+func (c *Client) ack() error {
+	var hdr [datagramHeader]byte
+	binary.BigEndian.PutUint32(hdr[0:], datagramHeader)
+	binary.BigEndian.PutUint32(hdr[4:], c.lastSeq)
+	binary.BigEndian.PutUint32(hdr[8:], c.window)
+	c.ackedSeq = c.lastSeq
+	_, err := c.stream.Write(hdr[:])
+	return err
+}
+
+func (c *Client) ReadBlock(buf []byte) (blk rtltcp.Block, err error) {
+	if !c.active {
+		if err = c.startStream(); err != nil {
+			return
+		}
+	}
+
+	for n := 0; n < len(buf); {
+		if len(c.pending) == 0 {
+			if err = c.nextDatagram(); err != nil {
+				return
+			}
+		}
+		m := copy(buf[n:], c.pending)
+		c.pending = c.pending[m:]
+		n += m
+	}
+
+	c.stateMu.Lock()
+	blk.Metadata = c.state
+	c.stateMu.Unlock()
+
+	blk.Samples = buf
+	blk.Index = c.index
+	c.index += uint64(blk.Len())
+	blk.Received = time.Now()
+	blk.Timestamp = blk.Received.Add(-blk.Duration())
+
+	return
+}
+
+// Reads the next datagram carrying samples into c.pending.
+func (c *Client) nextDatagram() error {
+	for {
+		n, err := c.stream.Read(c.datagram)
+		if err != nil {
+			return err
+		}
+		if n < datagramHeader {
+			continue
+		}
+
+		d := c.datagram[:n]
+		size := binary.BigEndian.Uint32(d[0:])
+		seq := binary.BigEndian.Uint32(d[4:])
+		elems := int32(binary.BigEndian.Uint32(d[8:]))
+
+		c.stateMu.Lock()
+		if seq != c.lastSeq+1 && c.lastSeq != 0 {
+			c.dropped += uint64(seq - c.lastSeq - 1)
+		}
+		c.stateMu.Unlock()
+		c.lastSeq = seq
+
+		if c.lastSeq-c.ackedSeq >= c.window/4 {
+			if err := c.ack(); err != nil {
+				return err
+			}
+		}
+
+		// Negative element counts report errors such as overflow.
+		if elems <= 0 || int(size) > n {
+			continue
+		}
+
+		samples := d[datagramHeader:size]
+		if len(samples) > 2*int(elems) {
+			samples = samples[:2*elems]
+		}
+		for i := range samples {
+			samples[i] ^= 0x80
+		}
+		c.pending = samples
+		return nil
+	}
+}
+
+// Stops streaming, releases the device and disconnects.
+func (c *Client) Close() error {
+	if c.active {
+		var p packer
+		p.Call(callDeactivateStream)
+		p.Int32(c.streamID)
+		p.Int32(0)
+		p.Int64(0)
+		c.call(p)
+
+		p = nil
+		p.Call(callCloseStream)
+		p.Int32(c.streamID)
+		c.call(p)
+	}
+	if c.stream != nil {
+		c.stream.Close()
+	}
+	if c.status != nil {
+		c.status.Close()
+	}
+
+	var p packer
+	p.Call(callUnmake)
+	c.call(p)
+
+	p = nil
+	p.Call(callHangup)
+	c.call(p)
+
+	return c.conn.Close()
+}
@@ -0,0 +1,71 @@
+package soapy
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Answers control calls as a SoapyRemote server would.
+func fakeServer(t *testing.T, ln net.Listener) {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		u, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		u.expect(typeCall)
+
+		var p packer
+		switch u.Int32() {
+		case callGetHardwareKey:
+			p.String("R820T")
+		case callGetFrequency:
+			p.Float64(433.92e6)
+		case callGetSampleRate:
+			p.Float64(2.048e6)
+		case callSetSampleRate:
+			p.tag(typeException)
+			p.String("unsupported sample rate")
+		default:
+			p.tag(typeVoid)
+		}
+		conn.Write(p.frame())
+	}
+}
+
+func TestClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go fakeServer(t, ln)
+
+	c, err := Dial(ln.Addr().String(), map[string]string{"driver": "rtlsdr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c.HardwareKey != "R820T" {
+		t.Errorf("hardware key: %q", c.HardwareKey)
+	}
+	if c.state.CenterFreq != 433920000 || c.state.SampleRate != 2048000 {
+		t.Errorf("state: %+v", c.state)
+	}
+	if err := c.SetCenterFreq(100e6); err != nil || c.state.CenterFreq != 100e6 {
+		t.Errorf("set center freq: %v %d", err, c.state.CenterFreq)
+	}
+	if err := c.SetSampleRate(1); err == nil || !strings.Contains(err.Error(), "unsupported sample rate") {
+		t.Errorf("expected remote error, got %v", err)
+	}
+}
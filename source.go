@@ -0,0 +1,17 @@
+package rtltcp
+
+// Source is a tunable stream of sample blocks. It's implemented by live
+// connections as well as recorded and synthetic data, so application code
+// can switch between them without changes.
+type Source interface {
+	// Set the center frequency in Hz.
+	SetCenterFreq(freq uint32) error
+	// Set the sample rate in Hz.
+	SetSampleRate(rate uint32) error
+	// Fill buf with samples, with io.ReadFull semantics, and return it as a
+	// block tagged with the acquisition state.
+	ReadBlock(buf []byte) (Block, error)
+	Close() error
+}
+
+var _ Source = (*SDR)(nil)
@@ -0,0 +1,394 @@
+// Package spyserver provides a client for Airspy's SpyServer protocol,
+// presenting remote dongles through the same source interface as rtl_tcp.
+package spyserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Protocol version 2.0.1700, as sent in the hello command.
+const ProtocolVersion = 2<<24 | 0<<16 | 1700
+
+// Client command types.
+const (
+	cmdHello      = 0
+	cmdSetSetting = 2
+	cmdPing       = 3
+)
+
+// Settings written with cmdSetSetting.
+const (
+	settingStreamingMode    = 0
+	settingStreamingEnabled = 1
+	settingGain             = 2
+	settingIQFormat         = 100
+	settingIQFrequency      = 101
+	settingIQDecimation     = 102
+)
+
+// Stream modes and sample formats.
+const (
+	streamModeIQ = 1
+
+	formatUint8 = 1
+	formatInt16 = 2
+)
+
+// Server message types.
+const (
+	msgDeviceInfo = 0
+	msgClientSync = 1
+	msgPong       = 2
+	msgUint8IQ    = 100
+	msgInt16IQ    = 101
+)
+
+// Largest message body accepted from a server.
+const maxBody = 1 << 24
+
+// Kinds of device a SpyServer may be serving.
+type DeviceType uint32
+
+func (d DeviceType) String() string {
+	switch d {
+	case 1:
+		return "Airspy One"
+	case 2:
+		return "Airspy HF+"
+	case 3:
+		return "RTL-SDR"
+	}
+	return "UNKNOWN"
+}
+
+// Describes the served device, sent by the server after hello.
+type DeviceInfo struct {
+	DeviceType           DeviceType
+	DeviceSerial         uint32
+	MaximumSampleRate    uint32
+	MaximumBandwidth     uint32
+	DecimationStageCount uint32
+	GainStageCount       uint32
+	MaximumGainIndex     uint32
+	MinimumFrequency     uint32
+	MaximumFrequency     uint32
+	Resolution           uint32
+	MinimumIQDecimation  uint32
+	ForcedIQFormat       uint32
+}
+
+// Server side state, sent after hello and whenever it changes.
+type ClientSync struct {
+	CanControl            uint32
+	Gain                  uint32
+	DeviceCenterFrequency uint32
+	IQCenterFrequency     uint32
+	FFTCenterFrequency    uint32
+	MinimumIQCenter       uint32
+	MaximumIQCenter       uint32
+	MinimumFFTCenter      uint32
+	MaximumFFTCenter      uint32
+}
+
+type messageHeader struct {
+	ProtocolID     uint32
+	MessageType    uint32
+	StreamType     uint32
+	SequenceNumber uint32
+	BodySize       uint32
+}
+
+// Client streams IQ from a SpyServer. Samples are delivered as unsigned
+// 8-bit IQ, converted from 16-bit if the server forces that format, so
+// blocks are interchangeable with those from rtl_tcp.
+type Client struct {
+	Info DeviceInfo
+
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu        sync.Mutex
+	sync      ClientSync
+	state     rtltcp.Metadata
+	format    uint32
+	streaming bool
+
+	pending []byte // Unconsumed samples of the last IQ message.
+	index   uint64 // Samples delivered since connecting.
+	body    []byte
+	lastSeq uint32
+	dropped uint64
+}
+
+var _ rtltcp.Source = (*Client)(nil)
+
+// Connects to the SpyServer at addr and waits for its device information.
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to SpyServer: %s", err)
+	}
+
+	c := &Client{conn: conn, r: bufio.NewReaderSize(conn, 1<<16)}
+	if err := c.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) handshake() (err error) {
+	name := "rtltcp"
+	body := binary.LittleEndian.AppendUint32(nil, ProtocolVersion)
+	body = append(body, name...)
+	if err = c.command(cmdHello, body); err != nil {
+		return
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	var haveInfo, haveSync bool
+	for !haveInfo || !haveSync {
+		var hdr messageHeader
+		if hdr, err = c.readMessage(); err != nil {
+			return fmt.Errorf("Error reading SpyServer handshake: %s", err)
+		}
+		switch hdr.MessageType & 0xFFFF {
+		case msgDeviceInfo:
+			haveInfo = true
+		case msgClientSync:
+			haveSync = true
+		}
+	}
+
+	c.format = formatUint8
+	if c.Info.ForcedIQFormat != 0 {
+		c.format = c.Info.ForcedIQFormat
+	}
+	if c.format != formatUint8 && c.format != formatInt16 {
+		return fmt.Errorf("unsupported forced IQ format: %d", c.format)
+	}
+
+	c.state.SampleRate = c.Info.MaximumSampleRate >> c.Info.MinimumIQDecimation
+	c.state.CenterFreq = c.sync.IQCenterFrequency
+
+	if err = c.setSetting(settingStreamingMode, streamModeIQ); err == nil {
+		err = c.setSetting(settingIQFormat, c.format)
+	}
+	if err == nil {
+		err = c.setSetting(settingIQDecimation, c.Info.MinimumIQDecimation)
+	}
+	return
+}
+
+func (c *Client) command(typ uint32, body []byte) error {
+	buf := binary.LittleEndian.AppendUint32(nil, typ)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(body)))
+	buf = append(buf, body...)
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func (c *Client) setSetting(setting uint32, values ...uint32) error {
+	body := binary.LittleEndian.AppendUint32(nil, setting)
+	for _, v := range values {
+		body = binary.LittleEndian.AppendUint32(body, v)
+	}
+	return c.command(cmdSetSetting, body)
+}
+
+// Reads one message, updating device state from control messages. The
+// body of sample messages is left in c.body.
+func (c *Client) readMessage() (hdr messageHeader, err error) {
+	if err = binary.Read(c.r, binary.LittleEndian, &hdr); err != nil {
+		return
+	}
+	if hdr.BodySize > maxBody {
+		return hdr, fmt.Errorf("message body too large: %d bytes", hdr.BodySize)
+	}
+
+	if cap(c.body) < int(hdr.BodySize) {
+		c.body = make([]byte, hdr.BodySize)
+	}
+	c.body = c.body[:hdr.BodySize]
+	if _, err = io.ReadFull(c.r, c.body); err != nil {
+		return
+	}
+
+	switch hdr.MessageType & 0xFFFF {
+	case msgDeviceInfo:
+		err = decode(c.body, &c.Info)
+	case msgClientSync:
+		c.mu.Lock()
+		err = decode(c.body, &c.sync)
+		c.mu.Unlock()
+	}
+
+	return
+}
+
+// Decodes a little-endian struct, tolerating servers that send fewer or
+// more fields than this client knows about.
+func decode(body []byte, v interface{}) error {
+	buf := make([]byte, binary.Size(v))
+	copy(buf, body)
+	return binary.Read(bytes.NewReader(buf), binary.LittleEndian, v)
+}
+
+// Returns the most recent server state.
+func (c *Client) Sync() ClientSync {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sync
+}
+
+// Returns the number of messages lost in transit, from sequence gaps.
+func (c *Client) Dropped() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// Returns the sample rates selectable by decimation, highest first.
+func (c *Client) SampleRates() (rates []uint32) {
+	for d := c.Info.MinimumIQDecimation; d < c.Info.DecimationStageCount; d++ {
+		rates = append(rates, c.Info.MaximumSampleRate>>d)
+	}
+	return
+}
+
+func (c *Client) SetCenterFreq(freq uint32) error {
+	if c.Sync().CanControl == 0 {
+		return errors.New("spyserver: control not permitted by server")
+	}
+	if err := c.setSetting(settingIQFrequency, freq); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.state.CenterFreq = freq
+	c.mu.Unlock()
+	return nil
+}
+
+// Set the sample rate, which must be one of SampleRates.
+func (c *Client) SetSampleRate(rate uint32) error {
+	for d := c.Info.MinimumIQDecimation; d < c.Info.DecimationStageCount; d++ {
+		if c.Info.MaximumSampleRate>>d != rate {
+			continue
+		}
+		if err := c.setSetting(settingIQDecimation, d); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.state.SampleRate = rate
+		c.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("spyserver: unsupported sample rate %d, available: %v", rate, c.SampleRates())
+}
+
+// Set the device gain by index, up to Info.MaximumGainIndex.
+func (c *Client) SetGain(idx uint32) error {
+	if idx > c.Info.MaximumGainIndex {
+		return fmt.Errorf("invalid gain index: %d", idx)
+	}
+	if err := c.setSetting(settingGain, idx); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.state.Gain = idx
+	c.mu.Unlock()
+	return nil
+}
+
+// Sends a ping, the server responds with a pong message.
+func (c *Client) Ping() error {
+	return c.command(cmdPing, nil)
+}
+
+func (c *Client) ReadBlock(buf []byte) (blk rtltcp.Block, err error) {
+	if !c.streaming {
+		if err = c.setSetting(settingStreamingEnabled, 1); err != nil {
+			return
+		}
+		c.streaming = true
+	}
+
+	for n := 0; n < len(buf); {
+		if len(c.pending) == 0 {
+			if err = c.nextIQ(); err != nil {
+				return
+			}
+		}
+		m := copy(buf[n:], c.pending)
+		c.pending = c.pending[m:]
+		n += m
+	}
+
+	blk.Metadata = c.metadata()
+	blk.Samples = buf
+	blk.Index = c.index
+	c.index += uint64(blk.Len())
+	blk.Received = time.Now()
+	blk.Timestamp = blk.Received.Add(-blk.Duration())
+
+	return
+}
+
+func (c *Client) metadata() rtltcp.Metadata {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Reads messages until one carrying samples arrives, leaving its samples
+// as unsigned 8-bit IQ in c.pending.
+func (c *Client) nextIQ() error {
+	for {
+		hdr, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+
+		typ := hdr.MessageType & 0xFFFF
+		if typ != msgUint8IQ && typ != msgInt16IQ {
+			continue
+		}
+
+		c.mu.Lock()
+		if c.lastSeq != 0 && hdr.SequenceNumber > c.lastSeq+1 {
+			c.dropped += uint64(hdr.SequenceNumber - c.lastSeq - 1)
+		}
+		c.lastSeq = hdr.SequenceNumber
+		c.mu.Unlock()
+
+		if typ == msgUint8IQ {
+			c.pending = c.body
+			return nil
+		}
+
+		// Keep the high byte of each little-endian 16-bit sample.
+		out := c.body[:len(c.body)/2]
+		for i := range out {
+			out[i] = c.body[2*i+1] + 128
+		}
+		c.pending = out
+		return nil
+	}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,103 @@
+package spyserver
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// Serves a minimal SpyServer session: device info and sync after hello,
+// then one 16-bit IQ message once streaming is enabled.
+func fakeServer(t *testing.T, ln net.Listener) {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	send := func(typ, seq uint32, body []byte) {
+		hdr := messageHeader{ProtocolVersion, typ, 0, seq, uint32(len(body))}
+		binary.Write(conn, binary.LittleEndian, hdr)
+		conn.Write(body)
+	}
+	encode := func(v interface{}) []byte {
+		buf := make([]byte, binary.Size(v))
+		binary.Encode(buf, binary.LittleEndian, v)
+		return buf
+	}
+
+	for {
+		var cmd [2]uint32
+		if err := binary.Read(conn, binary.LittleEndian, &cmd); err != nil {
+			return
+		}
+		body := make([]byte, cmd[1])
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		switch {
+		case cmd[0] == cmdHello:
+			send(msgDeviceInfo, 0, encode(DeviceInfo{
+				DeviceType:           3,
+				MaximumSampleRate:    2400000,
+				DecimationStageCount: 4,
+				MinimumIQDecimation:  1,
+				ForcedIQFormat:       formatInt16,
+			}))
+			send(msgClientSync, 0, encode(ClientSync{CanControl: 1, IQCenterFrequency: 100e6}))
+		case cmd[0] == cmdSetSetting && binary.LittleEndian.Uint32(body) == settingStreamingEnabled:
+			iq := make([]byte, 8)
+			for i := 0; i < 4; i++ {
+				binary.LittleEndian.PutUint16(iq[2*i:], uint16(int16(i-2)<<8))
+			}
+			send(msgInt16IQ, 1, iq)
+			send(msgInt16IQ, 3, iq)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go fakeServer(t, ln)
+
+	c, err := Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c.Info.DeviceType.String() != "RTL-SDR" {
+		t.Errorf("device type: %s", c.Info.DeviceType)
+	}
+	if rates := c.SampleRates(); len(rates) != 3 || rates[0] != 1200000 {
+		t.Errorf("sample rates: %v", rates)
+	}
+	if err := c.SetSampleRate(1e6); err == nil {
+		t.Error("expected error for unsupported sample rate")
+	}
+	if err := c.SetSampleRate(600000); err != nil {
+		t.Fatal(err)
+	}
+
+	blk, err := c.ReadBlock(make([]byte, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{126, 127, 128, 129, 126, 127, 128, 129}
+	if string(blk.Samples) != string(want) {
+		t.Errorf("samples: got %v, want %v", blk.Samples, want)
+	}
+	if blk.CenterFreq != 100e6 || blk.SampleRate != 600000 {
+		t.Errorf("metadata: %+v", blk.Metadata)
+	}
+	if c.Dropped() != 1 {
+		t.Errorf("dropped: got %d, want 1", c.Dropped())
+	}
+}
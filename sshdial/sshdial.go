@@ -0,0 +1,184 @@
+// Package sshdial connects to rtl_tcp servers through an SSH server, the
+// usual way of securing remote dongles, without running a separate tunnel.
+//
+//	client, err := sshdial.Dial(sshdial.Config{Addr: "pi@radio.local"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer client.Close()
+//
+//	sdr := rtltcp.SDR{Dialer: client}
+//	sdr.Flags.ServerAddr = "127.0.0.1:1234" // As seen from the SSH server.
+//	err = sdr.Connect(nil)
+package sshdial
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Time allowed for connecting and authenticating if Config.Timeout is zero.
+const DefaultTimeout = 15 * time.Second
+
+// Key files tried when Config.KeyFiles is empty, relative to ~/.ssh.
+var defaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// Config describes an SSH server and the credentials to log in with.
+type Config struct {
+	// Server as "[user@]host[:port]", port 22 if omitted.
+	Addr string
+	// User to log in as, overriding one given in Addr. The current user if
+	// neither is given.
+	User string
+	// Private key files, the default keys in ~/.ssh if empty. Keys held by
+	// ssh-agent are also tried when SSH_AUTH_SOCK is set.
+	KeyFiles []string
+	// Optional password, tried after keys.
+	Password string
+	// known_hosts file the server's key is verified against,
+	// ~/.ssh/known_hosts if empty.
+	KnownHosts string
+	// Accept any host key. Only for testing, it permits interception.
+	InsecureIgnoreHostKey bool
+	// DefaultTimeout if zero.
+	Timeout time.Duration
+}
+
+// Splits "[user@]host[:port]" into a user, possibly empty, and an address
+// with port.
+func splitAddr(s string) (user, addr string) {
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		user, s = s[:i], s[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		s = net.JoinHostPort(strings.Trim(s, "[]"), "22")
+	}
+	return user, s
+}
+
+// Connects and logs in to the SSH server. The client's Dial makes
+// connections from the server's end, so it can be used as an rtltcp.SDR
+// Dialer. Close the client once its connections are done with.
+func Dial(cfg Config) (*ssh.Client, error) {
+	name, addr := splitAddr(cfg.Addr)
+	if cfg.User != "" {
+		name = cfg.User
+	}
+	if name == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("Error getting current user: %s", err)
+		}
+		name = u.Username
+	}
+
+	hostKey, err := cfg.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	auth, closeAgent, err := cfg.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	if len(auth) == 0 {
+		return nil, errors.New("no SSH credentials: no agent, key files or password")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            name,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to SSH server: %s", err)
+	}
+	return client, nil
+}
+
+func (cfg Config) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if cfg.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	path := cfg.KnownHosts
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("Error finding known_hosts: %s", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading known hosts: %s", err)
+	}
+	return callback, nil
+}
+
+// Returns the available authentication methods and a function releasing
+// the agent connection, which must stay open until logged in. Default key
+// files which are missing or encrypted are skipped, they may be in the
+// agent.
+func (cfg Config) authMethods() (methods []ssh.AuthMethod, done func(), err error) {
+	done = func() {}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			done = func() { conn.Close() }
+		}
+	}
+
+	files := cfg.KeyFiles
+	explicit := len(files) > 0
+	if !explicit {
+		if home, err := os.UserHomeDir(); err == nil {
+			for _, name := range defaultKeys {
+				files = append(files, filepath.Join(home, ".ssh", name))
+			}
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, path := range files {
+		pem, err := os.ReadFile(path)
+		if err == nil {
+			var signer ssh.Signer
+			if signer, err = ssh.ParsePrivateKey(pem); err == nil {
+				signers = append(signers, signer)
+				continue
+			}
+		}
+		if explicit {
+			done()
+			return nil, nil, fmt.Errorf("Error loading key %s: %s", path, err)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if cfg.Password != "" {
+		methods = append(methods, ssh.Password(cfg.Password))
+	}
+	return methods, done, nil
+}
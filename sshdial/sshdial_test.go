@@ -0,0 +1,142 @@
+package sshdial
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bemasher/rtltcp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Serves SSH on a local port, authorizing clientKey and forwarding
+// direct-tcpip channels.
+func sshServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) string {
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					var target struct {
+						Host     string
+						Port     uint32
+						OrigHost string
+						OrigPort uint32
+					}
+					if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &target) != nil {
+						nc.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					up, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+					if err != nil {
+						nc.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, creqs, err := nc.Accept()
+					if err != nil {
+						up.Close()
+						continue
+					}
+					go ssh.DiscardRequests(creqs)
+					go func() {
+						defer ch.Close()
+						defer up.Close()
+						go io.Copy(up, ch)
+						io.Copy(ch, up)
+					}()
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestDial(t *testing.T) {
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewSignerFromKey(hostPriv)
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	sshClientPub, _ := ssh.NewPublicKey(clientPub)
+	addr := sshServer(t, hostKey, sshClientPub)
+
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey.PublicKey())+"\n"), 0600)
+
+	// An rtl_tcp server only reachable from the SSH server's end.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte{'R', 'T', 'L', '0', 0, 0, 0, 5, 0, 0, 0, 29})
+		io.Copy(io.Discard, conn)
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	client, err := Dial(Config{Addr: "tester@" + addr, KeyFiles: []string{keyFile}, KnownHosts: knownHosts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	sdr := rtltcp.SDR{Dialer: client}
+	sdr.Flags.ServerAddr = l.Addr().String()
+	if err := sdr.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer sdr.Close()
+	if sdr.Info.Tuner != rtltcp.TunerR820T {
+		t.Errorf("header = %s", sdr.Info)
+	}
+
+	// A host key not in known_hosts is refused.
+	os.WriteFile(knownHosts, nil, 0600)
+	if c, err := Dial(Config{Addr: addr, KeyFiles: []string{keyFile}, KnownHosts: knownHosts}); err == nil {
+		c.Close()
+		t.Error("unknown host key accepted")
+	}
+}
@@ -0,0 +1,93 @@
+package rtltcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Returns the directory calibrations and profiles are kept in by default,
+// under the user's configuration directory.
+func DefaultConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "rtltcp"), nil
+}
+
+// Entries keyed by name, persisted to a JSON file.
+type jsonStore[T any] struct {
+	path string
+	what string // What entries are, for errors.
+
+	mu      sync.Mutex
+	entries map[string]T
+}
+
+// Reads the store at path, empty if the file doesn't exist yet.
+func openJSONStore[T any](path, what string) (*jsonStore[T], error) {
+	s := &jsonStore[T]{path: path, what: what, entries: make(map[string]T)}
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", what, err)
+	}
+	if err = json.Unmarshal(buf, &s.entries); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", what, err)
+	}
+	return s, nil
+}
+
+func (s *jsonStore[T]) get(key string) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.entries[key]
+	return v, ok
+}
+
+func (s *jsonStore[T]) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Stores v under key, removing the entry if del, and rewrites the file.
+// The file is replaced atomically so a crash never leaves it truncated.
+func (s *jsonStore[T]) put(key string, v T, del bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if del {
+		delete(s.entries, key)
+	} else {
+		s.entries[key] = v
+	}
+
+	buf, err := json.MarshalIndent(s.entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("Error writing %s: %s", s.what, err)
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0644); err != nil {
+		return fmt.Errorf("Error writing %s: %s", s.what, err)
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("Error writing %s: %s", s.what, err)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package rtltcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Settings of a Stream, applied on connecting and restored on reconnecting
+// along with any changes made since.
+type StreamConfig struct {
+	CenterFreq uint32 // Hz, unchanged if zero.
+	SampleRate uint32 // Hz, unchanged if zero.
+	// Gain is left to the server's default, usually the tuner AGC, unless
+	// AutoGain or a Gain is set.
+	AutoGain       bool
+	Gain           uint32 // Tenths of a dB, applied unless AutoGain.
+	FreqCorrection int    // ppm, unchanged if zero.
+	// Offset of a converter ahead of the dongle in Hz, see SDR.ConverterOffset.
+	ConverterOffset int64
+	// Enable offset tuning if the tuner benefits, see SDR.AutoOffsetTuning.
+	AutoOffsetTuning bool
+	// Branch to sample HF directly on, see SDR.AutoDirectSampling.
+	AutoDirectSampling DirectSamplingBranch
+
+	// Bytes per block, sized to the sample rate if zero, see
+	// SDR.ReadBlockSize.
+	BlockSize int
+	// Blocks buffered for the receiver, DefaultQueueDepth if zero.
+	QueueDepth int
+	// Drop blocks the receiver falls behind on instead of stalling the
+	// connection, see SDR.DropOnOverflow.
+	DropOnOverflow bool
+
+	// Interval between reconnection attempts, DefaultReconnectInterval if
+	// zero.
+	ReconnectInterval time.Duration
+	// Optional policy for retrying command writes, see SDR.Retry.
+	Retry *RetryPolicy
+	// Wire format of the server, see SDR.Codec.
+	Codec Codec
+	// Optional callback invoked after reconnecting, with the error which
+	// lost the previous connection.
+	OnReconnect func(err error)
+}
+
+// Stream is a connection to an rtl_tcp server reading blocks in the
+// background, reconnecting and restoring settings when it drops: the usual
+// way of receiving samples, in one type. See Manager for several servers
+// feeding sinks.
+type Stream struct {
+	Config StreamConfig
+
+	addr   string
+	blocks chan Block
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	sdr    *SDR
+	err    error   // Why the stream is disconnected.
+	retune *uint32 // Center frequency set while disconnected.
+}
+
+// Connects to the server at addr, "host:port" or a unix socket as parsed by
+// ParseAddr, applies cfg and starts reading blocks until ctx is done or the
+// stream is closed. Fails if the initial connection fails.
+func NewStream(ctx context.Context, addr string, cfg StreamConfig) (*Stream, error) {
+	if cfg.QueueDepth <= 0 {
+		cfg.QueueDepth = DefaultQueueDepth
+	}
+	if cfg.ReconnectInterval <= 0 {
+		cfg.ReconnectInterval = DefaultReconnectInterval
+	}
+
+	s := &Stream{
+		Config: cfg,
+		addr:   addr,
+		blocks: make(chan Block, cfg.QueueDepth),
+		done:   make(chan struct{}),
+	}
+
+	sdr, err := s.connect(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sdr = sdr
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.run(ctx)
+
+	return s, nil
+}
+
+// Connects and configures the stream's SDR. If a previous connection is
+// given its settings are restored instead.
+func (s *Stream) connect(ctx context.Context, prev *SDR) (sdr *SDR, err error) {
+	sdr = &SDR{Retry: s.Config.Retry, Codec: s.Config.Codec, DropOnOverflow: s.Config.DropOnOverflow}
+	network, address := ParseAddr(s.addr)
+	if err = sdr.DialContext(ctx, network, address); err != nil {
+		return nil, fmt.Errorf("Error connecting to %s: %s", s.addr, err)
+	}
+
+	if prev != nil {
+		err = sdr.Restore(prev)
+	} else {
+		err = sdr.Batch(func() error { return s.apply(sdr) })
+	}
+	if err != nil {
+		sdr.Close()
+		return nil, fmt.Errorf("Error configuring %s: %s", s.addr, err)
+	}
+	return sdr, nil
+}
+
+func (s *Stream) apply(sdr *SDR) (err error) {
+	cfg := s.Config
+	sdr.ConverterOffset = cfg.ConverterOffset
+	sdr.AutoDirectSampling = cfg.AutoDirectSampling
+	if cfg.SampleRate != 0 {
+		if err = sdr.SetSampleRate(cfg.SampleRate); err != nil {
+			return
+		}
+	}
+	if cfg.CenterFreq != 0 {
+		if err = sdr.SetCenterFreq(cfg.CenterFreq); err != nil {
+			return
+		}
+	}
+	if cfg.AutoGain || cfg.Gain != 0 {
+		if err = sdr.SetTunerAGC(cfg.AutoGain); err != nil {
+			return
+		}
+	}
+	if !cfg.AutoGain && cfg.Gain != 0 {
+		if err = sdr.SetGain(cfg.Gain); err != nil {
+			return
+		}
+	}
+	if cfg.AutoOffsetTuning && sdr.Info.Tuner.OffsetTuningHelps() {
+		if err = sdr.SetOffsetTuning(true); err != nil {
+			return
+		}
+	}
+	if cfg.FreqCorrection != 0 {
+		err = sdr.SetFreqCorrection(uint32(cfg.FreqCorrection))
+	}
+	return
+}
+
+// Forwards blocks from each connection's reader, reconnecting on failure.
+func (s *Stream) run(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.blocks)
+
+	s.mu.Lock()
+	sdr := s.sdr
+	s.mu.Unlock()
+
+	for {
+		for blk := range sdr.BlocksContext(ctx, s.Config.BlockSize) {
+			select {
+			case s.blocks <- blk:
+			case <-ctx.Done():
+			}
+		}
+		sdr.Close()
+		if ctx.Err() != nil {
+			return
+		}
+
+		cause := sdr.Err()
+		s.mu.Lock()
+		s.err = cause
+		s.mu.Unlock()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.Config.ReconnectInterval):
+			}
+
+			next, err := s.connect(ctx, sdr)
+			if err == nil {
+				err = s.reconnected(next)
+			}
+			if err == nil {
+				sdr = next
+				break
+			}
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+		}
+
+		if s.Config.OnReconnect != nil {
+			s.Config.OnReconnect(cause)
+		}
+	}
+}
+
+// Applies a retune made while disconnected and makes sdr current.
+func (s *Stream) reconnected(sdr *SDR) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.retune != nil {
+		if err := sdr.SetCenterFreq(*s.retune); err != nil {
+			sdr.Close()
+			return err
+		}
+	}
+	s.sdr, s.err, s.retune = sdr, nil, nil
+	return nil
+}
+
+// Returns the channel blocks are delivered on, each owned by the receiver.
+// Blocks continue across reconnections, their Index counting from zero on
+// each connection. The channel is closed once the stream is closed or its
+// context is done.
+func (s *Stream) Blocks() <-chan Block {
+	return s.blocks
+}
+
+// Sets the center frequency in Hz. While disconnected the frequency is set
+// on reconnecting instead.
+func (s *Stream) Retune(freq uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		s.retune = &freq
+		return nil
+	}
+	return s.sdr.SetCenterFreq(freq)
+}
+
+// Calls fn with the stream's current connection, e.g. to change the gain.
+// Settings made this way survive reconnection. Fails while disconnected.
+func (s *Stream) Control(fn func(*SDR) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return fmt.Errorf("stream disconnected: %s", s.err)
+	}
+	return fn(s.sdr)
+}
+
+// Returns the stream's acquisition state.
+func (s *Stream) Metadata() Metadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sdr.Metadata()
+}
+
+// Returns the dongle information of the current connection.
+func (s *Stream) Info() DongleInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sdr.Info
+}
+
+// Returns why the stream is disconnected: the error which lost the
+// connection or failed the last attempt to reconnect. Nil while connected.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Stops reading and disconnects, waiting for the reader to finish.
+func (s *Stream) Close() error {
+	s.cancel()
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = errors.New("stream closed")
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package rtltcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Change of dongle behind a server, found by Restore when the server
+// reconnected to was restarted with a different one.
+type DongleChange struct {
+	Old, New DongleInfo
+	// Serials, empty unless sent by the servers, see ExtendedHeader.
+	OldSerial, NewSerial string
+	// Settings adjusted or dropped rather than restored as they were.
+	Adjusted []string
+}
+
+func (c DongleChange) String() string {
+	describe := func(info DongleInfo, serial string) string {
+		s := fmt.Sprintf("%s with %d gains", info.Tuner, info.GainCount)
+		if serial != "" {
+			s += ", serial " + serial
+		}
+		return s
+	}
+	s := fmt.Sprintf("dongle changed from %s to %s", describe(c.Old, c.OldSerial), describe(c.New, c.NewSerial))
+	if len(c.Adjusted) > 0 {
+		s += ": " + strings.Join(c.Adjusted, "; ")
+	}
+	return s
+}
+
+// Reports whether sdr's dongle differs from other's: by serial if both
+// servers sent one, otherwise by tuner and gain count.
+func (sdr *SDR) dongleChange(other *SDR) (c DongleChange, changed bool) {
+	c = DongleChange{
+		Old:       other.Info,
+		New:       sdr.Info,
+		OldSerial: other.Serial(),
+		NewSerial: sdr.Serial(),
+	}
+	if c.OldSerial != "" && c.NewSerial != "" {
+		return c, c.OldSerial != c.NewSerial
+	}
+	return c, c.Old.Tuner != c.New.Tuner || c.Old.GainCount != c.New.GainCount
+}
+
+// Rewrites settings issued to a previous dongle into ones a dongle with info
+// and gains, in tenths of a dB, accepts, describing each change. The gains of
+// the tuner are assumed if gains is nil.
+func Revalidate(info DongleInfo, gains []int, cmds []Command) (valid []Command, adjusted []string) {
+	tuner := info.Tuner
+	if gains == nil {
+		gains = tuner.Gains()
+	}
+	valid = make([]Command, 0, len(cmds))
+	for _, cmd := range cmds {
+		switch cmd.Opcode {
+		case FreqCorrection:
+			// The correction belongs to the crystal of the old dongle.
+			// The new one's calibration, if stored, was applied on connect.
+			adjusted = append(adjusted, fmt.Sprintf("dropped correction of %d ppm", int32(cmd.Parameter)))
+			continue
+		case TunerGain:
+			gain := int(int32(cmd.Parameter))
+			if len(gains) > 0 {
+				nearest := gains[0]
+				for _, g := range gains[1:] {
+					if abs(g-gain) < abs(nearest-gain) {
+						nearest = g
+					}
+				}
+				if nearest != gain {
+					adjusted = append(adjusted, fmt.Sprintf("gain %.1f dB unsupported by %s, using %.1f dB",
+						float64(gain)/10, tuner, float64(nearest)/10))
+					cmd.Parameter = uint32(int32(nearest))
+				}
+			}
+		case GainByIndex:
+			if info.GainCount > 0 && cmd.Parameter >= info.GainCount {
+				adjusted = append(adjusted, fmt.Sprintf("gain index %d beyond %d gains, using %d",
+					cmd.Parameter, info.GainCount, info.GainCount-1))
+				cmd.Parameter = info.GainCount - 1
+			}
+		case TunerIfGain:
+			if tuner != TunerE4000 {
+				adjusted = append(adjusted, fmt.Sprintf("dropped IF gain of stage %d, unsupported by %s", cmd.Parameter>>16, tuner))
+				continue
+			}
+		case OffsetTuning:
+			if cmd.Parameter != 0 && (tuner == TunerR820T || tuner == TunerR828D) {
+				adjusted = append(adjusted, fmt.Sprintf("dropped offset tuning, unsupported by %s", tuner))
+				continue
+			}
+		case CenterFreq:
+			if low, high := tuner.FreqRange(); high > 0 && (cmd.Parameter < low || cmd.Parameter > high) {
+				adjusted = append(adjusted, fmt.Sprintf("%d Hz outside the %s range of %d to %d Hz", cmd.Parameter, tuner, low, high))
+			}
+		}
+		valid = append(valid, cmd)
+	}
+	return valid, adjusted
+}
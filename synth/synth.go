@@ -0,0 +1,224 @@
+// Package synth provides a source of synthesized signals, for testing
+// demodulators and scanners deterministically without hardware.
+package synth
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Signal contributes to the synthesized baseband. Signals are positioned by
+// absolute frequency, so retuning the generator moves them relative to
+// baseband as it would a real dongle.
+type Signal interface {
+	// Adds the signal to dst, whose first element is sample n of the
+	// stream, at the given center frequency and sample rate.
+	Add(dst []complex128, n uint64, center, rate float64)
+}
+
+// An unmodulated carrier. Amplitude is relative to full scale.
+type Tone struct {
+	Freq      float64
+	Amplitude float64
+}
+
+func (t Tone) Add(dst []complex128, n uint64, center, rate float64) {
+	w := 2 * math.Pi * (t.Freq - center) / rate
+	for i := range dst {
+		dst[i] += complex(t.Amplitude, 0) * cmplx.Exp(complex(0, w*float64(n+uint64(i))))
+	}
+}
+
+// A carrier frequency modulated by Audio, which returns values between -1
+// and 1 at time t seconds from the start of the stream, with peak deviation
+// Deviation in Hz.
+type FM struct {
+	Carrier   float64
+	Deviation float64
+	Amplitude float64
+	Audio     func(t float64) float64
+
+	phase float64
+}
+
+// Returns an audio function producing a sine tone of the given frequency.
+func AudioTone(freq float64) func(float64) float64 {
+	return func(t float64) float64 {
+		return math.Sin(2 * math.Pi * freq * t)
+	}
+}
+
+func (fm *FM) Add(dst []complex128, n uint64, center, rate float64) {
+	for i := range dst {
+		t := float64(n+uint64(i)) / rate
+		dst[i] += complex(fm.Amplitude, 0) * cmplx.Exp(complex(0, fm.phase))
+
+		f := fm.Carrier - center
+		if fm.Audio != nil {
+			f += fm.Deviation * fm.Audio(t)
+		}
+		fm.phase = math.Mod(fm.phase+2*math.Pi*f/rate, 2*math.Pi)
+	}
+}
+
+// Complex gaussian noise with the given power relative to full scale.
+// The same seed always produces the same noise.
+type Noise struct {
+	Power float64
+	Seed  int64
+
+	rng *rand.Rand
+}
+
+func (ns *Noise) Add(dst []complex128, n uint64, center, rate float64) {
+	if ns.rng == nil {
+		ns.rng = rand.New(rand.NewSource(ns.Seed))
+	}
+	sigma := math.Sqrt(ns.Power / 2)
+	for i := range dst {
+		dst[i] += complex(ns.rng.NormFloat64()*sigma, ns.rng.NormFloat64()*sigma)
+	}
+}
+
+// A carrier swept linearly from Start to Stop every Period, repeating.
+type Sweep struct {
+	Start, Stop float64
+	Period      time.Duration
+	Amplitude   float64
+}
+
+func (s Sweep) Add(dst []complex128, n uint64, center, rate float64) {
+	period := s.Period.Seconds()
+	if period <= 0 {
+		return
+	}
+
+	k := (s.Stop - s.Start) / period
+	f0 := s.Start - center
+	// Phase accumulated over each complete sweep.
+	full := 2*math.Pi*f0*period + math.Pi*k*period*period
+
+	for i := range dst {
+		t := float64(n+uint64(i)) / rate
+		m, tau := math.Floor(t/period), math.Mod(t, period)
+		phase := math.Mod(m*full, 2*math.Pi) + 2*math.Pi*f0*tau + math.Pi*k*tau*tau
+		dst[i] += complex(s.Amplitude, 0) * cmplx.Exp(complex(0, phase))
+	}
+}
+
+// Generator synthesizes the sum of its signals as unsigned 8-bit IQ, as
+// rtl_tcp would deliver it. Output is a pure function of the signals and
+// the sequence of reads and tuning calls.
+type Generator struct {
+	Signals []Signal
+
+	// Pace reads to the sample rate, as a live source would be.
+	Realtime bool
+
+	// Wall time of the first sample, used to timestamp blocks.
+	Start time.Time
+
+	// Samples still synthesized at the previous frequency after each
+	// retune, emulating the delay of a tuner settling and of buffers in
+	// transit. Blocks are tagged with the requested frequency throughout.
+	Lag int
+
+	center, rate uint32
+	tuned        uint32 // Frequency synthesized until lag runs out.
+	lag          int
+	n            uint64
+	work         []complex128
+	started      time.Time
+}
+
+var _ rtltcp.Source = (*Generator)(nil)
+
+// Returns a generator at the given center frequency and sample rate.
+func New(center, rate uint32, signals ...Signal) *Generator {
+	return &Generator{
+		Signals: signals,
+		Start:   time.Now(),
+		center:  center,
+		rate:    rate,
+	}
+}
+
+func (g *Generator) SetCenterFreq(freq uint32) error {
+	if g.lag == 0 {
+		g.tuned = g.center
+	}
+	g.center, g.lag = freq, g.Lag
+	return nil
+}
+
+func (g *Generator) SetSampleRate(rate uint32) error {
+	g.rate = rate
+	return nil
+}
+
+func (g *Generator) ReadBlock(buf []byte) (blk rtltcp.Block, err error) {
+	samples := len(buf) / 2
+	if cap(g.work) < samples {
+		g.work = make([]complex128, samples)
+	}
+	work := g.work[:samples]
+	for i := range work {
+		work[i] = 0
+	}
+
+	lag := min(g.lag, samples)
+	for _, s := range g.Signals {
+		s.Add(work[:lag], g.n, float64(g.tuned), float64(g.rate))
+		s.Add(work[lag:], g.n+uint64(lag), float64(g.center), float64(g.rate))
+	}
+	g.lag -= lag
+
+	for i, s := range work {
+		buf[2*i] = quantize(real(s))
+		buf[2*i+1] = quantize(imag(s))
+	}
+
+	blk.CenterFreq = g.center
+	blk.SampleRate = g.rate
+	blk.Samples = buf
+	blk.Index = g.n
+	blk.Timestamp = g.Start.Add(g.elapsed(g.n))
+	g.n += uint64(samples)
+
+	if g.Realtime {
+		if g.started.IsZero() {
+			g.started = time.Now()
+		}
+		time.Sleep(time.Until(g.started.Add(g.elapsed(g.n))))
+	}
+	blk.Received = time.Now()
+
+	return
+}
+
+func (g *Generator) elapsed(n uint64) time.Duration {
+	if g.rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(n) / float64(g.rate) * float64(time.Second))
+}
+
+func (g *Generator) Close() error {
+	return nil
+}
+
+// Converts a full scale value to an unsigned 8-bit sample, clipping.
+func quantize(v float64) byte {
+	q := math.Round(127.5 + 127.5*v)
+	if q < 0 {
+		return 0
+	}
+	if q > 255 {
+		return 255
+	}
+	return byte(q)
+}
@@ -0,0 +1,76 @@
+package rtltcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Returns a TLS configuration presenting the certificate in certFile and
+// keyFile, if given, and trusting the PEM encoded CAs in caFile instead of
+// the system's, if given. The CAs verify servers when dialing and client
+// certificates when listening.
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA certificates: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no CA certificates found in " + caFile)
+		}
+		cfg.RootCAs = pool
+		cfg.ClientCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// Returns the TLS configuration to connect to host with, or nil for a plain
+// connection.
+func (sdr *SDR) tlsConfig(host string) (cfg *tls.Config, err error) {
+	switch {
+	case sdr.TLS != nil:
+		cfg = sdr.TLS.Clone()
+	case sdr.Flags.TLS:
+		if cfg, err = LoadTLSConfig(sdr.Flags.TLSCert, sdr.Flags.TLSKey, sdr.Flags.TLSCA); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	// Verify the name the server was addressed by.
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	return cfg, nil
+}
+
+// Sets the size of the operating system's receive buffer for the
+// connection, if its transport has one.
+func (sdr *SDR) SetReadBuffer(bytes int) error {
+	var c net.Conn = sdr.Conn
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	conn, ok := c.(interface{ SetReadBuffer(int) error })
+	if !ok {
+		return fmt.Errorf("%T has no receive buffer", c)
+	}
+	return conn.SetReadBuffer(bytes)
+}
@@ -0,0 +1,146 @@
+package rtltcp
+
+import "fmt"
+
+// Tuner values reported in DongleInfo.
+const (
+	TunerE4000 Tuner = iota + 1
+	TunerFC0012
+	TunerFC0013
+	TunerFC2580
+	TunerR820T
+	TunerR828D
+)
+
+// Gain in dB of each of the six E4000 IF stages, stage 1 first. Valid gains
+// per stage are:
+//
+//	1: -3, 6
+//	2: 0, 3, 6, 9
+//	3: 0, 3, 6, 9
+//	4: 0, 1, 2
+//	5: 3, 6, 9, 12, 15
+//	6: 3, 6, 9, 12, 15
+type E4000IFGain [6]int8
+
+// E4000 IF gain presets, totalling 32, 24 and 28 dB respectively. They
+// differ mostly in where along the chain the gain is applied.
+var (
+	// Gain applied early, minimizing the noise figure of the IF chain at
+	// the cost of compressing sooner in the presence of strong signals.
+	E4000Sensitivity = E4000IFGain{6, 9, 9, 2, 3, 3}
+	// The stage gains librtlsdr programs at initialization.
+	E4000Neutral = E4000IFGain{6, 0, 0, 0, 9, 9}
+	// Gain deferred to the last stages, tolerating strong signals at the
+	// cost of a higher noise figure.
+	E4000Linearity = E4000IFGain{-3, 0, 0, 1, 15, 15}
+)
+
+var e4000IFStageGains = [6][]int8{
+	{-3, 6},
+	{0, 3, 6, 9},
+	{0, 3, 6, 9},
+	{0, 1, 2},
+	{3, 6, 9, 12, 15},
+	{3, 6, 9, 12, 15},
+}
+
+// Returns an error if any stage gain isn't supported by the tuner.
+func (g E4000IFGain) Validate() error {
+	for i, gain := range g {
+		valid := false
+		for _, v := range e4000IFStageGains[i] {
+			valid = valid || v == gain
+		}
+		if !valid {
+			return fmt.Errorf("invalid gain %d dB for E4000 IF stage %d", gain, i+1)
+		}
+	}
+	return nil
+}
+
+// Returns the total IF gain in dB.
+func (g E4000IFGain) Total() (total int) {
+	for _, gain := range g {
+		total += int(gain)
+	}
+	return
+}
+
+// Programs all six IF stages of an E4000 tuner. Fails without sending
+// anything if the dongle has a different tuner or a gain is invalid.
+func (sdr *SDR) SetE4000IFGain(g E4000IFGain) error {
+	if sdr.Info.Tuner != TunerE4000 {
+		return fmt.Errorf("IF gain presets require an E4000 tuner, have %s", sdr.Info.Tuner)
+	}
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	for i, gain := range g {
+		// rtl_tcp takes the gain as signed tenths of a dB.
+		if err := sdr.SetTunerIfGain(uint16(i+1), uint16(int16(gain)*10)); err != nil {
+			return fmt.Errorf("Error setting IF stage %d gain: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Gains in tenths of a dB accepted by R820T and R828D tuners.
+var R820TGains = []uint32{
+	0, 9, 14, 27, 37, 77, 87, 125, 144, 157, 166, 197, 207, 229, 254,
+	280, 297, 328, 338, 364, 372, 386, 402, 421, 434, 439, 445, 480, 496,
+}
+
+// Gain profile of an R820T-family tuner. rtl_tcp doesn't expose the LNA,
+// mixer and VGA individually: in manual mode librtlsdr splits the requested
+// gain between LNA and mixer, raising each alternately, and holds the VGA at
+// 16.3 dB. In auto mode the LNA and mixer are under tuner AGC and the VGA is
+// fixed at 26.5 dB. A profile therefore selects the gain mode, the total
+// gain and the RTL2832's digital AGC.
+type R820TGain struct {
+	AutoGain bool   // Tuner AGC. Sends command 0x03 with parameter 0 if set, 1 otherwise.
+	Gain     uint32 // Tenths of a dB, one of R820TGains. Sent as command 0x04 unless AutoGain.
+	RTLAGC   bool   // RTL2832 digital AGC. Sends command 0x08.
+}
+
+// R820T gain profiles.
+var (
+	// Low LNA and mixer gain, for sites near broadcast or paging
+	// transmitters where higher gain overloads the tuner.
+	R820TStrongSignal = R820TGain{Gain: 144}
+	// Moderate gain suitable for most outdoor antennas.
+	R820TBalanced = R820TGain{Gain: 297}
+	// Maximum LNA and mixer gain, for distant or weak signals in a quiet
+	// RF environment.
+	R820TWeakSignal = R820TGain{Gain: 496}
+	// Tuner AGC, letting the R820T adjust LNA and mixer gain itself.
+	R820TAuto = R820TGain{AutoGain: true}
+)
+
+// Applies a gain profile to an R820T or R828D tuner. Fails without sending
+// anything if the dongle has a different tuner or the gain is unsupported.
+func (sdr *SDR) SetR820TGain(g R820TGain) (err error) {
+	if sdr.Info.Tuner != TunerR820T && sdr.Info.Tuner != TunerR828D {
+		return fmt.Errorf("R820T gain profiles require an R820T or R828D tuner, have %s", sdr.Info.Tuner)
+	}
+	if !g.AutoGain {
+		valid := false
+		for _, v := range R820TGains {
+			valid = valid || v == g.Gain
+		}
+		if !valid {
+			return fmt.Errorf("unsupported R820T gain: %d", g.Gain)
+		}
+	}
+
+	if err = sdr.SetTunerAGC(g.AutoGain); err != nil {
+		return
+	}
+	if !g.AutoGain {
+		if err = sdr.SetGain(g.Gain); err != nil {
+			return
+		}
+	}
+	return sdr.SetAGCMode(g.RTLAGC)
+}
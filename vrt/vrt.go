@@ -0,0 +1,190 @@
+// Package vrt encodes sample blocks as VITA-49 (VRT) packets: IF data
+// packets carrying samples, and context packets describing frequency,
+// sample rate and gain.
+package vrt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Sample bytes per data packet by default, fitting the packet in an
+// unfragmented UDP datagram on ethernet.
+const DefaultPayloadSize = 1440
+
+// Data packets sent between periodic context packets by default.
+const DefaultContextInterval = 1000
+
+// Packet types.
+const (
+	typeDataStreamID = 0x1
+	typeContext      = 0x4
+)
+
+// Header timestamp fields: UTC integer seconds, real-time picoseconds.
+const (
+	tsiUTC      = 0x1
+	tsfRealTime = 0x2
+)
+
+// Context indicator field bits.
+const (
+	cifChange     = 1 << 31
+	cifBandwidth  = 1 << 29
+	cifRFFreq     = 1 << 27
+	cifGain       = 1 << 23
+	cifSampleRate = 1 << 21
+	cifFormat     = 1 << 15
+)
+
+// Words of header, stream ID and timestamp preceding each payload.
+const prologueWords = 5
+
+// Writer encodes blocks as VRT packets on w, one Write per packet so a UDP
+// connection carries a packet per datagram. Samples are sent as signed
+// 8-bit complex cartesian pairs. A context packet precedes the first data
+// packet, follows every change of tuning or gain, and is repeated every
+// ContextInterval data packets.
+type Writer struct {
+	// Stream identifier of data packets. Context packets use StreamID+1.
+	StreamID uint32
+	// Sample bytes per data packet, a multiple of 4.
+	PayloadSize int
+	// Data packets between periodic context packets, 0 to only send
+	// context on change.
+	ContextInterval int
+
+	w         io.Writer
+	packet    []byte
+	dataCount uint8
+	ctxCount  uint8
+	sinceCtx  int
+	last      rtltcp.Metadata
+	sentCtx   bool
+}
+
+// Returns a writer encoding packets for stream id to w.
+func NewWriter(w io.Writer, id uint32) *Writer {
+	return &Writer{
+		StreamID:        id,
+		PayloadSize:     DefaultPayloadSize,
+		ContextInterval: DefaultContextInterval,
+		w:               w,
+	}
+}
+
+// Writes the packet header and stream ID and timestamp fields.
+func (v *Writer) prologue(typ uint32, count *uint8, id uint32, words int, t time.Time) {
+	hdr := typ<<28 | tsiUTC<<22 | tsfRealTime<<20 | uint32(*count&0xF)<<16 | uint32(words)
+	*count++
+
+	v.packet = v.packet[:0]
+	v.packet = binary.BigEndian.AppendUint32(v.packet, hdr)
+	v.packet = binary.BigEndian.AppendUint32(v.packet, id)
+	v.packet = binary.BigEndian.AppendUint32(v.packet, uint32(t.Unix()))
+	v.packet = binary.BigEndian.AppendUint64(v.packet, uint64(t.Nanosecond())*1000)
+}
+
+// Converts a value to 64-bit fixed point with a 20-bit fraction.
+func fixed20(f float64) uint64 {
+	return uint64(int64(f * (1 << 20)))
+}
+
+func (v *Writer) writeContext(m rtltcp.Metadata, t time.Time, changed bool) error {
+	cif := uint32(cifBandwidth | cifRFFreq | cifGain | cifSampleRate | cifFormat)
+	if changed {
+		cif |= cifChange
+	}
+
+	// Indicators, bandwidth, frequency, gain, sample rate and format.
+	words := prologueWords + 1 + 2 + 2 + 1 + 2 + 2
+	v.prologue(typeContext, &v.ctxCount, v.StreamID+1, words, t)
+
+	v.packet = binary.BigEndian.AppendUint32(v.packet, cif)
+
+	// Complex sampling passes a bandwidth equal to the sample rate.
+	v.packet = binary.BigEndian.AppendUint64(v.packet, fixed20(float64(m.SampleRate)))
+	v.packet = binary.BigEndian.AppendUint64(v.packet, fixed20(float64(m.CenterFreq)))
+
+	// Stage 1 gain in 1/128 dB, stage 2 unused. Gain is tenths of a dB.
+	gain := uint32(uint16(int16(int32(m.Gain) * 128 / 10)))
+	v.packet = binary.BigEndian.AppendUint32(v.packet, gain)
+
+	v.packet = binary.BigEndian.AppendUint64(v.packet, fixed20(float64(m.SampleRate)))
+
+	// Processing efficient, complex cartesian, signed fixed point, 8-bit
+	// items packed in 8-bit fields.
+	format := uint32(0x1<<29 | 7<<6 | 7)
+	v.packet = binary.BigEndian.AppendUint32(v.packet, format)
+	v.packet = binary.BigEndian.AppendUint32(v.packet, 0)
+
+	v.sentCtx = true
+	v.sinceCtx = 0
+	v.last = m
+	_, err := v.w.Write(v.packet)
+	return err
+}
+
+func (v *Writer) WriteBlock(blk rtltcp.Block) error {
+	if v.PayloadSize <= 0 || v.PayloadSize%4 != 0 {
+		return fmt.Errorf("vrt: payload size %d is not a positive multiple of 4", v.PayloadSize)
+	}
+
+	m := blk.Metadata
+	changed := m.CenterFreq != v.last.CenterFreq || m.SampleRate != v.last.SampleRate ||
+		m.Gain != v.last.Gain || m.AutoGain != v.last.AutoGain
+
+	t := blk.Timestamp
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	samples := blk.Samples
+	for len(samples) > 0 {
+		if !v.sentCtx || changed || (v.ContextInterval > 0 && v.sinceCtx >= v.ContextInterval) {
+			if err := v.writeContext(m, t, v.sentCtx && changed); err != nil {
+				return err
+			}
+			changed = false
+		}
+
+		n := len(samples)
+		if n > v.PayloadSize {
+			n = v.PayloadSize
+		}
+		words := (n + 3) / 4
+
+		v.prologue(typeDataStreamID, &v.dataCount, v.StreamID, prologueWords+words, t)
+		for _, s := range samples[:n] {
+			v.packet = append(v.packet, s^0x80)
+		}
+		// Pad a partial final word.
+		for len(v.packet)%4 != 0 {
+			v.packet = append(v.packet, 0)
+		}
+
+		if _, err := v.w.Write(v.packet); err != nil {
+			return err
+		}
+		v.sinceCtx++
+
+		if m.SampleRate != 0 {
+			t = t.Add(time.Duration(n/2) * time.Second / time.Duration(m.SampleRate))
+		}
+		samples = samples[n:]
+	}
+
+	return nil
+}
+
+// Closes the underlying writer if it is an io.Closer.
+func (v *Writer) Close() error {
+	if c, ok := v.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package vrt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/bemasher/rtltcp"
+)
+
+// Records each Write as a separate packet.
+type packets [][]byte
+
+func (p *packets) Write(b []byte) (int, error) {
+	*p = append(*p, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestWriter(t *testing.T) {
+	var out packets
+	w := NewWriter(&out, 10)
+	w.PayloadSize = 8
+
+	blk := rtltcp.Block{Samples: []byte{0, 127, 128, 255, 1, 2, 3, 4, 5, 6}}
+	blk.CenterFreq = 100e6
+	blk.SampleRate = 2e6
+	blk.Gain = 496
+	blk.Timestamp = time.Unix(1700000000, 500)
+
+	if err := w.WriteBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+	blk.CenterFreq = 101e6
+	if err := w.WriteBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+
+	// Context, two data, context on retune, two data.
+	if len(out) != 6 {
+		t.Fatalf("got %d packets, want 6", len(out))
+	}
+
+	for i, p := range out {
+		hdr := binary.BigEndian.Uint32(p)
+		if words := int(hdr & 0xFFFF); words*4 != len(p) {
+			t.Errorf("packet %d: size field %d words, length %d bytes", i, words, len(p))
+		}
+		typ, id := hdr>>28, binary.BigEndian.Uint32(p[4:])
+		isCtx := i%3 == 0
+		if isCtx && (typ != typeContext || id != 11) || !isCtx && (typ != typeDataStreamID || id != 10) {
+			t.Errorf("packet %d: type %d stream %d", i, typ, id)
+		}
+	}
+
+	ctx := out[3]
+	if cif := binary.BigEndian.Uint32(ctx[20:]); cif&cifChange == 0 {
+		t.Error("retune context missing change indicator")
+	}
+	if freq := binary.BigEndian.Uint64(ctx[32:]) >> 20; freq != 101e6 {
+		t.Errorf("frequency: %d", freq)
+	}
+	if gain := int16(binary.BigEndian.Uint32(ctx[40:])); gain != 49*128+76 {
+		t.Errorf("gain: %d", gain)
+	}
+
+	if got, want := out[1][20:], []byte{0x80, 0xFF, 0, 0x7F, 0x81, 0x82, 0x83, 0x84}; !bytes.Equal(got, want) {
+		t.Errorf("samples: got %x, want %x", got, want)
+	}
+	if got := out[2][20:]; !bytes.Equal(got, []byte{0x85, 0x86, 0, 0}) {
+		t.Errorf("padded samples: %x", got)
+	}
+
+	// Second data packet starts 4 samples later, 2us at 2 MS/s.
+	if ps := binary.BigEndian.Uint64(out[2][12:]); ps != 500*1000+2e6 {
+		t.Errorf("fractional timestamp: %d ps", ps)
+	}
+}
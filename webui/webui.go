@@ -0,0 +1,54 @@
+// Package webui serves a browser dashboard for a connected SDR, showing a
+// live waterfall, current settings and tuning controls.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/bemasher/rtltcp"
+	"github.com/bemasher/rtltcp/httpapi"
+	"github.com/bemasher/rtltcp/netsink"
+)
+
+//go:embed static
+var static embed.FS
+
+// Returns a handler serving only the UI's static files.
+func Static() http.Handler {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(sub))
+}
+
+// Server combines the REST API, a spectrum WebSocket at /ws and the UI at
+// /. Auth and CORS settings of the embedded httpapi.Server apply to all of
+// them, the UI passes a ?token query parameter on to its requests. Attach
+// the server to the SDR's stream as a sink to feed the waterfall.
+type Server struct {
+	*httpapi.Server
+	ws *netsink.WebSocket
+}
+
+// Returns a dashboard for sdr.
+func NewServer(sdr *rtltcp.SDR) *Server {
+	s := &Server{
+		Server: httpapi.NewServer(sdr),
+		ws:     netsink.NewWebSocket(),
+	}
+	s.Handle("/ws", s.ws)
+	s.Handle("/", Static())
+	return s
+}
+
+func (s *Server) WriteBlock(blk rtltcp.Block) error {
+	return s.ws.WriteBlock(blk)
+}
+
+// Disconnects WebSocket clients.
+func (s *Server) Close() error {
+	return s.ws.Close()
+}